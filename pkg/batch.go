@@ -0,0 +1,267 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	gitopsv1alpha1 "github.com/redhat-developer/gitops-generator/api/v1alpha1"
+)
+
+// Batch applies several operations to a branch of a GitOps repository, and commits and pushes them at once, so that
+// e.g. all the components of an application are promoted to an environment by a single commit. If an operation fails,
+// the changes of the whole batch are rolled back and the batch is closed. Operations with invalid names return a
+// ValidationError without rolling the batch back. A Batch is not safe for concurrent use.
+type Batch struct {
+	gen         Gen
+	remote      string
+	branch      string
+	repoContext string
+	repoPath    string
+	release     func()
+
+	// head is the commit the branch was at when the batch was opened, which the repository is reset to on rollback
+	head       string
+	trailers   []CommitTrailers
+	operations []CommitMessageData
+	closed     bool
+}
+
+// OpenBatch clones the remote and checks out the branch, like CloneGenerateAndPush, and returns the Batch the
+// operations are applied to. The cached workspace of the remote branch is used instead of a clone in outputPath when
+// the Gen has Workspaces. The other calls working on outputPath wait until the Batch is committed or rolled back, so
+// Commit or Rollback must be called once done with the Batch. The branch must have at least one commit.
+// 1. outputPath: The folder to clone the repository to
+// 2. remote: A string of the form https://$token@<domain>/<org>/<repo>, where <domain> is either github.com or gitlab.com, or one of the Hosts of the Gen, and $token is optional and omitted when using Credentials, or an SSH remote such as git@<domain>:<org>/<repo>.git. Corresponds to the application's gitops repository
+// 3. The branch to push to
+// 4. The path within the repository to generate the resources in
+func (s Gen) OpenBatch(outputPath string, remote string, branch string, repoContext string) (*Batch, error) {
+	return s.OpenBatchWithContext(context.Background(), outputPath, remote, branch, repoContext)
+}
+
+// OpenBatchWithContext is the context aware variant of OpenBatch. The context only applies to the opening of the Batch,
+// CommitWithContext and RollbackWithContext taking their own.
+func (s Gen) OpenBatchWithContext(ctx context.Context, outputPath string, remote string, branch string, repoContext string) (b *Batch, err error) {
+	defer func() { err = checkCancelled(ctx, "OpenBatch", err) }()
+	if err := validateArgs(pathArg("context", repoContext)); err != nil {
+		return nil, err
+	}
+	if invalidRemoteErr := s.validateRemote(remote); invalidRemoteErr != nil {
+		return nil, invalidRemoteErr
+	}
+	ctx, unlock, err := repoLocks.lock(ctx, remote, branch, outputPath)
+	if err != nil {
+		return nil, err
+	}
+	// The components are not known yet, so the whole tree is checked out
+	repoPath, releaseRepo, err := s.checkoutRepo(ctx, filepath.Dir(outputPath), remote, filepath.Base(outputPath), branch, nil)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	release := func() {
+		releaseRepo()
+		unlock()
+	}
+	out, err := s.execute(ctx, repoPath, GitCommand, "rev-parse", "HEAD")
+	if err != nil {
+		release()
+		return nil, &GitCmdError{path: repoPath, cmdResult: string(out), err: err, cmdType: getCommitID}
+	}
+	return &Batch{
+		gen:         s,
+		remote:      remote,
+		branch:      branch,
+		repoContext: repoContext,
+		repoPath:    repoPath,
+		release:     release,
+		head:        strings.TrimSpace(string(out)),
+	}, nil
+}
+
+// RepoPath returns the path of the repository the operations of the Batch are applied to
+func (b *Batch) RepoPath() string {
+	return b.repoPath
+}
+
+// Generate generates the base resources of the component, replacing the existing ones, like CloneGenerateAndPush
+func (b *Batch) Generate(options gitopsv1alpha1.GeneratorOptions) error {
+	componentName := options.Name
+	if err := validateArgs(nameArg("component name", componentName), optionalNameArg("application name", options.Application)); err != nil {
+		return err
+	}
+	trailers := CommitTrailers{Component: componentName, Application: options.Application, Image: options.ContainerImage}
+	data := CommitMessageData{Operation: GenerateBaseOperation, Component: componentName, Application: options.Application, Image: options.ContainerImage}
+	return b.apply(trailers, data, func() error {
+		gitopsFolder := filepath.Join(b.repoPath, b.repoContext)
+		componentPath := filepath.Join(gitopsFolder, "components", componentName, "base")
+		if err := removeAll(b.gen.filesystem(), b.repoPath, componentPath); err != nil {
+			return &DeleteFolderError{componentPath: componentPath, repoPath: b.repoPath, err: err}
+		}
+		if err := Generate(b.gen.filesystem(), gitopsFolder, componentPath, options); err != nil {
+			return &GitGenResourcesAndOverlaysError{path: componentPath, componentName: componentName, err: err}
+		}
+		return nil
+	})
+}
+
+// GenerateOverlays generates the overlays of the component for the environment, like GenerateOverlaysAndPush
+func (b *Batch) GenerateOverlays(options gitopsv1alpha1.GeneratorOptions, environmentName, imageName, namespace string, componentGeneratedResources map[string][]string) error {
+	componentName := options.Name
+	if err := validateArgs(nameArg("component name", componentName), optionalNameArg("application name", options.Application), optionalNameArg("environment name", environmentName)); err != nil {
+		return err
+	}
+	trailers := CommitTrailers{Component: componentName, Application: options.Application, Environment: environmentName, Image: imageName}
+	data := CommitMessageData{Operation: GenerateOverlaysOperation, Component: componentName, Application: options.Application, Environment: environmentName, Image: imageName}
+	return b.apply(trailers, data, func() error {
+		gitopsFolder := filepath.Join(b.repoPath, b.repoContext)
+		componentEnvOverlaysPath := filepath.Join(gitopsFolder, "components", componentName, "overlays", environmentName)
+		if err := GenerateOverlays(b.gen.filesystem(), gitopsFolder, componentEnvOverlaysPath, options, imageName, namespace, componentGeneratedResources); err != nil {
+			return &GitGenResourcesAndOverlaysError{path: componentEnvOverlaysPath, componentName: componentName, err: err, cmdType: genOverlays}
+		}
+		return nil
+	})
+}
+
+// RemoveComponent removes the component, like GitRemoveComponent
+func (b *Batch) RemoveComponent(componentName string) error {
+	if err := validateArgs(nameArg("component name", componentName)); err != nil {
+		return err
+	}
+	return b.apply(CommitTrailers{Component: componentName}, CommitMessageData{Operation: RemoveComponentOperation, Component: componentName}, func() error {
+		return b.gen.removeRepoComponent(b.repoPath, componentName, b.repoContext)
+	})
+}
+
+// apply runs the operation on the repository, and rolls the batch back if it fails. The trailers and the data its
+// commit message is rendered from describe the change made by the operation.
+func (b *Batch) apply(trailers CommitTrailers, data CommitMessageData, operation func() error) error {
+	if b.closed {
+		return &BatchClosedError{remote: b.remote, branch: b.branch}
+	}
+	if err := operation(); err != nil {
+		return b.fail(err)
+	}
+	b.trailers = append(b.trailers, trailers)
+	b.operations = append(b.operations, data)
+	return nil
+}
+
+// Commit commits the changes of all the operations at once, and pushes the commit to the branch. Pushes rejected
+// because the remote branch has moved are retried according to the RetryPolicy of the Gen. When empty, the commit
+// message is rendered from the CommitMessageTemplate of the Gen for a single operation, and lists the subjects rendered
+// for each operation otherwise. The trailers of each operation are appended to it. The
+// changes are rolled back if the commit or push fails. The Batch is closed once committed, and nothing is committed or
+// pushed when no operation changed the repository.
+// For a Gen returned by DryRun, the changes are recorded in its DryRunResult and rolled back instead.
+func (b *Batch) Commit(commitMessage string) error {
+	return b.CommitWithContext(context.Background(), commitMessage)
+}
+
+// CommitWithContext is the context aware variant of Commit. The changes are rolled back even though the context is
+// done.
+func (b *Batch) CommitWithContext(ctx context.Context, commitMessage string) (err error) {
+	defer func() { err = checkCancelled(ctx, "CommitBatch", err) }()
+	if b.closed {
+		return &BatchClosedError{remote: b.remote, branch: b.branch}
+	}
+	s := b.gen
+	var data *CommitMessageData
+	if commitMessage == "" && len(b.operations) == 1 {
+		data = &b.operations[0]
+	} else if commitMessage == "" {
+		if commitMessage, err = b.message(); err != nil {
+			return b.fail(err)
+		}
+	}
+	if s.dryRun != nil {
+		if err := s.recordDryRunCommit(ctx, s.filesystem(), b.repoPath); err != nil {
+			return b.fail(err)
+		}
+		return b.Rollback()
+	}
+
+	components := make([]string, 0, len(b.trailers))
+	for _, trailers := range b.trailers {
+		components = append(components, trailers.Component)
+	}
+	_, committed, err := s.commit(ctx, b.repoPath, b.remote, strings.Join(components, ","), b.branch, commitMessage, data, b.trailers)
+	if err == nil && committed {
+		err = s.pushWithRetry(ctx, b.repoPath, b.remote, b.branch)
+	}
+	if err != nil {
+		return b.fail(err)
+	}
+	b.close()
+	return nil
+}
+
+// message returns the commit message listing the subjects of the operations, rendered from the CommitMessageTemplate
+// of the Gen
+func (b *Batch) message() (string, error) {
+	var message strings.Builder
+	fmt.Fprintf(&message, "Apply %d changes to the GitOps resources\n\n", len(b.operations))
+	for _, data := range b.operations {
+		rendered, err := b.gen.CommitOptions.MessageTemplate.render(data)
+		if err != nil {
+			return "", err
+		}
+		message.WriteString("- " + strings.SplitN(rendered, "\n", 2)[0] + "\n")
+	}
+	return message.String(), nil
+}
+
+// Rollback discards the changes of the Batch, resetting the repository to the commit the branch was at when the
+// Batch was opened, and closes it. Rolling back a committed or rolled back Batch does nothing, so that it can be
+// deferred right after OpenBatch.
+func (b *Batch) Rollback() error {
+	return b.RollbackWithContext(context.Background())
+}
+
+// RollbackWithContext is the context aware variant of Rollback. The Batch is closed even if the context is done before
+// the changes are discarded.
+func (b *Batch) RollbackWithContext(ctx context.Context) (err error) {
+	defer func() { err = checkCancelled(ctx, "RollbackBatch", err) }()
+	if b.closed {
+		return nil
+	}
+	defer b.close()
+	if out, err := b.gen.execute(ctx, b.repoPath, GitCommand, "reset", "--hard", b.head); err != nil {
+		return &GitCmdError{path: b.repoPath, cmdResult: string(out), err: err, cmdType: rollbackBatch}
+	}
+	if out, err := b.gen.execute(ctx, b.repoPath, GitCommand, "clean", "-fd"); err != nil {
+		return &GitCmdError{path: b.repoPath, cmdResult: string(out), err: err, cmdType: rollbackBatch}
+	}
+	return nil
+}
+
+// fail rolls the batch back after the error, which is returned. The changes are rolled back even though the context of
+// the operation is done.
+func (b *Batch) fail(err error) error {
+	if rollbackErr := b.Rollback(); rollbackErr != nil {
+		b.gen.Log.Error(rollbackErr, "failed to roll back the batch", "repoPath", b.repoPath)
+	}
+	return err
+}
+
+// close releases the repository, after which no operation can be applied
+func (b *Batch) close() {
+	b.closed = true
+	b.release()
+}
@@ -0,0 +1,193 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	gitopsv1alpha1 "github.com/redhat-developer/gitops-generator/api/v1alpha1"
+	"github.com/redhat-developer/gitops-generator/pkg/testutils"
+	"github.com/redhat-developer/gitops-generator/pkg/util"
+	"github.com/redhat-developer/gitops-generator/pkg/util/ioutils"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatch(t *testing.T) {
+	useInProcessFileTransport(t)
+	remote := "file://" + newBareRemote(t, "main")
+	fs := ioutils.NewMemoryFilesystem()
+	e := NewGoGitExecutor(fs)
+	run := func(baseDir string, args ...string) string {
+		t.Helper()
+		out, err := e.Execute(context.Background(), baseDir, GitCommand, args...)
+		testutils.AssertNoError(t, err)
+		return string(out)
+	}
+	exists := func(path string) bool {
+		t.Helper()
+		exists, err := fs.Exists(path)
+		testutils.AssertNoError(t, err)
+		return exists
+	}
+	run("/upstream", "clone", remote, "repo")
+	run("/upstream/repo", "checkout", "-b", "main")
+	testutils.AssertNoError(t, writeFile(fs, "/upstream/repo/components/a/base/deployment.yaml", []byte("a\n"), 0644))
+	run("/upstream/repo", "add", ".")
+	run("/upstream/repo", "-c", "user.name=Test User", "-c", "user.email=test@test.org", "commit", "-m", "seed")
+	run("/upstream/repo", "push", "origin", "main")
+	seed := strings.TrimSpace(run("/upstream/repo", "rev-parse", "HEAD"))
+
+	generator := NewGitopsGen(WithExecutor(e), WithFilesystem(fs), WithHostRegistry(util.NewHostRegistry(util.Host{Schemes: []string{"file"}})),
+		WithCommitOptions(CommitOptions{Author: &Identity{Name: "Test User", Email: "test@test.org"}}))
+	component := func(name string) gitopsv1alpha1.GeneratorOptions {
+		return gitopsv1alpha1.GeneratorOptions{Name: name, ContainerImage: "testimage:latest", Replicas: 1}
+	}
+
+	t.Run("The operations are pushed in a single commit", func(t *testing.T) {
+		batch, err := generator.OpenBatch("/output/app", remote, "main", "/")
+		testutils.AssertNoError(t, err)
+		defer batch.Rollback()
+		assert.Equal(t, "/output/app", batch.RepoPath())
+
+		testutils.AssertNoError(t, batch.Generate(component("b")))
+		testutils.AssertNoError(t, batch.GenerateOverlays(component("b"), "staging", "image:1", "ns", nil))
+		testutils.AssertNoError(t, batch.RemoveComponent("a"))
+		testutils.AssertNoError(t, batch.Commit(""))
+
+		run("/upstream/repo", "pull")
+		commit := run("/upstream/repo", "cat-file", "commit", "HEAD")
+		assert.Contains(t, commit, "parent "+seed+"\n")
+		assert.Contains(t, commit, "Apply 3 changes to the GitOps resources\n\n"+
+			"- Generate GitOps base resources for component b\n"+
+			"- Generate staging environment overlays for component b\n"+
+			"- Removed component a\n")
+		assert.True(t, exists("/upstream/repo/components/b/base/deployment.yaml"))
+		assert.True(t, exists("/upstream/repo/components/b/overlays/staging/kustomization.yaml"))
+		_, err = e.Execute(context.Background(), "/upstream/repo", GitCommand, "--no-pager", "show", "HEAD:components/a/base/deployment.yaml")
+		assert.Error(t, err, "the removal of the component should be pushed")
+
+		err = batch.Generate(component("c"))
+		testutils.AssertErrorMatch(t, "the batch of branch \"main\" of remote \".*\" is already committed or rolled back", err)
+		testutils.AssertErrorMatch(t, "already committed or rolled back", batch.Commit(""))
+	})
+
+	t.Run("The messages of the operations are rendered from the template", func(t *testing.T) {
+		templated := generator
+		templated.CommitOptions.MessageTemplate = CommitMessageTemplate{Subject: "chore(gitops): {{.DefaultSubject}}", Body: "{{range .Files}}- {{.}}\n{{end}}"}
+		batch, err := templated.OpenBatch("/output/template", remote, "main", "/")
+		testutils.AssertNoError(t, err)
+		defer batch.Rollback()
+		testutils.AssertNoError(t, batch.GenerateOverlays(component("b"), "prod", "image:2", "ns", nil))
+		testutils.AssertNoError(t, batch.Commit(""))
+
+		run("/upstream/repo", "pull")
+		commit := run("/upstream/repo", "cat-file", "commit", "HEAD")
+		assert.Contains(t, commit, "chore(gitops): Generate prod environment overlays for component b\n\n"+
+			"- components/b/overlays/prod/deployment-patch.yaml\n")
+
+		batch, err = templated.OpenBatch("/output/templates", remote, "main", "/")
+		testutils.AssertNoError(t, err)
+		defer batch.Rollback()
+		testutils.AssertNoError(t, batch.Generate(component("d")))
+		testutils.AssertNoError(t, batch.RemoveComponent("b"))
+		testutils.AssertNoError(t, batch.Commit(""))
+
+		run("/upstream/repo", "pull")
+		commit = run("/upstream/repo", "cat-file", "commit", "HEAD")
+		assert.Contains(t, commit, "Apply 2 changes to the GitOps resources\n\n"+
+			"- chore(gitops): Generate GitOps base resources for component d\n"+
+			"- chore(gitops): Removed component b\n")
+	})
+
+	t.Run("Rolled back operations are not pushed", func(t *testing.T) {
+		head := strings.TrimSpace(run("/upstream/repo", "rev-parse", "HEAD"))
+		batch, err := generator.OpenBatch("/output/rollback", remote, "main", "/")
+		testutils.AssertNoError(t, err)
+		testutils.AssertNoError(t, batch.Generate(component("c")))
+		assert.True(t, exists("/output/rollback/components/c/base/deployment.yaml"))
+
+		testutils.AssertNoError(t, batch.Rollback())
+		testutils.AssertNoError(t, batch.Rollback())
+		assert.False(t, exists("/output/rollback/components/c"), "the changes should be rolled back")
+		assert.Equal(t, head, strings.TrimSpace(run("/output/rollback", "rev-parse", "HEAD")))
+		run("/upstream/repo", "fetch", "origin", "main")
+		assert.Equal(t, head, strings.TrimSpace(run("/upstream/repo", "rev-parse", "origin/main")))
+	})
+}
+
+func TestBatchFailure(t *testing.T) {
+	repo := "https://github.com/testing/testing.git"
+	executedCmds := []testutils.Execution{}
+	fs := ioutils.NewMemoryFilesystem()
+	testutils.AssertNoError(t, writeFile(fs, "/fake/path/app/components/test-component/base/deployment.yaml", []byte("a\n"), 0644))
+	generator := NewGitopsGen(WithExecutor(newTestExecutor(testutils.NewOutputs(), testutils.NewErrors(), &executedCmds)), WithFilesystem(afero.Afero{Fs: afero.NewReadOnlyFs(fs.Fs)}))
+
+	batch, err := generator.OpenBatch("/fake/path/app", repo, "main", "/")
+	testutils.AssertNoError(t, err)
+	err = batch.RemoveComponent("test-component")
+	testutils.AssertErrorMatch(t, "failed to delete \"/fake/path/app/components/test-component\" folder in repository in \"/fake/path/app\" \"\": operation not permitted", err)
+	assert.Equal(t, []testutils.Execution{
+		{BaseDir: "/fake/path", Command: "git", Args: []string{"clone", repo, "app"}},
+		{BaseDir: "/fake/path/app", Command: "git", Args: []string{"switch", "main"}},
+		{BaseDir: "/fake/path/app", Command: "git", Args: []string{"rev-parse", "HEAD"}},
+		{BaseDir: "/fake/path/app", Command: "git", Args: []string{"reset", "--hard", "ca82a6dff817ec66f44342007202690a93763949"}},
+		{BaseDir: "/fake/path/app", Command: "git", Args: []string{"clean", "-fd"}},
+	}, executedCmds)
+
+	err = batch.Generate(gitopsv1alpha1.GeneratorOptions{Name: "test-component"})
+	testutils.AssertErrorMatch(t, "already committed or rolled back", err)
+}
+
+func TestBatchContext(t *testing.T) {
+	repo := "https://github.com/testing/testing.git"
+	executedCmds := []testutils.Execution{}
+	fs := ioutils.NewMemoryFilesystem()
+	// The first commit has changes to push
+	outputs := testutils.NewOutputs(nil, nil, []byte("abc\trefs/heads/main"), []byte("components/test-component/base/deployment.yaml"), nil, nil, nil)
+	generator := NewGitopsGen(WithExecutor(newTestExecutor(outputs, testutils.NewErrors(), &executedCmds)), WithFilesystem(fs))
+	component := gitopsv1alpha1.GeneratorOptions{Name: "test-component", ContainerImage: "testimage:latest", Replicas: 1}
+
+	// The context of OpenBatchWithContext does not apply to the commit
+	ctx, cancel := context.WithCancel(context.Background())
+	batch, err := generator.OpenBatchWithContext(ctx, "/fake/path/app", repo, "main", "/")
+	testutils.AssertNoError(t, err)
+	cancel()
+	testutils.AssertNoError(t, batch.Generate(component))
+	testutils.AssertNoError(t, batch.Commit(""))
+	assert.Equal(t, []string{"push", "origin", "main"}, executedCmds[len(executedCmds)-1].Args)
+
+	// The changes are rolled back when the context of the commit is done
+	executedCmds = executedCmds[:0]
+	batch, err = generator.OpenBatch("/fake/path/other", repo, "main", "/")
+	testutils.AssertNoError(t, err)
+	testutils.AssertNoError(t, batch.Generate(component))
+	err = batch.CommitWithContext(ctx, "")
+	var cancelled *OperationCancelledError
+	assert.True(t, errors.As(err, &cancelled), "unexpected error %v", err)
+	assert.Equal(t, []string{"clean", "-fd"}, executedCmds[len(executedCmds)-1].Args)
+	testutils.AssertErrorMatch(t, "already committed or rolled back", batch.Commit(""))
+
+	// Rolling back with a done context closes the Batch
+	batch, err = generator.OpenBatch("/fake/path/rollback", repo, "main", "/")
+	testutils.AssertNoError(t, err)
+	err = batch.RollbackWithContext(ctx)
+	assert.True(t, errors.As(err, &cancelled), "unexpected error %v", err)
+	testutils.AssertErrorMatch(t, "already committed or rolled back", batch.Generate(component))
+}
@@ -0,0 +1,77 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// CloneOptions configures how the GitOps repositories are cloned. Large repositories can be cloned with a truncated
+// history, and with a working tree restricted to the component being updated. Committing and pushing work the same
+// in both modes.
+type CloneOptions struct {
+	// Depth truncates the history of each branch to the given number of commits. The whole history is cloned when zero.
+	Depth int
+	// Sparse restricts the working tree to the <context>/components/<name> folder of the component, along with the
+	// files of its parent folders, such as the kustomization.yaml files. CloneRepo, which is not given a context,
+	// always checks out the whole tree.
+	Sparse bool
+}
+
+// WithCloneOptions sets the depth and sparse checkout of the clones of the GitOps repositories
+func WithCloneOptions(cloneOptions CloneOptions) GenOption {
+	return func(g *Gen) {
+		g.CloneOptions = cloneOptions
+	}
+}
+
+// cloneArgs returns the git command line cloning the remote to dir, only checking out the top level files when sparse
+func (o CloneOptions) cloneArgs(remote string, dir string, sparse bool) []string {
+	args := []string{"clone"}
+	if o.Depth > 0 {
+		// Unlike the default of shallow clones, all the branches are fetched, so that any of them can be switched to
+		args = append(args, fmt.Sprintf("--depth=%d", o.Depth), "--no-single-branch")
+	}
+	if sparse {
+		args = append(args, "--sparse")
+	}
+	return append(args, remote, dir)
+}
+
+// sparsePaths returns the folders to check out for the component, nil if the whole tree is checked out
+func (o CloneOptions) sparsePaths(repoContext string, componentName string) []string {
+	if !o.Sparse {
+		return nil
+	}
+	path := filepath.ToSlash(filepath.Join(repoContext, "components", componentName))
+	return []string{strings.TrimPrefix(path, "/")}
+}
+
+// sparseCheckout adds the folders to the sparse checkout of the repository, the folders checked out so far being
+// replaced rather than kept when set is true
+func (s Gen) sparseCheckout(ctx context.Context, repoPath string, paths []string, set bool) error {
+	subCmd := "add"
+	if set {
+		subCmd = "set"
+	}
+	if out, err := s.execute(ctx, repoPath, GitCommand, append([]string{"sparse-checkout", subCmd}, paths...)...); err != nil {
+		return &GitCmdError{path: repoPath, cmdResult: string(out), err: err, cmdType: sparseCheckout}
+	}
+	return nil
+}
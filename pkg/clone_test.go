@@ -0,0 +1,151 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	gitopsv1alpha1 "github.com/redhat-developer/gitops-generator/api/v1alpha1"
+	"github.com/redhat-developer/gitops-generator/pkg/testutils"
+	"github.com/redhat-developer/gitops-generator/pkg/util/ioutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloneOptions(t *testing.T) {
+	repo := "https://github.com/testing/testing.git"
+	outputPath := "/fake/path"
+	repoPath := "/fake/path/test-component"
+	component := gitopsv1alpha1.GeneratorOptions{Name: "test-component", ContainerImage: "testimage:latest", Replicas: 1}
+
+	tests := []struct {
+		name          string
+		cloneOptions  CloneOptions
+		repoContext   string
+		errors        *testutils.ErrorStack
+		wantCmds      []testutils.Execution
+		wantErrString string
+	}{
+		{
+			name:        "Full clone",
+			repoContext: "/",
+			wantCmds: []testutils.Execution{
+				{BaseDir: outputPath, Command: "git", Args: []string{"clone", repo, "test-component"}},
+				{BaseDir: repoPath, Command: "git", Args: []string{"switch", "main"}},
+			},
+		},
+		{
+			name:         "Shallow clone",
+			cloneOptions: CloneOptions{Depth: 1},
+			repoContext:  "/",
+			wantCmds: []testutils.Execution{
+				{BaseDir: outputPath, Command: "git", Args: []string{"clone", "--depth=1", "--no-single-branch", repo, "test-component"}},
+				{BaseDir: repoPath, Command: "git", Args: []string{"switch", "main"}},
+			},
+		},
+		{
+			name:         "Sparse clone of the root context",
+			cloneOptions: CloneOptions{Sparse: true},
+			repoContext:  "/",
+			wantCmds: []testutils.Execution{
+				{BaseDir: outputPath, Command: "git", Args: []string{"clone", "--sparse", repo, "test-component"}},
+				{BaseDir: repoPath, Command: "git", Args: []string{"sparse-checkout", "set", "components/test-component"}},
+				{BaseDir: repoPath, Command: "git", Args: []string{"switch", "main"}},
+			},
+		},
+		{
+			name:         "Sparse and shallow clone of a nested context",
+			cloneOptions: CloneOptions{Depth: 5, Sparse: true},
+			repoContext:  "gitops/dev",
+			wantCmds: []testutils.Execution{
+				{BaseDir: outputPath, Command: "git", Args: []string{"clone", "--depth=5", "--no-single-branch", "--sparse", repo, "test-component"}},
+				{BaseDir: repoPath, Command: "git", Args: []string{"sparse-checkout", "set", "gitops/dev/components/test-component"}},
+				{BaseDir: repoPath, Command: "git", Args: []string{"switch", "main"}},
+			},
+		},
+		{
+			name:         "Sparse checkout error",
+			cloneOptions: CloneOptions{Sparse: true},
+			repoContext:  "/",
+			errors:       &testutils.ErrorStack{Errors: []error{errors.New("unknown subcommand: sparse-checkout"), nil}},
+			wantCmds: []testutils.Execution{
+				{BaseDir: outputPath, Command: "git", Args: []string{"clone", "--sparse", repo, "test-component"}},
+				{BaseDir: repoPath, Command: "git", Args: []string{"sparse-checkout", "set", "components/test-component"}},
+			},
+			wantErrString: "failed to set the sparse checkout of repository \"/fake/path/test-component\" \"\": unknown subcommand: sparse-checkout",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executedCmds := []testutils.Execution{}
+			errorStack := tt.errors
+			if errorStack == nil {
+				errorStack = testutils.NewErrors()
+			}
+			generator := NewGitopsGen(WithExecutor(newTestExecutor(testutils.NewOutputs(), errorStack, &executedCmds)), WithCloneOptions(tt.cloneOptions))
+
+			err := generator.CloneGenerateAndPush(outputPath, repo, component, ioutils.NewMemoryFilesystem(), "main", tt.repoContext, false)
+			if tt.wantErrString != "" {
+				testutils.AssertErrorMatch(t, tt.wantErrString, err)
+				assert.Equal(t, tt.wantCmds, executedCmds)
+				return
+			}
+			testutils.AssertNoError(t, err)
+			assert.Equal(t, tt.wantCmds, executedCmds[:len(tt.wantCmds)])
+		})
+	}
+
+	t.Run("CloneRepo is never sparse", func(t *testing.T) {
+		executedCmds := []testutils.Execution{}
+		generator := NewGitopsGen(WithExecutor(newTestExecutor(testutils.NewOutputs(), testutils.NewErrors(), &executedCmds)), WithCloneOptions(CloneOptions{Depth: 1, Sparse: true}))
+
+		testutils.AssertNoError(t, generator.CloneRepo(outputPath, repo, "test-component", "main"))
+		assert.Equal(t, []testutils.Execution{
+			{BaseDir: outputPath, Command: "git", Args: []string{"clone", "--depth=1", "--no-single-branch", repo, "test-component"}},
+			{BaseDir: repoPath, Command: "git", Args: []string{"switch", "main"}},
+		}, executedCmds)
+	})
+}
+
+func TestGoGitExecutorCloneOptions(t *testing.T) {
+	useInProcessFileTransport(t)
+	remote := newBareRemote(t, "main")
+	fs := ioutils.NewMemoryFilesystem()
+	e := NewGoGitExecutor(fs)
+	run := func(baseDir string, args ...string) {
+		t.Helper()
+		_, err := e.Execute(context.Background(), baseDir, GitCommand, args...)
+		testutils.AssertNoError(t, err)
+	}
+	run("/work", "clone", remote, "seed")
+	run("/work/seed", "checkout", "-b", "main")
+	testutils.AssertNoError(t, writeFile(fs, "/work/seed/components/a/base/deployment.yaml", []byte("a\n"), 0644))
+	run("/work/seed", "add", ".")
+	run("/work/seed", "-c", "user.name=Test User", "-c", "user.email=test@test.org", "commit", "-m", "update")
+	run("/work/seed", "push", "origin", "main")
+
+	// The sparse checkout is not supported by go-git, so the whole tree is checked out
+	run("/work", "clone", "--sparse", remote, "sparse")
+	run("/work/sparse", "sparse-checkout", "set", "components/b")
+	content, err := fs.ReadFile("/work/sparse/components/a/base/deployment.yaml")
+	testutils.AssertNoError(t, err)
+	assert.Equal(t, "a\n", string(content))
+
+	_, err = e.Execute(context.Background(), "/work", GitCommand, "clone", "--depth=x", remote, "invalid")
+	testutils.AssertErrorMatch(t, "invalid depth", err)
+}
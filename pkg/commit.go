@@ -0,0 +1,276 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"golang.org/x/crypto/ssh"
+)
+
+// signedCommitFile is the file, relative to the repository, the signed commit object is written to before being
+// stored in the repository
+const signedCommitFile = ".git/GITOPS_GENERATOR_SIGNED_COMMIT"
+
+// Identity is the name and email of the author or committer of a commit
+type Identity struct {
+	Name  string
+	Email string
+}
+
+// SigningFormat is the format of a SigningKey
+type SigningFormat string
+
+const (
+	// OpenPGPSigningFormat is used for armored OpenPGP private keys, like the ones exported by gpg --export-secret-keys --armor
+	OpenPGPSigningFormat SigningFormat = "openpgp"
+	// SSHSigningFormat is used for PEM encoded SSH private keys, like the ones generated by ssh-keygen
+	SSHSigningFormat SigningFormat = "ssh"
+)
+
+// SigningKey is the private key the commits are signed with. The commits are signed in-process, so neither gpg nor
+// ssh-keygen is needed.
+type SigningKey struct {
+	Format SigningFormat
+	// Key is the private key, in the encoding of its Format
+	Key []byte
+	// Passphrase decrypts the private key, if it is encrypted
+	Passphrase []byte
+}
+
+// CommitOptions configures the commits made by the Gen. As Gen is passed by value, the commits of a single call can be
+// configured by setting the CommitOptions of a copy of the Gen.
+type CommitOptions struct {
+	// Author of the commits. Defaults to the git identity configured in the environment.
+	Author *Identity
+	// Committer of the commits. Defaults to the Author when set, and to the git identity configured in the environment
+	// otherwise.
+	Committer *Identity
+	// SigningKey signs the commits when set
+	SigningKey *SigningKey
+	// MessageTemplate renders the messages of the commits made by the generator operations. The default messages, e.g.
+	// "Removed component <name>", are used when not set.
+	MessageTemplate CommitMessageTemplate
+	// CreatedBy identifies the client making the commits in their Created-By trailer. Defaults to
+	// "application-service". GenerateAndPush uses its createdBy argument instead, when set.
+	CreatedBy string
+}
+
+// createdBy returns the value of the Created-By trailer of the commits
+func (o CommitOptions) createdBy() string {
+	if o.CreatedBy == "" {
+		return defaultCreatedBy
+	}
+	return o.CreatedBy
+}
+
+// WithCommitOptions sets the author, committer, signing key and message template of the commits made by the Gen
+func WithCommitOptions(commitOptions CommitOptions) GenOption {
+	return func(g *Gen) {
+		g.CommitOptions = commitOptions
+	}
+}
+
+// identityArgs returns the git options setting the committer, which is the author as well unless overridden
+func (o CommitOptions) identityArgs() []string {
+	committer := o.Committer
+	if committer == nil {
+		committer = o.Author
+	}
+	if committer == nil {
+		return nil
+	}
+	return []string{"-c", "user.name=" + committer.Name, "-c", "user.email=" + committer.Email}
+}
+
+// commitArgs returns the git command line committing the staged changes with the commit message
+func (o CommitOptions) commitArgs(commitMessage string) []string {
+	args := append(o.identityArgs(), "commit")
+	if o.Author != nil {
+		args = append(args, fmt.Sprintf("--author=%s <%s>", o.Author.Name, o.Author.Email))
+	}
+	return append(args, "-m", commitMessage)
+}
+
+// validate checks that the identities are complete
+func (o CommitOptions) validate() error {
+	for _, identity := range []*Identity{o.Author, o.Committer} {
+		if identity != nil && (identity.Name == "" || identity.Email == "") {
+			return errors.New("the name and email of the commit author and committer are required")
+		}
+	}
+	if o.SigningKey != nil && o.SigningKey.Format != OpenPGPSigningFormat && o.SigningKey.Format != SSHSigningFormat {
+		return fmt.Errorf("unsupported signing key format %q", o.SigningKey.Format)
+	}
+	return nil
+}
+
+// commitChanges commits the staged changes of the repository with the CommitOptions of the Gen, and signs the commit
+// if a SigningKey is set
+func (s Gen) commitChanges(ctx context.Context, repoPath string, commitMessage string) error {
+	if err := s.CommitOptions.validate(); err != nil {
+		return &GitCmdError{path: repoPath, err: err, cmdType: commitFiles}
+	}
+	if out, err := s.execute(ctx, repoPath, GitCommand, s.CommitOptions.commitArgs(commitMessage)...); err != nil {
+		return &GitCmdError{path: repoPath, cmdResult: string(out), err: err, cmdType: commitFiles}
+	}
+	return s.signHead(ctx, repoPath)
+}
+
+// signHead replaces the commit HEAD points to with the same commit signed with the SigningKey of the Gen. Nothing is
+// done if no SigningKey is set.
+func (s Gen) signHead(ctx context.Context, repoPath string) error {
+	key := s.CommitOptions.SigningKey
+	if key == nil {
+		return nil
+	}
+	out, err := s.execute(ctx, repoPath, GitCommand, "cat-file", "commit", "HEAD")
+	if err != nil {
+		return &CommitSigningError{repoPath: repoPath, cmdResult: string(out), err: err}
+	}
+	signed, err := signCommitObject(*key, out)
+	if err != nil {
+		return &CommitSigningError{repoPath: repoPath, err: err}
+	}
+
+	fs := s.filesystem()
+	path := filepath.Join(repoPath, signedCommitFile)
+	if err := fs.WriteFile(path, signed, 0600); err != nil {
+		return &CommitSigningError{repoPath: repoPath, err: err}
+	}
+	defer func() {
+		_ = fs.Remove(path)
+	}()
+	out, err = s.execute(ctx, repoPath, GitCommand, "hash-object", "-t", "commit", "-w", signedCommitFile)
+	if err != nil {
+		return &CommitSigningError{repoPath: repoPath, cmdResult: string(out), err: err}
+	}
+	if out, err := s.execute(ctx, repoPath, GitCommand, "update-ref", "HEAD", strings.TrimSpace(string(out))); err != nil {
+		return &CommitSigningError{repoPath: repoPath, cmdResult: string(out), err: err}
+	}
+	return nil
+}
+
+// signCommitObject signs the raw commit object, and returns it with the signature in its gpgsig header
+func signCommitObject(key SigningKey, commit []byte) ([]byte, error) {
+	headers, message := commit, []byte{}
+	if i := bytes.Index(commit, []byte("\n\n")); i >= 0 {
+		headers, message = commit[:i+1], commit[i+1:]
+	}
+	var signature string
+	var err error
+	switch key.Format {
+	case OpenPGPSigningFormat:
+		signature, err = signOpenPGP(key, commit)
+	case SSHSigningFormat:
+		signature, err = signSSH(key, commit)
+	default:
+		err = fmt.Errorf("unsupported signing key format %q", key.Format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var signed bytes.Buffer
+	signed.Write(headers)
+	signed.WriteString("gpgsig " + strings.ReplaceAll(strings.TrimSuffix(signature, "\n"), "\n", "\n ") + "\n")
+	signed.Write(message)
+	return signed.Bytes(), nil
+}
+
+// signOpenPGP returns the armored detached OpenPGP signature of the commit
+func signOpenPGP(key SigningKey, commit []byte) (string, error) {
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(key.Key))
+	if err != nil {
+		return "", fmt.Errorf("failed to read the OpenPGP signing key: %w", err)
+	}
+	if len(entities) == 0 || entities[0].PrivateKey == nil {
+		return "", errors.New("the OpenPGP signing key does not contain a private key")
+	}
+	entity := entities[0]
+	if entity.PrivateKey.Encrypted {
+		if err := entity.PrivateKey.Decrypt(key.Passphrase); err != nil {
+			return "", fmt.Errorf("failed to decrypt the OpenPGP signing key: %w", err)
+		}
+	}
+	var signature bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&signature, entity, bytes.NewReader(commit), nil); err != nil {
+		return "", err
+	}
+	return signature.String(), nil
+}
+
+// signSSH returns the armored SSH signature of the commit, in the format of ssh-keygen -Y sign -n git
+func signSSH(key SigningKey, commit []byte) (string, error) {
+	var signer ssh.Signer
+	var err error
+	if len(key.Passphrase) > 0 {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(key.Key, key.Passphrase)
+	} else {
+		signer, err = ssh.ParsePrivateKey(key.Key)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read the SSH signing key: %w", err)
+	}
+
+	const namespace, hashAlgorithm = "git", "sha512"
+	hash := sha512.Sum512(commit)
+	signedData := append([]byte("SSHSIG"), ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          string
+	}{namespace, "", hashAlgorithm, string(hash[:])})...)
+
+	var signature *ssh.Signature
+	if algorithmSigner, ok := signer.(ssh.AlgorithmSigner); ok && signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		// SHA-1 RSA signatures are rejected by ssh-keygen
+		signature, err = algorithmSigner.SignWithAlgorithm(rand.Reader, signedData, ssh.SigAlgoRSASHA2512)
+	} else {
+		signature, err = signer.Sign(rand.Reader, signedData)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	blob := append([]byte("SSHSIG"), ssh.Marshal(struct {
+		Version       uint32
+		PublicKey     string
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     string
+	}{1, string(signer.PublicKey().Marshal()), namespace, "", hashAlgorithm, string(ssh.Marshal(signature))})...)
+
+	encoded := base64.StdEncoding.EncodeToString(blob)
+	var armored strings.Builder
+	armored.WriteString("-----BEGIN SSH SIGNATURE-----\n")
+	for len(encoded) > 70 {
+		armored.WriteString(encoded[:70] + "\n")
+		encoded = encoded[70:]
+	}
+	armored.WriteString(encoded + "\n-----END SSH SIGNATURE-----\n")
+	return armored.String(), nil
+}
@@ -0,0 +1,246 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/redhat-developer/gitops-generator/pkg/testutils"
+	"github.com/redhat-developer/gitops-generator/pkg/util/ioutils"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestCommitOptions(t *testing.T) {
+	repo := "https://github.com/testing/testing.git"
+	repoPath := "/fake/path/test-component"
+	author := &Identity{Name: "Author", Email: "author@test.org"}
+	committer := &Identity{Name: "Committer", Email: "committer@test.org"}
+
+	tests := []struct {
+		name          string
+		commitOptions CommitOptions
+		wantCommit    []string
+		wantErrString string
+	}{
+		{
+			name:       "Identity of the environment",
+			wantCommit: []string{"commit", "-m", withTrailers("Update", []CommitTrailers{{Component: "test-component"}}, defaultCreatedBy)},
+		},
+		{
+			name:          "Author only",
+			commitOptions: CommitOptions{Author: author},
+			wantCommit:    []string{"-c", "user.name=Author", "-c", "user.email=author@test.org", "commit", "--author=Author <author@test.org>", "-m", withTrailers("Update", []CommitTrailers{{Component: "test-component"}}, defaultCreatedBy)},
+		},
+		{
+			name:          "Committer only",
+			commitOptions: CommitOptions{Committer: committer},
+			wantCommit:    []string{"-c", "user.name=Committer", "-c", "user.email=committer@test.org", "commit", "-m", withTrailers("Update", []CommitTrailers{{Component: "test-component"}}, defaultCreatedBy)},
+		},
+		{
+			name:          "Author and committer",
+			commitOptions: CommitOptions{Author: author, Committer: committer},
+			wantCommit:    []string{"-c", "user.name=Committer", "-c", "user.email=committer@test.org", "commit", "--author=Author <author@test.org>", "-m", withTrailers("Update", []CommitTrailers{{Component: "test-component"}}, defaultCreatedBy)},
+		},
+		{
+			name:          "Created by",
+			commitOptions: CommitOptions{CreatedBy: "KAM CLI"},
+			wantCommit:    []string{"commit", "-m", "Update\n\nComponent: test-component\nGenerator-Version: " + GeneratorVersion + "\nCreated-By: KAM CLI\n"},
+		},
+		{
+			name:          "Incomplete identity",
+			commitOptions: CommitOptions{Author: &Identity{Name: "Author"}},
+			wantErrString: "failed to commit files to repository \"/fake/path/test-component\" \"\": the name and email of the commit author and committer are required",
+		},
+		{
+			name:          "Unsupported signing key format",
+			commitOptions: CommitOptions{SigningKey: &SigningKey{Format: "x509"}},
+			wantErrString: "unsupported signing key format \"x509\"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executedCmds := []testutils.Execution{}
+			outputs := testutils.NewOutputs(nil, nil, nil, []byte("components/test-component/base/deployment.yaml"), nil)
+			generator := NewGitopsGen(WithExecutor(newTestExecutor(outputs, testutils.NewErrors(), &executedCmds)), WithCommitOptions(tt.commitOptions))
+
+			err := generator.CommitAndPush("/fake/path", "", repo, "test-component", "main", "Update")
+			if tt.wantErrString != "" {
+				testutils.AssertErrorMatch(t, tt.wantErrString, err)
+				assert.Len(t, executedCmds, 3, "nothing should be committed")
+				return
+			}
+			testutils.AssertNoError(t, err)
+			assert.Equal(t, testutils.Execution{BaseDir: repoPath, Command: "git", Args: tt.wantCommit}, executedCmds[len(executedCmds)-2])
+		})
+	}
+}
+
+func newOpenPGPKeys(t *testing.T) (privateKey []byte, publicKey string) {
+	entity, err := openpgp.NewEntity("Test User", "", "test@test.org", nil)
+	testutils.AssertNoError(t, err)
+	var private, public bytes.Buffer
+	w, err := armor.Encode(&private, openpgp.PrivateKeyType, nil)
+	testutils.AssertNoError(t, err)
+	testutils.AssertNoError(t, entity.SerializePrivate(w, nil))
+	testutils.AssertNoError(t, w.Close())
+	w, err = armor.Encode(&public, openpgp.PublicKeyType, nil)
+	testutils.AssertNoError(t, err)
+	testutils.AssertNoError(t, entity.Serialize(w))
+	testutils.AssertNoError(t, w.Close())
+	return private.Bytes(), public.String()
+}
+
+func newSSHKey(t *testing.T) ([]byte, ssh.PublicKey) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	testutils.AssertNoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	testutils.AssertNoError(t, err)
+	sshPublic, err := ssh.NewPublicKey(public)
+	testutils.AssertNoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), sshPublic
+}
+
+// verifySSHSignature checks the armored SSH signature of the payload was made by the public key in the git namespace
+func verifySSHSignature(t *testing.T, armored string, payload []byte, publicKey ssh.PublicKey) {
+	t.Helper()
+	lines := strings.Split(strings.TrimSpace(armored), "\n")
+	assert.Equal(t, "-----BEGIN SSH SIGNATURE-----", lines[0])
+	assert.Equal(t, "-----END SSH SIGNATURE-----", lines[len(lines)-1])
+	blob, err := base64.StdEncoding.DecodeString(strings.Join(lines[1:len(lines)-1], ""))
+	testutils.AssertNoError(t, err)
+	assert.Equal(t, "SSHSIG", string(blob[:6]))
+	var sig struct {
+		Version       uint32
+		PublicKey     string
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     string
+	}
+	testutils.AssertNoError(t, ssh.Unmarshal(blob[6:], &sig))
+	assert.Equal(t, string(publicKey.Marshal()), sig.PublicKey)
+	assert.Equal(t, "git", sig.Namespace)
+	var signature ssh.Signature
+	testutils.AssertNoError(t, ssh.Unmarshal([]byte(sig.Signature), &signature))
+	hash := sha512.Sum512(payload)
+	signedData := append([]byte("SSHSIG"), ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          string
+	}{"git", "", "sha512", string(hash[:])})...)
+	testutils.AssertNoError(t, publicKey.Verify(signedData, &signature))
+}
+
+func TestSignedCommit(t *testing.T) {
+	useInProcessFileTransport(t)
+	openPGPKey, openPGPPublicKey := newOpenPGPKeys(t)
+	sshKey, sshPublicKey := newSSHKey(t)
+	author := &Identity{Name: "Author", Email: "author@test.org"}
+	committer := &Identity{Name: "Committer", Email: "committer@test.org"}
+
+	tests := []struct {
+		name          string
+		signingKey    *SigningKey
+		wantErrString string
+	}{
+		{
+			name: "Unsigned commit",
+		},
+		{
+			name:       "OpenPGP signed commit",
+			signingKey: &SigningKey{Format: OpenPGPSigningFormat, Key: openPGPKey},
+		},
+		{
+			name:       "SSH signed commit",
+			signingKey: &SigningKey{Format: SSHSigningFormat, Key: sshKey},
+		},
+		{
+			name:          "Invalid signing key",
+			signingKey:    &SigningKey{Format: SSHSigningFormat, Key: []byte("not a key")},
+			wantErrString: "failed to sign the last commit of repository \"/work/test-component\" \"\": failed to read the SSH signing key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := ioutils.NewMemoryFilesystem()
+			e := NewGoGitExecutor(fs)
+			repoPath := "/work/test-component"
+			_, err := e.Execute(context.Background(), "/work", GitCommand, "clone", newBareRemote(t, "main"), "test-component")
+			testutils.AssertNoError(t, err)
+			_, err = e.Execute(context.Background(), repoPath, GitCommand, "checkout", "-b", "main")
+			testutils.AssertNoError(t, err)
+			testutils.AssertNoError(t, writeFile(fs, repoPath+"/components/test-component/base/deployment.yaml", []byte("a\n"), 0644))
+			_, err = e.Execute(context.Background(), repoPath, GitCommand, "add", ".")
+			testutils.AssertNoError(t, err)
+
+			generator := NewGitopsGen(WithExecutor(e), WithFilesystem(fs), WithCommitOptions(CommitOptions{Author: author, Committer: committer, SigningKey: tt.signingKey}))
+			err = generator.commitChanges(context.Background(), repoPath, "Signed commit")
+			if tt.wantErrString != "" {
+				testutils.AssertErrorMatch(t, tt.wantErrString, err)
+				assert.IsType(t, &CommitSigningError{}, err)
+				return
+			}
+			testutils.AssertNoError(t, err)
+
+			r, _, err := e.open(repoPath)
+			testutils.AssertNoError(t, err)
+			head, err := r.Head()
+			testutils.AssertNoError(t, err)
+			assert.Equal(t, plumbing.NewBranchReferenceName("main"), head.Name())
+			commit, err := r.CommitObject(head.Hash())
+			testutils.AssertNoError(t, err)
+			assert.Equal(t, "Signed commit", commit.Message)
+			assert.Equal(t, "Author <author@test.org>", commit.Author.String())
+			assert.Equal(t, "Committer <committer@test.org>", commit.Committer.String())
+			exists, err := fs.Exists(repoPath + "/" + signedCommitFile)
+			testutils.AssertNoError(t, err)
+			assert.False(t, exists, "the signed commit file should be removed")
+
+			switch {
+			case tt.signingKey == nil:
+				assert.Empty(t, commit.PGPSignature)
+			case tt.signingKey.Format == OpenPGPSigningFormat:
+				_, err := commit.Verify(openPGPPublicKey)
+				testutils.AssertNoError(t, err)
+			default:
+				unsigned := &plumbing.MemoryObject{}
+				testutils.AssertNoError(t, commit.EncodeWithoutSignature(unsigned))
+				reader, err := unsigned.Reader()
+				testutils.AssertNoError(t, err)
+				var payload bytes.Buffer
+				_, err = payload.ReadFrom(reader)
+				testutils.AssertNoError(t, err)
+				verifySSHSignature(t, commit.PGPSignature, payload.Bytes(), sshPublicKey)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/redhat-developer/gitops-generator/pkg/util"
+	"github.com/redhat-developer/gitops-generator/pkg/util/ioutils"
+	"github.com/spf13/afero"
+)
+
+// Credentials provide the username and password used to authenticate to the HTTPS remotes. They are passed to git
+// through a credential helper rather than in the remote URL, so that they never end up in the git configuration of
+// the cloned repositories, in the arguments of the git processes or in the error messages. A GoGitExecutor is passed
+// them directly.
+type Credentials interface {
+	// Get returns the username and password to authenticate to the remote with
+	Get(ctx context.Context, remote string) (username string, password string, err error)
+}
+
+// TokenProvider is the Credentials returning the token to authenticate to the remote with, e.g. a short-lived GitHub
+// App installation token. It is called before each git command accessing the remote.
+type TokenProvider func(ctx context.Context, remote string) (string, error)
+
+// Get returns the token returned by the TokenProvider as the password, along with the username the Git host expects
+// for tokens. The host is looked up in the default registry of github.com and gitlab.com: a Gen looks it up in its
+// own Hosts instead.
+func (p TokenProvider) Get(ctx context.Context, remote string) (string, string, error) {
+	return p.get(ctx, util.DefaultHostRegistry(), remote)
+}
+
+// get returns the token returned by the TokenProvider, along with the username expected by the driver of the host of
+// the remote in the registry
+func (p TokenProvider) get(ctx context.Context, hosts *util.HostRegistry, remote string) (string, string, error) {
+	token, err := p(ctx, remote)
+	if err != nil {
+		return "", "", err
+	}
+	host, _ := hosts.HostOf(remote)
+	return tokenUsername(host.Driver), token, nil
+}
+
+// StaticToken returns the Credentials authenticating with the token, e.g. a personal access token
+func StaticToken(token string) Credentials {
+	return TokenProvider(func(ctx context.Context, remote string) (string, error) {
+		return token, nil
+	})
+}
+
+// BasicAuth returns the Credentials authenticating with the username and password
+func BasicAuth(username string, password string) Credentials {
+	return basicAuth{username: username, password: password}
+}
+
+type basicAuth struct {
+	username string
+	password string
+}
+
+func (b basicAuth) Get(ctx context.Context, remote string) (string, string, error) {
+	return b.username, b.password, nil
+}
+
+// WithCredentials sets the credentials used to authenticate to the HTTPS remotes
+func WithCredentials(credentials Credentials) GenOption {
+	return func(g *Gen) {
+		g.Credentials = credentials
+	}
+}
+
+// tokenUsername returns the username the Git hosts of the go-scm driver expect along with a token. GitHub requires
+// x-access-token for the GitHub App tokens, Bitbucket Cloud requires x-token-auth for the access tokens, GitLab
+// requires oauth2 for the OAuth tokens, and all of them accept any username for the personal access tokens.
+func tokenUsername(driver string) string {
+	switch driver {
+	case "github":
+		return "x-access-token"
+	case "bitbucket", "bitbucketcloud":
+		return "x-token-auth"
+	}
+	return "oauth2"
+}
+
+// credentials returns the username and password of the Credentials of the Gen for the remote. The username of the
+// tokens of a TokenProvider is the one expected by the driver of the host of the remote in the Hosts of the Gen.
+func (s Gen) credentials(ctx context.Context, remote string) (string, string, error) {
+	if p, ok := s.Credentials.(TokenProvider); ok {
+		return p.get(ctx, s.hostRegistry(), remote)
+	}
+	return s.Credentials.Get(ctx, remote)
+}
+
+// executeRemote runs the git command accessing the remote, authenticated with the SSHAuth of the Gen for the SSH
+// remotes, and with its Credentials for the other remotes. The GoGitExecutor is passed the authentication, while the
+// other executors are passed git options using the credentials written to a temporary folder, which is removed once
+// the command completes.
+func (s Gen) executeRemote(ctx context.Context, baseDir string, remote string, args ...string) ([]byte, error) {
+	if e, ok := s.Executor.(*GoGitExecutor); ok {
+		auth, err := s.remoteAuth(ctx, remote)
+		if err != nil {
+			return []byte(""), err
+		}
+		return e.executeRemote(ctx, baseDir, auth, args...)
+	}
+	authArgs, cleanup, err := s.remoteAuthArgs(ctx, remote)
+	if err != nil {
+		return []byte(""), err
+	}
+	defer cleanup()
+	return s.execute(ctx, baseDir, GitCommand, append(authArgs, args...)...)
+}
+
+// remoteAuth returns the go-git authentication to the remote, nil if the Gen has no credentials for the remote
+func (s Gen) remoteAuth(ctx context.Context, remote string) (transport.AuthMethod, error) {
+	if util.IsSSHRemote(remote) {
+		if s.SSHAuth == nil {
+			return nil, nil
+		}
+		auth, err := s.SSHAuth.publicKeys(remote)
+		if err != nil {
+			return nil, err
+		}
+		return auth, nil
+	}
+	if s.Credentials == nil {
+		return nil, nil
+	}
+	username, password, err := s.credentials(ctx, remote)
+	if err != nil {
+		return nil, &CredentialsError{remote: remote, err: err}
+	}
+	return &githttp.BasicAuth{Username: username, Password: password}, nil
+}
+
+// remoteAuthArgs writes the credentials for the remote, and returns the git options using them along with the
+// function removing them. No option is returned if the Gen has no credentials for the remote.
+func (s Gen) remoteAuthArgs(ctx context.Context, remote string) ([]string, func(), error) {
+	isSSH := util.IsSSHRemote(remote)
+	if (isSSH && s.SSHAuth == nil) || (!isSSH && s.Credentials == nil) {
+		return nil, func() {}, nil
+	}
+	// The files are read by the git processes, from the OS filesystem whatever the filesystem of the Gen
+	fs := ioutils.NewFilesystem()
+	dir, err := fs.TempDir("", util.CredentialsDirPrefix)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create the folder of the credentials: %w", err)
+	}
+	cleanup := func() {
+		_ = fs.RemoveAll(dir)
+	}
+
+	var authArgs []string
+	if isSSH {
+		var sshCommand string
+		if sshCommand, err = s.SSHAuth.writeSSHCommand(fs, dir); err == nil {
+			authArgs = []string{"-c", "core.sshCommand=" + sshCommand}
+		}
+	} else {
+		var helper string
+		if helper, err = s.writeCredentialHelper(ctx, fs, dir, remote); err == nil {
+			// The empty helper resets the helpers configured in the environment
+			authArgs = []string{"-c", "credential.helper=", "-c", "credential.helper=" + helper}
+		}
+	}
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return authArgs, cleanup, nil
+}
+
+// writeCredentialHelper writes the credentials for the remote to the folder, in the format of the git credential
+// helpers, and returns the helper printing them
+func (s Gen) writeCredentialHelper(ctx context.Context, fs afero.Afero, dir string, remote string) (string, error) {
+	username, password, err := s.credentials(ctx, remote)
+	if err != nil {
+		return "", &CredentialsError{remote: remote, err: err}
+	}
+	path := filepath.Join(dir, "credentials")
+	if err := fs.WriteFile(path, []byte(fmt.Sprintf("username=%s\npassword=%s\n", username, password)), 0600); err != nil {
+		return "", fmt.Errorf("failed to write the credentials: %w", err)
+	}
+	return credentialHelper(path), nil
+}
+
+// credentialHelper returns the git credential helper printing the credentials of the file
+func credentialHelper(path string) string {
+	return fmt.Sprintf(`!f() { test "$1" = get && cat '%s'; }; f`, path)
+}
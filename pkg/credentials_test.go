@@ -0,0 +1,200 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/jenkins-x/go-scm/scm/transport"
+	gitopsv1alpha1 "github.com/redhat-developer/gitops-generator/api/v1alpha1"
+	"github.com/redhat-developer/gitops-generator/pkg/testutils"
+	"github.com/redhat-developer/gitops-generator/pkg/util"
+	"github.com/redhat-developer/gitops-generator/pkg/util/ioutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredentials(t *testing.T) {
+	tests := []struct {
+		name         string
+		credentials  Credentials
+		remote       string
+		wantUsername string
+		wantPassword string
+	}{
+		{
+			name:         "Static token for GitHub",
+			credentials:  StaticToken("token"),
+			remote:       "https://github.com/org/repo.git",
+			wantUsername: "x-access-token",
+			wantPassword: "token",
+		},
+		{
+			name:         "Static token for GitLab",
+			credentials:  StaticToken("token"),
+			remote:       "https://gitlab.com/org/repo.git",
+			wantUsername: "oauth2",
+			wantPassword: "token",
+		},
+		{
+			name: "Token provider",
+			credentials: TokenProvider(func(ctx context.Context, remote string) (string, error) {
+				return "token for " + remote, nil
+			}),
+			remote:       "https://github.com/org/repo.git",
+			wantUsername: "x-access-token",
+			wantPassword: "token for https://github.com/org/repo.git",
+		},
+		{
+			name:         "Basic auth",
+			credentials:  BasicAuth("user", "password"),
+			remote:       "https://gitlab.com/org/repo.git",
+			wantUsername: "user",
+			wantPassword: "password",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			username, password, err := tt.credentials.Get(context.Background(), tt.remote)
+			testutils.AssertNoError(t, err)
+			assert.Equal(t, tt.wantUsername, username)
+			assert.Equal(t, tt.wantPassword, password)
+		})
+	}
+}
+
+func TestExecuteRemoteCredentials(t *testing.T) {
+	remote := "https://github.com/org/repo.git"
+
+	t.Run("HTTPS remote with credentials", func(t *testing.T) {
+		fs := ioutils.NewMemoryFilesystem()
+		e := &credentialsExecutor{}
+		generator := NewGitopsGen(WithExecutor(e), WithFilesystem(fs), WithCredentials(StaticToken("token")))
+
+		_, err := generator.executeRemote(context.Background(), "/work", remote, "clone", remote, "repo")
+		testutils.AssertNoError(t, err)
+		assert.Equal(t, []string{"-c", "credential.helper=", "-c"}, e.args[0][:3])
+		assert.Regexp(t, `^credential.helper=!f\(\) \{ test "\$1" = get && cat '/.*/gitops-generator-credentials-[0-9]+/credentials'; \}; f$`, e.args[0][3])
+		assert.Equal(t, []string{"clone", remote, "repo"}, e.args[0][4:])
+		// The credentials are read by git from the OS filesystem rather than the filesystem of the Gen
+		assert.Len(t, e.credentials[0], 1)
+		for path, content := range e.credentials[0] {
+			assert.Equal(t, "username=x-access-token\npassword=token\n", content)
+			exists, err := ioutils.NewFilesystem().Exists(path)
+			testutils.AssertNoError(t, err)
+			assert.False(t, exists, "the credentials should be removed")
+		}
+	})
+
+	t.Run("Token username from the driver of the host", func(t *testing.T) {
+		hosts := util.NewHostRegistry(util.Host{Hostname: "github.example.com", Driver: "github"}, util.Host{Hostname: "bitbucket.org", Driver: "bitbucketcloud"},
+			util.Host{Hostname: "gitlab.example.com", Driver: "gitlab"})
+		for remote, want := range map[string]string{
+			"https://github.example.com/org/repo.git": "x-access-token",
+			"https://bitbucket.org/org/repo.git":      "x-token-auth",
+			"https://gitlab.example.com/org/repo.git": "oauth2",
+		} {
+			fs := ioutils.NewMemoryFilesystem()
+			e := &credentialsExecutor{}
+			generator := NewGitopsGen(WithExecutor(e), WithFilesystem(fs), WithHostRegistry(hosts), WithCredentials(StaticToken("token")))
+
+			_, err := generator.executeRemote(context.Background(), "/work", remote, "fetch")
+			testutils.AssertNoError(t, err)
+			assert.Len(t, e.credentials[0], 1)
+			for _, content := range e.credentials[0] {
+				assert.Equal(t, "username="+want+"\npassword=token\n", content, remote)
+			}
+		}
+	})
+
+	t.Run("SSH remote with credentials only", func(t *testing.T) {
+		fs := ioutils.NewMemoryFilesystem()
+		e := &credentialsExecutor{}
+		generator := NewGitopsGen(WithExecutor(e), WithFilesystem(fs), WithCredentials(StaticToken("token")))
+
+		_, err := generator.executeRemote(context.Background(), "/work", "git@github.com:org/repo.git", "fetch")
+		testutils.AssertNoError(t, err)
+		assert.Equal(t, [][]string{{"fetch"}}, e.args)
+	})
+
+	t.Run("Token provider error", func(t *testing.T) {
+		t.Setenv("TMPDIR", t.TempDir())
+		fs := ioutils.NewMemoryFilesystem()
+		e := &credentialsExecutor{}
+		generator := NewGitopsGen(WithExecutor(e), WithFilesystem(fs), WithCredentials(TokenProvider(func(ctx context.Context, remote string) (string, error) {
+			return "", errors.New("the installation is suspended")
+		})))
+
+		err := generator.CloneRepo("/work", remote, "repo", "main")
+		testutils.AssertErrorMatch(t, `failed to clone git repository "/work" "": failed to get the credentials for remote "https://github.com/org/repo.git": the installation is suspended`, err)
+		assert.Empty(t, e.args, "git should not run without the credentials")
+		entries, err := ioutils.NewFilesystem().ReadDir(os.TempDir())
+		testutils.AssertNoError(t, err)
+		assert.Empty(t, entries, "the credentials folder should be removed")
+	})
+
+	t.Run("Errors are sanitized", func(t *testing.T) {
+		fs := ioutils.NewMemoryFilesystem()
+		e := &credentialsExecutor{output: "fatal: could not read <path>", err: errors.New("exit status 128")}
+		generator := NewGitopsGen(WithExecutor(e), WithFilesystem(fs), WithCredentials(StaticToken("token")))
+
+		err := generator.CloneRepo("/work", remote, "repo", "main")
+		testutils.AssertErrorMatch(t, `failed to clone git repository "/work" "fatal: could not read <CREDENTIALS>": exit status 128`, err)
+	})
+}
+
+func TestGoGitExecutorCredentials(t *testing.T) {
+	fs := ioutils.NewMemoryFilesystem()
+	generator := NewGitopsGen(WithExecutor(NewGoGitExecutor(fs)), WithFilesystem(fs), WithCredentials(StaticToken("token")))
+
+	auth, err := generator.remoteAuth(context.Background(), "git@github.com:org/repo.git")
+	testutils.AssertNoError(t, err)
+	assert.Nil(t, auth, "SSH remotes should not use the credentials")
+
+	auth, err = generator.remoteAuth(context.Background(), "https://github.com/org/repo.git")
+	testutils.AssertNoError(t, err)
+	assert.Equal(t, &githttp.BasicAuth{Username: "x-access-token", Password: "token"}, auth)
+
+	// The remote URL has no token, the repository is accessed with the credentials
+	api := testutils.NewScmServer(t, "test-user")
+	api.Git.Token = "secret-token"
+	remote := api.Git.URL + "/shop/gitops.git"
+	component := gitopsv1alpha1.GeneratorOptions{Name: "frontend", ContainerImage: "quay.io/shop/frontend:v1", TargetPort: 5000,
+		GitSource: &gitopsv1alpha1.GitSource{URL: remote}}
+	testutils.AssertNoError(t, newServedGen(api, fs, WithCredentials(StaticToken("secret-token"))).GenerateAndPush("/generated", remote, component, fs, "main", true, "KAM CLI"))
+	assert.Contains(t, pushedFiles(t, api.Git, "shop/gitops", "main"), "components/frontend/base/deployment.yaml")
+}
+
+func TestScmClientCredentials(t *testing.T) {
+	generator := NewGitopsGen(WithCredentials(StaticToken("token")))
+	client, err := generator.scmClient(context.Background(), "https://gitlab.com/org/repo.git")
+	testutils.AssertNoError(t, err)
+	privateToken, ok := client.Client.Transport.(*transport.PrivateToken)
+	if assert.True(t, ok) {
+		assert.Equal(t, "token", privateToken.Token)
+	}
+
+	generator.Credentials = TokenProvider(func(ctx context.Context, remote string) (string, error) {
+		return "", errors.New("the installation is suspended")
+	})
+	_, err = generator.scmClient(context.Background(), "https://github.com/org/repo.git")
+	testutils.AssertErrorMatch(t, "failed to get the credentials for remote", err)
+	assert.IsType(t, &CredentialsError{}, err)
+}
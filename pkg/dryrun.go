@@ -0,0 +1,346 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	gitopsv1alpha1 "github.com/redhat-developer/gitops-generator/api/v1alpha1"
+	"github.com/redhat-developer/gitops-generator/pkg/util/ioutils"
+	"github.com/spf13/afero"
+)
+
+// DryRunResult holds the changes a dry run would have made to the GitOps repository.
+// Paths are relative to the root of the repository, and each list is sorted by path.
+type DryRunResult struct {
+	Added    []FileChange
+	Modified []FileChange
+	Deleted  []FileChange
+}
+
+// FileChange is a file added, modified or deleted by a dry run, along with its unified diff
+type FileChange struct {
+	Path string
+	Diff string
+}
+
+// IsEmpty returns true if the dry run did not change any file
+func (r *DryRunResult) IsEmpty() bool {
+	return len(r.Added) == 0 && len(r.Modified) == 0 && len(r.Deleted) == 0
+}
+
+// DryRun returns a copy of the Gen whose methods compute the changes they would make to the GitOps repository,
+// without committing or pushing them, and without creating any repository on the Git host. Repositories are still
+// cloned, but the resources are generated in an in-memory copy of the clone, so that its files are left untouched.
+// The returned DryRunResult holds the changes computed by the last method called on the copy.
+func (s Gen) DryRun() (Gen, *DryRunResult) {
+	result := &DryRunResult{}
+	s.dryRun = result
+	return s, result
+}
+
+// DryRunGenerate returns the changes Generate would make to the gitOpsFolder, without writing to the filesystem
+func DryRunGenerate(fs afero.Afero, gitOpsFolder string, outputFolder string, component gitopsv1alpha1.GeneratorOptions) (*DryRunResult, error) {
+	return dryRun(fs, gitOpsFolder, func(copyFs afero.Afero) error {
+		return Generate(copyFs, gitOpsFolder, outputFolder, component)
+	})
+}
+
+// DryRunGenerateOverlays returns the changes GenerateOverlays would make to the gitOpsFolder, without writing to the
+// filesystem
+func DryRunGenerateOverlays(fs afero.Afero, gitOpsFolder string, outputFolder string, options gitopsv1alpha1.GeneratorOptions, imageName, namespace string, componentGeneratedResources map[string][]string) (*DryRunResult, error) {
+	return dryRun(fs, gitOpsFolder, func(copyFs afero.Afero) error {
+		return GenerateOverlays(copyFs, gitOpsFolder, outputFolder, options, imageName, namespace, componentGeneratedResources)
+	})
+}
+
+// dryRun runs the update against an in-memory copy of the root folder, and returns the changes it made to the copy
+func dryRun(fs afero.Afero, root string, update func(copyFs afero.Afero) error) (*DryRunResult, error) {
+	copyFs := ioutils.NewMemoryFilesystem()
+	if err := copyTree(fs, copyFs, root); err != nil {
+		return nil, err
+	}
+	if err := update(copyFs); err != nil {
+		return nil, err
+	}
+	return diffTrees(fs, copyFs, root)
+}
+
+// recordDryRun runs the update like dryRun, and stores the changes in the DryRunResult of the Gen
+func (s Gen) recordDryRun(fs afero.Afero, root string, update func(copyFs afero.Afero) error) error {
+	result, err := dryRun(fs, root, update)
+	if err != nil {
+		return err
+	}
+	*s.dryRun = *result
+	return nil
+}
+
+// showBatchSize is the number of files whose contents are read by each git show of recordDryRunCommit, which keeps
+// its command line short
+const showBatchSize = 500
+
+// recordDryRunCommit stores the changes git would commit since the last commit of the repository in the DryRunResult
+// of the Gen. Only the files listed by git ls-files are compared, which leaves out the ignored files, as well as the
+// files of the last commit outside of the sparse checkout. The contents of the files of the last commit are read by
+// git show, which outputs them one after the other, and are split according to the sizes listed by git ls-tree.
+func (s Gen) recordDryRunCommit(ctx context.Context, fs afero.Afero, repoPath string) error {
+	out, err := s.execute(ctx, repoPath, GitCommand, "ls-files", "-z", "-t", "--cached", "--others", "--exclude-standard")
+	if err != nil {
+		return &GitCmdError{path: repoPath, cmdResult: string(out), err: err, cmdType: listFiles}
+	}
+	listed, err := parseListedFiles(string(out))
+	if err != nil {
+		return &GitCmdError{path: repoPath, cmdResult: string(out), err: err, cmdType: listFiles}
+	}
+
+	lastCommit := map[string][]byte{}
+	// Listing the files fails when there is no commit yet, in which case all the files are added
+	if out, err := s.execute(ctx, repoPath, GitCommand, "ls-tree", "-r", "-l", "-z", "HEAD"); err == nil {
+		files, err := parseTreeFiles(string(out))
+		if err != nil {
+			return &GitCmdError{path: repoPath, cmdResult: string(out), err: err, cmdType: readCommit}
+		}
+		var checkedOut []treeFile
+		for _, file := range files {
+			if listed[file.path] != skipWorktreeTag {
+				checkedOut = append(checkedOut, file)
+			}
+		}
+		for start := 0; start < len(checkedOut); start += showBatchSize {
+			batch := checkedOut[start:]
+			if len(batch) > showBatchSize {
+				batch = batch[:showBatchSize]
+			}
+			args := []string{"--no-pager", "show"}
+			for _, file := range batch {
+				args = append(args, "HEAD:"+file.path)
+			}
+			contents, err := s.execute(ctx, repoPath, GitCommand, args...)
+			if err != nil {
+				return &GitCmdError{path: repoPath, cmdResult: string(contents), err: err, cmdType: readCommit}
+			}
+			for _, file := range batch {
+				if int64(len(contents)) < file.size {
+					return &GitCmdError{path: repoPath, err: fmt.Errorf("the content of %q is truncated", file.path), cmdType: readCommit}
+				}
+				lastCommit[file.path] = contents[:file.size]
+				contents = contents[file.size:]
+			}
+		}
+	}
+
+	worktree, err := readTree(fs, repoPath)
+	if err != nil {
+		return err
+	}
+	for path := range worktree {
+		if tag, ok := listed[path]; !ok || tag == skipWorktreeTag {
+			delete(worktree, path)
+		}
+	}
+	result, err := diffFiles(lastCommit, worktree)
+	if err != nil {
+		return err
+	}
+	*s.dryRun = *result
+	return nil
+}
+
+// skipWorktreeTag is the status git ls-files -t gives to the files outside of the sparse checkout
+const skipWorktreeTag = "S"
+
+// parseListedFiles returns the status tags of the files listed by git ls-files -z -t, keyed by their path. The entries
+// are of the form "<tag> <path>", where the tag is "?" for the untracked files.
+func parseListedFiles(out string) (map[string]string, error) {
+	files := map[string]string{}
+	for _, entry := range strings.Split(out, "\x00") {
+		if entry == "" {
+			continue
+		}
+		fields := strings.SplitN(entry, " ", 2)
+		if len(fields) != 2 || fields[0] == "" {
+			return nil, fmt.Errorf("invalid ls-files entry %q", entry)
+		}
+		files[fields[1]] = fields[0]
+	}
+	return files, nil
+}
+
+// treeFile is a file listed by git ls-tree -l
+type treeFile struct {
+	path string
+	size int64
+}
+
+// parseTreeFiles returns the files listed by git ls-tree -r -l -z, whose entries are of the form
+// "<mode> <type> <hash> <size>\t<path>". The submodules are skipped, as they have no content.
+func parseTreeFiles(out string) ([]treeFile, error) {
+	var files []treeFile
+	for _, entry := range strings.Split(out, "\x00") {
+		if entry == "" {
+			continue
+		}
+		fields := strings.SplitN(entry, "\t", 2)
+		info := strings.Fields(fields[0])
+		if len(fields) != 2 || len(info) != 4 {
+			return nil, fmt.Errorf("invalid ls-tree entry %q", entry)
+		}
+		if info[1] != "blob" {
+			continue
+		}
+		size, err := strconv.ParseInt(info[3], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ls-tree entry %q", entry)
+		}
+		files = append(files, treeFile{path: fields[1], size: size})
+	}
+	return files, nil
+}
+
+// readTree returns the content of the files under root, keyed by their path relative to root. The .git folder is skipped.
+func readTree(fs afero.Afero, root string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	if exists, err := fs.Exists(root); err != nil || !exists {
+		return files, err
+	}
+	err := fs.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		content, err := fs.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(relPath)] = content
+		return nil
+	})
+	return files, err
+}
+
+// copyTree copies the files under root to the same location on the destination filesystem. The .git folder is skipped.
+func copyTree(src afero.Afero, dst afero.Afero, root string) error {
+	files, err := readTree(src, root)
+	if err != nil {
+		return err
+	}
+	for path, content := range files {
+		if err := writeFile(dst, filepath.Join(root, path), content, 0644); err != nil {
+			return err
+		}
+	}
+	return dst.MkdirAll(root, 0755)
+}
+
+func writeFile(fs afero.Afero, path string, content []byte, perm os.FileMode) error {
+	if err := fs.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return fs.WriteFile(path, content, perm)
+}
+
+// splitLines splits the content in newline terminated lines for difflib. Unlike difflib.SplitLines, no empty line is
+// added after the trailing newline, and an empty content has no lines.
+func splitLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += "\n"
+	return lines
+}
+
+// diffTrees returns the changes between the files under root on the before and after filesystems
+func diffTrees(before afero.Afero, after afero.Afero, root string) (*DryRunResult, error) {
+	beforeFiles, err := readTree(before, root)
+	if err != nil {
+		return nil, err
+	}
+	afterFiles, err := readTree(after, root)
+	if err != nil {
+		return nil, err
+	}
+	return diffFiles(beforeFiles, afterFiles)
+}
+
+// diffFiles returns the changes between the before and after contents of the files, keyed by their path
+func diffFiles(beforeFiles map[string][]byte, afterFiles map[string][]byte) (*DryRunResult, error) {
+	var paths []string
+	for path := range beforeFiles {
+		paths = append(paths, path)
+	}
+	for path := range afterFiles {
+		if _, ok := beforeFiles[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	result := &DryRunResult{}
+	for _, path := range paths {
+		beforeContent, existed := beforeFiles[path]
+		afterContent, exists := afterFiles[path]
+		fromFile, toFile := "a/"+path, "b/"+path
+		switch {
+		case !existed:
+			fromFile = "/dev/null"
+		case !exists:
+			toFile = "/dev/null"
+		case string(beforeContent) == string(afterContent):
+			continue
+		}
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        splitLines(beforeContent),
+			B:        splitLines(afterContent),
+			FromFile: fromFile,
+			ToFile:   toFile,
+			Context:  3,
+		})
+		if err != nil {
+			return nil, err
+		}
+		change := FileChange{Path: path, Diff: diff}
+		switch {
+		case !existed:
+			result.Added = append(result.Added, change)
+		case !exists:
+			result.Deleted = append(result.Deleted, change)
+		default:
+			result.Modified = append(result.Modified, change)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,264 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	gitopsv1alpha1 "github.com/redhat-developer/gitops-generator/api/v1alpha1"
+	"github.com/redhat-developer/gitops-generator/pkg/testutils"
+	"github.com/redhat-developer/gitops-generator/pkg/util/ioutils"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func changedPathsOf(changes []FileChange) []string {
+	paths := []string{}
+	for _, change := range changes {
+		paths = append(paths, change.Path)
+	}
+	return paths
+}
+
+// commandRecorder runs the commands with the GitExecutor, and records their arguments
+type commandRecorder struct {
+	GitExecutor
+	commands [][]string
+}
+
+func (r *commandRecorder) Execute(ctx context.Context, baseDir string, cmd CommandType, args ...string) ([]byte, error) {
+	r.commands = append(r.commands, args)
+	return r.GitExecutor.Execute(ctx, baseDir, cmd, args...)
+}
+
+func TestDryRunGenerate(t *testing.T) {
+	fs := ioutils.NewMemoryFilesystem()
+	gitopsFolder := "/gitops"
+	componentPath := "/gitops/components/test-component/base"
+	component := gitopsv1alpha1.GeneratorOptions{Name: "test-component", ContainerImage: "testimage:latest", Replicas: 1}
+
+	result, err := DryRunGenerate(fs, gitopsFolder, componentPath, component)
+	testutils.AssertNoError(t, err)
+	assert.Contains(t, changedPathsOf(result.Added), "components/test-component/base/deployment.yaml")
+	assert.Contains(t, changedPathsOf(result.Added), "components/test-component/base/kustomization.yaml")
+	assert.Empty(t, result.Modified)
+	assert.Empty(t, result.Deleted)
+	exists, err := fs.Exists(gitopsFolder)
+	testutils.AssertNoError(t, err)
+	assert.False(t, exists, "the dry run should not write to the filesystem")
+
+	testutils.AssertNoError(t, Generate(fs, gitopsFolder, componentPath, component))
+	before, err := readTree(fs, gitopsFolder)
+	testutils.AssertNoError(t, err)
+
+	result, err = DryRunGenerate(fs, gitopsFolder, componentPath, component)
+	testutils.AssertNoError(t, err)
+	assert.True(t, result.IsEmpty(), "generating the same resources should not change anything")
+
+	component.Replicas = 3
+	result, err = DryRunGenerate(fs, gitopsFolder, componentPath, component)
+	testutils.AssertNoError(t, err)
+	assert.Empty(t, result.Added)
+	assert.Equal(t, []string{"components/test-component/base/deployment.yaml"}, changedPathsOf(result.Modified))
+	assert.Contains(t, result.Modified[0].Diff, "--- a/components/test-component/base/deployment.yaml\n+++ b/components/test-component/base/deployment.yaml\n")
+	assert.Contains(t, result.Modified[0].Diff, "-  replicas: 1\n+  replicas: 3\n")
+	after, err := readTree(fs, gitopsFolder)
+	testutils.AssertNoError(t, err)
+	assert.Equal(t, before, after, "the dry run should not write to the filesystem")
+}
+
+func TestDryRunGenerateOverlays(t *testing.T) {
+	fs := ioutils.NewMemoryFilesystem()
+	gitopsFolder := "/gitops"
+	overlaysPath := "/gitops/components/test-component/overlays/staging"
+	component := gitopsv1alpha1.GeneratorOptions{Name: "test-component", ContainerImage: "testimage:latest", Replicas: 2}
+	testutils.AssertNoError(t, Generate(fs, gitopsFolder, "/gitops/components/test-component/base", component))
+
+	result, err := DryRunGenerateOverlays(fs, gitopsFolder, overlaysPath, component, "newimage:latest", "namespace", nil)
+	testutils.AssertNoError(t, err)
+	assert.Contains(t, changedPathsOf(result.Added), "components/test-component/overlays/staging/kustomization.yaml")
+	for _, change := range result.Added {
+		assert.Contains(t, change.Diff, "--- /dev/null\n+++ b/"+change.Path+"\n")
+	}
+	exists, err := fs.Exists(overlaysPath)
+	testutils.AssertNoError(t, err)
+	assert.False(t, exists, "the dry run should not write to the filesystem")
+}
+
+func TestGenDryRun(t *testing.T) {
+	repo := "https://github.com/testing/testing.git"
+	outputPath := "/fake/path"
+	repoPath := "/fake/path/test-component"
+	component := gitopsv1alpha1.GeneratorOptions{Name: "test-component", ContainerImage: "testimage:latest", Replicas: 1}
+
+	t.Run("CloneGenerateAndPush does not delete, commit nor push", func(t *testing.T) {
+		fs := ioutils.NewMemoryFilesystem()
+		testutils.AssertNoError(t, Generate(fs, repoPath, repoPath+"/components/test-component/base", component))
+		testutils.AssertNoError(t, fs.WriteFile(repoPath+"/components/test-component/base/stale.yaml", []byte("stale\n"), 0644))
+		executedCmds := []testutils.Execution{}
+		generator, result := NewGitopsGen(WithExecutor(newTestExecutor(testutils.NewOutputs(), testutils.NewErrors(), &executedCmds))).DryRun()
+
+		component.Replicas = 2
+		testutils.AssertNoError(t, generator.CloneGenerateAndPush(outputPath, repo, component, fs, "main", "/", true))
+		assert.Equal(t, []testutils.Execution{
+			{BaseDir: outputPath, Command: "git", Args: []string{"clone", repo, "test-component"}},
+			{BaseDir: repoPath, Command: "git", Args: []string{"switch", "main"}},
+		}, executedCmds)
+		assert.Empty(t, result.Added)
+		assert.Equal(t, []string{"components/test-component/base/deployment.yaml"}, changedPathsOf(result.Modified))
+		assert.Equal(t, []FileChange{{Path: "components/test-component/base/stale.yaml", Diff: "--- a/components/test-component/base/stale.yaml\n+++ /dev/null\n@@ -1 +0,0 @@\n-stale\n"}}, result.Deleted)
+		exists, err := fs.Exists(repoPath + "/components/test-component/base/stale.yaml")
+		testutils.AssertNoError(t, err)
+		assert.True(t, exists, "the dry run should not write to the filesystem")
+	})
+
+	t.Run("GenerateAndPush does not create the repository", func(t *testing.T) {
+		fs := ioutils.NewMemoryFilesystem()
+		executedCmds := []testutils.Execution{}
+		generator, result := NewGitopsGen(WithExecutor(newTestExecutor(testutils.NewOutputs(), testutils.NewErrors(), &executedCmds))).DryRun()
+
+		testutils.AssertNoError(t, generator.GenerateAndPush(outputPath, repo, component, fs, "main", true, "application-service"))
+		assert.Empty(t, executedCmds)
+		assert.Contains(t, changedPathsOf(result.Added), "components/test-component/base/deployment.yaml")
+		exists, err := fs.Exists(outputPath)
+		testutils.AssertNoError(t, err)
+		assert.False(t, exists, "the dry run should not write to the filesystem")
+	})
+
+	t.Run("GitRemoveComponent deletes the component", func(t *testing.T) {
+		fs := ioutils.NewMemoryFilesystem()
+		testutils.AssertNoError(t, Generate(fs, repoPath, repoPath+"/components/test-component/base", component))
+		executedCmds := []testutils.Execution{}
+		generator, result := NewGitopsGen(WithExecutor(newTestExecutor(testutils.NewOutputs(), testutils.NewErrors(), &executedCmds)), WithFilesystem(fs)).DryRun()
+
+		testutils.AssertNoError(t, generator.GitRemoveComponent(outputPath, repo, "test-component", "main", "/"))
+		assert.Len(t, executedCmds, 2)
+		assert.Empty(t, result.Added)
+		assert.Contains(t, changedPathsOf(result.Deleted), "components/test-component/base/deployment.yaml")
+	})
+}
+
+func TestCommitAndPushDryRun(t *testing.T) {
+	useInProcessFileTransport(t)
+	remote := newBareRemote(t, "main")
+	fs := ioutils.NewMemoryFilesystem()
+	e := NewGoGitExecutor(fs)
+	write := func(fs afero.Afero, path, content string) {
+		t.Helper()
+		testutils.AssertNoError(t, writeFile(fs, path, []byte(content), 0644))
+	}
+	_, err := e.Execute(context.Background(), "/work", GitCommand, "clone", remote, "test-component")
+	testutils.AssertNoError(t, err)
+	_, err = e.Execute(context.Background(), "/work/test-component", GitCommand, "checkout", "-b", "main")
+	testutils.AssertNoError(t, err)
+	recorder := &commandRecorder{GitExecutor: e}
+	generator, result := NewGitopsGen(WithExecutor(recorder), WithFilesystem(fs)).DryRun()
+	repo := "https://github.com/testing/testing.git"
+
+	// Without any commit, all the files are added
+	write(fs, "/work/test-component/components/a/base/deployment.yaml", "a\n")
+	write(fs, "/work/test-component/components/b/base/deployment.yaml", "b\n")
+	testutils.AssertNoError(t, generator.CommitAndPush("/work", "", repo, "test-component", "main", "dry run"))
+	assert.Equal(t, []string{"components/a/base/deployment.yaml", "components/b/base/deployment.yaml"}, changedPathsOf(result.Added))
+
+	for _, args := range [][]string{{"add", "."}, {"-c", "user.name=Test User", "-c", "user.email=test@test.org", "commit", "-m", "first commit"}} {
+		_, err := e.Execute(context.Background(), "/work/test-component", GitCommand, args...)
+		testutils.AssertNoError(t, err)
+	}
+	testutils.AssertNoError(t, generator.CommitAndPush("/work", "", repo, "test-component", "main", "dry run"))
+	assert.True(t, result.IsEmpty())
+
+	// The changes are computed against the last commit
+	write(fs, "/work/test-component/components/a/base/deployment.yaml", "a2\n")
+	testutils.AssertNoError(t, fs.RemoveAll("/work/test-component/components/b"))
+	write(fs, "/work/test-component/components/c/base/deployment.yaml", "c\n")
+	recorder.commands = nil
+	testutils.AssertNoError(t, generator.CommitAndPush("/work", "", repo, "test-component", "main", "dry run"))
+	assert.Contains(t, recorder.commands, []string{"--no-pager", "show", "HEAD:components/a/base/deployment.yaml", "HEAD:components/b/base/deployment.yaml"},
+		"the files of the last commit should be read at once")
+	assert.Equal(t, []string{"components/c/base/deployment.yaml"}, changedPathsOf(result.Added))
+	assert.Equal(t, []FileChange{{Path: "components/a/base/deployment.yaml", Diff: "--- a/components/a/base/deployment.yaml\n+++ b/components/a/base/deployment.yaml\n@@ -1 +1 @@\n-a\n+a2\n"}}, result.Modified)
+	assert.Equal(t, []string{"components/b/base/deployment.yaml"}, changedPathsOf(result.Deleted))
+
+	// The ignored files are left out
+	write(fs, "/work/test-component/.gitignore", "*.log\n")
+	write(fs, "/work/test-component/components/a/base/generate.log", "generated\n")
+	testutils.AssertNoError(t, generator.CommitAndPush("/work", "", repo, "test-component", "main", "dry run"))
+	assert.Equal(t, []string{".gitignore", "components/c/base/deployment.yaml"}, changedPathsOf(result.Added))
+
+	// Nothing is committed
+	out, err := e.Execute(context.Background(), "/work/test-component", GitCommand, "--no-pager", "show", "HEAD:components/a/base/deployment.yaml")
+	testutils.AssertNoError(t, err)
+	assert.Equal(t, "a\n", string(out))
+	_, err = e.Execute(context.Background(), "/work/test-component", GitCommand, "ls-tree", "HEAD")
+	testutils.AssertErrorMatch(t, "only ls-tree -r -l -z <rev> is supported", err)
+}
+
+func TestCommitAndPushDryRunSparse(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	root := t.TempDir()
+	fs := ioutils.NewFilesystem()
+	run := func(baseDir string, args ...string) {
+		t.Helper()
+		if out, err := (ExecExecutor{}).Execute(context.Background(), baseDir, GitCommand, args...); err != nil {
+			t.Fatalf("git %v failed: %s: %s", args, err, out)
+		}
+	}
+	for _, path := range []string{"components/a/base/deployment.yaml", "components/b/base/deployment.yaml"} {
+		testutils.AssertNoError(t, writeFile(fs, filepath.Join(root, "upstream", path), []byte("a\n"), 0644))
+	}
+	run(filepath.Join(root, "upstream"), "init")
+	run(filepath.Join(root, "upstream"), "checkout", "-b", "main")
+	run(filepath.Join(root, "upstream"), "add", ".")
+	run(filepath.Join(root, "upstream"), "-c", "user.name=Test User", "-c", "user.email=test@test.org", "commit", "-m", "first commit")
+	run(root, "clone", "--sparse", "file://"+filepath.Join(root, "upstream"), "test-component")
+	run(filepath.Join(root, "test-component"), "sparse-checkout", "set", "components/a")
+
+	// The files outside of the sparse checkout are not deleted
+	testutils.AssertNoError(t, fs.WriteFile(filepath.Join(root, "test-component/components/a/base/deployment.yaml"), []byte("a2\n"), 0644))
+	generator, result := NewGitopsGen(WithFilesystem(fs)).DryRun()
+	testutils.AssertNoError(t, generator.CommitAndPush(root, "", "https://github.com/testing/testing.git", "test-component", "main", "dry run"))
+	assert.Empty(t, result.Added)
+	assert.Equal(t, []string{"components/a/base/deployment.yaml"}, changedPathsOf(result.Modified))
+	assert.Empty(t, result.Deleted)
+}
+
+func TestParseListedFiles(t *testing.T) {
+	files, err := parseListedFiles("? components/a b/new.yaml\x00H .gitignore\x00S components/b/base/deployment.yaml\x00")
+	testutils.AssertNoError(t, err)
+	assert.Equal(t, map[string]string{"components/a b/new.yaml": "?", ".gitignore": "H", "components/b/base/deployment.yaml": "S"}, files)
+
+	_, err = parseListedFiles("a\x00")
+	testutils.AssertErrorMatch(t, "invalid ls-files entry \"a\"", err)
+}
+
+func TestParseTreeFiles(t *testing.T) {
+	out := "100644 blob 78981922613b2afb6025042ff6bd878ac1994e85       2\ta\x00" +
+		"120000 blob 2e65efe2a145dda7ee51d1741299f848e5bf752e       1\tlink\x00" +
+		"160000 commit 2e65efe2a145dda7ee51d1741299f848e5bf752e       -\tsubmodule\x00" +
+		"100644 blob b5b5773c405b48235f24b489e56c5bd6522a4773 1048576\tcomponents/a b/base/deployment.yaml\x00"
+	files, err := parseTreeFiles(out)
+	testutils.AssertNoError(t, err)
+	assert.Equal(t, []treeFile{{path: "a", size: 2}, {path: "link", size: 1}, {path: "components/a b/base/deployment.yaml", size: 1048576}}, files)
+
+	_, err = parseTreeFiles("a\x00")
+	testutils.AssertErrorMatch(t, "invalid ls-tree entry \"a\"", err)
+}
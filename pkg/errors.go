@@ -17,6 +17,7 @@ package gitops
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/redhat-developer/gitops-generator/pkg/util"
 )
@@ -34,6 +35,13 @@ const (
 	switchBranch   GitCmd = "switch to"
 	checkoutBranch GitCmd = "checkout"
 	genOverlays    GitCmd = "overlays dir"
+	readCommit     GitCmd = "read the last commit of"
+	listFiles      GitCmd = "list the files of"
+	resetWorkspace GitCmd = "reset the workspace of"
+	sparseCheckout GitCmd = "set the sparse checkout of"
+	rollbackBatch  GitCmd = "roll back the batch of"
+	listCommits    GitCmd = "list the commits of"
+	revertCommit   GitCmd = "revert the commit in"
 )
 
 // GitCmdError is used to construct custom errors for a number of git commands that follow similar message patterns
@@ -176,3 +184,153 @@ type GitOpsRepoGenUserError struct {
 func (e *GitOpsRepoGenUserError) Error() string {
 	return util.SanitizeErrorMessage(fmt.Errorf("failed to get the user with their auth token: %w", e.err)).Error()
 }
+
+// OperationCancelledError is returned when the context passed to a Generator method is cancelled or times out
+type OperationCancelledError struct {
+	operation string
+	ctxErr    error
+	err       error
+}
+
+func (e *OperationCancelledError) Error() string {
+	return util.SanitizeErrorMessage(fmt.Errorf("%s operation was cancelled (%s): %s", e.operation, e.ctxErr, e.err)).Error()
+}
+
+// Unwrap returns the context error, so that errors.Is can match context.Canceled or context.DeadlineExceeded
+func (e *OperationCancelledError) Unwrap() error {
+	return e.ctxErr
+}
+
+// GitFetchError is used to construct custom errors related to git fetch failures
+type GitFetchError struct {
+	remote    string
+	cmdResult string
+	err       error
+}
+
+func (e *GitFetchError) Error() string {
+	return util.SanitizeErrorMessage(fmt.Errorf("failed to fetch from remote %q %q: %s", e.remote, string(e.cmdResult), e.err)).Error()
+}
+
+// GitRebaseConflictError is returned when a rejected push cannot be retried, because the local commits conflict
+// with the changes pushed to the remote branch in the meantime
+type GitRebaseConflictError struct {
+	remote    string
+	branch    string
+	cmdResult string
+	err       error
+}
+
+func (e *GitRebaseConflictError) Error() string {
+	return util.SanitizeErrorMessage(fmt.Errorf("failed to rebase onto branch %q of remote %q, the changes conflict with the remote changes %q: %s", e.branch, e.remote, string(e.cmdResult), e.err)).Error()
+}
+
+// CommitSigningError is used to construct custom errors related to commit signing failures
+type CommitSigningError struct {
+	repoPath  string
+	cmdResult string
+	err       error
+}
+
+func (e *CommitSigningError) Error() string {
+	return util.SanitizeErrorMessage(fmt.Errorf("failed to sign the last commit of repository %q %q: %s", e.repoPath, e.cmdResult, e.err)).Error()
+}
+
+// CredentialsError is used to construct custom errors related to the failures to get the credentials of a remote
+type CredentialsError struct {
+	remote string
+	err    error
+}
+
+func (e *CredentialsError) Error() string {
+	return util.SanitizeErrorMessage(fmt.Errorf("failed to get the credentials for remote %q: %s", e.remote, e.err)).Error()
+}
+
+// PullRequestError is used to construct custom errors related to opening or updating pull requests
+type PullRequestError struct {
+	remote       string
+	sourceBranch string
+	targetBranch string
+	err          error
+}
+
+func (e *PullRequestError) Error() string {
+	return util.SanitizeErrorMessage(fmt.Errorf("failed to open a pull request from branch %q to branch %q of remote %q: %s", e.sourceBranch, e.targetBranch, e.remote, e.err)).Error()
+}
+
+// BatchClosedError is returned when an operation is applied to a Batch that was already committed or rolled back
+type BatchClosedError struct {
+	remote string
+	branch string
+}
+
+func (e *BatchClosedError) Error() string {
+	return util.SanitizeErrorMessage(fmt.Errorf("the batch of branch %q of remote %q is already committed or rolled back", e.branch, e.remote)).Error()
+}
+
+// CommitMessageTemplateError is used to construct custom errors related to the failures to render a commit message
+type CommitMessageTemplateError struct {
+	template  string
+	operation CommitOperation
+	err       error
+}
+
+func (e *CommitMessageTemplateError) Error() string {
+	return util.SanitizeErrorMessage(fmt.Errorf("failed to render the commit message %s template of operation %q: %s", e.template, e.operation, e.err)).Error()
+}
+
+// ValidationError is returned when a name or path argument is invalid, before any git or filesystem operation is run
+type ValidationError struct {
+	argument string
+	value    string
+	reasons  []string
+}
+
+func (e *ValidationError) Error() string {
+	return util.SanitizeErrorMessage(fmt.Errorf("invalid %s %q: %s", e.argument, e.value, strings.Join(e.reasons, ", "))).Error()
+}
+
+// ForeignRepositoryError is returned when GenerateAndPush refuses to adopt an existing repository holding content that
+// was not generated
+type ForeignRepositoryError struct {
+	remote string
+	reason string
+}
+
+func (e *ForeignRepositoryError) Error() string {
+	return util.SanitizeErrorMessage(fmt.Errorf("refusing to adopt the existing repository of remote %q, %s", e.remote, e.reason)).Error()
+}
+
+// RepositorySettingsError is returned when the settings of a repository created by GenerateAndPush cannot be set
+type RepositorySettingsError struct {
+	repo string
+	err  error
+}
+
+func (e *RepositorySettingsError) Error() string {
+	return util.SanitizeErrorMessage(fmt.Errorf("failed to update the settings of repository %q: %s", e.repo, e.err)).Error()
+}
+
+// WebhookError is used to construct custom errors related to the failures to manage the webhooks of a repository
+type WebhookError struct {
+	repo   string
+	action string
+	err    error
+}
+
+func (e *WebhookError) Error() string {
+	return util.SanitizeErrorMessage(fmt.Errorf("failed to %s the webhooks of repository %q: %s", e.action, e.repo, e.err)).Error()
+}
+
+// ScaffoldError is used to construct custom errors related to the failures to render the scaffolding templates
+type ScaffoldError struct {
+	template string
+	err      error
+}
+
+func (e *ScaffoldError) Error() string {
+	if e.template == "" {
+		return util.SanitizeErrorMessage(fmt.Errorf("failed to read the scaffolding templates: %s", e.err)).Error()
+	}
+	return util.SanitizeErrorMessage(fmt.Errorf("failed to render the scaffolding template %q: %s", e.template, e.err)).Error()
+}
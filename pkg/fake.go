@@ -0,0 +1,1035 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jenkins-x/go-scm/scm"
+	gitopsv1alpha1 "github.com/redhat-developer/gitops-generator/api/v1alpha1"
+	"github.com/redhat-developer/gitops-generator/pkg/util"
+	"github.com/redhat-developer/gitops-generator/pkg/util/ioutils"
+	"github.com/spf13/afero"
+)
+
+// errFakeFailure is the cause of the errors scripted with FailNext that have none
+var errFakeFailure = errors.New("simulated failure")
+
+// FakeCall is a call to a method of the FakeGenerator
+type FakeCall struct {
+	// Method is the name of the method. The context aware variants are recorded under the name of the method they are
+	// the variant of, e.g. CommitAndPush for CommitAndPushWithContext.
+	Method string
+	// Args are the arguments of the call, in order, without the context
+	Args []interface{}
+}
+
+// FakeCommit is a commit of a remote simulated by the FakeGenerator
+type FakeCommit struct {
+	ID string
+	// Parent is the ID of the parent commit, empty for the first commit of the remote
+	Parent  string
+	Message string
+	Author  Identity
+	Date    time.Time
+	// Files holds the content of all the files of the repository as of the commit, keyed by their slash separated path
+	Files map[string][]byte
+}
+
+// fakeRemote is a repository simulated by the FakeGenerator
+type fakeRemote struct {
+	defaultBranch string
+	// branches holds the ID of the head commit of each branch
+	branches     map[string]string
+	commits      map[string]*FakeCommit
+	hooks        []*scm.Hook
+	pullRequests []*PullRequest
+}
+
+// files returns the files of the commit, none for an empty ID
+func (r *fakeRemote) files(id string) map[string][]byte {
+	if c := r.commits[id]; c != nil {
+		return c.Files
+	}
+	return map[string][]byte{}
+}
+
+// add adds a commit with the files on top of the parent commit
+func (r *fakeRemote) add(parent string, message string, author Identity, files map[string][]byte) *FakeCommit {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	hash := sha1.New()
+	fmt.Fprintf(hash, "%s\x00%s\x00%d", parent, message, len(r.commits))
+	for _, path := range paths {
+		fmt.Fprintf(hash, "\x00%s\x00%s", path, files[path])
+	}
+	commit := &FakeCommit{ID: fmt.Sprintf("%x", hash.Sum(nil)), Parent: parent, Message: message, Author: author, Date: time.Now(), Files: files}
+	r.commits[commit.ID] = commit
+	return commit
+}
+
+// isAncestor returns true if the commit is the descendant commit or one of its ancestors
+func (r *fakeRemote) isAncestor(id string, descendant string) bool {
+	for c := r.commits[descendant]; c != nil; c = r.commits[c.Parent] {
+		if c.ID == id {
+			return true
+		}
+	}
+	return id == ""
+}
+
+// fakeClone is a folder a branch of a remote is checked out in, by a clone or the push of a new repository
+type fakeClone struct {
+	fs afero.Afero
+	// head is the ID of the commit checked out in the folder, empty for an empty remote
+	head string
+}
+
+// FakeGenerator is an in-memory Generator for the unit tests of the consumers of the library. No git command nor Git
+// host API call is made: the remotes are simulated, so that the tests can check the content pushed to them rather
+// than the calls made.
+//
+// Cloning checks out the files of a branch of a remote in a folder, the resources are generated in the folder like Gen
+// does, and pushing commits the changes of the folder to the branch of the remote, on top of the changes pushed in the
+// meantime. The remotes are keyed by their URL without the token, and are created by GenerateAndPush or AddRemote.
+//
+// The calls are recorded, and the failures of the methods can be scripted with FailNext. A FakeGenerator is safe for
+// concurrent use, and is created with NewFakeGenerator.
+type FakeGenerator struct {
+	// Fs is the filesystem of the folders of the methods without a filesystem argument, e.g. CloneRepo and
+	// GitRemoveComponent. Those folders can be shared with the other methods by passing them the same filesystem.
+	Fs afero.Afero
+	// Hosts are the Git hosts the remotes are allowed to point to. Defaults to github.com and gitlab.com, like Gen.
+	Hosts *util.HostRegistry
+	// Author is the author of the commits
+	Author Identity
+	// CreatedBy is the Created-By trailer of the commits. Defaults to "application-service". GenerateAndPush uses its
+	// createdBy argument instead, when set.
+	CreatedBy string
+
+	mu       sync.Mutex
+	calls    []FakeCall
+	failures map[string][]error
+	remotes  map[string]*fakeRemote
+	clones   map[string]*fakeClone
+}
+
+var _ Generator = &FakeGenerator{}
+
+// NewFakeGenerator returns a FakeGenerator without any remote, whose folders are on a memory filesystem
+func NewFakeGenerator() *FakeGenerator {
+	return &FakeGenerator{
+		Fs:       ioutils.NewMemoryFilesystem(),
+		Author:   Identity{Name: "gitops-generator", Email: "gitops-generator@example.com"},
+		failures: map[string][]error{},
+		remotes:  map[string]*fakeRemote{},
+		clones:   map[string]*fakeClone{},
+	}
+}
+
+// createdBy returns the Created-By trailer of the commits
+func (f *FakeGenerator) createdBy() string {
+	return CommitOptions{CreatedBy: f.CreatedBy}.createdBy()
+}
+
+// fakeRemoteKey returns the URL of the remote without its token
+func fakeRemoteKey(remote string) string {
+	u, err := util.ParseRemote(remote)
+	if err != nil {
+		return remote
+	}
+	u.User = nil
+	return strings.TrimSuffix(strings.TrimSuffix(u.String(), "/"), ".git")
+}
+
+// AddRemote simulates an existing repository, e.g. to be cloned by CloneGenerateAndPush. The files, keyed by their
+// slash separated path, are committed to the branch, which is the default branch of the remote. The remote is left
+// empty when there are no files.
+func (f *FakeGenerator) AddRemote(remote string, branch string, files map[string][]byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := fakeRemoteKey(remote)
+	if _, ok := f.remotes[key]; ok {
+		return fmt.Errorf("the remote %s already exists", key)
+	}
+	r := &fakeRemote{defaultBranch: branch, branches: map[string]string{}, commits: map[string]*FakeCommit{}}
+	f.remotes[key] = r
+	if len(files) > 0 {
+		copied := map[string][]byte{}
+		for path, content := range files {
+			copied[path] = content
+		}
+		r.branches[branch] = r.add("", "Initial commit", f.Author, copied).ID
+	}
+	return nil
+}
+
+// AddWebhook registers the webhook on the remote. It is listed by ListWebhooks if its target is marked as managed by
+// the generator, with the managed-by=gitops-generator query parameter.
+func (f *FakeGenerator) AddWebhook(remote string, hook scm.Hook) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r := f.remotes[fakeRemoteKey(remote)]
+	if r == nil {
+		return fmt.Errorf("the remote %s does not exist", fakeRemoteKey(remote))
+	}
+	r.hooks = append(r.hooks, &hook)
+	return nil
+}
+
+// Commits returns the commits of the branch of the remote, the most recent first
+func (f *FakeGenerator) Commits(remote string, branch string) []FakeCommit {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r := f.remotes[fakeRemoteKey(remote)]
+	if r == nil {
+		return nil
+	}
+	var commits []FakeCommit
+	for c := r.commits[r.branches[branch]]; c != nil; c = r.commits[c.Parent] {
+		commits = append(commits, *c)
+	}
+	return commits
+}
+
+// Files returns the files of the branch of the remote, keyed by their slash separated path. nil is returned if the
+// branch does not exist.
+func (f *FakeGenerator) Files(remote string, branch string) map[string][]byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r := f.remotes[fakeRemoteKey(remote)]
+	if r == nil {
+		return nil
+	}
+	head, ok := r.branches[branch]
+	if !ok {
+		return nil
+	}
+	files := map[string][]byte{}
+	for path, content := range r.files(head) {
+		files[path] = content
+	}
+	return files
+}
+
+// PullRequests returns the pull requests opened on the remote, in the order they were opened
+func (f *FakeGenerator) PullRequests(remote string) []PullRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r := f.remotes[fakeRemoteKey(remote)]
+	if r == nil {
+		return nil
+	}
+	prs := make([]PullRequest, 0, len(r.pullRequests))
+	for _, pr := range r.pullRequests {
+		prs = append(prs, *pr)
+	}
+	return prs
+}
+
+// Calls returns the calls made so far, in order
+func (f *FakeGenerator) Calls() []FakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeCall(nil), f.calls...)
+}
+
+// FailNext makes the next call to the method, e.g. CommitAndPush, return the error without any side effect. The calls
+// are failed in the order the errors were scripted. The empty fields of the errors of this package, such as the
+// remote of a &GitPullError{}, are set from the arguments of the call.
+func (f *FakeGenerator) FailNext(method string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures[method] = append(f.failures[method], err)
+}
+
+// fakeFailure describes a call, to set the fields of its scripted error
+type fakeFailure struct {
+	path      string
+	remote    string
+	branch    string
+	component string
+	cmdType   GitCmd
+}
+
+// begin records the call to the method, and returns the scripted error of the call, if any, or the error of the
+// context. The lock of the FakeGenerator must be held.
+func (f *FakeGenerator) begin(ctx context.Context, method string, failure fakeFailure, args ...interface{}) error {
+	f.calls = append(f.calls, FakeCall{Method: method, Args: args})
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(f.failures[method]) == 0 {
+		return nil
+	}
+	err := f.failures[method][0]
+	f.failures[method] = f.failures[method][1:]
+	return failure.fill(err)
+}
+
+// fill sets the empty fields of the error, if it is one of the errors of this package
+func (c fakeFailure) fill(err error) error {
+	set := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+	cause := func(field *error) {
+		if *field == nil {
+			*field = errFakeFailure
+		}
+	}
+	repo, _ := repoFullName(c.remote)
+	switch e := err.(type) {
+	case *GitCmdError:
+		set(&e.path, c.path)
+		cause(&e.err)
+		if e.cmdType == "" {
+			e.cmdType = c.cmdType
+		}
+	case *GitBranchError:
+		set(&e.branch, c.branch)
+		set(&e.repoPath, c.path)
+		cause(&e.err)
+		if e.cmdType == "" {
+			e.cmdType = checkoutBranch
+		}
+	case *GitPullError:
+		set(&e.remote, c.remote)
+		cause(&e.err)
+	case *GitLsRemoteError:
+		set(&e.remote, c.remote)
+		cause(&e.err)
+	case *GitFetchError:
+		set(&e.remote, c.remote)
+		cause(&e.err)
+	case *GitRebaseConflictError:
+		set(&e.remote, c.remote)
+		set(&e.branch, c.branch)
+		cause(&e.err)
+	case *GitGenResourcesAndOverlaysError:
+		set(&e.path, c.path)
+		set(&e.componentName, c.component)
+		cause(&e.err)
+	case *DeleteFolderError:
+		set(&e.componentPath, filepath.Join(c.path, "components", c.component))
+		set(&e.repoPath, c.path)
+		cause(&e.err)
+	case *GitCreateRepoError:
+		org, name, _ := strings.Cut(repo, "/")
+		set(&e.org, org)
+		set(&e.repoName, name)
+		cause(&e.err)
+	case *GitAddFilesToRemoteError:
+		set(&e.componentName, c.component)
+		set(&e.remoteURL, c.remote)
+		set(&e.repoPath, c.path)
+		cause(&e.err)
+	case *GitAddFilesError:
+		set(&e.componentName, c.component)
+		set(&e.repoPath, c.path)
+		cause(&e.err)
+	case *GitOpsRepoGenError:
+		set(&e.gitopsURL, c.remote)
+		set(&e.errMsg, "failed to parse GitOps repo URL %q: %w")
+		cause(&e.err)
+	case *GitOpsRepoGenUserError:
+		cause(&e.err)
+	case *CommitSigningError:
+		set(&e.repoPath, c.path)
+		cause(&e.err)
+	case *CredentialsError:
+		set(&e.remote, c.remote)
+		cause(&e.err)
+	case *PullRequestError:
+		set(&e.remote, c.remote)
+		set(&e.sourceBranch, pullRequestBranch(c.component, ""))
+		set(&e.targetBranch, c.branch)
+		cause(&e.err)
+	case *RepositorySettingsError:
+		set(&e.repo, repo)
+		cause(&e.err)
+	case *WebhookError:
+		set(&e.repo, repo)
+		set(&e.action, "manage")
+		cause(&e.err)
+	case *ForeignRepositoryError:
+		set(&e.remote, c.remote)
+		set(&e.reason, "it holds commits that were not made by the generator")
+	case *ScaffoldError:
+		cause(&e.err)
+	}
+	return err
+}
+
+// validateRemote validates the remote against the Hosts of the FakeGenerator, like Gen
+func (f *FakeGenerator) validateRemote(remote string) error {
+	return Gen{Hosts: f.Hosts}.validateRemote(remote)
+}
+
+// clone checks out the branch of the remote in repoPath, like cloneRepo. The branch is created from the default branch
+// of the remote when it does not exist.
+func (f *FakeGenerator) clone(fs afero.Afero, repoPath string, remote string, branch string) error {
+	r := f.remotes[fakeRemoteKey(remote)]
+	if r == nil {
+		return &GitCmdError{path: filepath.Dir(repoPath), err: fmt.Errorf("repository %q not found", fakeRemoteKey(remote)), cmdType: cloneRepo}
+	}
+	if exists, _ := fs.Exists(repoPath); exists {
+		if empty, _ := fs.IsEmpty(repoPath); !empty {
+			return &GitCmdError{path: filepath.Dir(repoPath), err: fmt.Errorf("destination path %q already exists and is not an empty directory", repoPath), cmdType: cloneRepo}
+		}
+	}
+	head, ok := r.branches[branch]
+	if !ok {
+		head = r.branches[r.defaultBranch]
+	}
+	c := &fakeClone{fs: fs, head: head}
+	f.clones[repoPath] = c
+	return checkoutFiles(fs, repoPath, r.files(head))
+}
+
+// checkoutFiles replaces the content of repoPath with the files
+func checkoutFiles(fs afero.Afero, repoPath string, files map[string][]byte) error {
+	if err := fs.RemoveAll(repoPath); err != nil {
+		return err
+	}
+	if err := fs.MkdirAll(repoPath, 0755); err != nil {
+		return err
+	}
+	for path, content := range files {
+		if err := writeFile(fs, filepath.Join(repoPath, filepath.FromSlash(path)), content, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commit commits the changes of the folder on top of the branch of the remote, like commit, and pushes the commit to
+// the target branch. The message is rendered for the operation described by data when not nil, and the trailers are
+// appended to it. nil is returned if there is nothing to commit.
+func (f *FakeGenerator) commit(repoPath string, remote string, branch string, target string, message string, data *CommitMessageData, trailers []CommitTrailers, createdBy string) (*FakeCommit, error) {
+	c := f.clones[repoPath]
+	if c == nil {
+		return nil, &GitCmdError{path: repoPath, err: errors.New("not a git repository"), cmdType: checkGitDiff}
+	}
+	r := f.remotes[fakeRemoteKey(remote)]
+	if r == nil {
+		return nil, &GitLsRemoteError{remote: remote, err: fmt.Errorf("repository %q not found", fakeRemoteKey(remote))}
+	}
+	local, err := readTree(c.fs, repoPath)
+	if err != nil {
+		return nil, &GitAddFilesError{repoPath: repoPath, err: err}
+	}
+	base := r.files(c.head)
+	changed := changedFiles(base, local)
+	if len(changed) == 0 {
+		return nil, nil
+	}
+	if data != nil {
+		withFiles := *data
+		withFiles.Files = changed
+		if message, err = (CommitMessageTemplate{}).render(withFiles); err != nil {
+			return nil, err
+		}
+	}
+
+	// The changes are applied on top of the changes pushed to the branch in the meantime, like a pull. The commits
+	// that were not pushed to the branch, e.g. to the topic branch of a pull request, are kept when the branch did
+	// not change since.
+	head := r.branches[branch]
+	if r.isAncestor(head, c.head) {
+		head = c.head
+	}
+	remoteFiles := r.files(head)
+	files := map[string][]byte{}
+	for path, content := range remoteFiles {
+		files[path] = content
+	}
+	for _, path := range changed {
+		remoteContent, remoteOk := remoteFiles[path]
+		baseContent, baseOk := base[path]
+		localContent, localOk := local[path]
+		if head != c.head && (remoteOk != baseOk || !bytes.Equal(remoteContent, baseContent)) && (remoteOk != localOk || !bytes.Equal(remoteContent, localContent)) {
+			return nil, &GitPullError{remote: remote, err: fmt.Errorf("merge conflict in %s", path)}
+		}
+		if localOk {
+			files[path] = localContent
+		} else {
+			delete(files, path)
+		}
+	}
+	commit := r.add(head, withTrailers(message, trailers, createdBy), f.Author, files)
+	r.branches[target] = commit.ID
+	c.head = commit.ID
+	return commit, checkoutFiles(c.fs, repoPath, files)
+}
+
+// changedFiles returns the sorted paths of the files that differ between before and after
+func changedFiles(before map[string][]byte, after map[string][]byte) []string {
+	var changed []string
+	for path, content := range after {
+		if beforeContent, ok := before[path]; !ok || !bytes.Equal(beforeContent, content) {
+			changed = append(changed, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// CloneGenerateAndPush clones the remote to outputPath/<component>, generates the resources of the component in it and
+// pushes them to the branch when doPush is set, like Gen.CloneGenerateAndPush
+func (f *FakeGenerator) CloneGenerateAndPush(outputPath string, remote string, options gitopsv1alpha1.GeneratorOptions, appFs afero.Afero, branch string, repoContext string, doPush bool) error {
+	return f.CloneGenerateAndPushWithContext(context.Background(), outputPath, remote, options, appFs, branch, repoContext, doPush)
+}
+
+// CloneGenerateAndPushWithContext is the context aware variant of CloneGenerateAndPush
+func (f *FakeGenerator) CloneGenerateAndPushWithContext(ctx context.Context, outputPath string, remote string, options gitopsv1alpha1.GeneratorOptions, appFs afero.Afero, branch string, repoContext string, doPush bool) (err error) {
+	defer func() { err = checkCancelled(ctx, "CloneGenerateAndPush", err) }()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	componentName := options.Name
+	repoPath := filepath.Join(outputPath, componentName)
+	failure := fakeFailure{path: repoPath, remote: remote, branch: branch, component: componentName, cmdType: cloneRepo}
+	if err := f.begin(ctx, "CloneGenerateAndPush", failure, outputPath, remote, options, appFs, branch, repoContext, doPush); err != nil {
+		return err
+	}
+	if err := validateArgs(nameArg("component name", componentName), optionalNameArg("application name", options.Application), pathArg("context", repoContext)); err != nil {
+		return err
+	}
+	if err := f.validateRemote(remote); err != nil {
+		return err
+	}
+	if err := f.clone(appFs, repoPath, remote, branch); err != nil {
+		return err
+	}
+
+	gitopsFolder := filepath.Join(repoPath, repoContext)
+	componentPath := filepath.Join(gitopsFolder, "components", componentName, "base")
+	if err := removeAll(appFs, repoPath, filepath.Join("components", componentName, "base")); err != nil {
+		return &DeleteFolderError{componentPath: filepath.Join("components", componentName, "base"), repoPath: repoPath, err: err}
+	}
+	if err := Generate(appFs, gitopsFolder, componentPath, options); err != nil {
+		return &GitGenResourcesAndOverlaysError{path: componentPath, componentName: componentName, err: err}
+	}
+	if doPush {
+		trailers := []CommitTrailers{{Component: componentName, Application: options.Application, Image: options.ContainerImage}}
+		data := &CommitMessageData{Operation: GenerateBaseOperation, Component: componentName, Application: options.Application, Image: options.ContainerImage}
+		_, err := f.commit(repoPath, remote, branch, branch, "", data, trailers, f.createdBy())
+		return err
+	}
+	return nil
+}
+
+// CommitAndPush commits the changes of outputPath/<component>, or outputPath/<repoPathOverride> when set, and pushes
+// them to the branch, like Gen.CommitAndPush. The folder must have been cloned by the FakeGenerator.
+func (f *FakeGenerator) CommitAndPush(outputPath string, repoPathOverride string, remote string, componentName string, branch string, commitMessage string) error {
+	return f.CommitAndPushWithContext(context.Background(), outputPath, repoPathOverride, remote, componentName, branch, commitMessage)
+}
+
+// CommitAndPushWithContext is the context aware variant of CommitAndPush
+func (f *FakeGenerator) CommitAndPushWithContext(ctx context.Context, outputPath string, repoPathOverride string, remote string, componentName string, branch string, commitMessage string) (err error) {
+	defer func() { err = checkCancelled(ctx, "CommitAndPush", err) }()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	repoPath := fakeRepoPath(outputPath, repoPathOverride, componentName)
+	failure := fakeFailure{path: repoPath, remote: remote, branch: branch, component: componentName, cmdType: pushRemote}
+	if err := f.begin(ctx, "CommitAndPush", failure, outputPath, repoPathOverride, remote, componentName, branch, commitMessage); err != nil {
+		return err
+	}
+	if err := validateArgs(nameArg("component name", componentName), pathArg("repository path override", repoPathOverride)); err != nil {
+		return err
+	}
+	if err := f.validateRemote(remote); err != nil {
+		return err
+	}
+	_, err = f.commit(repoPath, remote, branch, branch, commitMessage, nil, []CommitTrailers{{Component: componentName}}, f.createdBy())
+	return err
+}
+
+// fakeRepoPath returns the folder of the repository of the component, like commitAndPush
+func fakeRepoPath(outputPath string, repoPathOverride string, componentName string) string {
+	if repoPathOverride != "" {
+		return filepath.Join(outputPath, repoPathOverride)
+	}
+	return filepath.Join(outputPath, componentName)
+}
+
+// GenerateAndPush generates the resources of the component in outputPath/<application>, and pushes them to a new
+// remote when doPush is set, like Gen.GenerateAndPush. It fails if the remote already exists.
+func (f *FakeGenerator) GenerateAndPush(outputPath string, remote string, options gitopsv1alpha1.GeneratorOptions, appFs afero.Afero, branch string, doPush bool, createdBy string) error {
+	return f.GenerateAndPushWithContext(context.Background(), outputPath, remote, options, appFs, branch, doPush, createdBy)
+}
+
+// GenerateAndPushWithContext is the context aware variant of GenerateAndPush
+func (f *FakeGenerator) GenerateAndPushWithContext(ctx context.Context, outputPath string, remote string, options gitopsv1alpha1.GeneratorOptions, appFs afero.Afero, branch string, doPush bool, createdBy string) (err error) {
+	defer func() { err = checkCancelled(ctx, "GenerateAndPush", err) }()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	componentName := options.Name
+	repoPath := filepath.Join(outputPath, options.Application)
+	failure := fakeFailure{path: repoPath, remote: remote, branch: branch, component: componentName, cmdType: pushRemote}
+	if err := f.begin(ctx, "GenerateAndPush", failure, outputPath, remote, options, appFs, branch, doPush, createdBy); err != nil {
+		return err
+	}
+	if err := validateArgs(nameArg("component name", componentName), optionalNameArg("application name", options.Application)); err != nil {
+		return err
+	}
+	componentPath := filepath.Join(repoPath, "components", componentName, "base")
+	if err := Generate(appFs, repoPath, componentPath, options); err != nil {
+		return &GitGenResourcesAndOverlaysError{path: componentPath, componentName: componentName, err: err}
+	}
+	if !doPush {
+		return nil
+	}
+	if err := f.validateRemote(remote); err != nil {
+		return err
+	}
+	key := fakeRemoteKey(remote)
+	if _, ok := f.remotes[key]; ok {
+		return fmt.Errorf("failed to create repository, repo already exists")
+	}
+	f.remotes[key] = &fakeRemote{defaultBranch: branch, branches: map[string]string{}, commits: map[string]*FakeCommit{}}
+	f.clones[repoPath] = &fakeClone{fs: appFs}
+	trailers := []CommitTrailers{{Component: componentName, Application: options.Application, Image: options.ContainerImage}}
+	data := &CommitMessageData{Operation: GenerateRepositoryOperation, Component: componentName, Application: options.Application, Image: options.ContainerImage}
+	if createdBy == "" {
+		createdBy = f.createdBy()
+	}
+	_, err = f.commit(repoPath, remote, branch, branch, "", data, trailers, createdBy)
+	return err
+}
+
+// GenerateOverlaysAndPush generates the overlays of the component for the environment in outputPath/<application>,
+// cloning the remote first when clone is set, and pushes them to the branch when doPush is set, like
+// Gen.GenerateOverlaysAndPush
+func (f *FakeGenerator) GenerateOverlaysAndPush(outputPath string, clone bool, remote string, options gitopsv1alpha1.GeneratorOptions, applicationName, environmentName, imageName, namespace string, appFs afero.Afero, branch string, repoContext string, doPush bool, componentGeneratedResources map[string][]string) error {
+	return f.GenerateOverlaysAndPushWithContext(context.Background(), outputPath, clone, remote, options, applicationName, environmentName, imageName, namespace, appFs, branch, repoContext, doPush, componentGeneratedResources)
+}
+
+// GenerateOverlaysAndPushWithContext is the context aware variant of GenerateOverlaysAndPush
+func (f *FakeGenerator) GenerateOverlaysAndPushWithContext(ctx context.Context, outputPath string, clone bool, remote string, options gitopsv1alpha1.GeneratorOptions, applicationName, environmentName, imageName, namespace string, appFs afero.Afero, branch string, repoContext string, doPush bool, componentGeneratedResources map[string][]string) (err error) {
+	defer func() { err = checkCancelled(ctx, "GenerateOverlaysAndPush", err) }()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	repoPath := filepath.Join(outputPath, applicationName)
+	failure := fakeFailure{path: repoPath, remote: remote, branch: branch, component: options.Name, cmdType: pushRemote}
+	if err := f.begin(ctx, "GenerateOverlaysAndPush", failure, outputPath, clone, remote, options, applicationName, environmentName, imageName, namespace, appFs, branch, repoContext, doPush, componentGeneratedResources); err != nil {
+		return err
+	}
+	if err := f.generateOverlays(repoPath, clone, remote, options, environmentName, imageName, namespace, appFs, branch, repoContext, doPush, componentGeneratedResources); err != nil {
+		return err
+	}
+	if doPush {
+		trailers := []CommitTrailers{{Component: options.Name, Application: applicationName, Environment: environmentName, Image: imageName}}
+		data := &CommitMessageData{Operation: GenerateOverlaysOperation, Component: options.Name, Application: applicationName, Environment: environmentName, Image: imageName}
+		_, err = f.commit(repoPath, remote, branch, branch, "", data, trailers, f.createdBy())
+	}
+	return err
+}
+
+// generateOverlays generates the overlays of the component for the environment in repoPath, cloning the remote first
+// when clone is set
+func (f *FakeGenerator) generateOverlays(repoPath string, clone bool, remote string, options gitopsv1alpha1.GeneratorOptions, environmentName, imageName, namespace string, appFs afero.Afero, branch string, repoContext string, doPush bool, componentGeneratedResources map[string][]string) error {
+	if err := validateArgs(nameArg("component name", options.Name), optionalNameArg("application name", filepath.Base(repoPath)), optionalNameArg("environment name", environmentName), pathArg("context", repoContext)); err != nil {
+		return err
+	}
+	if clone || doPush {
+		if err := f.validateRemote(remote); err != nil {
+			return err
+		}
+	}
+	if clone {
+		if err := f.clone(appFs, repoPath, remote, branch); err != nil {
+			return err
+		}
+	}
+	gitopsFolder := filepath.Join(repoPath, repoContext)
+	overlaysPath := filepath.Join(gitopsFolder, "components", options.Name, "overlays", environmentName)
+	if err := GenerateOverlays(appFs, gitopsFolder, overlaysPath, options, imageName, namespace, componentGeneratedResources); err != nil {
+		return &GitGenResourcesAndOverlaysError{path: overlaysPath, componentName: options.Name, err: err, cmdType: genOverlays}
+	}
+	return nil
+}
+
+// GitRemoveComponent clones the remote to outputPath/<component> on the Fs, removes the component and pushes the
+// removal to the branch, like Gen.GitRemoveComponent
+func (f *FakeGenerator) GitRemoveComponent(outputPath string, remote string, componentName string, branch string, repoContext string) error {
+	return f.GitRemoveComponentWithContext(context.Background(), outputPath, remote, componentName, branch, repoContext)
+}
+
+// GitRemoveComponentWithContext is the context aware variant of GitRemoveComponent
+func (f *FakeGenerator) GitRemoveComponentWithContext(ctx context.Context, outputPath string, remote string, componentName string, branch string, repoContext string) (err error) {
+	defer func() { err = checkCancelled(ctx, "GitRemoveComponent", err) }()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	repoPath := filepath.Join(outputPath, componentName)
+	failure := fakeFailure{path: repoPath, remote: remote, branch: branch, component: componentName, cmdType: cloneRepo}
+	if err := f.begin(ctx, "GitRemoveComponent", failure, outputPath, remote, componentName, branch, repoContext); err != nil {
+		return err
+	}
+	if err := validateArgs(nameArg("component name", componentName), pathArg("context", repoContext)); err != nil {
+		return err
+	}
+	if err := f.validateRemote(remote); err != nil {
+		return err
+	}
+	if err := f.clone(f.Fs, repoPath, remote, branch); err != nil {
+		return err
+	}
+	componentPath := filepath.Join(repoPath, repoContext, "components", componentName)
+	if err := removeAll(f.Fs, repoPath, componentPath); err != nil {
+		return &DeleteFolderError{componentPath: componentPath, repoPath: repoPath, err: err}
+	}
+	data := &CommitMessageData{Operation: RemoveComponentOperation, Component: componentName}
+	_, err = f.commit(repoPath, remote, branch, branch, "", data, []CommitTrailers{{Component: componentName}}, f.createdBy())
+	return err
+}
+
+// CloneRepo clones the remote to outputPath/<component> on the Fs, and checks out the branch, like Gen.CloneRepo
+func (f *FakeGenerator) CloneRepo(outputPath string, remote string, componentName string, branch string) error {
+	return f.CloneRepoWithContext(context.Background(), outputPath, remote, componentName, branch)
+}
+
+// CloneRepoWithContext is the context aware variant of CloneRepo
+func (f *FakeGenerator) CloneRepoWithContext(ctx context.Context, outputPath string, remote string, componentName string, branch string) (err error) {
+	defer func() { err = checkCancelled(ctx, "CloneRepo", err) }()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	repoPath := filepath.Join(outputPath, componentName)
+	failure := fakeFailure{path: repoPath, remote: remote, branch: branch, component: componentName, cmdType: cloneRepo}
+	if err := f.begin(ctx, "CloneRepo", failure, outputPath, remote, componentName, branch); err != nil {
+		return err
+	}
+	if err := validateArgs(nameArg("component name", componentName)); err != nil {
+		return err
+	}
+	if err := f.validateRemote(remote); err != nil {
+		return err
+	}
+	return f.clone(f.Fs, repoPath, remote, branch)
+}
+
+// GetCommitIDFromRepo returns the ID of the commit checked out in the folder
+func (f *FakeGenerator) GetCommitIDFromRepo(fs afero.Afero, repoPath string) (string, error) {
+	return f.GetCommitIDFromRepoWithContext(context.Background(), fs, repoPath)
+}
+
+// GetCommitIDFromRepoWithContext is the context aware variant of GetCommitIDFromRepo
+func (f *FakeGenerator) GetCommitIDFromRepoWithContext(ctx context.Context, fs afero.Afero, repoPath string) (commitID string, err error) {
+	defer func() { err = checkCancelled(ctx, "GetCommitIDFromRepo", err) }()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "GetCommitIDFromRepo", fakeFailure{path: repoPath, cmdType: getCommitID}, fs, repoPath); err != nil {
+		return "", err
+	}
+	c := f.clones[repoPath]
+	if c == nil || c.head == "" {
+		return "", &GitCmdError{path: repoPath, err: errors.New("ambiguous argument 'HEAD': unknown revision"), cmdType: getCommitID}
+	}
+	return c.head, nil
+}
+
+// CommitAndOpenPullRequest commits the changes like CommitAndPush, pushes them to a topic branch and opens a pull
+// request to the branch, like Gen.CommitAndOpenPullRequest. The pull requests are listed by PullRequests.
+func (f *FakeGenerator) CommitAndOpenPullRequest(outputPath string, repoPathOverride string, remote string, componentName string, branch string, commitMessage string, prOptions PullRequestOptions) (*PullRequest, error) {
+	return f.CommitAndOpenPullRequestWithContext(context.Background(), outputPath, repoPathOverride, remote, componentName, branch, commitMessage, prOptions)
+}
+
+// CommitAndOpenPullRequestWithContext is the context aware variant of CommitAndOpenPullRequest
+func (f *FakeGenerator) CommitAndOpenPullRequestWithContext(ctx context.Context, outputPath string, repoPathOverride string, remote string, componentName string, branch string, commitMessage string, prOptions PullRequestOptions) (pr *PullRequest, err error) {
+	defer func() { err = checkCancelled(ctx, "CommitAndOpenPullRequest", err) }()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	repoPath := fakeRepoPath(outputPath, repoPathOverride, componentName)
+	failure := fakeFailure{path: repoPath, remote: remote, branch: branch, component: componentName, cmdType: pushRemote}
+	if err := f.begin(ctx, "CommitAndOpenPullRequest", failure, outputPath, repoPathOverride, remote, componentName, branch, commitMessage, prOptions); err != nil {
+		return nil, err
+	}
+	if err := validateArgs(nameArg("component name", componentName), pathArg("repository path override", repoPathOverride)); err != nil {
+		return nil, err
+	}
+	return f.openPullRequest(repoPath, remote, componentName, "", branch, commitMessage, nil, []CommitTrailers{{Component: componentName}}, prOptions)
+}
+
+// GenerateOverlaysAndOpenPullRequest generates the overlays like GenerateOverlaysAndPush, and proposes them through a
+// pull request to the branch like CommitAndOpenPullRequest
+func (f *FakeGenerator) GenerateOverlaysAndOpenPullRequest(outputPath string, clone bool, remote string, options gitopsv1alpha1.GeneratorOptions, applicationName, environmentName, imageName, namespace string, appFs afero.Afero, branch string, repoContext string, componentGeneratedResources map[string][]string, prOptions PullRequestOptions) (*PullRequest, error) {
+	return f.GenerateOverlaysAndOpenPullRequestWithContext(context.Background(), outputPath, clone, remote, options, applicationName, environmentName, imageName, namespace, appFs, branch, repoContext, componentGeneratedResources, prOptions)
+}
+
+// GenerateOverlaysAndOpenPullRequestWithContext is the context aware variant of GenerateOverlaysAndOpenPullRequest
+func (f *FakeGenerator) GenerateOverlaysAndOpenPullRequestWithContext(ctx context.Context, outputPath string, clone bool, remote string, options gitopsv1alpha1.GeneratorOptions, applicationName, environmentName, imageName, namespace string, appFs afero.Afero, branch string, repoContext string, componentGeneratedResources map[string][]string, prOptions PullRequestOptions) (pr *PullRequest, err error) {
+	defer func() { err = checkCancelled(ctx, "GenerateOverlaysAndOpenPullRequest", err) }()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	repoPath := filepath.Join(outputPath, applicationName)
+	failure := fakeFailure{path: repoPath, remote: remote, branch: branch, component: options.Name, cmdType: pushRemote}
+	if err := f.begin(ctx, "GenerateOverlaysAndOpenPullRequest", failure, outputPath, clone, remote, options, applicationName, environmentName, imageName, namespace, appFs, branch, repoContext, componentGeneratedResources, prOptions); err != nil {
+		return nil, err
+	}
+	if err := f.generateOverlays(repoPath, clone, remote, options, environmentName, imageName, namespace, appFs, branch, repoContext, false, componentGeneratedResources); err != nil {
+		return nil, err
+	}
+	data := &CommitMessageData{Operation: GenerateOverlaysOperation, Component: options.Name, Application: applicationName, Environment: environmentName, Image: imageName}
+	trailers := []CommitTrailers{{Component: options.Name, Application: applicationName, Environment: environmentName, Image: imageName}}
+	return f.openPullRequest(repoPath, remote, options.Name, environmentName, branch, "", data, trailers, prOptions)
+}
+
+// openPullRequest commits the changes of the folder to the topic branch, and opens a pull request from it to the
+// branch, or updates the one already open. nil is returned when there is nothing to commit.
+func (f *FakeGenerator) openPullRequest(repoPath string, remote string, componentName string, environmentName string, branch string, commitMessage string, data *CommitMessageData, trailers []CommitTrailers, prOptions PullRequestOptions) (*PullRequest, error) {
+	if err := f.validateRemote(remote); err != nil {
+		return nil, err
+	}
+	sourceBranch := prOptions.SourceBranch
+	if sourceBranch == "" {
+		sourceBranch = pullRequestBranch(componentName, environmentName)
+	}
+	commit, err := f.commit(repoPath, remote, branch, sourceBranch, commitMessage, data, trailers, f.createdBy())
+	if err != nil || commit == nil {
+		return nil, err
+	}
+
+	r := f.remotes[fakeRemoteKey(remote)]
+	for _, pr := range r.pullRequests {
+		if pr.SourceBranch == sourceBranch && pr.TargetBranch == branch {
+			updated := *pr
+			updated.Updated = true
+			return &updated, nil
+		}
+	}
+	pr := &PullRequest{
+		Number:       len(r.pullRequests) + 1,
+		URL:          fmt.Sprintf("%s/pull/%d", fakeRemoteKey(remote), len(r.pullRequests)+1),
+		SourceBranch: sourceBranch,
+		TargetBranch: branch,
+	}
+	r.pullRequests = append(r.pullRequests, pr)
+	opened := *pr
+	return &opened, nil
+}
+
+// GetCommitHistory returns the changes made by the generator, parsed from the commits checked out in the folder, the
+// most recent first, like Gen.GetCommitHistory
+func (f *FakeGenerator) GetCommitHistory(repoPath string, repoContext string, options CommitHistoryOptions) ([]GeneratorCommit, error) {
+	return f.GetCommitHistoryWithContext(context.Background(), repoPath, repoContext, options)
+}
+
+// GetCommitHistoryWithContext is the context aware variant of GetCommitHistory
+func (f *FakeGenerator) GetCommitHistoryWithContext(ctx context.Context, repoPath string, repoContext string, options CommitHistoryOptions) (history []GeneratorCommit, err error) {
+	defer func() { err = checkCancelled(ctx, "GetCommitHistory", err) }()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "GetCommitHistory", fakeFailure{path: repoPath, cmdType: listCommits}, repoPath, repoContext, options); err != nil {
+		return nil, err
+	}
+	if err := validateArgs(pathArg("context", repoContext)); err != nil {
+		return nil, err
+	}
+	c := f.clones[repoPath]
+	if c == nil {
+		return nil, &GitCmdError{path: repoPath, err: errors.New("not a git repository"), cmdType: listCommits}
+	}
+	for commit := f.commitOf(c.head); commit != nil; commit = f.commitOf(commit.Parent) {
+		for _, change := range parseGeneratorChanges(commit.Message) {
+			if !options.matches(change) {
+				continue
+			}
+			change.CommitID, change.Author, change.Date = commit.ID, commit.Author, commit.Date
+			if content, ok := commit.Files[imageFile(repoContext, change)]; ok {
+				if change.Image, err = deploymentImage(content); err != nil {
+					return nil, &GitCmdError{path: repoPath, err: err, cmdType: listCommits}
+				}
+			}
+			history = append(history, change)
+			if options.MaxCount > 0 && len(history) == options.MaxCount {
+				return history, nil
+			}
+		}
+	}
+	return history, nil
+}
+
+// commitOf returns the commit with the ID, or whose ID starts with it, in any of the remotes. nil is returned if there
+// is none.
+func (f *FakeGenerator) commitOf(id string) *FakeCommit {
+	if id == "" {
+		return nil
+	}
+	for _, r := range f.remotes {
+		if c := r.commits[id]; c != nil {
+			return c
+		}
+		for commitID, c := range r.commits {
+			if strings.HasPrefix(commitID, id) {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// RevertCommit reverts a commit made by the generator on top of the branch, and pushes the revert to the remote, like
+// Gen.RevertCommit
+func (f *FakeGenerator) RevertCommit(repoPath string, remote string, branch string, commitID string) error {
+	return f.RevertCommitWithContext(context.Background(), repoPath, remote, branch, commitID)
+}
+
+// RevertCommitWithContext is the context aware variant of RevertCommit
+func (f *FakeGenerator) RevertCommitWithContext(ctx context.Context, repoPath string, remote string, branch string, commitID string) (err error) {
+	defer func() { err = checkCancelled(ctx, "RevertCommit", err) }()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	failure := fakeFailure{path: repoPath, remote: remote, branch: branch, cmdType: revertCommit}
+	if err := f.begin(ctx, "RevertCommit", failure, repoPath, remote, branch, commitID); err != nil {
+		return err
+	}
+	if err := validateArgs(commitIDArg("commit ID", commitID)); err != nil {
+		return err
+	}
+	if err := f.validateRemote(remote); err != nil {
+		return err
+	}
+	c := f.clones[repoPath]
+	r := f.remotes[fakeRemoteKey(remote)]
+	if c == nil || r == nil {
+		return &GitCmdError{path: repoPath, err: errors.New("not a git repository"), cmdType: listCommits}
+	}
+	commit := f.commitOf(commitID)
+	if commit == nil {
+		return &GitCmdError{path: repoPath, err: fmt.Errorf("ambiguous argument '%s': unknown revision", commitID), cmdType: listCommits}
+	}
+	reverted := parseGeneratorChanges(commit.Message)
+	if len(reverted) == 0 {
+		return &GitCmdError{path: repoPath, err: fmt.Errorf("commit %s was not made by the generator", commitID), cmdType: revertCommit}
+	}
+	for i := range reverted {
+		reverted[i].CommitID = commit.ID
+	}
+
+	head := r.branches[branch]
+	files := map[string][]byte{}
+	for path, content := range r.files(head) {
+		files[path] = content
+	}
+	parentFiles := r.files(commit.Parent)
+	for _, path := range changedFiles(parentFiles, commit.Files) {
+		content, ok := files[path]
+		committed, committedOk := commit.Files[path]
+		if ok != committedOk || !bytes.Equal(content, committed) {
+			return &GitCmdError{path: repoPath, err: fmt.Errorf("could not revert %s, %s was changed since", commit.ID[:7], path), cmdType: revertCommit}
+		}
+		if parentContent, ok := parentFiles[path]; ok {
+			files[path] = parentContent
+		} else {
+			delete(files, path)
+		}
+	}
+	trailers := make([]CommitTrailers, 0, len(reverted))
+	for _, change := range reverted {
+		trailers = append(trailers, CommitTrailers{Component: change.Component, Environment: change.Environment})
+	}
+	revert := r.add(head, withTrailers(revertMessage(reverted), trailers, f.createdBy()), f.Author, files)
+	r.branches[branch] = revert.ID
+	c.head = revert.ID
+	return checkoutFiles(c.fs, repoPath, files)
+}
+
+// ListWebhooks returns the webhooks of the remote marked as managed by the generator, like Gen.ListWebhooks
+func (f *FakeGenerator) ListWebhooks(remote string) ([]*scm.Hook, error) {
+	return f.ListWebhooksWithContext(context.Background(), remote)
+}
+
+// ListWebhooksWithContext is the context aware variant of ListWebhooks
+func (f *FakeGenerator) ListWebhooksWithContext(ctx context.Context, remote string) (hooks []*scm.Hook, err error) {
+	defer func() { err = checkCancelled(ctx, "ListWebhooks", err) }()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "ListWebhooks", fakeFailure{remote: remote}, remote); err != nil {
+		return nil, err
+	}
+	r, err := f.webhookRemote(remote, "list")
+	if err != nil {
+		return nil, err
+	}
+	for _, hook := range r.hooks {
+		if isManagedWebhook(hook) {
+			copied := *hook
+			hooks = append(hooks, &copied)
+		}
+	}
+	return hooks, nil
+}
+
+// RemoveWebhooks removes the webhooks of the remote marked as managed by the generator, like Gen.RemoveWebhooks
+func (f *FakeGenerator) RemoveWebhooks(remote string) error {
+	return f.RemoveWebhooksWithContext(context.Background(), remote)
+}
+
+// RemoveWebhooksWithContext is the context aware variant of RemoveWebhooks
+func (f *FakeGenerator) RemoveWebhooksWithContext(ctx context.Context, remote string) (err error) {
+	defer func() { err = checkCancelled(ctx, "RemoveWebhooks", err) }()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "RemoveWebhooks", fakeFailure{remote: remote}, remote); err != nil {
+		return err
+	}
+	r, err := f.webhookRemote(remote, "remove")
+	if err != nil {
+		return err
+	}
+	var kept []*scm.Hook
+	for _, hook := range r.hooks {
+		if !isManagedWebhook(hook) {
+			kept = append(kept, hook)
+		}
+	}
+	r.hooks = kept
+	return nil
+}
+
+// webhookRemote returns the remote whose webhooks the action is performed on
+func (f *FakeGenerator) webhookRemote(remote string, action string) (*fakeRemote, error) {
+	if err := f.validateRemote(remote); err != nil {
+		return nil, err
+	}
+	repo, err := repoFullName(remote)
+	if err != nil {
+		return nil, err
+	}
+	r := f.remotes[fakeRemoteKey(remote)]
+	if r == nil {
+		return nil, &WebhookError{repo: repo, action: action, err: errors.New("Not Found")}
+	}
+	return r, nil
+}
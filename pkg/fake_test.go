@@ -0,0 +1,205 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jenkins-x/go-scm/scm"
+	gitopsv1alpha1 "github.com/redhat-developer/gitops-generator/api/v1alpha1"
+	"github.com/redhat-developer/gitops-generator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+const fakeGitOpsRemote = "https://token@github.com/shop/gitops.git"
+
+// fakeComponent returns the options of the component of the shop application
+func fakeComponent(name string, image string) gitopsv1alpha1.GeneratorOptions {
+	options := gitopsv1alpha1.GeneratorOptions{ContainerImage: image, TargetPort: 5000}
+	options.Name, options.Application = name, "shop"
+	return options
+}
+
+func TestFakeGenerator(t *testing.T) {
+	fake := NewFakeGenerator()
+	var generator Generator = fake
+
+	// The repository is created by GenerateAndPush, and components are added to clones of it
+	testutils.AssertNoError(t, generator.GenerateAndPush("/generated", fakeGitOpsRemote, fakeComponent("frontend", "quay.io/shop/frontend:v1"), fake.Fs, "main", true, "KAM CLI"))
+	err := generator.GenerateAndPush("/again", fakeGitOpsRemote, fakeComponent("frontend", "quay.io/shop/frontend:v1"), fake.Fs, "main", true, "KAM CLI")
+	testutils.AssertErrorMatch(t, "repo already exists", err)
+	testutils.AssertNoError(t, generator.CloneGenerateAndPush("/cloned", fakeGitOpsRemote, fakeComponent("backend", "quay.io/shop/backend:v1"), fake.Fs, "main", "", true))
+	testutils.AssertNoError(t, generator.GenerateOverlaysAndPush("/overlays", true, fakeGitOpsRemote, fakeComponent("backend", ""), "shop", "prod", "quay.io/shop/backend:v2", "shop-prod", fake.Fs, "main", "", true, nil))
+
+	files := fake.Files("https://github.com/shop/gitops", "main")
+	assert.Contains(t, files, "components/frontend/base/deployment.yaml")
+	assert.Contains(t, files, "components/backend/base/deployment.yaml")
+	assert.Contains(t, files, "components/backend/overlays/prod/deployment-patch.yaml")
+	commits := fake.Commits(fakeGitOpsRemote, "main")
+	assert.Len(t, commits, 3)
+	assert.Contains(t, commits[0].Message, "Environment: prod\n")
+
+	// The changes of the generator are read from the history of a clone
+	testutils.AssertNoError(t, generator.CloneRepo("/history", fakeGitOpsRemote, "shop", "main"))
+	history, err := generator.GetCommitHistory("/history/shop", "", CommitHistoryOptions{Component: "backend"})
+	testutils.AssertNoError(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, "prod", history[0].Environment)
+	assert.Equal(t, "quay.io/shop/backend:v2", history[0].Image)
+	assert.Equal(t, "quay.io/shop/backend:v1", history[1].Image)
+	id, err := generator.GetCommitIDFromRepo(fake.Fs, "/history/shop")
+	testutils.AssertNoError(t, err)
+	assert.Equal(t, commits[0].ID, id)
+
+	// Reverting the overlays removes them from the remote
+	testutils.AssertNoError(t, generator.RevertCommit("/history/shop", fakeGitOpsRemote, "main", history[0].CommitID[:7]))
+	assert.NotContains(t, fake.Files(fakeGitOpsRemote, "main"), "components/backend/overlays/prod/deployment-patch.yaml")
+	assert.Contains(t, fake.Commits(fakeGitOpsRemote, "main")[0].Message, "This reverts commit "+history[0].CommitID)
+
+	// Removing a component, then committing changes made outside of the generator
+	testutils.AssertNoError(t, generator.GitRemoveComponent("/removed", fakeGitOpsRemote, "frontend", "main", ""))
+	assert.NotContains(t, fake.Files(fakeGitOpsRemote, "main"), "components/frontend/base/deployment.yaml")
+	testutils.AssertNoError(t, fake.Fs.WriteFile("/cloned/backend/README.md", []byte("# Backend\n"), 0644))
+	testutils.AssertNoError(t, generator.CommitAndPush("/cloned", "", fakeGitOpsRemote, "backend", "main", "Document the backend"))
+	assert.Equal(t, "# Backend\n", string(fake.Files(fakeGitOpsRemote, "main")["README.md"]))
+	assert.NotContains(t, fake.Files(fakeGitOpsRemote, "main"), "components/frontend/base/deployment.yaml", "the changes pushed in the meantime should be kept")
+	testutils.AssertNoError(t, generator.CommitAndPush("/cloned", "", fakeGitOpsRemote, "backend", "main", "Nothing to commit"))
+	assert.Len(t, fake.Commits(fakeGitOpsRemote, "main"), 6)
+
+	calls := fake.Calls()
+	assert.Equal(t, "GenerateAndPush", calls[0].Method)
+	assert.Equal(t, []interface{}{"/cloned", "", fakeGitOpsRemote, "backend", "main", "Nothing to commit"}, calls[len(calls)-1].Args)
+}
+
+func TestFakeGeneratorPullRequests(t *testing.T) {
+	fake := NewFakeGenerator()
+	testutils.AssertNoError(t, fake.AddRemote(fakeGitOpsRemote, "main", map[string][]byte{"README.md": []byte("# Shop\n")}))
+
+	testutils.AssertNoError(t, fake.CloneRepo("/output", fakeGitOpsRemote, "backend", "main"))
+	pr, err := fake.GenerateOverlaysAndOpenPullRequest("/output", false, fakeGitOpsRemote, fakeComponent("backend", ""), "backend", "prod", "quay.io/shop/backend:v2", "", fake.Fs, "main", "", nil, PullRequestOptions{})
+	testutils.AssertNoError(t, err)
+	assert.Equal(t, PullRequest{Number: 1, URL: "https://github.com/shop/gitops/pull/1", SourceBranch: "gitops-generator/environments/prod/backend", TargetBranch: "main"}, *pr)
+	assert.Contains(t, fake.Files(fakeGitOpsRemote, pr.SourceBranch), "components/backend/overlays/prod/kustomization.yaml")
+	assert.NotContains(t, fake.Files(fakeGitOpsRemote, "main"), "components/backend/overlays/prod/kustomization.yaml")
+
+	// The open pull request is updated, and nothing is proposed without changes
+	testutils.AssertNoError(t, fake.Fs.WriteFile("/output/backend/NOTES.md", []byte("Rolled out to prod\n"), 0644))
+	pr, err = fake.CommitAndOpenPullRequest("/output", "", fakeGitOpsRemote, "backend", "main", "Add notes", PullRequestOptions{SourceBranch: "gitops-generator/environments/prod/backend"})
+	testutils.AssertNoError(t, err)
+	assert.True(t, pr.Updated)
+	assert.Contains(t, fake.Files(fakeGitOpsRemote, pr.SourceBranch), "components/backend/overlays/prod/kustomization.yaml")
+	assert.Contains(t, fake.Files(fakeGitOpsRemote, pr.SourceBranch), "NOTES.md")
+	pr, err = fake.CommitAndOpenPullRequest("/output", "", fakeGitOpsRemote, "backend", "main", "Add notes", PullRequestOptions{SourceBranch: "gitops-generator/environments/prod/backend"})
+	testutils.AssertNoError(t, err)
+	assert.Nil(t, pr)
+	assert.Len(t, fake.PullRequests(fakeGitOpsRemote), 1)
+
+	// Only the commits of the generator can be reverted
+	initial := fake.Commits(fakeGitOpsRemote, "main")[0].ID
+	err = fake.RevertCommit("/output/backend", fakeGitOpsRemote, "main", initial)
+	testutils.AssertErrorMatch(t, "was not made by the generator", err)
+}
+
+func TestFakeGeneratorWebhooks(t *testing.T) {
+	fake := NewFakeGenerator()
+	testutils.AssertNoError(t, fake.AddRemote(fakeGitOpsRemote, "main", nil))
+	testutils.AssertNoError(t, fake.AddWebhook(fakeGitOpsRemote, scm.Hook{ID: "1", Target: "https://argocd.example.com/api/webhook?managed-by=gitops-generator"}))
+	testutils.AssertNoError(t, fake.AddWebhook(fakeGitOpsRemote, scm.Hook{ID: "2", Target: "https://ci.example.com/hook"}))
+
+	hooks, err := fake.ListWebhooks(fakeGitOpsRemote)
+	testutils.AssertNoError(t, err)
+	assert.Len(t, hooks, 1)
+	testutils.AssertNoError(t, fake.RemoveWebhooks(fakeGitOpsRemote))
+	hooks, err = fake.ListWebhooks(fakeGitOpsRemote)
+	testutils.AssertNoError(t, err)
+	assert.Empty(t, hooks)
+	_, err = fake.ListWebhooks("https://github.com/shop/unknown")
+	testutils.AssertErrorMatch(t, "failed to list the webhooks of repository \"shop/unknown\"", err)
+}
+
+func TestFakeGeneratorFailures(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		err           error
+		call          func(f *FakeGenerator) error
+		wantErrString string
+	}{
+		{
+			name:   "Pull error with the remote of the call",
+			method: "CommitAndPush",
+			err:    &GitPullError{},
+			call: func(f *FakeGenerator) error {
+				return f.CommitAndPush("/output", "", fakeGitOpsRemote, "backend", "main", "Update")
+			},
+			wantErrString: "failed to pull from remote .*github.com/shop/gitops.git.*: simulated failure",
+		},
+		{
+			name:   "Clone error with the path and command of the call",
+			method: "CloneRepo",
+			err:    &GitCmdError{},
+			call: func(f *FakeGenerator) error {
+				return f.CloneRepo("/output", fakeGitOpsRemote, "backend", "main")
+			},
+			wantErrString: "/output/backend.*: simulated failure",
+		},
+		{
+			name:   "Branch error with its own cause",
+			method: "CloneGenerateAndPush",
+			err:    &GitBranchError{err: errors.New("invalid reference")},
+			call: func(f *FakeGenerator) error {
+				return f.CloneGenerateAndPush("/output", fakeGitOpsRemote, fakeComponent("backend", ""), f.Fs, "release", "", true)
+			},
+			wantErrString: "release.*invalid reference",
+		},
+		{
+			name:   "Other errors are returned as is",
+			method: "GitRemoveComponent",
+			err:    errors.New("remote unavailable"),
+			call: func(f *FakeGenerator) error {
+				return f.GitRemoveComponent("/output", fakeGitOpsRemote, "backend", "main", "")
+			},
+			wantErrString: "remote unavailable",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := NewFakeGenerator()
+			testutils.AssertNoError(t, fake.AddRemote(fakeGitOpsRemote, "main", map[string][]byte{"README.md": []byte("# Shop\n")}))
+			fake.FailNext(tt.method, tt.err)
+
+			err := tt.call(fake)
+			testutils.AssertErrorMatch(t, tt.wantErrString, err)
+			assert.Same(t, tt.err, err)
+			assert.Len(t, fake.Commits(fakeGitOpsRemote, "main"), 1, "the failed call should have no side effect")
+			exists, _ := fake.Fs.Exists("/output")
+			assert.False(t, exists, "the failed call should have no side effect")
+		})
+	}
+}
+
+func TestFakeGeneratorCancelled(t *testing.T) {
+	fake := NewFakeGenerator()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := fake.CloneRepoWithContext(ctx, "/output", fakeGitOpsRemote, "backend", "main")
+	var cancelled *OperationCancelledError
+	assert.True(t, errors.As(err, &cancelled), "unexpected error %v", err)
+	assert.Equal(t, []FakeCall{{Method: "CloneRepo", Args: []interface{}{"/output", fakeGitOpsRemote, "backend", "main"}}}, fake.Calls())
+}
@@ -42,15 +42,31 @@ const (
 	otherFileName           = "other_resources.yaml"
 )
 
+// CreatedBy is the app.kubernetes.io/created-by label of the generated resources. GenerateAndPush labels them with its
+// createdBy argument instead, when set.
 var CreatedBy = "application-service"
 
 // Generate takes in a given Component CR and
 // spits out a deployment, service, and route file to disk
 func Generate(fs afero.Afero, gitOpsFolder string, outputFolder string, component gitopsv1alpha1.GeneratorOptions) error {
+	return generate(fs, gitOpsFolder, outputFolder, component, CreatedBy)
+}
+
+// generateComponent runs Generate, labelling the resources with the createdBy of the call
+func (s Gen) generateComponent(fs afero.Afero, gitOpsFolder string, outputFolder string, component gitopsv1alpha1.GeneratorOptions) error {
+	createdBy := s.createdBy
+	if createdBy == "" {
+		createdBy = CreatedBy
+	}
+	return generate(fs, gitOpsFolder, outputFolder, component, createdBy)
+}
+
+// generate runs Generate, labelling the resources as created by createdBy
+func generate(fs afero.Afero, gitOpsFolder string, outputFolder string, component gitopsv1alpha1.GeneratorOptions, createdBy string) error {
 
 	var deployment *appsv1.Deployment
 	if len(component.KubernetesResources.Deployments) == 0 {
-		deployment = generateDeployment(component)
+		deployment = generateDeployment(component, createdBy)
 	} else if len(component.KubernetesResources.Deployments) > 0 {
 		deployment, component.KubernetesResources.Deployments = &component.KubernetesResources.Deployments[0], component.KubernetesResources.Deployments[1:]
 		var otherDeployments []interface{}
@@ -76,7 +92,7 @@ func Generate(fs afero.Afero, gitOpsFolder string, outputFolder string, componen
 	if len(component.KubernetesResources.Services) == 0 && component.TargetPort != 0 {
 		// If service was not provided, generate a service only if target port was provided
 		// If service was not provided and target port is 0, skip generation
-		service = generateService(component)
+		service = generateService(component, createdBy)
 	} else if len(component.KubernetesResources.Services) > 0 {
 		// If a service was provided, get the first and append the rest to others
 		service, component.KubernetesResources.Services = &component.KubernetesResources.Services[0], component.KubernetesResources.Services[1:]
@@ -92,7 +108,7 @@ func Generate(fs afero.Afero, gitOpsFolder string, outputFolder string, componen
 	if len(component.KubernetesResources.Routes) == 0 && component.TargetPort != 0 {
 		// If route was not provided, generate a route only if target port was provided
 		// If route was not provided and target port is 0, skip generation
-		route = generateRoute(component)
+		route = generateRoute(component, createdBy)
 	} else if len(component.KubernetesResources.Routes) > 0 {
 		// If a route was provided, get the first and append the rest to others
 		route, component.KubernetesResources.Routes = &component.KubernetesResources.Routes[0], component.KubernetesResources.Routes[1:]
@@ -227,13 +243,13 @@ func UpdateExistingKustomize(fs afero.Afero, outputFolder string) error {
 	return err
 }
 
-func generateDeployment(component gitopsv1alpha1.GeneratorOptions) *appsv1.Deployment {
+func generateDeployment(component gitopsv1alpha1.GeneratorOptions, createdBy string) *appsv1.Deployment {
 	var containerImage string
 	if component.ContainerImage != "" {
 		containerImage = component.ContainerImage
 	}
 	replicas := getReplicas(component)
-	k8sLabels := generateK8sLabels(component)
+	k8sLabels := generateK8sLabels(component, createdBy)
 	matchLabels := getMatchLabel(component)
 	deployment := appsv1.Deployment{
 		TypeMeta: v1.TypeMeta{
@@ -371,8 +387,8 @@ func generateDeploymentPatch(options gitopsv1alpha1.GeneratorOptions, imageName,
 	return &deployment
 }
 
-func generateService(options gitopsv1alpha1.GeneratorOptions) *corev1.Service {
-	k8sLabels := generateK8sLabels(options)
+func generateService(options gitopsv1alpha1.GeneratorOptions, createdBy string) *corev1.Service {
+	k8sLabels := generateK8sLabels(options, createdBy)
 	matchLabels := getMatchLabel(options)
 	service := corev1.Service{
 		TypeMeta: v1.TypeMeta{
@@ -398,14 +414,14 @@ func generateService(options gitopsv1alpha1.GeneratorOptions) *corev1.Service {
 	return &service
 }
 
-func generateRoute(options gitopsv1alpha1.GeneratorOptions) *routev1.Route {
+func generateRoute(options gitopsv1alpha1.GeneratorOptions, createdBy string) *routev1.Route {
 	// Trim the generated route name to under 30 characters (plus a few random characters for uniqueness)
 	// To ensure issues where the generated hostname (componentName-namespace) is too long
 	routeName := options.Name
 	if len(routeName) >= 30 {
 		routeName = routeName[0:25] + util.GetRandomString(4, true)
 	}
-	k8sLabels := generateK8sLabels(options)
+	k8sLabels := generateK8sLabels(options, createdBy)
 	weight := int32(100)
 	route := routev1.Route{
 		TypeMeta: v1.TypeMeta{
@@ -456,8 +472,8 @@ func getReplicas(options gitopsv1alpha1.GeneratorOptions) int32 {
 // app.kubernetes.io/instance: "<component-cr-name>"
 // app.kubernetes.io/part-of: "<application-name>"
 // app.kubernetes.io/managed-by: "kustomize"
-// app.kubernetes.io/created-by: "application-service"
-func generateK8sLabels(options gitopsv1alpha1.GeneratorOptions) map[string]string {
+// app.kubernetes.io/created-by: "<created-by>", CreatedBy unless set otherwise
+func generateK8sLabels(options gitopsv1alpha1.GeneratorOptions, createdBy string) map[string]string {
 	if options.K8sLabels != nil {
 		return options.K8sLabels
 	}
@@ -466,7 +482,7 @@ func generateK8sLabels(options gitopsv1alpha1.GeneratorOptions) map[string]strin
 		"app.kubernetes.io/instance":   options.Name,
 		"app.kubernetes.io/part-of":    options.Application,
 		"app.kubernetes.io/managed-by": "kustomize",
-		"app.kubernetes.io/created-by": CreatedBy,
+		"app.kubernetes.io/created-by": createdBy,
 	}
 }
 
@@ -298,7 +298,7 @@ func TestGenerateDeployment(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			generatedDeployment := generateDeployment(tt.component)
+			generatedDeployment := generateDeployment(tt.component, CreatedBy)
 
 			if !reflect.DeepEqual(*generatedDeployment, tt.wantDeployment) {
 				t.Errorf("TestGenerateDeployment() error: expected %v got %v", tt.wantDeployment, generatedDeployment)
@@ -495,7 +495,7 @@ func TestGenerateService(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			generatedService := generateService(tt.component)
+			generatedService := generateService(tt.component, CreatedBy)
 
 			if !reflect.DeepEqual(*generatedService, tt.wantService) {
 				t.Errorf("TestGenerateService() error: expected %v got %v", tt.wantService, generatedService)
@@ -652,7 +652,7 @@ func TestGenerateRoute(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			generatedRoute := generateRoute(tt.component)
+			generatedRoute := generateRoute(tt.component, CreatedBy)
 			if len(generatedRoute.Name) > 30 {
 				t.Errorf("TestGenerateRoute() error: expected CR name of length 30, got %v", len(generatedRoute.Name))
 			}
@@ -1152,15 +1152,15 @@ func TestGenerate(t *testing.T) {
 
 			// if resources are generated, add the generated resources to the wantFiles list
 			if tt.isDeploymentGenerated {
-				tt.wantFiles[deploymentFileName] = generateDeployment(tt.component)
+				tt.wantFiles[deploymentFileName] = generateDeployment(tt.component, CreatedBy)
 			}
 
 			if tt.isServicetGenerated {
-				tt.wantFiles[serviceFileName] = generateService(tt.component)
+				tt.wantFiles[serviceFileName] = generateService(tt.component, CreatedBy)
 			}
 
 			if tt.isRouteGenerated {
-				tt.wantFiles[routeFileName] = generateRoute(tt.component)
+				tt.wantFiles[routeFileName] = generateRoute(tt.component, CreatedBy)
 			}
 
 			// serialize array interface to match file contents
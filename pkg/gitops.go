@@ -17,19 +17,21 @@ package gitops
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/url"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 
 	"github.com/go-logr/logr"
 	"github.com/redhat-developer/gitops-generator/pkg/util"
+	"github.com/redhat-developer/gitops-generator/pkg/util/ioutils"
 	"go.uber.org/zap/zapcore"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	"github.com/jenkins-x/go-scm/scm"
-	"github.com/jenkins-x/go-scm/scm/factory"
 
 	gitopsv1alpha1 "github.com/redhat-developer/gitops-generator/api/v1alpha1"
 	"github.com/spf13/afero"
@@ -40,47 +42,158 @@ const defaultRepoDescription = "Bootstrapped GitOps Repository based on Componen
 type CommandType string
 
 const (
-	GitCommand        CommandType = "git"
+	GitCommand CommandType = "git"
+	// RmCommand is still run by ExecExecutor and GoGitExecutor, but no longer issued by Gen
 	RmCommand         CommandType = "rm"
 	unsupportedCmdMsg             = "Unsupported command \"%s\" "
 )
 
 type Generator interface {
-	CloneGenerateAndPush(outputPath string, remote string, options gitopsv1alpha1.GeneratorOptions, appFs afero.Afero, branch string, context string, doPush bool) error
+	CloneGenerateAndPush(outputPath string, remote string, options gitopsv1alpha1.GeneratorOptions, appFs afero.Afero, branch string, repoContext string, doPush bool) error
 	CommitAndPush(outputPath string, repoPathOverride string, remote string, componentName string, branch string, commitMessage string) error
 	GenerateAndPush(outputPath string, remote string, options gitopsv1alpha1.GeneratorOptions, appFs afero.Afero, branch string, doPush bool, createdBy string) error
-	GenerateOverlaysAndPush(outputPath string, clone bool, remote string, options gitopsv1alpha1.GeneratorOptions, applicationName, environmentName, imageName, namespace string, appFs afero.Afero, branch string, context string, doPush bool, componentGeneratedResources map[string][]string) error
-	GitRemoveComponent(outputPath string, remote string, componentName string, branch string, context string) error
+	GenerateOverlaysAndPush(outputPath string, clone bool, remote string, options gitopsv1alpha1.GeneratorOptions, applicationName, environmentName, imageName, namespace string, appFs afero.Afero, branch string, repoContext string, doPush bool, componentGeneratedResources map[string][]string) error
+	GitRemoveComponent(outputPath string, remote string, componentName string, branch string, repoContext string) error
 	CloneRepo(outputPath string, remote string, componentName string, branch string) error
 	GetCommitIDFromRepo(fs afero.Afero, repoPath string) (string, error)
+
+	// Context aware variants of the above. Cancelling the context aborts the running git commands and SCM API calls,
+	// and an OperationCancelledError is returned.
+	CloneGenerateAndPushWithContext(ctx context.Context, outputPath string, remote string, options gitopsv1alpha1.GeneratorOptions, appFs afero.Afero, branch string, repoContext string, doPush bool) error
+	CommitAndPushWithContext(ctx context.Context, outputPath string, repoPathOverride string, remote string, componentName string, branch string, commitMessage string) error
+	GenerateAndPushWithContext(ctx context.Context, outputPath string, remote string, options gitopsv1alpha1.GeneratorOptions, appFs afero.Afero, branch string, doPush bool, createdBy string) error
+	GenerateOverlaysAndPushWithContext(ctx context.Context, outputPath string, clone bool, remote string, options gitopsv1alpha1.GeneratorOptions, applicationName, environmentName, imageName, namespace string, appFs afero.Afero, branch string, repoContext string, doPush bool, componentGeneratedResources map[string][]string) error
+	GitRemoveComponentWithContext(ctx context.Context, outputPath string, remote string, componentName string, branch string, repoContext string) error
+	CloneRepoWithContext(ctx context.Context, outputPath string, remote string, componentName string, branch string) error
+	GetCommitIDFromRepoWithContext(ctx context.Context, fs afero.Afero, repoPath string) (string, error)
+
+	// Pull request variants of CommitAndPush and GenerateOverlaysAndPush, for repositories with protected branches.
+	// The changes are pushed to a topic branch and proposed through a pull request (GitHub) or merge request (GitLab).
+	CommitAndOpenPullRequest(outputPath string, repoPathOverride string, remote string, componentName string, branch string, commitMessage string, prOptions PullRequestOptions) (*PullRequest, error)
+	GenerateOverlaysAndOpenPullRequest(outputPath string, clone bool, remote string, options gitopsv1alpha1.GeneratorOptions, applicationName, environmentName, imageName, namespace string, appFs afero.Afero, branch string, repoContext string, componentGeneratedResources map[string][]string, prOptions PullRequestOptions) (*PullRequest, error)
+	CommitAndOpenPullRequestWithContext(ctx context.Context, outputPath string, repoPathOverride string, remote string, componentName string, branch string, commitMessage string, prOptions PullRequestOptions) (*PullRequest, error)
+	GenerateOverlaysAndOpenPullRequestWithContext(ctx context.Context, outputPath string, clone bool, remote string, options gitopsv1alpha1.GeneratorOptions, applicationName, environmentName, imageName, namespace string, appFs afero.Afero, branch string, repoContext string, componentGeneratedResources map[string][]string, prOptions PullRequestOptions) (*PullRequest, error)
+
+	// History of the changes made by the generator, and revert of the commits holding them
+	GetCommitHistory(repoPath string, repoContext string, options CommitHistoryOptions) ([]GeneratorCommit, error)
+	RevertCommit(repoPath string, remote string, branch string, commitID string) error
+	GetCommitHistoryWithContext(ctx context.Context, repoPath string, repoContext string, options CommitHistoryOptions) ([]GeneratorCommit, error)
+	RevertCommitWithContext(ctx context.Context, repoPath string, remote string, branch string, commitID string) error
+
+	// Webhooks registered by GenerateAndPush when RepositoryOptions.Webhook is set
+	ListWebhooks(remote string) ([]*scm.Hook, error)
+	RemoveWebhooks(remote string) error
+	ListWebhooksWithContext(ctx context.Context, remote string) ([]*scm.Hook, error)
+	RemoveWebhooksWithContext(ctx context.Context, remote string) error
 }
 
 // NewGitopsGen returns a Generator implementation
-func NewGitopsGen() Gen {
-	return Gen{
-		Log: zap.New(zap.UseFlagOptions(&zap.Options{
-			Development: true,
-			TimeEncoder: zapcore.ISO8601TimeEncoder,
-		})),
+func NewGitopsGen(opts ...GenOption) Gen {
+	return newGen(zap.New(zap.UseFlagOptions(&zap.Options{
+		Development: true,
+		TimeEncoder: zapcore.ISO8601TimeEncoder,
+	})), opts...)
+}
+
+func NewGitopsGenWithLogger(log logr.Logger, opts ...GenOption) Gen {
+	return newGen(log, opts...)
+}
+
+func newGen(log logr.Logger, opts ...GenOption) Gen {
+	gen := Gen{
+		Log:         log,
+		Executor:    ExecExecutor{},
+		RetryPolicy: DefaultRetryPolicy(),
+	}
+	for _, opt := range opts {
+		opt(&gen)
 	}
+	return gen
 }
 
-func NewGitopsGenWithLogger(log logr.Logger) Gen {
-	return Gen{
-		Log: log,
+// GenOption configures optional behaviour of a Gen created through NewGitopsGen or NewGitopsGenWithLogger
+type GenOption func(*Gen)
+
+// WithExecutor sets the GitExecutor used by the Gen to run the git commands
+func WithExecutor(executor GitExecutor) GenOption {
+	return func(g *Gen) {
+		g.Executor = executor
 	}
 }
 
+// Gen is the Generator implementation. The calls working on the same local repository of a remote branch are run one
+// at a time, even from different Gen, the other calls waiting until it is done or their context is. The component,
+// application and environment names must be DNS-1123 labels, and the contexts must stay within the repository, or a
+// ValidationError is returned before anything is run.
 type Gen struct {
 	Log logr.Logger
+
+	// Executor runs the git commands. Defaults to ExecExecutor when not set.
+	Executor GitExecutor
+
+	// RetryPolicy configures how pushes rejected because the remote branch has moved are retried.
+	// Rejected pushes are not retried when not set.
+	RetryPolicy RetryPolicy
+
+	// ScmClientFactory creates the go-scm clients used to call the Git host APIs. Defaults to NewScmClient when not set.
+	ScmClientFactory ScmClientFactory
+
+	// Hosts holds the Git hosts the remotes are allowed to point to, along with the go-scm driver and API URL of
+	// each. Defaults to github.com and gitlab.com when not set.
+	Hosts *util.HostRegistry
+
+	// CommitOptions configures the author, committer and signature of the commits.
+	// The git identity configured in the environment is used and commits are not signed when not set.
+	CommitOptions CommitOptions
+
+	// Credentials authenticate to the HTTPS remotes, and to the API of their Git host when no ScmClientFactory is set.
+	// The token of the remote URL, if any, is used when not set.
+	Credentials Credentials
+
+	// SSHAuth holds the credentials used to access the SSH remotes.
+	// The SSH configuration of the environment is used when not set.
+	SSHAuth *SSHAuth
+
+	// CloneOptions configures the depth and sparse checkout of the clones.
+	// The whole history and tree are cloned when not set.
+	CloneOptions CloneOptions
+
+	// RepositoryOptions configures the repositories created by GenerateAndPush. Private repositories with the default
+	// description are created, and GenerateAndPush fails if the repository already exists, when not set.
+	RepositoryOptions RepositoryOptions
+
+	// Workspaces caches the clones of the remote branches across calls. The repositories are cloned to the outputPath
+	// of each call when not set.
+	Workspaces *WorkspaceCache
+
+	// Fs is the filesystem the Executor clones the repositories to. It is used by the methods that do not take a
+	// filesystem argument. Defaults to the filesystem of the Executor when it is a GoGitExecutor, and to the OS
+	// filesystem otherwise.
+	Fs afero.Afero
+
+	// dryRun holds the changes computed by a Gen returned by DryRun, nil otherwise
+	dryRun *DryRunResult
+
+	// createdBy is the app.kubernetes.io/created-by label of the resources generated by the call, CreatedBy when empty
+	createdBy string
+}
+
+// GitExecutor executes the commands needed to manage the GitOps repository.
+// Only "git" is required to be supported, the files being deleted through the filesystem of the Gen.
+// Cancelling the context should abort the running command.
+type GitExecutor interface {
+	Execute(ctx context.Context, baseDir string, cmd CommandType, args ...string) ([]byte, error)
 }
 
-// expose as a global variable for the purpose of running mock tests
-// only "git" and "rm" are supported
+// ExecExecutor is the default GitExecutor. It runs the commands as subprocesses on the local machine.
+type ExecExecutor struct{}
+
+// Execute runs the command in the baseDir folder and returns its combined output. The process is killed if the
+// context is done before it completes.
 /* #nosec G204 -- used internally to execute various gitops actions and eventual cleanup of artifacts.  Calling methods validate user input to ensure commands are used appropriately */
-var execute = func(baseDir string, cmd CommandType, args ...string) ([]byte, error) {
+func (e ExecExecutor) Execute(ctx context.Context, baseDir string, cmd CommandType, args ...string) ([]byte, error) {
 	if cmd == GitCommand || cmd == RmCommand {
-		c := exec.Command(string(cmd), args...)
+		c := exec.CommandContext(ctx, string(cmd), args...)
 		c.Dir = baseDir
 		output, err := c.CombinedOutput()
 		return output, err
@@ -89,44 +202,109 @@ var execute = func(baseDir string, cmd CommandType, args ...string) ([]byte, err
 	return []byte(""), fmt.Errorf(unsupportedCmdMsg, string(cmd))
 }
 
+// WithFilesystem sets the filesystem the Executor clones the repositories to, e.g. the filesystem of a GoGitExecutor
+func WithFilesystem(fs afero.Afero) GenOption {
+	return func(g *Gen) {
+		g.Fs = fs
+	}
+}
+
+// filesystem returns the configured Fs, falling back to the filesystem of a GoGitExecutor, and to the OS filesystem for a
+// zero value Gen
+func (s Gen) filesystem() afero.Afero {
+	if s.Fs.Fs != nil {
+		return s.Fs
+	}
+	if e, ok := s.Executor.(*GoGitExecutor); ok {
+		return e.fs
+	}
+	return ioutils.NewFilesystem()
+}
+
+// execute runs the command with the configured Executor, falling back to ExecExecutor for a zero value Gen.
+// No command is run once the context is done.
+func (s Gen) execute(ctx context.Context, baseDir string, cmd CommandType, args ...string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return []byte(""), err
+	}
+	if s.Executor == nil {
+		return ExecExecutor{}.Execute(ctx, baseDir, cmd, args...)
+	}
+	return s.Executor.Execute(ctx, baseDir, cmd, args...)
+}
+
+// checkCancelled returns an OperationCancelledError wrapping err if the context is done, err otherwise
+func checkCancelled(ctx context.Context, operation string, err error) error {
+	var cancelledErr *OperationCancelledError
+	if err == nil || ctx.Err() == nil || errors.As(err, &cancelledErr) {
+		return err
+	}
+	return &OperationCancelledError{operation: operation, ctxErr: ctx.Err(), err: err}
+}
+
 // CloneGenerateAndPush takes in the following args and generates the gitops resources for a given component
+// The cached workspace of the remote branch is used instead of a clone in outputPath when the Gen has Workspaces and
+// doPush is set. Otherwise, the repository is cloned in outputPath for the caller to commit the changes.
 // 1. outputPath: Where to output the gitops resources to
-// 2. remote: A string of the form https://$token@<domain>/<org>/<repo>, where <domain> is either github.com or gitlab.com and $token is optional. Corresponds to the component's gitops repository
+// 2. remote: A string of the form https://$token@<domain>/<org>/<repo>, where <domain> is either github.com or gitlab.com, or one of the Hosts of the Gen, and $token is optional and omitted when using Credentials, or an SSH remote such as git@<domain>:<org>/<repo>.git. Corresponds to the component's gitops repository
 // 3. options: Options for resource generation
 // 4. The filesystem object used to create (either ioutils.NewFilesystem() or ioutils.NewMemoryFilesystem())
 // 5. The branch to push to
 // 6. The path within the repository to generate the resources in
 // 7. The gitops config containing the build bundle;
 // Adapted from https://github.com/redhat-developer/kam/blob/master/pkg/pipelines/utils.go#L79
-func (s Gen) CloneGenerateAndPush(outputPath string, remote string, options gitopsv1alpha1.GeneratorOptions, appFs afero.Afero, branch string, context string, doPush bool) error {
+func (s Gen) CloneGenerateAndPush(outputPath string, remote string, options gitopsv1alpha1.GeneratorOptions, appFs afero.Afero, branch string, repoContext string, doPush bool) error {
+	return s.CloneGenerateAndPushWithContext(context.Background(), outputPath, remote, options, appFs, branch, repoContext, doPush)
+}
+
+// CloneGenerateAndPushWithContext is the context aware variant of CloneGenerateAndPush
+func (s Gen) CloneGenerateAndPushWithContext(ctx context.Context, outputPath string, remote string, options gitopsv1alpha1.GeneratorOptions, appFs afero.Afero, branch string, repoContext string, doPush bool) (err error) {
+	defer func() { err = checkCancelled(ctx, "CloneGenerateAndPush", err) }()
 	componentName := options.Name
+	if err := validateArgs(nameArg("component name", componentName), optionalNameArg("application name", options.Application), pathArg("context", repoContext)); err != nil {
+		return err
+	}
 
-	invalidRemoteErr := util.ValidateRemote(remote)
+	invalidRemoteErr := s.validateRemote(remote)
 	if invalidRemoteErr != nil {
 		return invalidRemoteErr
 	}
 
-	s.Log.V(6).Info("Cloning GitOps repository")
-	if out, err := execute(outputPath, GitCommand, "clone", remote, componentName); err != nil {
-		return &GitCmdError{path: outputPath, cmdResult: string(out), err: err, cmdType: cloneRepo}
+	ctx, unlock, err := repoLocks.lock(ctx, remote, branch, filepath.Join(outputPath, componentName))
+	if err != nil {
+		return err
 	}
-	s.Log.V(6).Info("GitOps repository cloned")
+	defer unlock()
 
-	repoPath := filepath.Join(outputPath, componentName)
-	gitopsFolder := filepath.Join(repoPath, context)
+	if !doPush {
+		// The changes are committed by the caller, and would be discarded by the next use of the cached workspace
+		s.Workspaces = nil
+	}
+	s.Log.V(6).Info(fmt.Sprintf("Checking out branch %s of the GitOps repository", branch))
+	repoPath, release, err := s.checkoutRepo(ctx, outputPath, remote, componentName, branch, s.CloneOptions.sparsePaths(repoContext, componentName))
+	if err != nil {
+		return err
+	}
+	defer release()
+	s.Log.V(6).Info(fmt.Sprintf("Branch %s of the GitOps repository checked out", branch))
+
+	gitopsFolder := filepath.Join(repoPath, repoContext)
 	componentPath := filepath.Join(gitopsFolder, "components", componentName, "base")
 
-	// Checkout the specified branch
-	s.Log.V(6).Info(fmt.Sprintf("Checking out branch %s", branch))
-	if _, err := execute(repoPath, GitCommand, "switch", branch); err != nil {
-		if out, err := execute(repoPath, GitCommand, "checkout", "-b", branch); err != nil {
-			return &GitBranchError{branch: branch, repoPath: repoPath, cmdResult: string(out), err: err, cmdType: checkoutBranch}
-		}
+	if s.dryRun != nil {
+		return s.recordDryRun(appFs, repoPath, func(copyFs afero.Afero) error {
+			if err := removeAll(copyFs, repoPath, filepath.Join("components", componentName, "base")); err != nil {
+				return &DeleteFolderError{componentPath: filepath.Join("components", componentName, "base"), repoPath: repoPath, err: err}
+			}
+			if err := Generate(copyFs, gitopsFolder, componentPath, options); err != nil {
+				return &GitGenResourcesAndOverlaysError{path: componentPath, componentName: componentName, err: err}
+			}
+			return nil
+		})
 	}
-	s.Log.V(6).Info(fmt.Sprintf("Branch %s checked out", branch))
 
-	if out, err := execute(repoPath, RmCommand, "-rf", filepath.Join("components", componentName, "base")); err != nil {
-		return &DeleteFolderError{componentPath: filepath.Join("components", componentName, "base"), repoPath: repoPath, cmdResult: string(out), err: err}
+	if err := removeAll(appFs, repoPath, filepath.Join("components", componentName, "base")); err != nil {
+		return &DeleteFolderError{componentPath: filepath.Join("components", componentName, "base"), repoPath: repoPath, err: err}
 	}
 
 	// Generate the gitops resources and update the parent kustomize yaml file
@@ -138,21 +316,40 @@ func (s Gen) CloneGenerateAndPush(outputPath string, remote string, options gito
 
 	if doPush {
 		s.Log.V(6).Info("Pushing GitOps resources to repository")
-		return s.CommitAndPush(outputPath, "", remote, componentName, branch, fmt.Sprintf("Generate GitOps base resources for component %s", componentName))
+		trailers := []CommitTrailers{{Component: componentName, Application: options.Application, Image: options.ContainerImage}}
+		data := &CommitMessageData{Operation: GenerateBaseOperation, Component: componentName, Application: options.Application, Image: options.ContainerImage}
+		return s.commitAndPush(ctx, filepath.Dir(repoPath), filepath.Base(repoPath), remote, componentName, branch, "", data, trailers)
 	}
 	return nil
 }
 
 // CommitAndPush pushes any new changes to the GitOps repo.  The folder should already be cloned in the target output folder.
+// Pushes rejected because the remote branch has moved are retried according to the RetryPolicy of the Gen.
+// The author, committer and signature of the commit are set by the CommitOptions of the Gen.
 // 1. outputPath: Where the gitops resources are
 // 2. repoPathOverride: The default path is the componentName. Use this to override the default folder.
-// 3. remote: A string of the form https://$token@github.com/<org>/<repo>. Corresponds to the component's gitops repository
+// 3. remote: A string of the form https://$token@github.com/<org>/<repo>, where $token is omitted when using Credentials, or an SSH remote such as git@github.com:<org>/<repo>.git. Corresponds to the component's gitops repository
 // 4. componentName: The component name corresponding to a single Component in an Application in AS. eg. component.Name
 // 5. The branch to push to
 // 6. The path within the repository to generate the resources in
 func (s Gen) CommitAndPush(outputPath string, repoPathOverride string, remote string, componentName string, branch string, commitMessage string) error {
+	return s.CommitAndPushWithContext(context.Background(), outputPath, repoPathOverride, remote, componentName, branch, commitMessage)
+}
+
+// CommitAndPushWithContext is the context aware variant of CommitAndPush
+func (s Gen) CommitAndPushWithContext(ctx context.Context, outputPath string, repoPathOverride string, remote string, componentName string, branch string, commitMessage string) error {
+	return s.commitAndPush(ctx, outputPath, repoPathOverride, remote, componentName, branch, commitMessage, nil, []CommitTrailers{{Component: componentName}})
+}
 
-	invalidRemoteErr := util.ValidateRemote(remote)
+// commitAndPush is CommitAndPushWithContext, rendering the commit message of the operation described by data when not nil,
+// and appending the trailers of the changes to the commit message
+func (s Gen) commitAndPush(ctx context.Context, outputPath string, repoPathOverride string, remote string, componentName string, branch string, commitMessage string, data *CommitMessageData, trailers []CommitTrailers) (err error) {
+	defer func() { err = checkCancelled(ctx, "CommitAndPush", err) }()
+	if err := validateArgs(nameArg("component name", componentName), pathArg("repository path override", repoPathOverride)); err != nil {
+		return err
+	}
+
+	invalidRemoteErr := s.validateRemote(remote)
 	if invalidRemoteErr != nil {
 		return invalidRemoteErr
 	}
@@ -162,63 +359,127 @@ func (s Gen) CommitAndPush(outputPath string, repoPathOverride string, remote st
 		repoPath = filepath.Join(outputPath, repoPathOverride)
 	}
 
-	if out, err := execute(repoPath, GitCommand, "add", "."); err != nil {
-		return &GitAddFilesError{componentName: componentName, repoPath: repoPath, cmdResult: string(out), err: err}
+	ctx, unlock, err := repoLocks.lock(ctx, remote, branch, repoPath)
+	if err != nil {
+		return err
 	}
+	defer unlock()
 
-	if out, err := execute(repoPath, GitCommand, "--no-pager", "diff", "--cached"); err != nil {
-		return &GitCmdError{path: repoPath, cmdResult: string(out), err: err, cmdType: checkGitDiff}
+	if s.dryRun != nil {
+		return s.recordDryRunCommit(ctx, s.filesystem(), repoPath)
+	}
 
-	} else if string(out) != "" {
-		// Pull from remote if branch is present
-		if out, err := execute(repoPath, GitCommand, "ls-remote", "--heads", remote, branch); err != nil {
-			return &GitLsRemoteError{err: err, cmdResult: string(out), remote: remote}
-		} else if strings.Contains(string(out), "refs/heads/"+branch) {
-			// only if the git repository contains the branch, pull
-			if out, err := execute(repoPath, GitCommand, "pull"); err != nil {
-				return &GitPullError{err: err, cmdResult: string(out), remote: remote}
-			}
-		}
+	if _, committed, err := s.commit(ctx, repoPath, remote, componentName, branch, commitMessage, data, trailers); err != nil || !committed {
+		return err
+	}
+	return s.pushWithRetry(ctx, repoPath, remote, branch)
+}
 
-		// Commit the changes and push
-		if out, err := execute(repoPath, GitCommand, "commit", "-m", commitMessage); err != nil {
-			return &GitCmdError{path: repoPath, cmdResult: string(out), err: err, cmdType: commitFiles}
-		}
-		if out, err := execute(repoPath, GitCommand, "push", "origin", branch); err != nil {
-			return &GitCmdError{path: remote, cmdResult: string(out), err: err, cmdType: pushRemote}
-		}
+// commit stages all the changes of the repository and commits them on top of the latest commit of the remote branch.
+// The commit message is rendered for the operation described by data when not nil, and the trailers of the changes are
+// appended to it. It returns the commit message, without the trailers, and false if there was nothing to commit.
+func (s Gen) commit(ctx context.Context, repoPath string, remote string, componentName string, branch string, commitMessage string, data *CommitMessageData, trailers []CommitTrailers) (string, bool, error) {
+	if out, err := s.execute(ctx, repoPath, GitCommand, "add", "."); err != nil {
+		return "", false, &GitAddFilesError{componentName: componentName, repoPath: repoPath, cmdResult: string(out), err: err}
+	}
+
+	out, err := s.execute(ctx, repoPath, GitCommand, "--no-pager", "diff", "--cached", "--name-only")
+	if err != nil {
+		return "", false, &GitCmdError{path: repoPath, cmdResult: string(out), err: err, cmdType: checkGitDiff}
+	} else if string(out) == "" {
+		return "", false, nil
+	}
+	if commitMessage, err = s.commitMessage(commitMessage, data, string(out)); err != nil {
+		return "", false, err
+	}
+
+	if err := s.pull(ctx, repoPath, remote, branch); err != nil {
+		return "", false, err
+	}
+	if err := s.commitChanges(ctx, repoPath, withTrailers(commitMessage, trailers, s.CommitOptions.createdBy())); err != nil {
+		return "", false, err
 	}
+	return commitMessage, true, nil
+}
 
+// pull pulls the remote branch into the repository, if the branch exists on the remote
+func (s Gen) pull(ctx context.Context, repoPath string, remote string, branch string) error {
+	if out, err := s.executeRemote(ctx, repoPath, remote, "ls-remote", "--heads", remote, branch); err != nil {
+		return &GitLsRemoteError{err: err, cmdResult: string(out), remote: remote}
+	} else if strings.Contains(string(out), "refs/heads/"+branch) {
+		// only if the git repository contains the branch, pull
+		if out, err := s.executeRemote(ctx, repoPath, remote, "pull"); err != nil {
+			return &GitPullError{err: err, cmdResult: string(out), remote: remote}
+		}
+	}
 	return nil
 }
 
-// GenerateAndPush generates a new gitops folder with one component, and optionally pushes to Git. Note: this does not
-// clone an existing gitops repo.
+// GenerateAndPush generates a new gitops folder with one component, along with the scaffolding files of
+// RepositoryOptions.Scaffold if set, and optionally pushes to Git. Note: this does not clone an existing gitops repo,
+// unless the repository already exists and RepositoryOptions.AdoptExisting is set. The author, committer and signature
+// of the commit are set by the CommitOptions of the Gen.
 // 1. outputPath: Where the gitops resources are
-// 2. remote: A string of the form https://$token@github.com/<org>/<repo>. Corresponds to the component's gitops repository
+// 2. remote: A string of the form https://$token@github.com/<org>/<repo>, where $token is omitted when using Credentials, or an SSH remote such as git@github.com:<org>/<repo>.git. Corresponds to the component's gitops repository
 // 3. options: Options for resource generation
 // 4. The filesystem object used to create (either ioutils.NewFilesystem() or ioutils.NewMemoryFilesystem())
 // 5. The branch to push to
 // 6. Optionally push to the GitOps repository or not.  Default is not to push.
 // 7. createdBy: Use a unique name to identify that clients are generating the GitOps repository. Default is "application-service" and should be overwritten.
 func (s Gen) GenerateAndPush(outputPath string, remote string, options gitopsv1alpha1.GeneratorOptions, appFs afero.Afero, branch string, doPush bool, createdBy string) error {
-	CreatedBy = createdBy
+	return s.GenerateAndPushWithContext(context.Background(), outputPath, remote, options, appFs, branch, doPush, createdBy)
+}
+
+// GenerateAndPushWithContext is the context aware variant of GenerateAndPush
+func (s Gen) GenerateAndPushWithContext(ctx context.Context, outputPath string, remote string, options gitopsv1alpha1.GeneratorOptions, appFs afero.Afero, branch string, doPush bool, createdBy string) (err error) {
+	defer func() { err = checkCancelled(ctx, "GenerateAndPush", err) }()
+	args := []argument{nameArg("component name", options.Name), optionalNameArg("application name", options.Application)}
+	if scaffold := s.RepositoryOptions.Scaffold; scaffold != nil {
+		for _, environment := range scaffold.Environments {
+			args = append(args, nameArg("environment name", environment))
+		}
+	}
+	if err := validateArgs(args...); err != nil {
+		return err
+	}
+	if createdBy != "" {
+		// s is a copy, so that the Created-By trailer and label of the call do not affect the other calls
+		s.CommitOptions.CreatedBy = createdBy
+		s.createdBy = createdBy
+	}
 	componentName := options.Name
 	repoPath := filepath.Join(outputPath, options.Application)
 
+	ctx, unlock, err := repoLocks.lock(ctx, remote, branch, repoPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// Generate the gitops resources and update the parent kustomize yaml file
 	gitopsFolder := repoPath
 
 	gitHostAccessToken := options.Secret
 	componentPath := filepath.Join(gitopsFolder, "components", componentName, "base")
-	if err := Generate(appFs, gitopsFolder, componentPath, options); err != nil {
+	if s.dryRun != nil {
+		return s.recordDryRun(appFs, repoPath, func(copyFs afero.Afero) error {
+			if err := s.generateComponent(copyFs, gitopsFolder, componentPath, options); err != nil {
+				return &GitGenResourcesAndOverlaysError{path: componentPath, componentName: componentName, err: err}
+			}
+			return s.scaffold(copyFs, repoPath, options)
+		})
+	}
+	if err := s.generateComponent(appFs, gitopsFolder, componentPath, options); err != nil {
 		return &GitGenResourcesAndOverlaysError{path: componentPath, componentName: componentName, err: err}
 	}
+	if err := s.scaffold(appFs, repoPath, options); err != nil {
+		return err
+	}
 
 	// Commit the changes and push
 	if doPush {
 
-		invalidRemoteErr := util.ValidateRemote(remote)
+		invalidRemoteErr := s.validateRemote(remote)
 		if invalidRemoteErr != nil {
 			return invalidRemoteErr
 		}
@@ -234,77 +495,153 @@ func (s Gen) GenerateAndPush(outputPath string, remote string, options gitopsv1a
 		if err != nil {
 			return &GitOpsRepoGenError{gitopsURL: gitOpsRepoURL, errMsg: "failed to parse GitOps repo URL %q: %w", err: err}
 		}
-		parts := strings.Split(u.Path, "/")
-		var org, repoName string
-		//Check length to avoid panic
-		if len(parts) > 3 {
-			org = parts[1]
-			repoName = strings.TrimSuffix(strings.Join(parts[2:], "/"), ".git")
-		}
+		org, repoName := splitRepoPath(u.Path)
 
+		if gitHostAccessToken == "" && s.Credentials != nil {
+			if _, gitHostAccessToken, err = s.credentials(ctx, remote); err != nil {
+				return &CredentialsError{remote: remote, err: err}
+			}
+		}
 		u.User = url.UserPassword("", gitHostAccessToken)
 
-		client, err := factory.FromRepoURL(u.String())
+		var client *scm.Client
+		if s.ScmClientFactory != nil {
+			client, err = s.ScmClientFactory(u.String())
+		} else {
+			client, err = newScmClient(s.hostRegistry(), u.String())
+		}
 		if err != nil {
 			return &GitOpsRepoGenError{gitopsURL: gitOpsRepoURL, errMsg: "failed to create a client to access %q: %w", err: err}
 		}
-		ctx := context.Background()
-		// If we're creating the repository in a personal user's account, it's a
-		// different API call that's made, clearing the org triggers go-scm to use
-		// the "create repo in personal account" endpoint.
 		currentUser, _, err := client.Users.Find(ctx)
 		if err != nil {
 			return &GitOpsRepoGenUserError{err: err}
 		}
-		if currentUser.Login == org {
-			org = ""
+		namespace, personal := s.RepositoryOptions.namespace(org, currentUser.Login)
+		if err := s.RepositoryOptions.validate(client.Driver); err != nil {
+			return &GitCreateRepoError{repoName: repoName, org: namespace, err: err}
 		}
+		fullName := namespace + "/" + repoName
 
-		ri := &scm.RepositoryInput{
-			Private:     true,
-			Description: defaultRepoDescription,
-			Namespace:   org,
-			Name:        repoName,
-		}
-		_, _, err = client.Repositories.Create(context.Background(), ri)
-		if err != nil {
-			repo := fmt.Sprintf("%s/%s", org, repoName)
-			if org == "" {
-				repo = fmt.Sprintf("%s/%s", currentUser.Login, repoName)
+		created, pushed := false, false
+		if err := s.RepositoryOptions.create(ctx, client, namespace, personal, repoName); err != nil {
+			if _, resp, findErr := client.Repositories.Find(ctx, fullName); findErr != nil || resp.Status != 200 {
+				return &GitCreateRepoError{repoName: repoName, org: namespace, err: err}
 			}
-			if _, resp, err := client.Repositories.Find(context.Background(), repo); err == nil && resp.Status == 200 {
+			if !s.RepositoryOptions.AdoptExisting {
 				return fmt.Errorf("failed to create repository, repo already exists")
 			}
-			return &GitCreateRepoError{repoName: repoName, org: org, err: err}
+			// An empty repository is pushed to like a new one
+			if pushed, err = s.adoptRepository(ctx, repoPath, remote, branch, appFs, options); err != nil {
+				return err
+			}
+		} else {
+			created = true
+			if err := s.RepositoryOptions.configure(ctx, client, fullName); err != nil {
+				return &RepositorySettingsError{repo: fullName, err: err}
+			}
+			if s.RepositoryOptions.Template != "" {
+				if pushed, err = s.pushOnTemplate(ctx, repoPath, remote, branch, appFs, options); err != nil {
+					return err
+				}
+			}
 		}
-
-		if out, err := execute(repoPath, GitCommand, "init", "."); err != nil {
-			return &GitCmdError{path: repoPath, cmdResult: string(out), err: err, cmdType: initializeGit}
+		if !pushed {
+			if err := s.pushNewRepository(ctx, repoPath, remote, branch, appFs, options); err != nil {
+				return err
+			}
 		}
-		if out, err := execute(repoPath, GitCommand, "add", "."); err != nil {
-			return &GitCmdError{path: repoPath, cmdResult: string(out), err: err, cmdType: addComponents}
+		if created && s.RepositoryOptions.DefaultBranch != "" {
+			if err := updateRepository(ctx, client, fullName, map[string]interface{}{"default_branch": s.RepositoryOptions.DefaultBranch}); err != nil {
+				return &RepositorySettingsError{repo: fullName, err: err}
+			}
 		}
-		if out, err := execute(repoPath, GitCommand, "commit", "-m", "Generate GitOps resources"); err != nil {
-			return &GitCmdError{path: repoPath, cmdResult: string(out), err: err, cmdType: commitFiles}
+		if webhook := s.RepositoryOptions.Webhook; webhook != nil {
+			if err := registerWebhook(ctx, client, fullName, *webhook); err != nil {
+				return err
+			}
 		}
-		if out, err := execute(repoPath, GitCommand, "branch", "-m", branch); err != nil {
-			return &GitBranchError{branch: branch, repoPath: repoPath, cmdResult: string(out), err: err, cmdType: switchBranch}
+	}
+
+	return nil
+}
+
+// splitRepoPath returns the organization and the name of the repository of the path of a GitOps repo URL, e.g. org
+// and repo for /org/repo.git. The name holds the remaining segments of the path, for the subgroups of GitLab. Both are
+// empty when the path has less than two segments.
+func splitRepoPath(path string) (string, string) {
+	parts := strings.Split(path, "/")
+	//Check length to avoid panic
+	if len(parts) < 3 {
+		return "", ""
+	}
+	return parts[1], strings.TrimSuffix(strings.Join(parts[2:], "/"), ".git")
+}
+
+// pushNewRepository initializes the repository of the generated resources, and pushes its first commit to the branch
+// of the remote. When a previous call initialized the repository but failed to push it, e.g. because the push was
+// rejected, its commit is pushed along with a commit of the resources generated since, if any.
+func (s Gen) pushNewRepository(ctx context.Context, repoPath string, remote string, branch string, appFs afero.Afero, options gitopsv1alpha1.GeneratorOptions) error {
+	componentName := options.Name
+	initialized, err := appFs.Exists(filepath.Join(repoPath, ".git"))
+	if err != nil {
+		return &GitCmdError{path: repoPath, err: err, cmdType: initializeGit}
+	}
+	if !initialized {
+		if out, err := s.execute(ctx, repoPath, GitCommand, "init", "."); err != nil {
+			return &GitCmdError{path: repoPath, cmdResult: string(out), err: err, cmdType: initializeGit}
 		}
-		if out, err := execute(repoPath, GitCommand, "remote", "add", "origin", remote); err != nil {
+		if out, err := s.execute(ctx, repoPath, GitCommand, "remote", "add", "origin", remote); err != nil {
 			return &GitAddFilesToRemoteError{componentName: componentName, remoteURL: remote, repoPath: repoPath, cmdResult: string(out), err: err}
 		}
-		if out, err := execute(repoPath, GitCommand, "push", "-u", "origin", branch); err != nil {
-			return &GitCmdError{path: remote, cmdResult: string(out), err: err, cmdType: pushRemote}
-		}
+	} else if out, err := s.execute(ctx, repoPath, GitCommand, "remote", "set-url", "origin", remote); err != nil {
+		// The token of the remote may have changed since the previous call
+		return &GitAddFilesToRemoteError{componentName: componentName, remoteURL: remote, repoPath: repoPath, cmdResult: string(out), err: err}
+	}
+	if out, err := s.execute(ctx, repoPath, GitCommand, "add", "."); err != nil {
+		return &GitCmdError{path: repoPath, cmdResult: string(out), err: err, cmdType: addComponents}
 	}
 
+	data := CommitMessageData{Operation: GenerateRepositoryOperation, Component: componentName, Application: options.Application, Image: options.ContainerImage}
+	committed := false
+	if initialized {
+		// Only the changes made since the commit of the previous call are committed on top of it
+		_, err := s.execute(ctx, repoPath, GitCommand, "rev-parse", "--verify", "HEAD")
+		committed = err == nil
+	}
+	if committed {
+		out, err := s.execute(ctx, repoPath, GitCommand, "--no-pager", "diff", "--cached", "--name-only")
+		if err != nil {
+			return &GitCmdError{path: repoPath, cmdResult: string(out), err: err, cmdType: checkGitDiff}
+		}
+		data.Operation, data.Files = GenerateBaseOperation, stagedFiles(string(out))
+	} else if data.Files, err = repositoryFiles(appFs, repoPath); err != nil {
+		return &GitCmdError{path: repoPath, err: err, cmdType: addComponents}
+	}
+	if !committed || len(data.Files) > 0 {
+		commitMessage, err := s.CommitOptions.MessageTemplate.render(data)
+		if err != nil {
+			return err
+		}
+		trailers := []CommitTrailers{{Component: componentName, Application: options.Application, Image: options.ContainerImage}}
+		if err := s.commitChanges(ctx, repoPath, withTrailers(commitMessage, trailers, s.CommitOptions.createdBy())); err != nil {
+			return err
+		}
+	}
+	if out, err := s.execute(ctx, repoPath, GitCommand, "branch", "-m", branch); err != nil {
+		return &GitBranchError{branch: branch, repoPath: repoPath, cmdResult: string(out), err: err, cmdType: switchBranch}
+	}
+	if out, err := s.executeRemote(ctx, repoPath, remote, "push", "-u", "origin", branch); err != nil {
+		return &GitCmdError{path: remote, cmdResult: string(out), err: err, cmdType: pushRemote}
+	}
 	return nil
 }
 
 // GenerateOverlaysAndPush generates the overlays kustomize from App Env Snapshot Binding Spec
+// When clone is set, the cached workspace of the remote branch is used instead of a clone in outputPath when the Gen has Workspaces and doPush is set.
 // 1. outputPath: Where to output the gitops resources to
 // 2. clone: Optionally clone the repository first
-// 3. remote: A string of the form https://$token@github.com/<org>/<repo>. Corresponds to the component's gitops repository
+// 3. remote: A string of the form https://$token@github.com/<org>/<repo>, where $token is omitted when using Credentials, or an SSH remote such as git@github.com:<org>/<repo>.git. Corresponds to the component's gitops repository
 // 4. options: Options for resource generation
 // 5. applicationName: The name of the application
 // 6. environmentName: The name of the environment
@@ -315,10 +652,19 @@ func (s Gen) GenerateAndPush(outputPath string, remote string, options gitopsv1a
 // 11. The path within the repository to generate the resources in
 // 12. Push the changes to the repository or not.
 // 13. The gitops config containing the build bundle;
-func (s Gen) GenerateOverlaysAndPush(outputPath string, clone bool, remote string, options gitopsv1alpha1.GeneratorOptions, applicationName, environmentName, imageName, namespace string, appFs afero.Afero, branch string, context string, doPush bool, componentGeneratedResources map[string][]string) error {
+func (s Gen) GenerateOverlaysAndPush(outputPath string, clone bool, remote string, options gitopsv1alpha1.GeneratorOptions, applicationName, environmentName, imageName, namespace string, appFs afero.Afero, branch string, repoContext string, doPush bool, componentGeneratedResources map[string][]string) error {
+	return s.GenerateOverlaysAndPushWithContext(context.Background(), outputPath, clone, remote, options, applicationName, environmentName, imageName, namespace, appFs, branch, repoContext, doPush, componentGeneratedResources)
+}
+
+// GenerateOverlaysAndPushWithContext is the context aware variant of GenerateOverlaysAndPush
+func (s Gen) GenerateOverlaysAndPushWithContext(ctx context.Context, outputPath string, clone bool, remote string, options gitopsv1alpha1.GeneratorOptions, applicationName, environmentName, imageName, namespace string, appFs afero.Afero, branch string, repoContext string, doPush bool, componentGeneratedResources map[string][]string) (err error) {
+	defer func() { err = checkCancelled(ctx, "GenerateOverlaysAndPush", err) }()
+	if err := validateArgs(nameArg("component name", options.Name), optionalNameArg("application name", applicationName), optionalNameArg("environment name", environmentName), pathArg("context", repoContext)); err != nil {
+		return err
+	}
 
 	if clone || doPush {
-		invalidRemoteErr := util.ValidateRemote(remote)
+		invalidRemoteErr := s.validateRemote(remote)
 		if invalidRemoteErr != nil {
 			return invalidRemoteErr
 		}
@@ -327,94 +673,229 @@ func (s Gen) GenerateOverlaysAndPush(outputPath string, clone bool, remote strin
 	componentName := options.Name
 	repoPath := filepath.Join(outputPath, applicationName)
 
-	if clone {
-		if out, err := execute(outputPath, GitCommand, "clone", remote, applicationName); err != nil {
-			return &GitCmdError{path: outputPath, cmdResult: string(out), err: err, cmdType: cloneRepo}
-		}
+	ctx, unlock, err := repoLocks.lock(ctx, remote, branch, repoPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-		// Checkout the specified branch
-		if _, err := execute(repoPath, GitCommand, "switch", branch); err != nil {
-			if out, err := execute(repoPath, GitCommand, "checkout", "-b", branch); err != nil {
-				return &GitBranchError{branch: branch, repoPath: repoPath, cmdResult: string(out), err: err, cmdType: checkoutBranch}
-			}
+	if !doPush {
+		// The changes are committed by the caller, and would be discarded by the next use of the cached workspace
+		s.Workspaces = nil
+	}
+	if clone {
+		var release func()
+		if repoPath, release, err = s.checkoutRepo(ctx, outputPath, remote, applicationName, branch, s.CloneOptions.sparsePaths(repoContext, componentName)); err != nil {
+			return err
 		}
+		defer release()
 	}
 
 	// Generate the gitops resources and update the parent kustomize yaml file
-	gitopsFolder := filepath.Join(repoPath, context)
+	gitopsFolder := filepath.Join(repoPath, repoContext)
 	componentEnvOverlaysPath := filepath.Join(gitopsFolder, "components", componentName, "overlays", environmentName)
+	if s.dryRun != nil {
+		return s.recordDryRun(appFs, repoPath, func(copyFs afero.Afero) error {
+			if err := GenerateOverlays(copyFs, gitopsFolder, componentEnvOverlaysPath, options, imageName, namespace, componentGeneratedResources); err != nil {
+				return &GitGenResourcesAndOverlaysError{path: componentEnvOverlaysPath, componentName: componentName, err: err, cmdType: genOverlays}
+			}
+			return nil
+		})
+	}
 	if err := GenerateOverlays(appFs, gitopsFolder, componentEnvOverlaysPath, options, imageName, namespace, componentGeneratedResources); err != nil {
 		return &GitGenResourcesAndOverlaysError{path: componentEnvOverlaysPath, componentName: componentName, err: err, cmdType: genOverlays}
 	}
 
 	if doPush {
-		return s.CommitAndPush(outputPath, applicationName, remote, componentName, branch, fmt.Sprintf("Generate %s environment overlays for component %s", environmentName, componentName))
+		trailers := []CommitTrailers{{Component: componentName, Application: applicationName, Environment: environmentName, Image: imageName}}
+		data := &CommitMessageData{Operation: GenerateOverlaysOperation, Component: componentName, Application: applicationName, Environment: environmentName, Image: imageName}
+		return s.commitAndPush(ctx, filepath.Dir(repoPath), filepath.Base(repoPath), remote, componentName, branch, "", data, trailers)
 	}
 	return nil
 }
 
 // GitRemoveComponent clones the repo, removes the component, and pushes the changes back to the repository. It takes in the following args and updates the gitops resources by removing the given component
+// The cached workspace of the remote branch is used instead of a clone in outputPath when the Gen has Workspaces.
 // 1. outputPath: Where to output the gitops resources to
-// 2. remote: A string of the form https://$token@<domain>/<org>/<repo>, where <domain> is either github.com or gitlab.com and $token is optional. Corresponds to the component's gitops repository
+// 2. remote: A string of the form https://$token@<domain>/<org>/<repo>, where <domain> is either github.com or gitlab.com, or one of the Hosts of the Gen, and $token is optional and omitted when using Credentials, or an SSH remote such as git@<domain>:<org>/<repo>.git. Corresponds to the component's gitops repository
 // 3. componentName: The component name corresponding to a single Component in an Application. eg. component.Name
 // 4. The branch to push to
 // 5. The path within the repository to generate the resources in
-func (s Gen) GitRemoveComponent(outputPath string, remote string, componentName string, branch string, context string) error {
-	if cloneError := s.CloneRepo(outputPath, remote, componentName, branch); cloneError != nil {
-		return cloneError
+func (s Gen) GitRemoveComponent(outputPath string, remote string, componentName string, branch string, repoContext string) error {
+	return s.GitRemoveComponentWithContext(context.Background(), outputPath, remote, componentName, branch, repoContext)
+}
+
+// GitRemoveComponentWithContext is the context aware variant of GitRemoveComponent
+func (s Gen) GitRemoveComponentWithContext(ctx context.Context, outputPath string, remote string, componentName string, branch string, repoContext string) (err error) {
+	defer func() { err = checkCancelled(ctx, "GitRemoveComponent", err) }()
+	if err := validateArgs(nameArg("component name", componentName), pathArg("context", repoContext)); err != nil {
+		return err
+	}
+	if s.dryRun != nil {
+		// Cloning does not change the repository
+		*s.dryRun = DryRunResult{}
+	}
+	if invalidRemoteErr := s.validateRemote(remote); invalidRemoteErr != nil {
+		return invalidRemoteErr
+	}
+	ctx, unlock, err := repoLocks.lock(ctx, remote, branch, filepath.Join(outputPath, componentName))
+	if err != nil {
+		return err
 	}
-	if removeComponentError := removeComponent(outputPath, componentName, context); removeComponentError != nil {
+	defer unlock()
+	repoPath, release, cloneError := s.checkoutRepo(ctx, outputPath, remote, componentName, branch, s.CloneOptions.sparsePaths(repoContext, componentName))
+	if cloneError != nil {
+		return checkCancelled(ctx, "CloneRepo", cloneError)
+	}
+	defer release()
+	if s.dryRun != nil {
+		componentPath := filepath.Join(repoPath, repoContext, "components", componentName)
+		return s.recordDryRun(s.filesystem(), repoPath, func(copyFs afero.Afero) error {
+			if err := removeAll(copyFs, repoPath, componentPath); err != nil {
+				return &DeleteFolderError{componentPath: componentPath, repoPath: repoPath, err: err}
+			}
+			return nil
+		})
+	}
+	if removeComponentError := s.removeRepoComponent(repoPath, componentName, repoContext); removeComponentError != nil {
 		return removeComponentError
 	}
 
-	return s.CommitAndPush(outputPath, "", remote, componentName, branch, fmt.Sprintf("Removed component %s", componentName))
+	data := &CommitMessageData{Operation: RemoveComponentOperation, Component: componentName}
+	return s.commitAndPush(ctx, filepath.Dir(repoPath), filepath.Base(repoPath), remote, componentName, branch, "", data, []CommitTrailers{{Component: componentName}})
 }
 
 // CloneRepo clones the repo, and switches to the branch
 // 1. outputPath: Where to output the gitops resources to
-// 2. remote: A string of the form https://$token@<domain>/<org>/<repo>, where <domain> is either github.com or gitlab.com and $token is optional. Corresponds to the component's gitops repository
+// 2. remote: A string of the form https://$token@<domain>/<org>/<repo>, where <domain> is either github.com or gitlab.com, or one of the Hosts of the Gen, and $token is optional and omitted when using Credentials, or an SSH remote such as git@<domain>:<org>/<repo>.git. Corresponds to the component's gitops repository
 // 3. componentName: The component name corresponding to a single Component in an Application. eg. component.Name
 // 4. The branch to push to switch to
 func (s Gen) CloneRepo(outputPath string, remote string, componentName string, branch string) error {
-	invalidRemoteErr := util.ValidateRemote(remote)
+	return s.CloneRepoWithContext(context.Background(), outputPath, remote, componentName, branch)
+}
+
+// CloneRepoWithContext is the context aware variant of CloneRepo
+func (s Gen) CloneRepoWithContext(ctx context.Context, outputPath string, remote string, componentName string, branch string) (err error) {
+	defer func() { err = checkCancelled(ctx, "CloneRepo", err) }()
+	if err := validateArgs(nameArg("component name", componentName)); err != nil {
+		return err
+	}
+	if s.dryRun != nil {
+		// Cloning does not change the repository
+		*s.dryRun = DryRunResult{}
+	}
+	invalidRemoteErr := s.validateRemote(remote)
 	if invalidRemoteErr != nil {
 		return invalidRemoteErr
 	}
+	ctx, unlock, err := repoLocks.lock(ctx, remote, branch, filepath.Join(outputPath, componentName))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return s.cloneRepo(ctx, outputPath, remote, componentName, branch, nil)
+}
 
-	repoPath := filepath.Join(outputPath, componentName)
+// cloneRepo clones the remote to outputPath/dir following the CloneOptions of the Gen, and switches to the branch.
+// Only the sparsePaths folders are checked out if not empty.
+func (s Gen) cloneRepo(ctx context.Context, outputPath string, remote string, dir string, branch string, sparsePaths []string) error {
+	repoPath := filepath.Join(outputPath, dir)
 
-	if out, err := execute(outputPath, GitCommand, "clone", remote, componentName); err != nil {
+	if out, err := s.executeRemote(ctx, outputPath, remote, s.CloneOptions.cloneArgs(remote, dir, len(sparsePaths) > 0)...); err != nil {
 		return &GitCmdError{path: outputPath, cmdResult: string(out), err: err, cmdType: cloneRepo}
 	}
+	if len(sparsePaths) > 0 {
+		if err := s.sparseCheckout(ctx, repoPath, sparsePaths, true); err != nil {
+			return err
+		}
+	}
 
 	// Checkout the specified branch
-	if _, err := execute(repoPath, GitCommand, "switch", branch); err != nil {
-		if out, err := execute(repoPath, GitCommand, "checkout", "-b", branch); err != nil {
+	if _, err := s.execute(ctx, repoPath, GitCommand, "switch", branch); err != nil {
+		if out, err := s.execute(ctx, repoPath, GitCommand, "checkout", "-b", branch); err != nil {
 			return &GitBranchError{branch: branch, repoPath: repoPath, cmdResult: string(out), err: err, cmdType: checkoutBranch}
 		}
 	}
 	return nil
 }
 
+// checkoutRepo returns the path of a repository the branch of the remote is checked out in, along with the function
+// to call once done with it. The workspace of the remote branch is used when the Gen has Workspaces, and the remote
+// is cloned to outputPath/dir otherwise. Only the sparsePaths folders are checked out if not empty.
+func (s Gen) checkoutRepo(ctx context.Context, outputPath string, remote string, dir string, branch string, sparsePaths []string) (string, func(), error) {
+	if s.Workspaces != nil {
+		return s.Workspaces.acquire(ctx, s, remote, branch, sparsePaths)
+	}
+	if err := s.cloneRepo(ctx, outputPath, remote, dir, branch, sparsePaths); err != nil {
+		return "", nil, err
+	}
+	return filepath.Join(outputPath, dir), func() {}, nil
+}
+
 // removeComponent removes the component from the local folder.  This expects the git repo to be already cloned
 // 1. outputPath: Where the gitops repo contents have been cloned
 // 2. componentName: The component name corresponding to a single Component in an Application. eg. component.Name
 // 3. The path within the repository to generate the resources in
-func removeComponent(outputPath string, componentName string, context string) error {
-	repoPath := filepath.Join(outputPath, componentName)
-	gitopsFolder := filepath.Join(repoPath, context)
+func (s Gen) removeComponent(outputPath string, componentName string, repoContext string) error {
+	return s.removeRepoComponent(filepath.Join(outputPath, componentName), componentName, repoContext)
+}
+
+// removeRepoComponent removes the component from the repository at repoPath, on the filesystem of the Gen
+func (s Gen) removeRepoComponent(repoPath string, componentName string, repoContext string) error {
+	gitopsFolder := filepath.Join(repoPath, repoContext)
 	componentPath := filepath.Join(gitopsFolder, "components", componentName)
-	if out, err := execute(repoPath, RmCommand, "-rf", componentPath); err != nil {
-		return &DeleteFolderError{componentPath: componentPath, repoPath: repoPath, cmdResult: string(out), err: err}
+	if err := removeAll(s.filesystem(), repoPath, componentPath); err != nil {
+		return &DeleteFolderError{componentPath: componentPath, repoPath: repoPath, err: err}
 	}
 	return nil
 }
 
+// removeAll deletes the path, relative to the repository at repoPath unless absolute, and its content from the
+// filesystem. Paths outside of the repository, the repository itself and its .git folder are refused, as well as paths
+// going through a symbolic link, so that crafted component names or contexts cannot delete anything else.
+func removeAll(fs afero.Afero, repoPath string, path string) error {
+	repoPath = filepath.Clean(repoPath)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(repoPath, path)
+	}
+	path = filepath.Clean(path)
+	rel, err := filepath.Rel(repoPath, path)
+	if err != nil {
+		return err
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	if rel == "." || parts[0] == ".." || parts[0] == ".git" {
+		return fmt.Errorf("%q is not a folder within the repository", path)
+	}
+	if lstater, ok := fs.Fs.(afero.Lstater); ok {
+		parent := repoPath
+		for _, part := range parts[:len(parts)-1] {
+			parent = filepath.Join(parent, part)
+			info, _, err := lstater.LstatIfPossible(parent)
+			if os.IsNotExist(err) {
+				// Nothing to delete
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if info.Mode()&os.ModeSymlink != 0 {
+				return fmt.Errorf("%q goes through the symbolic link %q", path, parent)
+			}
+		}
+	}
+	return fs.RemoveAll(path)
+}
+
 // GetCommitIDFromRepo returns the commit ID for the given repository
 func (s Gen) GetCommitIDFromRepo(fs afero.Afero, repoPath string) (string, error) {
+	return s.GetCommitIDFromRepoWithContext(context.Background(), fs, repoPath)
+}
+
+// GetCommitIDFromRepoWithContext is the context aware variant of GetCommitIDFromRepo
+func (s Gen) GetCommitIDFromRepoWithContext(ctx context.Context, fs afero.Afero, repoPath string) (commitID string, err error) {
+	defer func() { err = checkCancelled(ctx, "GetCommitIDFromRepo", err) }()
 	var out []byte
-	var err error
-	if out, err = execute(repoPath, GitCommand, "rev-parse", "HEAD"); err != nil {
+	if out, err = s.execute(ctx, repoPath, GitCommand, "rev-parse", "HEAD"); err != nil {
 		return "", &GitCmdError{path: repoPath, cmdResult: string(out), err: err, cmdType: getCommitID}
 	}
 	return string(out), nil
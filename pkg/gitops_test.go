@@ -16,8 +16,10 @@
 package gitops
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -36,8 +38,6 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-var originalExecute = execute
-
 func TestCloneGenerateAndPush(t *testing.T) {
 	repo := "https://github.com/testing/testing.git"
 	repoWithToken := "https://ghu_28lafsjdifouwej@github.com/testing/testing.git"
@@ -55,7 +55,12 @@ func TestCloneGenerateAndPush(t *testing.T) {
 	component.Name = "test-component"
 	fs := ioutils.NewMemoryFilesystem()
 	readOnlyFs := ioutils.NewReadOnlyFs()
-	generator := NewGitopsGen()
+	// The base resources of the component cannot be deleted from a read only repository
+	repoFs := ioutils.NewMemoryFilesystem()
+	if err := Generate(repoFs, repoPath, filepath.Join(repoPath, "components", componentName, "base"), component); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	readOnlyRepoFs := afero.Afero{Fs: afero.NewReadOnlyFs(repoFs.Fs)}
 
 	tests := []struct {
 		name          string
@@ -80,7 +85,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				[]byte("test output4 refs/heads/main"),
 				[]byte("test output5"),
 				[]byte("test output6"),
-				[]byte("test output7"),
 				[]byte("test output8"),
 				[]byte("test output9"),
 			},
@@ -95,11 +99,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", filepath.Join("components", componentName, "base")},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -108,7 +107,7 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -123,7 +122,7 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"commit", "-m", fmt.Sprintf("Generate GitOps base resources for component %s", componentName)},
+					Args:    []string{"commit", "-m", "Generate GitOps base resources for component test-component\n\nComponent: test-component\nImage: testimage:latest\nGenerator-Version: " + GeneratorVersion + "\nCreated-By: application-service\n"},
 				},
 				{
 					BaseDir: repoPath,
@@ -197,7 +196,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				[]byte("test output4 refs/heads/main"),
 				[]byte("test output5"),
 				[]byte("test output6"),
-				[]byte("test output7"),
 				[]byte("test output8"),
 				[]byte("test output9"),
 			},
@@ -212,11 +210,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", filepath.Join("components", componentName, "base")},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -225,7 +218,7 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -240,7 +233,7 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"commit", "-m", fmt.Sprintf("Generate GitOps base resources for component %s", componentName)},
+					Args:    []string{"commit", "-m", withTrailers(fmt.Sprintf("Generate GitOps base resources for component %s", componentName), []CommitTrailers{{Component: componentName}}, defaultCreatedBy)},
 				},
 				{
 					BaseDir: repoPath,
@@ -273,7 +266,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				[]byte("test output4 refs/heads/main"),
 				[]byte("test output5"),
 				[]byte("test output6"),
-				[]byte("test output7"),
 				[]byte("test output8"),
 				[]byte("test output9"),
 			},
@@ -288,11 +280,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", filepath.Join("components", componentName, "base")},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -301,7 +288,7 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -316,7 +303,7 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"commit", "-m", fmt.Sprintf("Generate GitOps base resources for component %s", componentName)},
+					Args:    []string{"commit", "-m", withTrailers(fmt.Sprintf("Generate GitOps base resources for component %s", componentName), []CommitTrailers{{Component: componentName}}, defaultCreatedBy)},
 				},
 				{
 					BaseDir: repoPath,
@@ -350,7 +337,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				[]byte("test output4 refs/heads/main"),
 				[]byte("test output5"),
 				[]byte("test output6"),
-				[]byte("test output7"),
 				[]byte("test output8"),
 				[]byte("test output9"),
 			},
@@ -365,11 +351,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", filepath.Join("components", componentName, "base")},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -378,7 +359,7 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -393,7 +374,7 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"commit", "-m", fmt.Sprintf("Generate GitOps base resources for component %s", componentName)},
+					Args:    []string{"commit", "-m", withTrailers(fmt.Sprintf("Generate GitOps base resources for component %s", componentName), []CommitTrailers{{Component: componentName}}, defaultCreatedBy)},
 				},
 				{
 					BaseDir: repoPath,
@@ -426,7 +407,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				[]byte("test output4 refs/heads/main"),
 				[]byte("test output5"),
 				[]byte("test output6"),
-				[]byte("test output7"),
 				[]byte("test output8"),
 				[]byte("test output9"),
 			},
@@ -441,11 +421,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", filepath.Join("components", componentName, "base")},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -454,7 +429,7 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -469,7 +444,7 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"commit", "-m", fmt.Sprintf("Generate GitOps base resources for component %s", componentName)},
+					Args:    []string{"commit", "-m", withTrailers(fmt.Sprintf("Generate GitOps base resources for component %s", componentName), []CommitTrailers{{Component: componentName}}, defaultCreatedBy)},
 				},
 				{
 					BaseDir: repoPath,
@@ -503,7 +478,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				[]byte("test output4 refs/heads/main"),
 				[]byte("test output5"),
 				[]byte("test output6"),
-				[]byte("test output7"),
 				[]byte("test output8"),
 				[]byte("test output9"),
 			},
@@ -518,11 +492,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", filepath.Join("components", componentName, "base")},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -531,7 +500,7 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -546,7 +515,7 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"commit", "-m", fmt.Sprintf("Generate GitOps base resources for component %s", componentName)},
+					Args:    []string{"commit", "-m", withTrailers(fmt.Sprintf("Generate GitOps base resources for component %s", componentName), []CommitTrailers{{Component: componentName}}, defaultCreatedBy)},
 				},
 				{
 					BaseDir: repoPath,
@@ -579,7 +548,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				[]byte("test output4 refs/heads/main"),
 				[]byte("test output5"),
 				[]byte("test output6"),
-				[]byte("test output7"),
 				[]byte("test output8"),
 				[]byte("test output9"),
 			},
@@ -594,11 +562,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", filepath.Join("components", componentName, "base")},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -607,7 +570,7 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -622,7 +585,7 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"commit", "-m", fmt.Sprintf("Generate GitOps base resources for component %s", componentName)},
+					Args:    []string{"commit", "-m", withTrailers(fmt.Sprintf("Generate GitOps base resources for component %s", componentName), []CommitTrailers{{Component: componentName}}, defaultCreatedBy)},
 				},
 				{
 					BaseDir: repoPath,
@@ -710,7 +673,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				[]byte("test output4 refs/heads/main"),
 				[]byte("test output5"),
 				[]byte("test output6"),
-				[]byte("test output7"),
 				[]byte("test output8"),
 				[]byte("test output9"),
 				[]byte("test output10"),
@@ -731,11 +693,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 					Command: "git",
 					Args:    []string{"checkout", "-b", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", filepath.Join("components", componentName, "base")},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -744,7 +701,7 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -759,7 +716,7 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"commit", "-m", fmt.Sprintf("Generate GitOps base resources for component %s", componentName)},
+					Args:    []string{"commit", "-m", withTrailers(fmt.Sprintf("Generate GitOps base resources for component %s", componentName), []CommitTrailers{{Component: componentName, Image: component.ContainerImage}}, defaultCreatedBy)},
 				},
 				{
 					BaseDir: repoPath,
@@ -770,19 +727,17 @@ func TestCloneGenerateAndPush(t *testing.T) {
 			wantErrString: "",
 		},
 		{
-			name:      "rm -rf failure",
+			name:      "Delete failure",
 			repo:      repo,
-			fs:        fs,
+			fs:        readOnlyRepoFs,
 			component: component,
 			errors: &testutils.ErrorStack{
 				Errors: []error{
-					errors.New("Permission Denied"),
 					nil,
 					nil,
 				},
 			},
 			outputs: [][]byte{
-				[]byte("test output1"),
 				[]byte("test output2"),
 				[]byte("test output3"),
 			},
@@ -797,13 +752,8 @@ func TestCloneGenerateAndPush(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", "components/test-component/base"},
-				},
 			},
-			wantErrString: "failed to delete \"components/test-component/base\" folder in repository in \"/fake/path/test-component\" \"test output1\": Permission Denied",
+			wantErrString: "failed to delete \"components/test-component/base\" folder in repository in \"/fake/path/test-component\" \"\": operation not permitted",
 		},
 		{
 			name:      "git add failure",
@@ -815,12 +765,10 @@ func TestCloneGenerateAndPush(t *testing.T) {
 					errors.New("Fatal error"),
 					nil,
 					nil,
-					nil,
 				},
 			},
 			outputs: [][]byte{
 				[]byte("test output1"),
-				[]byte("test output2"),
 				[]byte("test output3"),
 				[]byte("test output4"),
 			},
@@ -835,11 +783,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", "components/test-component/base"},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -859,13 +802,11 @@ func TestCloneGenerateAndPush(t *testing.T) {
 					nil,
 					nil,
 					nil,
-					nil,
 				},
 			},
 			outputs: [][]byte{
 				[]byte("test output1"),
 				[]byte("test output2"),
-				[]byte("test output3"),
 				[]byte("test output4"),
 				[]byte("test output5"),
 			},
@@ -880,11 +821,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", "components/test-component/base"},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -893,7 +829,7 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 			},
 			wantErrString: "failed to check git diff in repository \"/fake/path/test-component\" \"test output1\": Permission Denied",
@@ -910,14 +846,12 @@ func TestCloneGenerateAndPush(t *testing.T) {
 					nil,
 					nil,
 					nil,
-					nil,
 				},
 			},
 			outputs: [][]byte{
 				[]byte("test output1"),
 				[]byte("test output2"),
 				[]byte("test output3"),
-				[]byte("test output4"),
 				[]byte("test output5"),
 				[]byte("test output6"),
 			},
@@ -932,11 +866,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", "components/test-component/base"},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -945,7 +874,7 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -968,7 +897,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 					nil,
 					nil,
 					nil,
-					nil,
 				},
 			},
 			outputs: [][]byte{
@@ -976,7 +904,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				[]byte("test output2 refs/heads/main"),
 				[]byte("test output3"),
 				[]byte("test output4"),
-				[]byte("test output5"),
 				[]byte("test output6"),
 				[]byte("test output6"),
 			},
@@ -991,11 +918,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", "components/test-component/base"},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -1004,7 +926,7 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -1033,7 +955,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 					nil,
 					nil,
 					nil,
-					nil,
 				},
 			},
 			outputs: [][]byte{
@@ -1042,7 +963,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				[]byte("test output3 refs/heads/main"),
 				[]byte("test output4"),
 				[]byte("test output5"),
-				[]byte("test output6"),
 				[]byte("test output7"),
 				[]byte("test output8"),
 			},
@@ -1057,11 +977,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", "components/test-component/base"},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -1070,7 +985,7 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -1085,7 +1000,7 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"commit", "-m", fmt.Sprintf("Generate GitOps base resources for component %s", componentName)},
+					Args:    []string{"commit", "-m", withTrailers(fmt.Sprintf("Generate GitOps base resources for component %s", componentName), []CommitTrailers{{Component: componentName, Image: component.ContainerImage}}, defaultCreatedBy)},
 				},
 			},
 			wantErrString: "failed to commit files to repository \"/fake/path/test-component\" \"test output1\": Fatal error",
@@ -1105,7 +1020,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 					nil,
 					nil,
 					nil,
-					nil,
 				},
 			},
 			outputs: [][]byte{
@@ -1115,7 +1029,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				[]byte("test output4 refs/heads/main"),
 				[]byte("test output5"),
 				[]byte("test output6"),
-				[]byte("test output7"),
 				[]byte("test output8"),
 				[]byte("test output9"),
 			},
@@ -1130,11 +1043,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", "components/test-component/base"},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -1143,7 +1051,7 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -1158,7 +1066,7 @@ func TestCloneGenerateAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"commit", "-m", fmt.Sprintf("Generate GitOps base resources for component %s", componentName)},
+					Args:    []string{"commit", "-m", withTrailers(fmt.Sprintf("Generate GitOps base resources for component %s", componentName), []CommitTrailers{{Component: componentName, Image: component.ContainerImage}}, defaultCreatedBy)},
 				},
 				{
 					BaseDir: repoPath,
@@ -1185,11 +1093,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", "components/test-component/base"},
-				},
 			},
 			wantErrString: "failed to generate the gitops resources in \"/fake/path/test-component/components/test-component/base\" for component \"test-component\"",
 		},
@@ -1214,11 +1117,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", "components/test-component/base"},
-				},
 			},
 			wantErrString: "failed to generate the gitops resources in \"/fake/path/test-component/components/test-component/base\" for component \"test-component\": failed to MkDirAll",
 		},
@@ -1230,7 +1128,7 @@ func TestCloneGenerateAndPush(t *testing.T) {
 			outputStack := testutils.NewOutputs(tt.outputs...)
 			executedCmds := []testutils.Execution{}
 
-			execute = newTestExecute(outputStack, tt.errors, &executedCmds)
+			generator := NewGitopsGen(WithExecutor(newTestExecutor(outputStack, tt.errors, &executedCmds)))
 
 			err := generator.CloneGenerateAndPush(outputPath, tt.repo, tt.component, tt.fs, branch, "/", true)
 
@@ -1243,9 +1141,6 @@ func TestCloneGenerateAndPush(t *testing.T) {
 			assert.Equal(t, tt.want, executedCmds, "command executed should be equal")
 		})
 	}
-
-	execute = originalExecute
-
 }
 
 func TestGenerateOverlaysAndPush(t *testing.T) {
@@ -1265,7 +1160,6 @@ func TestGenerateOverlaysAndPush(t *testing.T) {
 	component.Name = "test-component"
 	fs := ioutils.NewMemoryFilesystem()
 	readOnlyFs := ioutils.NewReadOnlyFs()
-	generator := NewGitopsGen()
 	tests := []struct {
 		name            string
 		fs              afero.Afero
@@ -1317,7 +1211,7 @@ func TestGenerateOverlaysAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -1332,7 +1226,7 @@ func TestGenerateOverlaysAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"commit", "-m", fmt.Sprintf("Generate %s environment overlays for component %s", environmentName, componentName)},
+					Args:    []string{"commit", "-m", withTrailers(fmt.Sprintf("Generate %s environment overlays for component %s", environmentName, componentName), []CommitTrailers{{Component: componentName, Application: applicationName, Environment: environmentName, Image: imageName}}, defaultCreatedBy)},
 				},
 				{
 					BaseDir: repoPath,
@@ -1457,7 +1351,7 @@ func TestGenerateOverlaysAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -1472,7 +1366,7 @@ func TestGenerateOverlaysAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"commit", "-m", fmt.Sprintf("Generate %s environment overlays for component %s", environmentName, componentName)},
+					Args:    []string{"commit", "-m", withTrailers(fmt.Sprintf("Generate %s environment overlays for component %s", environmentName, componentName), []CommitTrailers{{Component: componentName, Application: applicationName, Environment: environmentName, Image: imageName}}, defaultCreatedBy)},
 				},
 				{
 					BaseDir: repoPath,
@@ -1562,7 +1456,7 @@ func TestGenerateOverlaysAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 			},
 			wantErrString: "failed to check git diff in repository \"/fake/path/test-application\" \"test output1\": Permission Denied",
@@ -1606,7 +1500,7 @@ func TestGenerateOverlaysAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -1658,7 +1552,7 @@ func TestGenerateOverlaysAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -1721,7 +1615,7 @@ func TestGenerateOverlaysAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -1736,7 +1630,7 @@ func TestGenerateOverlaysAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"commit", "-m", fmt.Sprintf("Generate %s environment overlays for component %s", environmentName, componentName)},
+					Args:    []string{"commit", "-m", withTrailers(fmt.Sprintf("Generate %s environment overlays for component %s", environmentName, componentName), []CommitTrailers{{Component: componentName, Application: applicationName, Environment: environmentName, Image: imageName}}, defaultCreatedBy)},
 				},
 			},
 			wantErrString: "failed to commit files to repository \"/fake/path/test-application\" \"test output1\": Fatal error",
@@ -1790,7 +1684,7 @@ func TestGenerateOverlaysAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -1805,7 +1699,7 @@ func TestGenerateOverlaysAndPush(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"commit", "-m", fmt.Sprintf("Generate %s environment overlays for component %s", environmentName, componentName)},
+					Args:    []string{"commit", "-m", withTrailers(fmt.Sprintf("Generate %s environment overlays for component %s", environmentName, componentName), []CommitTrailers{{Component: componentName, Application: applicationName, Environment: environmentName, Image: imageName}}, defaultCreatedBy)},
 				},
 				{
 					BaseDir: repoPath,
@@ -1846,7 +1740,7 @@ func TestGenerateOverlaysAndPush(t *testing.T) {
 			outputStack := testutils.NewOutputs(tt.outputs...)
 			executedCmds := []testutils.Execution{}
 
-			execute = newTestExecute(outputStack, tt.errors, &executedCmds)
+			generator := NewGitopsGen(WithExecutor(newTestExecutor(outputStack, tt.errors, &executedCmds)))
 
 			err := generator.GenerateOverlaysAndPush(outputPath, true, repo, tt.component, tt.applicationName, tt.environmentName, tt.imageName, tt.namespace, tt.fs, branch, "/", true, generatedResources)
 
@@ -1867,7 +1761,6 @@ func TestGenerateOverlaysAndPush(t *testing.T) {
 			assert.Equal(t, tt.want, executedCmds, "command executed should be equal")
 		})
 	}
-	execute = originalExecute
 }
 
 func TestGitRemoveComponent(t *testing.T) {
@@ -1885,7 +1778,6 @@ func TestGitRemoveComponent(t *testing.T) {
 	}
 	component.Name = "test-component"
 	fs := ioutils.NewMemoryFilesystem()
-	generator := NewGitopsGen()
 	branch := "main"
 
 	tests := []struct {
@@ -1909,7 +1801,6 @@ func TestGitRemoveComponent(t *testing.T) {
 				[]byte("test output4 refs/heads/main"),
 				[]byte("test output5"),
 				[]byte("test output6"),
-				[]byte("test output7"),
 				[]byte("test output8"),
 				[]byte("test output9"),
 			},
@@ -1924,11 +1815,6 @@ func TestGitRemoveComponent(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", componentPath},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -1937,7 +1823,7 @@ func TestGitRemoveComponent(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -1952,7 +1838,7 @@ func TestGitRemoveComponent(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"commit", "-m", fmt.Sprintf("Removed component %s", componentName)},
+					Args:    []string{"commit", "-m", withTrailers(fmt.Sprintf("Removed component %s", componentName), []CommitTrailers{{Component: componentName}}, defaultCreatedBy)},
 				},
 				{
 					BaseDir: repoPath,
@@ -2037,7 +1923,6 @@ func TestGitRemoveComponent(t *testing.T) {
 				[]byte("test output4 refs/heads/main"),
 				[]byte("test output5"),
 				[]byte("test output6"),
-				[]byte("test output7"),
 				[]byte("test output8"),
 				[]byte("test output9"),
 				[]byte("test output10"),
@@ -2058,11 +1943,6 @@ func TestGitRemoveComponent(t *testing.T) {
 					Command: "git",
 					Args:    []string{"checkout", "-b", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", componentPath},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -2071,7 +1951,7 @@ func TestGitRemoveComponent(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -2086,7 +1966,7 @@ func TestGitRemoveComponent(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"commit", "-m", fmt.Sprintf("Removed component %s", componentName)},
+					Args:    []string{"commit", "-m", withTrailers(fmt.Sprintf("Removed component %s", componentName), []CommitTrailers{{Component: componentName}}, defaultCreatedBy)},
 				},
 				{
 					BaseDir: repoPath,
@@ -2097,18 +1977,16 @@ func TestGitRemoveComponent(t *testing.T) {
 			wantErrString: "",
 		},
 		{
-			name:      "rm -rf failure",
-			fs:        fs,
+			name:      "Delete failure",
+			fs:        afero.Afero{Fs: afero.NewReadOnlyFs(fs.Fs)},
 			component: component,
 			errors: &testutils.ErrorStack{
 				Errors: []error{
-					errors.New("Permission Denied"),
 					nil,
 					nil,
 				},
 			},
 			outputs: [][]byte{
-				[]byte("test output1"),
 				[]byte("test output2"),
 				[]byte("test output3"),
 			},
@@ -2123,13 +2001,8 @@ func TestGitRemoveComponent(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", componentPath},
-				},
 			},
-			wantErrString: "failed to delete \"/fake/path/test-component/components/test-component\" folder in repository in \"/fake/path/test-component\" \"test output1\": Permission Denied",
+			wantErrString: "failed to delete \"/fake/path/test-component/components/test-component\" folder in repository in \"/fake/path/test-component\" \"\": operation not permitted",
 		},
 		{
 			name:      "git add failure",
@@ -2140,12 +2013,10 @@ func TestGitRemoveComponent(t *testing.T) {
 					errors.New("Fatal error"),
 					nil,
 					nil,
-					nil,
 				},
 			},
 			outputs: [][]byte{
 				[]byte("test output1"),
-				[]byte("test output2"),
 				[]byte("test output3"),
 				[]byte("test output4"),
 			},
@@ -2160,11 +2031,6 @@ func TestGitRemoveComponent(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", componentPath},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -2183,13 +2049,11 @@ func TestGitRemoveComponent(t *testing.T) {
 					nil,
 					nil,
 					nil,
-					nil,
 				},
 			},
 			outputs: [][]byte{
 				[]byte("test output1"),
 				[]byte("test output2"),
-				[]byte("test output3"),
 				[]byte("test output4"),
 				[]byte("test output5"),
 			},
@@ -2204,11 +2068,6 @@ func TestGitRemoveComponent(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", componentPath},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -2217,7 +2076,7 @@ func TestGitRemoveComponent(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 			},
 			wantErrString: "failed to check git diff in repository \"/fake/path/test-component\" \"test output1\": Permission Denied",
@@ -2233,14 +2092,12 @@ func TestGitRemoveComponent(t *testing.T) {
 					nil,
 					nil,
 					nil,
-					nil,
 				},
 			},
 			outputs: [][]byte{
 				[]byte("test output1"),
 				[]byte("test output2"),
 				[]byte("test output3"),
-				[]byte("test output4"),
 				[]byte("test output5"),
 				[]byte("test output6"),
 			},
@@ -2255,11 +2112,6 @@ func TestGitRemoveComponent(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", componentPath},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -2268,7 +2120,7 @@ func TestGitRemoveComponent(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -2290,7 +2142,6 @@ func TestGitRemoveComponent(t *testing.T) {
 					nil,
 					nil,
 					nil,
-					nil,
 				},
 			},
 			outputs: [][]byte{
@@ -2298,7 +2149,6 @@ func TestGitRemoveComponent(t *testing.T) {
 				[]byte("test output2 refs/heads/main"),
 				[]byte("test output3"),
 				[]byte("test output4"),
-				[]byte("test output5"),
 				[]byte("test output6"),
 				[]byte("test output7"),
 			},
@@ -2313,11 +2163,6 @@ func TestGitRemoveComponent(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", componentPath},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -2326,7 +2171,7 @@ func TestGitRemoveComponent(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -2354,7 +2199,6 @@ func TestGitRemoveComponent(t *testing.T) {
 					nil,
 					nil,
 					nil,
-					nil,
 				},
 			},
 			outputs: [][]byte{
@@ -2363,7 +2207,6 @@ func TestGitRemoveComponent(t *testing.T) {
 				[]byte("test output3 refs/heads/main"),
 				[]byte("test output4"),
 				[]byte("test output5"),
-				[]byte("test output6"),
 				[]byte("test output7"),
 				[]byte("test output8"),
 			},
@@ -2378,11 +2221,6 @@ func TestGitRemoveComponent(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", componentPath},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -2391,7 +2229,7 @@ func TestGitRemoveComponent(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -2406,7 +2244,7 @@ func TestGitRemoveComponent(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"commit", "-m", fmt.Sprintf("Removed component %s", componentName)},
+					Args:    []string{"commit", "-m", withTrailers(fmt.Sprintf("Removed component %s", componentName), []CommitTrailers{{Component: componentName}}, defaultCreatedBy)},
 				},
 			},
 			wantErrString: "failed to commit files to repository \"/fake/path/test-component\" \"test output1\": Fatal error",
@@ -2425,7 +2263,6 @@ func TestGitRemoveComponent(t *testing.T) {
 					nil,
 					nil,
 					nil,
-					nil,
 				},
 			},
 			outputs: [][]byte{
@@ -2435,7 +2272,6 @@ func TestGitRemoveComponent(t *testing.T) {
 				[]byte("test output4 refs/heads/main"),
 				[]byte("test output5"),
 				[]byte("test output6"),
-				[]byte("test output7"),
 				[]byte("test output8"),
 				[]byte("test output8"),
 			},
@@ -2450,11 +2286,6 @@ func TestGitRemoveComponent(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", componentPath},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -2463,7 +2294,7 @@ func TestGitRemoveComponent(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -2478,7 +2309,7 @@ func TestGitRemoveComponent(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"commit", "-m", fmt.Sprintf("Removed component %s", componentName)},
+					Args:    []string{"commit", "-m", withTrailers(fmt.Sprintf("Removed component %s", componentName), []CommitTrailers{{Component: componentName}}, defaultCreatedBy)},
 				},
 				{
 					BaseDir: repoPath,
@@ -2496,7 +2327,7 @@ func TestGitRemoveComponent(t *testing.T) {
 			outputStack := testutils.NewOutputs(tt.outputs...)
 			executedCmds := []testutils.Execution{}
 
-			execute = newTestExecute(outputStack, tt.errors, &executedCmds)
+			generator := NewGitopsGen(WithExecutor(newTestExecutor(outputStack, tt.errors, &executedCmds)), WithFilesystem(tt.fs))
 
 			if err := Generate(fs, repoPath, componentBasePath, tt.component); err != nil {
 				t.Errorf("unexpected error %v", err)
@@ -2509,13 +2340,14 @@ func TestGitRemoveComponent(t *testing.T) {
 				testutils.AssertErrorMatch(t, tt.wantErrString, err)
 			} else {
 				testutils.AssertNoError(t, err)
+				exists, err := fs.Exists(componentPath)
+				testutils.AssertNoError(t, err)
+				assert.False(t, exists, "the component should be deleted")
 			}
 
 			assert.Equal(t, tt.want, executedCmds, "command executed should be equal")
 		})
 	}
-
-	execute = originalExecute
 }
 
 func TestRemoveComponent(t *testing.T) {
@@ -2534,7 +2366,6 @@ func TestRemoveComponent(t *testing.T) {
 	branch := "main"
 	component.Name = "test-component"
 	fs := ioutils.NewMemoryFilesystem()
-	generator := NewGitopsGen()
 	tests := []struct {
 		name                string
 		fs                  afero.Afero
@@ -2558,7 +2389,6 @@ func TestRemoveComponent(t *testing.T) {
 				[]byte("test output4 refs/heads/main"),
 				[]byte("test output5"),
 				[]byte("test output6"),
-				[]byte("test output7"),
 				[]byte("test output8"),
 				[]byte("test output9"),
 			},
@@ -2573,11 +2403,6 @@ func TestRemoveComponent(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", componentPath},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -2586,7 +2411,7 @@ func TestRemoveComponent(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -2601,7 +2426,7 @@ func TestRemoveComponent(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"commit", "-m", fmt.Sprintf("Removed component %s", componentName)},
+					Args:    []string{"commit", "-m", withTrailers(fmt.Sprintf("Removed component %s", componentName), []CommitTrailers{{Component: componentName}}, defaultCreatedBy)},
 				},
 				{
 					BaseDir: repoPath,
@@ -2686,7 +2511,6 @@ func TestRemoveComponent(t *testing.T) {
 				[]byte("test output4 refs/heads/main"),
 				[]byte("test output5"),
 				[]byte("test output6"),
-				[]byte("test output7"),
 				[]byte("test output8"),
 				[]byte("test output9"),
 				[]byte("test output10"),
@@ -2707,11 +2531,6 @@ func TestRemoveComponent(t *testing.T) {
 					Command: "git",
 					Args:    []string{"checkout", "-b", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", componentPath},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -2720,7 +2539,7 @@ func TestRemoveComponent(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -2735,7 +2554,7 @@ func TestRemoveComponent(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"commit", "-m", fmt.Sprintf("Removed component %s", componentName)},
+					Args:    []string{"commit", "-m", withTrailers(fmt.Sprintf("Removed component %s", componentName), []CommitTrailers{{Component: componentName}}, defaultCreatedBy)},
 				},
 				{
 					BaseDir: repoPath,
@@ -2746,18 +2565,16 @@ func TestRemoveComponent(t *testing.T) {
 			wantCloneErrString: "",
 		},
 		{
-			name:      "rm -rf failure",
-			fs:        fs,
+			name:      "Delete failure",
+			fs:        afero.Afero{Fs: afero.NewReadOnlyFs(fs.Fs)},
 			component: component,
 			errors: &testutils.ErrorStack{
 				Errors: []error{
-					errors.New("Permission Denied"),
 					nil,
 					nil,
 				},
 			},
 			outputs: [][]byte{
-				[]byte("test output1"),
 				[]byte("test output2"),
 				[]byte("test output3"),
 			},
@@ -2772,13 +2589,8 @@ func TestRemoveComponent(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", componentPath},
-				},
 			},
-			wantRemoveErrString: "failed to delete \"/fake/path/test-component/components/test-component\" folder in repository in \"/fake/path/test-component\" \"test output1\": Permission Denied",
+			wantRemoveErrString: "failed to delete \"/fake/path/test-component/components/test-component\" folder in repository in \"/fake/path/test-component\" \"\": operation not permitted",
 		},
 		{
 			name:      "git add failure",
@@ -2789,12 +2601,10 @@ func TestRemoveComponent(t *testing.T) {
 					errors.New("Fatal error"),
 					nil,
 					nil,
-					nil,
 				},
 			},
 			outputs: [][]byte{
 				[]byte("test output1"),
-				[]byte("test output2"),
 				[]byte("test output3"),
 				[]byte("test output4"),
 			},
@@ -2809,11 +2619,6 @@ func TestRemoveComponent(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", componentPath},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -2832,13 +2637,11 @@ func TestRemoveComponent(t *testing.T) {
 					nil,
 					nil,
 					nil,
-					nil,
 				},
 			},
 			outputs: [][]byte{
 				[]byte("test output1"),
 				[]byte("test output2"),
-				[]byte("test output3"),
 				[]byte("test output4"),
 				[]byte("test output5"),
 			},
@@ -2853,11 +2656,6 @@ func TestRemoveComponent(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", componentPath},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -2866,7 +2664,7 @@ func TestRemoveComponent(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 			},
 			wantPushErrString: "failed to check git diff in repository \"/fake/path/test-component\" \"test output1\": Permission Denied",
@@ -2882,14 +2680,12 @@ func TestRemoveComponent(t *testing.T) {
 					nil,
 					nil,
 					nil,
-					nil,
 				},
 			},
 			outputs: [][]byte{
 				[]byte("test output1"),
 				[]byte("test output2"),
 				[]byte("test output3"),
-				[]byte("test output4"),
 				[]byte("test output5"),
 				[]byte("test output6"),
 			},
@@ -2904,11 +2700,6 @@ func TestRemoveComponent(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", componentPath},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -2917,7 +2708,7 @@ func TestRemoveComponent(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -2939,7 +2730,6 @@ func TestRemoveComponent(t *testing.T) {
 					nil,
 					nil,
 					nil,
-					nil,
 				},
 			},
 			outputs: [][]byte{
@@ -2947,7 +2737,6 @@ func TestRemoveComponent(t *testing.T) {
 				[]byte("test output2 refs/heads/main"),
 				[]byte("test output3"),
 				[]byte("test output4"),
-				[]byte("test output5"),
 				[]byte("test output6"),
 				[]byte("test output7"),
 			},
@@ -2962,11 +2751,6 @@ func TestRemoveComponent(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", componentPath},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -2975,7 +2759,7 @@ func TestRemoveComponent(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -3003,7 +2787,6 @@ func TestRemoveComponent(t *testing.T) {
 					nil,
 					nil,
 					nil,
-					nil,
 				},
 			},
 			outputs: [][]byte{
@@ -3012,7 +2795,6 @@ func TestRemoveComponent(t *testing.T) {
 				[]byte("test output3 refs/heads/main"),
 				[]byte("test output4"),
 				[]byte("test output5"),
-				[]byte("test output6"),
 				[]byte("test output7"),
 				[]byte("test output8"),
 			},
@@ -3027,11 +2809,6 @@ func TestRemoveComponent(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", componentPath},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -3040,7 +2817,7 @@ func TestRemoveComponent(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -3055,7 +2832,7 @@ func TestRemoveComponent(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"commit", "-m", fmt.Sprintf("Removed component %s", componentName)},
+					Args:    []string{"commit", "-m", withTrailers(fmt.Sprintf("Removed component %s", componentName), []CommitTrailers{{Component: componentName}}, defaultCreatedBy)},
 				},
 			},
 			wantPushErrString: "failed to commit files to repository \"/fake/path/test-component\" \"test output1\": Fatal error",
@@ -3074,7 +2851,6 @@ func TestRemoveComponent(t *testing.T) {
 					nil,
 					nil,
 					nil,
-					nil,
 				},
 			},
 			outputs: [][]byte{
@@ -3084,7 +2860,6 @@ func TestRemoveComponent(t *testing.T) {
 				[]byte("test output4 refs/heads/main"),
 				[]byte("test output5"),
 				[]byte("test output6"),
-				[]byte("test output7"),
 				[]byte("test output8"),
 				[]byte("test output9"),
 			},
@@ -3099,11 +2874,6 @@ func TestRemoveComponent(t *testing.T) {
 					Command: "git",
 					Args:    []string{"switch", "main"},
 				},
-				{
-					BaseDir: repoPath,
-					Command: "rm",
-					Args:    []string{"-rf", componentPath},
-				},
 				{
 					BaseDir: repoPath,
 					Command: "git",
@@ -3112,7 +2882,7 @@ func TestRemoveComponent(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"--no-pager", "diff", "--cached"},
+					Args:    []string{"--no-pager", "diff", "--cached", "--name-only"},
 				},
 				{
 					BaseDir: repoPath,
@@ -3127,7 +2897,7 @@ func TestRemoveComponent(t *testing.T) {
 				{
 					BaseDir: repoPath,
 					Command: "git",
-					Args:    []string{"commit", "-m", fmt.Sprintf("Removed component %s", componentName)},
+					Args:    []string{"commit", "-m", withTrailers(fmt.Sprintf("Removed component %s", componentName), []CommitTrailers{{Component: componentName}}, defaultCreatedBy)},
 				},
 				{
 					BaseDir: repoPath,
@@ -3144,7 +2914,7 @@ func TestRemoveComponent(t *testing.T) {
 			outputStack := testutils.NewOutputs(tt.outputs...)
 			executedCmds := []testutils.Execution{}
 
-			execute = newTestExecute(outputStack, tt.errors, &executedCmds)
+			generator := NewGitopsGen(WithExecutor(newTestExecutor(outputStack, tt.errors, &executedCmds)), WithFilesystem(tt.fs))
 
 			if err := Generate(fs, repoPath, componentBasePath, tt.component); err != nil {
 				t.Errorf("unexpected error %v", err)
@@ -3161,12 +2931,15 @@ func TestRemoveComponent(t *testing.T) {
 
 			if tt.wantCloneErrString == "" {
 
-				err = removeComponent(outputPath, tt.component.Name, "/")
+				err = generator.removeComponent(outputPath, tt.component.Name, "/")
 
 				if tt.wantRemoveErrString != "" {
 					testutils.AssertErrorMatch(t, tt.wantRemoveErrString, err)
 				} else {
 					testutils.AssertNoError(t, err)
+					exists, err := fs.Exists(componentPath)
+					testutils.AssertNoError(t, err)
+					assert.False(t, exists, "the component should be deleted")
 				}
 
 				if tt.wantRemoveErrString == "" {
@@ -3186,7 +2959,6 @@ func TestRemoveComponent(t *testing.T) {
 
 		})
 	}
-	execute = originalExecute
 }
 
 func TestExecute(t *testing.T) {
@@ -3213,12 +2985,7 @@ func TestExecute(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			outputStack := testutils.NewOutputs()
-			executedCmds := []testutils.Execution{}
-
-			execute = newTestExecute(outputStack, testutils.NewErrors(), &executedCmds)
-
-			_, err := execute(tt.outputPath, tt.command, tt.args)
+			_, err := ExecExecutor{}.Execute(context.Background(), tt.outputPath, tt.command, tt.args)
 
 			if tt.wantErr != nil && err != nil {
 				if tt.wantErr.Error() != err.Error() {
@@ -3235,7 +3002,122 @@ func TestExecute(t *testing.T) {
 			}
 		})
 	}
-	execute = originalExecute
+}
+
+func TestNewGitopsGen(t *testing.T) {
+	executedCmds := []testutils.Execution{}
+	recorder := newTestExecutor(testutils.NewOutputs(), testutils.NewErrors(), &executedCmds)
+
+	tests := []struct {
+		name string
+		opts []GenOption
+		want GitExecutor
+	}{
+		{
+			name: "Default executor",
+			want: ExecExecutor{},
+		},
+		{
+			name: "Custom executor",
+			opts: []GenOption{WithExecutor(recorder)},
+			want: recorder,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generator := NewGitopsGen(tt.opts...)
+			assert.Equal(t, tt.want, generator.Executor, "executor should be equal")
+
+			generator = NewGitopsGenWithLogger(generator.Log, tt.opts...)
+			assert.Equal(t, tt.want, generator.Executor, "executor should be equal")
+		})
+	}
+
+	// A zero value Gen falls back to the exec based executor
+	if _, err := (Gen{}).execute(context.Background(), "", "cd", "/"); err == nil || err.Error() != fmt.Sprintf(unsupportedCmdMsg, "cd") {
+		t.Errorf("TestNewGitopsGen() unexpected error for zero value Gen: %v", err)
+	}
+}
+
+func TestNewGitopsGenWithGoGitExecutor(t *testing.T) {
+	useInProcessFileTransport(t)
+	remote := "file://" + newBareRemote(t, "main")
+	fs := ioutils.NewMemoryFilesystem()
+	e := NewGoGitExecutor(fs)
+	run := func(baseDir string, args ...string) {
+		t.Helper()
+		_, err := e.Execute(context.Background(), baseDir, GitCommand, args...)
+		testutils.AssertNoError(t, err)
+	}
+	run("/upstream", "clone", remote, "repo")
+	run("/upstream/repo", "checkout", "-b", "main")
+	testutils.AssertNoError(t, writeFile(fs, "/upstream/repo/components/backend/base/deployment.yaml", []byte("a\n"), 0644))
+	run("/upstream/repo", "add", ".")
+	run("/upstream/repo", "-c", "user.name=Test User", "-c", "user.email=test@test.org", "commit", "-m", "seed")
+	run("/upstream/repo", "push", "origin", "main")
+
+	// Without WithFilesystem, the component is removed from the filesystem of the executor
+	generator := NewGitopsGen(WithExecutor(e), WithHostRegistry(util.NewHostRegistry(util.Host{Schemes: []string{"file"}})),
+		WithCommitOptions(CommitOptions{Author: &Identity{Name: "Test User", Email: "test@test.org"}}))
+	assert.Same(t, fs.Fs, generator.filesystem().Fs)
+	testutils.AssertNoError(t, generator.GitRemoveComponent("/output", remote, "backend", "main", ""))
+	exists, err := fs.Exists("/output/backend/components/backend")
+	testutils.AssertNoError(t, err)
+	assert.False(t, exists, "the component should be removed from the clone")
+}
+
+func TestWithContext(t *testing.T) {
+	executedCmds := []testutils.Execution{}
+	generator := NewGitopsGen(WithExecutor(newTestExecutor(testutils.NewOutputs(), testutils.NewErrors(), &executedCmds)))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name      string
+		operation string
+		run       func() error
+	}{
+		{
+			name:      "Cancelled CommitAndPush",
+			operation: "CommitAndPush",
+			run: func() error {
+				return generator.CommitAndPushWithContext(ctx, "/fake/path", "", "https://github.com/testing/testing.git", "test-component", "main", "commit message")
+			},
+		},
+		{
+			name:      "Cancelled GitRemoveComponent reports the inner clone",
+			operation: "CloneRepo",
+			run: func() error {
+				return generator.GitRemoveComponentWithContext(ctx, "/fake/path", "https://github.com/testing/testing.git", "test-component", "main", "/")
+			},
+		},
+		{
+			name:      "Cancelled GetCommitIDFromRepo",
+			operation: "GetCommitIDFromRepo",
+			run: func() error {
+				_, err := generator.GetCommitIDFromRepoWithContext(ctx, ioutils.NewMemoryFilesystem(), "/fake/path")
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.run()
+			var cancelledErr *OperationCancelledError
+			if !errors.As(err, &cancelledErr) {
+				t.Fatalf("TestWithContext() expected an OperationCancelledError, got: %v", err)
+			}
+			testutils.AssertErrorMatch(t, tt.operation+" operation was cancelled", err)
+			assert.True(t, errors.Is(err, context.Canceled), "error should match context.Canceled")
+		})
+	}
+	assert.Empty(t, executedCmds, "no command should be executed once the context is cancelled")
+
+	// The exec based executor does not start the command once the context is cancelled
+	_, err := ExecExecutor{}.Execute(ctx, "", GitCommand, "help")
+	assert.Error(t, err)
 }
 
 func TestGenerateAndPush(t *testing.T) {
@@ -3248,7 +3130,6 @@ func TestGenerateAndPush(t *testing.T) {
 	}
 	component.Name = "test-component"
 	fs := ioutils.NewMemoryFilesystem()
-	generator := NewGitopsGen()
 	tests := []struct {
 		name          string
 		fs            afero.Afero
@@ -3296,7 +3177,7 @@ func TestGenerateAndPush(t *testing.T) {
 			outputStack := testutils.NewOutputs(tt.outputs...)
 			executedCmds := []testutils.Execution{}
 			component.GitSource.URL = tt.repo
-			execute = newTestExecute(outputStack, tt.errors, &executedCmds)
+			generator := NewGitopsGen(WithExecutor(newTestExecutor(outputStack, tt.errors, &executedCmds)))
 			err := generator.GenerateAndPush(outputPath, repo, tt.component, tt.fs, "main", tt.doPush, "KAM CLI")
 
 			if tt.wantErrString != "" {
@@ -3308,7 +3189,116 @@ func TestGenerateAndPush(t *testing.T) {
 			assert.Equal(t, tt.want, executedCmds, "command executed should be equal")
 		})
 	}
-	execute = originalExecute
+}
+
+func TestSplitRepoPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		wantOrg  string
+		wantRepo string
+	}{
+		{
+			name:     "Organization and repository",
+			url:      "https://github.com/org/repo",
+			wantOrg:  "org",
+			wantRepo: "repo",
+		},
+		{
+			name:     "Repository with the .git suffix",
+			url:      "https://github.com/org/repo.git",
+			wantOrg:  "org",
+			wantRepo: "repo",
+		},
+		{
+			name:     "GitLab subgroup",
+			url:      "https://gitlab.com/group/subgroup/repo.git",
+			wantOrg:  "group",
+			wantRepo: "subgroup/repo",
+		},
+		{
+			name: "Organization only",
+			url:  "https://github.com/org",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			testutils.AssertNoError(t, err)
+			org, repo := splitRepoPath(u.Path)
+			assert.Equal(t, tt.wantOrg, org)
+			assert.Equal(t, tt.wantRepo, repo)
+		})
+	}
+}
+
+func TestRemoveAll(t *testing.T) {
+	fs := ioutils.NewMemoryFilesystem()
+	for _, path := range []string{"/repo/components/a/base/deployment.yaml", "/repo/.git/HEAD", "/outside/file"} {
+		testutils.AssertNoError(t, writeFile(fs, path, []byte("a\n"), 0644))
+	}
+	tests := []struct {
+		name          string
+		path          string
+		wantErrString string
+	}{
+		{
+			name: "Relative path",
+			path: "components/a",
+		},
+		{
+			name: "Missing path",
+			path: "/repo/components/b/base",
+		},
+		{
+			name:          "Path outside of the repository",
+			path:          "components/../../outside",
+			wantErrString: "\"/outside\" is not a folder within the repository",
+		},
+		{
+			name:          "Repository",
+			path:          "/repo/components/..",
+			wantErrString: "\"/repo\" is not a folder within the repository",
+		},
+		{
+			name:          "Git folder",
+			path:          ".git",
+			wantErrString: "\"/repo/.git\" is not a folder within the repository",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := removeAll(fs, "/repo", tt.path)
+			if tt.wantErrString != "" {
+				testutils.AssertErrorMatch(t, tt.wantErrString, err)
+			} else {
+				testutils.AssertNoError(t, err)
+			}
+		})
+	}
+	exists, err := fs.Exists("/repo/components/a")
+	testutils.AssertNoError(t, err)
+	assert.False(t, exists, "the relative path should be deleted")
+	for _, path := range []string{"/repo/.git/HEAD", "/outside/file"} {
+		exists, err := fs.Exists(path)
+		testutils.AssertNoError(t, err)
+		assert.True(t, exists, "%s should not be deleted", path)
+	}
+
+	t.Run("Symbolic link", func(t *testing.T) {
+		dir := t.TempDir()
+		osFs := ioutils.NewFilesystem()
+		testutils.AssertNoError(t, writeFile(osFs, filepath.Join(dir, "outside", "base", "deployment.yaml"), []byte("a\n"), 0644))
+		testutils.AssertNoError(t, osFs.MkdirAll(filepath.Join(dir, "repo", "components"), 0755))
+		if err := os.Symlink(filepath.Join(dir, "outside"), filepath.Join(dir, "repo", "components", "a")); err != nil {
+			t.Skipf("symbolic links are not supported: %v", err)
+		}
+		err := removeAll(osFs, filepath.Join(dir, "repo"), filepath.Join("components", "a", "base"))
+		testutils.AssertErrorMatch(t, "goes through the symbolic link", err)
+		exists, err := osFs.Exists(filepath.Join(dir, "outside", "base", "deployment.yaml"))
+		testutils.AssertNoError(t, err)
+		assert.True(t, exists, "the target of the link should not be deleted")
+	})
 }
 
 func TestGetCommitIDFromRepo(t *testing.T) {
@@ -3328,7 +3318,6 @@ func TestGetCommitIDFromRepo(t *testing.T) {
 		t.Errorf("unexpected error: %v", err)
 	}
 
-	generator := NewGitopsGen()
 	tests := []struct {
 		name        string
 		useMockExec bool
@@ -3362,11 +3351,12 @@ func TestGetCommitIDFromRepo(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 
+			generator := NewGitopsGen()
 			if tt.useMockExec {
 				outputStack := testutils.NewOutputs()
 				executedCmds := []testutils.Execution{}
 
-				execute = newTestExecute(outputStack, testutils.NewErrors(), &executedCmds)
+				generator = NewGitopsGen(WithExecutor(newTestExecutor(outputStack, testutils.NewErrors(), &executedCmds)))
 			}
 
 			commitID, err := generator.GetCommitIDFromRepo(fs, tt.repoPath)
@@ -3382,18 +3372,17 @@ func TestGetCommitIDFromRepo(t *testing.T) {
 			}
 		})
 	}
-	execute = originalExecute
 }
 
 // createEmptyGitRepository generates an empty git repository under the specified folder
 func createEmptyGitRepository(repoPath string) error {
 	// Initialize the Git repository
-	if out, err := execute(repoPath, GitCommand, "init"); err != nil {
+	if out, err := (ExecExecutor{}).Execute(context.Background(), repoPath, GitCommand, "init"); err != nil {
 		return fmt.Errorf("Unable to intialize git repository in %q %q: %s", repoPath, out, err)
 	}
 
 	// Create an empty commit
-	if out, err := execute(repoPath, GitCommand, "-c", "user.name='Test User'", "-c", "user.email='test@test.org'", "commit", "--allow-empty", "-m", "\"Empty commit\""); err != nil {
+	if out, err := (ExecExecutor{}).Execute(context.Background(), repoPath, GitCommand, "-c", "user.name='Test User'", "-c", "user.email='test@test.org'", "commit", "--allow-empty", "-m", "\"Empty commit\""); err != nil {
 		return fmt.Errorf("Unable to create empty commit in %q %q: %s", repoPath, out, err)
 	}
 	return nil
@@ -3427,11 +3416,20 @@ func mockExecute(outputStack *testutils.OutputStack, errorStack *testutils.Error
 	return []byte(""), fmt.Errorf("Unsupported command \"%s\" ", string(cmd)), executedCmds
 }
 
-func newTestExecute(outputStack *testutils.OutputStack, errorStack *testutils.ErrorStack, executedCmds *[]testutils.Execution) func(baseDir string, cmd CommandType, args ...string) ([]byte, error) {
-	return func(baseDir string, cmd CommandType, args ...string) ([]byte, error) {
-		var output []byte
-		var execErr error
-		output, execErr, executedCmds = mockExecute(outputStack, errorStack, executedCmds, baseDir, cmd, args...)
-		return output, execErr
-	}
+// testExecutor is a GitExecutor that records the executed commands and returns canned outputs and errors
+type testExecutor struct {
+	outputStack  *testutils.OutputStack
+	errorStack   *testutils.ErrorStack
+	executedCmds *[]testutils.Execution
+}
+
+func newTestExecutor(outputStack *testutils.OutputStack, errorStack *testutils.ErrorStack, executedCmds *[]testutils.Execution) *testExecutor {
+	return &testExecutor{outputStack: outputStack, errorStack: errorStack, executedCmds: executedCmds}
+}
+
+func (e *testExecutor) Execute(ctx context.Context, baseDir string, cmd CommandType, args ...string) ([]byte, error) {
+	var output []byte
+	var execErr error
+	output, execErr, e.executedCmds = mockExecute(e.outputStack, e.errorStack, e.executedCmds, baseDir, cmd, args...)
+	return output, execErr
 }
@@ -0,0 +1,149 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	gitopsv1alpha1 "github.com/redhat-developer/gitops-generator/api/v1alpha1"
+	"github.com/redhat-developer/gitops-generator/pkg/testutils"
+	"github.com/redhat-developer/gitops-generator/pkg/util"
+	"github.com/redhat-developer/gitops-generator/pkg/util/ioutils"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+// newServedGen returns a Gen against the repositories of the ScmServer, using the GoGitExecutor on the filesystem unless
+// the options set another executor
+func newServedGen(api *testutils.ScmServer, fs afero.Afero, opts ...GenOption) Gen {
+	hosts := util.NewHostRegistry(util.Host{Hostname: api.Git.Host(), Driver: "github", APIURL: api.URL, Schemes: []string{"http"}})
+	return NewGitopsGen(append([]GenOption{
+		WithExecutor(NewGoGitExecutor(fs)), WithFilesystem(fs), WithHostRegistry(hosts),
+		WithCommitOptions(CommitOptions{Author: &Identity{Name: "Generator", Email: "generator@test.org"}}),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}),
+	}, opts...)...)
+}
+
+// pushedFiles returns the files of the commit at the head of the branch of the repository served by the GitServer
+func pushedFiles(t *testing.T, server *testutils.GitServer, fullName string, branch string) []string {
+	t.Helper()
+	r, err := server.Repository(fullName)
+	testutils.AssertNoError(t, err)
+	ref, err := r.Reference(plumbing.NewBranchReferenceName(branch), true)
+	testutils.AssertNoError(t, err)
+	commit, err := r.CommitObject(ref.Hash())
+	testutils.AssertNoError(t, err)
+	files, err := commit.Files()
+	testutils.AssertNoError(t, err)
+	var names []string
+	testutils.AssertNoError(t, files.ForEach(func(f *object.File) error {
+		names = append(names, f.Name)
+		return nil
+	}))
+	return names
+}
+
+func TestGitServerEndToEnd(t *testing.T) {
+	tests := []struct {
+		name string
+		// newExecutor returns the executor and the filesystem it works on, along with the folder to generate in
+		newExecutor func(t *testing.T) (GitExecutor, afero.Afero, string)
+		// wantUnauthorized matches the error of a clone without the token
+		wantUnauthorized string
+	}{
+		{
+			name: "ExecExecutor",
+			newExecutor: func(t *testing.T) (GitExecutor, afero.Afero, string) {
+				if _, err := exec.LookPath("git"); err != nil {
+					t.Skip("git is not installed")
+				}
+				// git fails instead of prompting for the missing credentials
+				t.Setenv("GIT_TERMINAL_PROMPT", "0")
+				return ExecExecutor{}, ioutils.NewFilesystem(), t.TempDir()
+			},
+			wantUnauthorized: "terminal prompts disabled",
+		},
+		{
+			name: "GoGitExecutor",
+			newExecutor: func(t *testing.T) (GitExecutor, afero.Afero, string) {
+				fs := ioutils.NewMemoryFilesystem()
+				return NewGoGitExecutor(fs), fs, "/"
+			},
+			wantUnauthorized: "authentication required",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor, fs, root := tt.newExecutor(t)
+			api := testutils.NewScmServer(t, "test-user")
+			api.Git.Token = "secret-token"
+			remote := api.Git.Remote("shop/gitops")
+			component := func(name string) gitopsv1alpha1.GeneratorOptions {
+				options := gitopsv1alpha1.GeneratorOptions{ContainerImage: "quay.io/shop/" + name + ":v1", TargetPort: 5000,
+					GitSource: &gitopsv1alpha1.GitSource{URL: api.Git.URL + "/shop/gitops.git"}, Secret: api.Git.Token}
+				options.Name = name
+				return options
+			}
+			newGen := func(opts ...GenOption) Gen {
+				return newServedGen(api, fs, append([]GenOption{WithExecutor(executor)}, opts...)...)
+			}
+			// git clones in an existing folder
+			outputPath := func(name string) string {
+				t.Helper()
+				path := filepath.Join(root, name)
+				testutils.AssertNoError(t, fs.MkdirAll(path, 0755))
+				return path
+			}
+			gen := newGen(WithRepositoryOptions(RepositoryOptions{Description: "GitOps resources of the shop", Webhook: &WebhookOptions{URL: "https://argocd.example.com/api/webhook"}}))
+
+			// The repository is created through the API, and the generated resources are pushed to it over HTTP
+			testutils.AssertNoError(t, gen.GenerateAndPush(outputPath("generated"), remote, component("frontend"), fs, "main", true, "KAM CLI"))
+			repo, ok := api.Repository("shop/gitops")
+			assert.True(t, ok, "the repository should be created")
+			assert.Equal(t, "GitOps resources of the shop", repo.Description)
+			assert.Len(t, repo.Hooks, 1)
+			assert.Contains(t, pushedFiles(t, api.Git, "shop/gitops", "main"), "components/frontend/base/deployment.yaml")
+
+			// Another component is added to a clone of the repository
+			testutils.AssertNoError(t, newGen().CloneGenerateAndPush(outputPath("cloned"), remote, component("backend"), fs, "main", "", true))
+			assert.Contains(t, pushedFiles(t, api.Git, "shop/gitops", "main"), "components/backend/base/deployment.yaml")
+			assert.Equal(t, 2, api.Git.Pushes("shop/gitops"))
+
+			// A push rejected because of a concurrent push is rebased and retried
+			api.Git.RejectPushes("shop/gitops", "fetch first", 1)
+			testutils.AssertNoError(t, newGen().CloneGenerateAndPush(outputPath("retried"), remote, component("payment"), fs, "main", "", true))
+			assert.Contains(t, pushedFiles(t, api.Git, "shop/gitops", "main"), "components/payment/base/deployment.yaml")
+			assert.Equal(t, 3, api.Git.Pushes("shop/gitops"))
+
+			// A push rejected by the Git host is not
+			api.Git.RejectPushes("shop/gitops", "protected branch hook declined", -1)
+			err := newGen().CloneGenerateAndPush(outputPath("declined"), remote, component("cart"), fs, "main", "", true)
+			testutils.AssertErrorMatch(t, "protected branch hook declined", err)
+			assert.NotContains(t, pushedFiles(t, api.Git, "shop/gitops", "main"), "components/cart/base/deployment.yaml")
+			api.Git.RejectPushes("shop/gitops", "", 0)
+
+			// The token is required
+			err = newGen().CloneGenerateAndPush(outputPath("unauthorized"), api.Git.URL+"/shop/gitops.git", component("cart"), fs, "main", "", true)
+			testutils.AssertErrorMatch(t, tt.wantUnauthorized, err)
+			assert.Equal(t, 3, api.Git.Pushes("shop/gitops"))
+		})
+	}
+}
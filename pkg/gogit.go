@@ -0,0 +1,1353 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/redhat-developer/gitops-generator/pkg/util"
+	"github.com/redhat-developer/gitops-generator/pkg/util/ioutils"
+	"github.com/spf13/afero"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// authorPattern matches the "Name <email>" value of commit --author
+var authorPattern = regexp.MustCompile(`^(.+) <(.+)>$`)
+
+// GoGitExecutor is a GitExecutor that runs the git commands in-process with go-git, so that no git binary is needed.
+// Repositories are read from and written to the afero filesystem it was created with, which should be the same
+// filesystem passed to the Gen methods.
+//
+// Only the commands issued by Gen are supported: clone [--depth=<n>], switch, checkout -b, add,
+// diff --cached --name-only, ls-remote --heads, pull, fetch, rebase, commit [--author] -m, push, init, branch -m,
+// remote add|set-url, rev-parse, ls-tree -r -l -z, ls-files -z -t --cached --others --exclude-standard, show <rev>:<path>..., cat-file commit, hash-object -t commit -w,
+// update-ref, reset --hard, clean -fd, log --format, revert --no-commit and sparse-checkout, along with "rm -rf". Pull
+// only supports fast-forward updates, as go-git cannot merge divergent histories. Rebase and revert only apply commits
+// whose changes do not overlap with the upstream changes. As go-git has no sparse checkout, the whole tree is always
+// checked out.
+type GoGitExecutor struct {
+	fs afero.Afero
+}
+
+// NewGoGitExecutor returns a GoGitExecutor working against the given filesystem
+func NewGoGitExecutor(fs afero.Afero) *GoGitExecutor {
+	return &GoGitExecutor{fs: fs}
+}
+
+// Execute runs the command against the repository found in the baseDir folder. The context aborts the network
+// operations of clone, ls-remote, pull, fetch and push. The remotes are accessed with the credentials of their URL, if
+// any: Gen passes the authentication of its Credentials and SSHAuth to the executor instead of the git options.
+func (e *GoGitExecutor) Execute(ctx context.Context, baseDir string, cmd CommandType, args ...string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return []byte(""), err
+	}
+	switch cmd {
+	case GitCommand:
+		return e.git(ctx, baseDir, args, nil)
+	case RmCommand:
+		return e.rm(baseDir, args)
+	}
+	return []byte(""), fmt.Errorf(unsupportedCmdMsg, string(cmd))
+}
+
+// executeRemote runs the git command accessing a remote with the authentication, nil to use the credentials of the
+// remote URL
+func (e *GoGitExecutor) executeRemote(ctx context.Context, baseDir string, auth transport.AuthMethod, args ...string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return []byte(""), err
+	}
+	return e.git(ctx, baseDir, args, auth)
+}
+
+// gitArgs holds the parsed arguments of a git command line
+type gitArgs struct {
+	// config holds the values set with "-c key=value"
+	config map[string]string
+	// flags holds the options of the sub command, e.g. "-b" or "--heads"
+	flags map[string]bool
+	// positional holds the non-option arguments of the sub command
+	positional []string
+	// auth authenticates the commands accessing a remote, nil to use the credentials of the remote URL
+	auth transport.AuthMethod
+}
+
+// parseGitArgs splits a git command line into its sub command and arguments. Options are assumed to never take a
+// value, which holds for all the commands issued by Gen. The value of "commit -m" is returned as a positional argument.
+func parseGitArgs(args []string) (string, gitArgs) {
+	parsed := gitArgs{config: map[string]string{}, flags: map[string]bool{}}
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		if args[0] == "-c" && len(args) > 1 {
+			kv := strings.SplitN(args[1], "=", 2)
+			if len(kv) == 2 {
+				parsed.config[kv[0]] = strings.Trim(kv[1], "'\"")
+			}
+			args = args[2:]
+			continue
+		}
+		// global options such as --no-pager do not affect the result
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return "", parsed
+	}
+	for _, arg := range args[1:] {
+		if strings.HasPrefix(arg, "-") {
+			parsed.flags[arg] = true
+		} else {
+			parsed.positional = append(parsed.positional, arg)
+		}
+	}
+	return args[0], parsed
+}
+
+func (e *GoGitExecutor) git(ctx context.Context, baseDir string, args []string, auth transport.AuthMethod) ([]byte, error) {
+	subCmd, parsed := parseGitArgs(args)
+	parsed.auth = auth
+	switch subCmd {
+	case "clone":
+		return e.clone(ctx, baseDir, parsed)
+	case "switch":
+		return e.switchBranch(baseDir, parsed)
+	case "checkout":
+		return e.checkout(baseDir, parsed)
+	case "add":
+		return e.add(baseDir, parsed)
+	case "diff":
+		return e.diff(baseDir, parsed)
+	case "ls-remote":
+		return e.lsRemote(ctx, parsed)
+	case "pull":
+		return e.pull(ctx, baseDir, parsed)
+	case "fetch":
+		return e.fetch(ctx, baseDir, parsed)
+	case "rebase":
+		return e.rebase(baseDir, parsed)
+	case "commit":
+		return e.commit(baseDir, parsed)
+	case "push":
+		return e.push(ctx, baseDir, parsed)
+	case "init":
+		return e.init(baseDir, parsed)
+	case "branch":
+		return e.renameBranch(baseDir, parsed)
+	case "remote":
+		return e.remote(baseDir, parsed)
+	case "rev-parse":
+		return e.revParse(baseDir, parsed)
+	case "ls-tree":
+		return e.lsTree(baseDir, parsed)
+	case "ls-files":
+		return e.lsFiles(baseDir, parsed)
+	case "show":
+		return e.show(baseDir, parsed)
+	case "cat-file":
+		return e.catFile(baseDir, parsed)
+	case "hash-object":
+		return e.hashObject(baseDir, parsed)
+	case "update-ref":
+		return e.updateRef(baseDir, parsed)
+	case "reset":
+		return e.reset(baseDir, parsed)
+	case "clean":
+		return e.clean(baseDir, parsed)
+	case "log":
+		return e.log(baseDir, parsed)
+	case "revert":
+		return e.revert(baseDir, parsed)
+	case "sparse-checkout":
+		// go-git has no sparse checkout, the whole tree is checked out instead
+		return []byte(""), nil
+	}
+	return []byte(""), fmt.Errorf("unsupported git command %q", strings.Join(args, " "))
+}
+
+// knownHostsCallback returns the callback checking the host keys against the known_hosts entries. The knownhosts
+// package only reads files from the OS filesystem, so the entries go through a temporary file.
+func knownHostsCallback(knownHosts []byte) (ssh.HostKeyCallback, error) {
+	f, err := ioutil.TempFile("", util.CredentialsDirPrefix)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(knownHosts)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return knownhosts.New(f.Name())
+}
+
+// storage returns the go-git storage for the .git folder of the repository at repoPath
+func (e *GoGitExecutor) storage(repoPath string) *filesystem.Storage {
+	return filesystem.NewStorage(ioutils.NewBillyFilesystem(e.fs, filepath.Join(repoPath, git.GitDirName)), cache.NewObjectLRUDefault())
+}
+
+// open opens the repository at repoPath along with its worktree
+func (e *GoGitExecutor) open(repoPath string) (*git.Repository, *git.Worktree, error) {
+	r, err := git.Open(e.storage(repoPath), ioutils.NewBillyFilesystem(e.fs, repoPath))
+	if err != nil {
+		return nil, nil, err
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, w, nil
+}
+
+// currentBranch returns the branch HEAD points to, even if the branch does not have any commit yet
+func currentBranch(r *git.Repository) (plumbing.ReferenceName, error) {
+	head, err := r.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return "", err
+	}
+	if head.Type() != plumbing.SymbolicReference {
+		return "", fmt.Errorf("HEAD is detached at %s", head.Hash())
+	}
+	return head.Target(), nil
+}
+
+func (e *GoGitExecutor) clone(ctx context.Context, baseDir string, args gitArgs) ([]byte, error) {
+	if len(args.positional) == 0 {
+		return []byte(""), errors.New("you must specify a repository to clone")
+	}
+	remote := args.positional[0]
+	dir := strings.TrimSuffix(filepath.Base(remote), ".git")
+	if len(args.positional) > 1 {
+		dir = args.positional[1]
+	}
+	repoPath := filepath.Join(baseDir, dir)
+
+	opts := &git.CloneOptions{URL: remote, Auth: args.auth}
+	for flag := range args.flags {
+		if strings.HasPrefix(flag, "--depth=") {
+			var err error
+			if opts.Depth, err = strconv.Atoi(strings.TrimPrefix(flag, "--depth=")); err != nil {
+				return []byte(""), fmt.Errorf("invalid depth %q", flag)
+			}
+		}
+	}
+	_, err := git.CloneContext(ctx, e.storage(repoPath), ioutils.NewBillyFilesystem(e.fs, repoPath), opts)
+	if errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		// Like git, cloning an empty repository succeeds. go-git has already initialized it with the origin remote.
+		return []byte("warning: You appear to have cloned an empty repository."), nil
+	}
+	if err != nil {
+		return []byte(""), err
+	}
+	return []byte(""), nil
+}
+
+func (e *GoGitExecutor) switchBranch(repoPath string, args gitArgs) ([]byte, error) {
+	if len(args.positional) != 1 {
+		return []byte(""), errors.New("switch expects a single branch name")
+	}
+	r, w, err := e.open(repoPath)
+	if err != nil {
+		return []byte(""), err
+	}
+	branch := plumbing.NewBranchReferenceName(args.positional[0])
+	if current, err := currentBranch(r); err == nil && current == branch {
+		return []byte(fmt.Sprintf("Already on '%s'", branch.Short())), nil
+	}
+
+	if _, err := r.Reference(branch, false); err == nil {
+		return []byte(""), w.Checkout(&git.CheckoutOptions{Branch: branch})
+	}
+
+	// As git does, create the local branch when a remote tracking branch of the same name exists
+	remoteRef, err := r.Reference(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, branch.Short()), true)
+	if err != nil {
+		return []byte(""), fmt.Errorf("invalid reference: %s", branch.Short())
+	}
+	if err := w.Checkout(&git.CheckoutOptions{Branch: branch, Hash: remoteRef.Hash(), Create: true}); err != nil {
+		return []byte(""), err
+	}
+	return []byte(""), r.CreateBranch(&config.Branch{Name: branch.Short(), Remote: git.DefaultRemoteName, Merge: branch})
+}
+
+func (e *GoGitExecutor) checkout(repoPath string, args gitArgs) ([]byte, error) {
+	if !args.flags["-b"] || len(args.positional) != 1 {
+		return []byte(""), errors.New("only checkout -b <branch> is supported")
+	}
+	r, w, err := e.open(repoPath)
+	if err != nil {
+		return []byte(""), err
+	}
+	branch := plumbing.NewBranchReferenceName(args.positional[0])
+	if _, err := r.Head(); errors.Is(err, plumbing.ErrReferenceNotFound) {
+		// There are no commits yet, the branch is created by the first commit
+		return []byte(""), r.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, branch))
+	} else if err != nil {
+		return []byte(""), err
+	}
+	return []byte(""), w.Checkout(&git.CheckoutOptions{Branch: branch, Create: true, Keep: true})
+}
+
+func (e *GoGitExecutor) add(repoPath string, args gitArgs) ([]byte, error) {
+	_, w, err := e.open(repoPath)
+	if err != nil {
+		return []byte(""), err
+	}
+	for _, path := range args.positional {
+		if path == "." {
+			err = w.AddWithOptions(&git.AddOptions{All: true})
+		} else {
+			_, err = w.Add(path)
+		}
+		if err != nil {
+			return []byte(""), err
+		}
+	}
+
+	// Stage the deleted files as well, which go-git does not do when adding a folder
+	status, err := w.Status()
+	if err != nil {
+		return []byte(""), err
+	}
+	for path, fileStatus := range status {
+		if fileStatus.Worktree == git.Deleted {
+			if _, err := w.Remove(path); err != nil {
+				return []byte(""), err
+			}
+		}
+	}
+	return []byte(""), nil
+}
+
+// diff only supports "diff --cached --name-only", and outputs the paths of the staged files
+func (e *GoGitExecutor) diff(repoPath string, args gitArgs) ([]byte, error) {
+	if !args.flags["--cached"] || !args.flags["--name-only"] {
+		return []byte(""), errors.New("only diff --cached --name-only is supported")
+	}
+	_, w, err := e.open(repoPath)
+	if err != nil {
+		return []byte(""), err
+	}
+	status, err := w.Status()
+	if err != nil {
+		return []byte(""), err
+	}
+	var paths []string
+	for path, fileStatus := range status {
+		if fileStatus.Staging != git.Unmodified && fileStatus.Staging != git.Untracked {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	var out strings.Builder
+	for _, path := range paths {
+		out.WriteString(path + "\n")
+	}
+	return []byte(out.String()), nil
+}
+
+func (e *GoGitExecutor) lsRemote(ctx context.Context, args gitArgs) ([]byte, error) {
+	if len(args.positional) == 0 {
+		return []byte(""), errors.New("ls-remote expects a remote")
+	}
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{args.positional[0]}})
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: args.auth})
+	if errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		return []byte(""), nil
+	} else if err != nil {
+		return []byte(""), err
+	}
+
+	var lines []string
+	for _, ref := range refs {
+		if args.flags["--heads"] && !ref.Name().IsBranch() {
+			continue
+		}
+		if !matchesRefPatterns(ref.Name(), args.positional[1:]) {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s\t%s\n", ref.Hash(), ref.Name()))
+	}
+	sort.Strings(lines)
+	return []byte(strings.Join(lines, "")), nil
+}
+
+// matchesRefPatterns matches the reference against the ls-remote patterns, which must match whole trailing components
+func matchesRefPatterns(name plumbing.ReferenceName, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if string(name) == pattern || strings.HasSuffix(string(name), "/"+pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// pull fast-forwards the current branch to its remote counterpart, keeping the local changes of the worktree as
+// long as they do not touch the files updated on the remote, like git does.
+func (e *GoGitExecutor) pull(ctx context.Context, repoPath string, args gitArgs) ([]byte, error) {
+	r, w, err := e.open(repoPath)
+	if err != nil {
+		return []byte(""), err
+	}
+	branch, err := currentBranch(r)
+	if err != nil {
+		return []byte(""), err
+	}
+	if err := r.FetchContext(ctx, &git.FetchOptions{RemoteName: git.DefaultRemoteName, Auth: args.auth}); err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return []byte(""), err
+	}
+	remoteRef, err := r.Reference(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, branch.Short()), true)
+	if err != nil {
+		return []byte(""), fmt.Errorf("couldn't find remote ref %s", branch)
+	}
+	remoteCommit, err := r.CommitObject(remoteRef.Hash())
+	if err != nil {
+		return []byte(""), err
+	}
+
+	var localTree *object.Tree
+	if head, err := r.Head(); err == nil {
+		if head.Hash() == remoteRef.Hash() {
+			return []byte("Already up to date."), nil
+		}
+		localCommit, err := r.CommitObject(head.Hash())
+		if err != nil {
+			return []byte(""), err
+		}
+		if ahead, err := remoteCommit.IsAncestor(localCommit); err != nil {
+			return []byte(""), err
+		} else if ahead {
+			return []byte("Already up to date."), nil
+		}
+		if ff, err := localCommit.IsAncestor(remoteCommit); err != nil {
+			return []byte(""), err
+		} else if !ff {
+			return []byte(""), git.ErrNonFastForwardUpdate
+		}
+		if localTree, err = localCommit.Tree(); err != nil {
+			return []byte(""), err
+		}
+	} else if !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return []byte(""), err
+	}
+
+	remoteTree, err := remoteCommit.Tree()
+	if err != nil {
+		return []byte(""), err
+	}
+	updated, err := changedPaths(localTree, remoteTree)
+	if err != nil {
+		return []byte(""), err
+	}
+	status, err := w.Status()
+	if err != nil {
+		return []byte(""), err
+	}
+	var conflicts []string
+	for path := range status {
+		if updated[path] {
+			conflicts = append(conflicts, path)
+		}
+	}
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return []byte(""), fmt.Errorf("your local changes to the following files would be overwritten by merge: %s", strings.Join(conflicts, ", "))
+	}
+
+	// Save the local changes, move the branch to the remote commit and restore them
+	saved := map[string][]byte{}
+	for path := range status {
+		content, err := e.fs.ReadFile(filepath.Join(repoPath, path))
+		if err == nil {
+			saved[path] = content
+		}
+	}
+	if localTree == nil {
+		// The branch has no commits yet, create it so that the reset can move it
+		if err := r.Storer.SetReference(plumbing.NewHashReference(branch, remoteRef.Hash())); err != nil {
+			return []byte(""), err
+		}
+	}
+	if err := w.Reset(&git.ResetOptions{Mode: git.HardReset, Commit: remoteRef.Hash()}); err != nil {
+		return []byte(""), err
+	}
+	for path, fileStatus := range status {
+		fullPath := filepath.Join(repoPath, path)
+		if content, ok := saved[path]; ok {
+			if err := e.fs.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+				return []byte(""), err
+			}
+			if err := e.fs.WriteFile(fullPath, content, 0644); err != nil {
+				return []byte(""), err
+			}
+		} else if err := e.fs.RemoveAll(fullPath); err != nil {
+			return []byte(""), err
+		}
+		if fileStatus.Staging == git.Unmodified || fileStatus.Staging == git.Untracked {
+			continue
+		}
+		if _, ok := saved[path]; ok {
+			_, err = w.Add(path)
+		} else {
+			_, err = w.Remove(path)
+		}
+		if err != nil {
+			return []byte(""), err
+		}
+	}
+	return []byte(fmt.Sprintf("Fast-forward to %s", remoteRef.Hash())), nil
+}
+
+// changedPaths returns the paths of the files that differ between the two trees. A nil from tree is treated as empty.
+func changedPaths(from, to *object.Tree) (map[string]bool, error) {
+	paths := map[string]bool{}
+	if from == nil {
+		err := to.Files().ForEach(func(f *object.File) error {
+			paths[f.Name] = true
+			return nil
+		})
+		return paths, err
+	}
+	changes, err := object.DiffTree(from, to)
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		if change.From.Name != "" {
+			paths[change.From.Name] = true
+		}
+		if change.To.Name != "" {
+			paths[change.To.Name] = true
+		}
+	}
+	return paths, nil
+}
+
+// fetch only supports "fetch <remote> [<branch>]", and updates the remote tracking branches
+func (e *GoGitExecutor) fetch(ctx context.Context, repoPath string, args gitArgs) ([]byte, error) {
+	if len(args.positional) == 0 || len(args.positional) > 2 {
+		return []byte(""), errors.New("fetch expects a remote and an optional branch")
+	}
+	r, _, err := e.open(repoPath)
+	if err != nil {
+		return []byte(""), err
+	}
+	remoteName := args.positional[0]
+	opts := &git.FetchOptions{RemoteName: remoteName, Auth: args.auth}
+	if len(args.positional) == 2 {
+		branch := plumbing.NewBranchReferenceName(args.positional[1])
+		opts.RefSpecs = []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", branch, plumbing.NewRemoteReferenceName(remoteName, branch.Short())))}
+	}
+	if err := r.FetchContext(ctx, opts); err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return []byte(""), err
+	}
+	return []byte(""), nil
+}
+
+// rebase only supports "rebase <upstream>" and "rebase --abort". The commits of the current branch that are not in
+// upstream are replayed on top of it, one at a time. A commit can only be replayed if every file it changes is
+// unchanged upstream, or already has the content of the commit. Otherwise the branch is left untouched and an error
+// is returned, so there is never a rebase in progress to abort.
+func (e *GoGitExecutor) rebase(repoPath string, args gitArgs) ([]byte, error) {
+	if args.flags["--abort"] {
+		return []byte(""), nil
+	}
+	if len(args.positional) != 1 {
+		return []byte(""), errors.New("rebase expects an upstream")
+	}
+	r, w, err := e.open(repoPath)
+	if err != nil {
+		return []byte(""), err
+	}
+	branch, err := currentBranch(r)
+	if err != nil {
+		return []byte(""), err
+	}
+	upstreamHash, err := r.ResolveRevision(plumbing.Revision(args.positional[0]))
+	if err != nil {
+		return []byte(""), fmt.Errorf("invalid upstream '%s'", args.positional[0])
+	}
+	upstream, err := r.CommitObject(*upstreamHash)
+	if err != nil {
+		return []byte(""), err
+	}
+	head, err := r.Head()
+	if err != nil {
+		return []byte(""), err
+	}
+	local, err := r.CommitObject(head.Hash())
+	if err != nil {
+		return []byte(""), err
+	}
+
+	if upToDate, err := upstream.IsAncestor(local); err != nil {
+		return []byte(""), err
+	} else if upToDate {
+		return []byte(fmt.Sprintf("Current branch %s is up to date.", branch.Short())), nil
+	}
+	bases, err := local.MergeBase(upstream)
+	if err != nil {
+		return []byte(""), err
+	}
+	if len(bases) == 0 {
+		return []byte(""), fmt.Errorf("no common ancestor between %s and %s", branch.Short(), args.positional[0])
+	}
+
+	// Collect the commits to replay, oldest first
+	var commits []*object.Commit
+	for c := local; c.Hash != bases[0].Hash; {
+		if c.NumParents() != 1 {
+			return []byte(""), fmt.Errorf("cannot rebase merge commit %s", c.Hash)
+		}
+		commits = append([]*object.Commit{c}, commits...)
+		if c, err = c.Parent(0); err != nil {
+			return []byte(""), err
+		}
+	}
+
+	if err := w.Reset(&git.ResetOptions{Mode: git.HardReset, Commit: upstream.Hash}); err != nil {
+		return []byte(""), err
+	}
+	tip := upstream
+	for _, c := range commits {
+		conflicts, err := e.replay(repoPath, w, tip, c)
+		if err == nil && len(conflicts) == 0 {
+			var hash plumbing.Hash
+			if hash, err = e.commitReplayed(w, tip, c); err == nil {
+				tip, err = r.CommitObject(hash)
+			}
+		}
+		if err != nil || len(conflicts) > 0 {
+			// Move the branch back to where it was before the rebase
+			if resetErr := w.Reset(&git.ResetOptions{Mode: git.HardReset, Commit: local.Hash}); resetErr != nil {
+				return []byte(""), resetErr
+			}
+		}
+		if err != nil {
+			return []byte(""), err
+		}
+		if len(conflicts) > 0 {
+			var out strings.Builder
+			for _, path := range conflicts {
+				out.WriteString(fmt.Sprintf("CONFLICT (content): Merge conflict in %s\n", path))
+			}
+			return []byte(out.String()), fmt.Errorf("could not apply %s... %s", c.Hash.String()[:7], strings.SplitN(c.Message, "\n", 2)[0])
+		}
+	}
+	return []byte(fmt.Sprintf("Successfully rebased and updated %s.", branch)), nil
+}
+
+// replay applies the changes of the commit to the worktree, which must be clean and at tip. The paths changed both
+// by the commit and since its parent on tip are returned as conflicts, in which case the worktree is left as is.
+func (e *GoGitExecutor) replay(repoPath string, w *git.Worktree, tip *object.Commit, c *object.Commit) ([]string, error) {
+	parent, err := c.Parent(0)
+	if err != nil {
+		return nil, err
+	}
+	parentTree, err := parent.Tree()
+	if err != nil {
+		return nil, err
+	}
+	commitTree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+	return e.applyChanges(repoPath, w, tip, parentTree, commitTree)
+}
+
+// applyChanges applies the changes from the from tree to the to tree to the worktree, which must be clean and at tip,
+// and stages them. The paths changed both between the trees and on tip are returned as conflicts, in which case the
+// worktree is left as is.
+func (e *GoGitExecutor) applyChanges(repoPath string, w *git.Worktree, tip *object.Commit, from *object.Tree, to *object.Tree) ([]string, error) {
+	tipTree, err := tip.Tree()
+	if err != nil {
+		return nil, err
+	}
+	changes, err := object.DiffTree(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var conflicts []string
+	for _, change := range changes {
+		name := change.To.Name
+		if name == "" {
+			name = change.From.Name
+		}
+		current := plumbing.ZeroHash
+		if f, err := tipTree.File(name); err == nil {
+			current = f.Hash
+		}
+		if current != change.From.TreeEntry.Hash && current != change.To.TreeEntry.Hash {
+			conflicts = append(conflicts, name)
+		}
+	}
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return conflicts, nil
+	}
+
+	for _, change := range changes {
+		_, to, err := change.Files()
+		if err != nil {
+			return nil, err
+		}
+		if to == nil {
+			if err := e.fs.RemoveAll(filepath.Join(repoPath, change.From.Name)); err != nil {
+				return nil, err
+			}
+			if _, err := w.Remove(change.From.Name); err != nil && !errors.Is(err, index.ErrEntryNotFound) {
+				return nil, err
+			}
+			continue
+		}
+		content, err := to.Contents()
+		if err != nil {
+			return nil, err
+		}
+		fullPath := filepath.Join(repoPath, change.To.Name)
+		if err := e.fs.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			return nil, err
+		}
+		if err := e.fs.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			return nil, err
+		}
+		if _, err := w.Add(change.To.Name); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// commitReplayed commits the staged changes with the message and author of the replayed commit. If the changes
+// were already upstream, nothing is committed and the tip is returned.
+func (e *GoGitExecutor) commitReplayed(w *git.Worktree, tip *object.Commit, c *object.Commit) (plumbing.Hash, error) {
+	status, err := w.Status()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	for _, fileStatus := range status {
+		if fileStatus.Staging != git.Unmodified && fileStatus.Staging != git.Untracked {
+			committer := c.Committer
+			committer.When = time.Now()
+			return w.Commit(c.Message, &git.CommitOptions{Author: &c.Author, Committer: &committer})
+		}
+	}
+	return tip.Hash, nil
+}
+
+func (e *GoGitExecutor) commit(repoPath string, args gitArgs) ([]byte, error) {
+	if len(args.positional) == 0 {
+		return []byte(""), errors.New("commit expects a message")
+	}
+	r, w, err := e.open(repoPath)
+	if err != nil {
+		return []byte(""), err
+	}
+	status, err := w.Status()
+	if err != nil {
+		return []byte(""), err
+	}
+	staged := false
+	for _, fileStatus := range status {
+		if fileStatus.Staging != git.Unmodified && fileStatus.Staging != git.Untracked {
+			staged = true
+			break
+		}
+	}
+	if !staged && !args.flags["--allow-empty"] {
+		return []byte("nothing to commit, working tree clean"), errors.New("nothing to commit")
+	}
+
+	// Like git, the configured identity is the committer, and the author unless --author is set
+	opts := &git.CommitOptions{}
+	now := time.Now()
+	if name, email := args.config["user.name"], args.config["user.email"]; name != "" && email != "" {
+		opts.Author = &object.Signature{Name: name, Email: email, When: now}
+		opts.Committer = &object.Signature{Name: name, Email: email, When: now}
+	}
+	for flag := range args.flags {
+		if !strings.HasPrefix(flag, "--author=") {
+			continue
+		}
+		author := authorPattern.FindStringSubmatch(strings.TrimPrefix(flag, "--author="))
+		if author == nil {
+			return []byte(""), fmt.Errorf("invalid author %q, expected \"Name <email>\"", strings.TrimPrefix(flag, "--author="))
+		}
+		opts.Author = &object.Signature{Name: author[1], Email: author[2], When: now}
+	}
+	hash, err := w.Commit(args.positional[0], opts)
+	if err != nil {
+		return []byte(""), err
+	}
+	branch, _ := currentBranch(r)
+	return []byte(fmt.Sprintf("[%s %s] %s", branch.Short(), hash.String()[:7], args.positional[0])), nil
+}
+
+// push supports "push [-u] [--force] <remote> <branch>" and "push [--force] <remote> <src>:<dst>", where src can be HEAD
+func (e *GoGitExecutor) push(ctx context.Context, repoPath string, args gitArgs) ([]byte, error) {
+	if len(args.positional) != 2 {
+		return []byte(""), errors.New("push expects a remote and a branch")
+	}
+	r, _, err := e.open(repoPath)
+	if err != nil {
+		return []byte(""), err
+	}
+	remoteName := args.positional[0]
+	src, dst := args.positional[1], args.positional[1]
+	if parts := strings.SplitN(args.positional[1], ":", 2); len(parts) == 2 {
+		src, dst = parts[0], parts[1]
+	}
+	var branch plumbing.ReferenceName
+	if src == "HEAD" {
+		if branch, err = currentBranch(r); err != nil {
+			return []byte(""), err
+		}
+	} else {
+		branch = plumbing.NewBranchReferenceName(strings.TrimPrefix(src, "refs/heads/"))
+	}
+	target := plumbing.NewBranchReferenceName(strings.TrimPrefix(dst, "refs/heads/"))
+	force := args.flags["-f"] || args.flags["--force"]
+
+	refSpec := config.RefSpec(fmt.Sprintf("%s:%s", branch, target))
+	if force {
+		refSpec = "+" + refSpec
+	}
+	err = r.PushContext(ctx, &git.PushOptions{RemoteName: remoteName, RefSpecs: []config.RefSpec{refSpec}, Auth: args.auth})
+	if errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return []byte("Everything up-to-date"), nil
+	} else if err != nil && strings.Contains(err.Error(), "non-fast-forward") {
+		return []byte(fmt.Sprintf(" ! [rejected]        %s -> %s (non-fast-forward)", branch.Short(), target.Short())), err
+	} else if err != nil {
+		return []byte(""), err
+	}
+
+	if args.flags["-u"] || args.flags["--set-upstream"] {
+		if err := r.CreateBranch(&config.Branch{Name: branch.Short(), Remote: remoteName, Merge: target}); err != nil && !errors.Is(err, git.ErrBranchExists) {
+			return []byte(""), err
+		}
+	}
+	return []byte(""), nil
+}
+
+func (e *GoGitExecutor) init(baseDir string, args gitArgs) ([]byte, error) {
+	repoPath := baseDir
+	if len(args.positional) > 0 {
+		repoPath = filepath.Join(baseDir, args.positional[0])
+	}
+	_, err := git.Init(e.storage(repoPath), ioutils.NewBillyFilesystem(e.fs, repoPath))
+	if errors.Is(err, git.ErrRepositoryAlreadyExists) {
+		return []byte("Reinitialized existing Git repository"), nil
+	} else if err != nil {
+		return []byte(""), err
+	}
+	return []byte("Initialized empty Git repository"), nil
+}
+
+// renameBranch only supports "branch -m [<old>] <new>"
+func (e *GoGitExecutor) renameBranch(repoPath string, args gitArgs) ([]byte, error) {
+	if !args.flags["-m"] && !args.flags["-M"] {
+		return []byte(""), errors.New("only branch -m is supported")
+	}
+	r, _, err := e.open(repoPath)
+	if err != nil {
+		return []byte(""), err
+	}
+	current, err := currentBranch(r)
+	if err != nil {
+		return []byte(""), err
+	}
+	var oldBranch, newBranch plumbing.ReferenceName
+	switch len(args.positional) {
+	case 1:
+		oldBranch, newBranch = current, plumbing.NewBranchReferenceName(args.positional[0])
+	case 2:
+		oldBranch, newBranch = plumbing.NewBranchReferenceName(args.positional[0]), plumbing.NewBranchReferenceName(args.positional[1])
+	default:
+		return []byte(""), errors.New("branch -m expects a branch name")
+	}
+	if oldBranch == newBranch {
+		return []byte(""), nil
+	}
+
+	if ref, err := r.Reference(oldBranch, false); err == nil {
+		if err := r.Storer.SetReference(plumbing.NewHashReference(newBranch, ref.Hash())); err != nil {
+			return []byte(""), err
+		}
+		if err := r.Storer.RemoveReference(oldBranch); err != nil {
+			return []byte(""), err
+		}
+	} else if !errors.Is(err, plumbing.ErrReferenceNotFound) || oldBranch != current {
+		return []byte(""), fmt.Errorf("no branch named '%s'", oldBranch.Short())
+	}
+	if oldBranch == current {
+		return []byte(""), r.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, newBranch))
+	}
+	return []byte(""), nil
+}
+
+// remote only supports "remote add <name> <url>" and "remote set-url <name> <url>"
+func (e *GoGitExecutor) remote(repoPath string, args gitArgs) ([]byte, error) {
+	if len(args.positional) != 3 || (args.positional[0] != "add" && args.positional[0] != "set-url") {
+		return []byte(""), errors.New("only remote add|set-url <name> <url> is supported")
+	}
+	r, _, err := e.open(repoPath)
+	if err != nil {
+		return []byte(""), err
+	}
+	name, url := args.positional[1], args.positional[2]
+	if args.positional[0] == "add" {
+		_, err = r.CreateRemote(&config.RemoteConfig{Name: name, URLs: []string{url}})
+		return []byte(""), err
+	}
+	cfg, err := r.Config()
+	if err != nil {
+		return []byte(""), err
+	}
+	remote, ok := cfg.Remotes[name]
+	if !ok {
+		return []byte(""), fmt.Errorf("no such remote '%s'", name)
+	}
+	remote.URLs = []string{url}
+	return []byte(""), r.Storer.SetConfig(cfg)
+}
+
+// revParse only supports "rev-parse [--verify] [--end-of-options] <rev>[^{commit}]"
+func (e *GoGitExecutor) revParse(repoPath string, args gitArgs) ([]byte, error) {
+	if len(args.positional) != 1 {
+		return []byte(""), errors.New("rev-parse expects a single revision")
+	}
+	r, _, err := e.open(repoPath)
+	if err != nil {
+		return []byte(""), err
+	}
+	rev := strings.TrimSuffix(args.positional[0], "^{commit}")
+	hash, err := r.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return []byte(""), err
+	}
+	if rev != args.positional[0] {
+		if _, err := r.CommitObject(*hash); err != nil {
+			return []byte(""), fmt.Errorf("%s is not a commit: %w", rev, err)
+		}
+	}
+	return []byte(hash.String() + "\n"), nil
+}
+
+// reset only supports "reset --hard <rev>"
+func (e *GoGitExecutor) reset(repoPath string, args gitArgs) ([]byte, error) {
+	if !args.flags["--hard"] || len(args.positional) != 1 {
+		return []byte(""), errors.New("only reset --hard <rev> is supported")
+	}
+	r, w, err := e.open(repoPath)
+	if err != nil {
+		return []byte(""), err
+	}
+	hash, err := r.ResolveRevision(plumbing.Revision(args.positional[0]))
+	if err != nil {
+		return []byte(""), err
+	}
+	return []byte(""), w.Reset(&git.ResetOptions{Commit: *hash, Mode: git.HardReset})
+}
+
+// clean only supports "clean -fd", removing the untracked files and folders
+func (e *GoGitExecutor) clean(repoPath string, args gitArgs) ([]byte, error) {
+	if !args.flags["-fd"] {
+		return []byte(""), errors.New("only clean -fd is supported")
+	}
+	_, w, err := e.open(repoPath)
+	if err != nil {
+		return []byte(""), err
+	}
+	return []byte(""), w.Clean(&git.CleanOptions{Dir: true})
+}
+
+// catFile only supports "cat-file commit <rev>", and outputs the raw content of the commit object
+func (e *GoGitExecutor) catFile(repoPath string, args gitArgs) ([]byte, error) {
+	if len(args.positional) != 2 || args.positional[0] != "commit" {
+		return []byte(""), errors.New("only cat-file commit <rev> is supported")
+	}
+	r, _, err := e.open(repoPath)
+	if err != nil {
+		return []byte(""), err
+	}
+	hash, err := r.ResolveRevision(plumbing.Revision(args.positional[1]))
+	if err != nil {
+		return []byte(""), err
+	}
+	obj, err := r.Storer.EncodedObject(plumbing.CommitObject, *hash)
+	if err != nil {
+		return []byte(""), err
+	}
+	reader, err := obj.Reader()
+	if err != nil {
+		return []byte(""), err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+// hashObject only supports "hash-object -t commit -w <file>", and stores the commit object read from the file, relative
+// paths being resolved against the repository
+func (e *GoGitExecutor) hashObject(repoPath string, args gitArgs) ([]byte, error) {
+	if !args.flags["-t"] || !args.flags["-w"] || len(args.positional) != 2 || args.positional[0] != "commit" {
+		return []byte(""), errors.New("only hash-object -t commit -w <file> is supported")
+	}
+	path := args.positional[1]
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(repoPath, path)
+	}
+	content, err := e.fs.ReadFile(path)
+	if err != nil {
+		return []byte(""), err
+	}
+	r, _, err := e.open(repoPath)
+	if err != nil {
+		return []byte(""), err
+	}
+	obj := r.Storer.NewEncodedObject()
+	obj.SetType(plumbing.CommitObject)
+	writer, err := obj.Writer()
+	if err != nil {
+		return []byte(""), err
+	}
+	if _, err := writer.Write(content); err != nil {
+		return []byte(""), err
+	}
+	if err := writer.Close(); err != nil {
+		return []byte(""), err
+	}
+	// Like git, reject content that is not a valid commit
+	if _, err := object.DecodeCommit(r.Storer, obj); err != nil {
+		return []byte(""), err
+	}
+	hash, err := r.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return []byte(""), err
+	}
+	return []byte(hash.String() + "\n"), nil
+}
+
+// updateRef only supports "update-ref <ref> <commit>". A symbolic reference such as HEAD updates the reference it
+// points to.
+func (e *GoGitExecutor) updateRef(repoPath string, args gitArgs) ([]byte, error) {
+	if len(args.positional) != 2 {
+		return []byte(""), errors.New("update-ref expects a reference and a commit")
+	}
+	r, _, err := e.open(repoPath)
+	if err != nil {
+		return []byte(""), err
+	}
+	name := plumbing.ReferenceName(args.positional[0])
+	if ref, err := r.Storer.Reference(name); err == nil && ref.Type() == plumbing.SymbolicReference {
+		name = ref.Target()
+	}
+	hash := plumbing.NewHash(args.positional[1])
+	if _, err := r.CommitObject(hash); err != nil {
+		return []byte(""), fmt.Errorf("%s: not a valid commit: %w", args.positional[1], err)
+	}
+	return []byte(""), r.Storer.SetReference(plumbing.NewHashReference(name, hash))
+}
+
+// lsTree only supports "ls-tree -r -l -z <rev>", and outputs the mode, type, hash, size and path of the files of the
+// revision
+func (e *GoGitExecutor) lsTree(repoPath string, args gitArgs) ([]byte, error) {
+	if !args.flags["-r"] || !args.flags["-l"] || !args.flags["-z"] || len(args.positional) != 1 {
+		return []byte(""), errors.New("only ls-tree -r -l -z <rev> is supported")
+	}
+	tree, err := e.revisionTree(repoPath, args.positional[0])
+	if err != nil {
+		return []byte(""), err
+	}
+	var out strings.Builder
+	err = tree.Files().ForEach(func(f *object.File) error {
+		out.WriteString(fmt.Sprintf("%06o blob %s %7d\t%s\x00", uint32(f.Mode), f.Hash, f.Size, f.Name))
+		return nil
+	})
+	return []byte(out.String()), err
+}
+
+// lsFiles only supports "ls-files -z -t --cached --others --exclude-standard", and outputs the files of the index
+// tagged with "H", followed by the untracked files that are not ignored tagged with "?"
+func (e *GoGitExecutor) lsFiles(repoPath string, args gitArgs) ([]byte, error) {
+	for _, flag := range []string{"-z", "-t", "--cached", "--others", "--exclude-standard"} {
+		if !args.flags[flag] {
+			return []byte(""), errors.New("only ls-files -z -t --cached --others --exclude-standard is supported")
+		}
+	}
+	r, w, err := e.open(repoPath)
+	if err != nil {
+		return []byte(""), err
+	}
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return []byte(""), err
+	}
+	var out strings.Builder
+	for _, entry := range idx.Entries {
+		out.WriteString("H " + entry.Name + "\x00")
+	}
+	status, err := w.Status()
+	if err != nil {
+		return []byte(""), err
+	}
+	var untracked []string
+	for path, fileStatus := range status {
+		if fileStatus.Worktree == git.Untracked {
+			untracked = append(untracked, path)
+		}
+	}
+	sort.Strings(untracked)
+	for _, path := range untracked {
+		out.WriteString("? " + path + "\x00")
+	}
+	return []byte(out.String()), nil
+}
+
+// log only supports "log --format=<format> [--max-count=<n>] [<rev>]", following the first parent from the revision,
+// HEAD by default. The format supports the %H, %P, %an, %ae, %aI, %s, %B and %x<hex> placeholders.
+func (e *GoGitExecutor) log(repoPath string, args gitArgs) ([]byte, error) {
+	format, maxCount := "", 0
+	for flag := range args.flags {
+		switch {
+		case strings.HasPrefix(flag, "--format="):
+			format = strings.TrimPrefix(flag, "--format=")
+		case strings.HasPrefix(flag, "--max-count="):
+			var err error
+			if maxCount, err = strconv.Atoi(strings.TrimPrefix(flag, "--max-count=")); err != nil {
+				return []byte(""), fmt.Errorf("invalid max count %q", flag)
+			}
+		}
+	}
+	if format == "" || len(args.positional) > 1 {
+		return []byte(""), errors.New("only log --format=<format> [--max-count=<n>] [<rev>] is supported")
+	}
+	rev := "HEAD"
+	if len(args.positional) == 1 {
+		rev = args.positional[0]
+	}
+	r, _, err := e.open(repoPath)
+	if err != nil {
+		return []byte(""), err
+	}
+	hash, err := r.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return []byte(""), err
+	}
+	c, err := r.CommitObject(*hash)
+	if err != nil {
+		return []byte(""), err
+	}
+
+	var out strings.Builder
+	for count := 0; c != nil && (maxCount <= 0 || count < maxCount); count++ {
+		formatted, err := formatCommit(format, c)
+		if err != nil {
+			return []byte(""), err
+		}
+		out.WriteString(formatted + "\n")
+		if c.NumParents() == 0 {
+			break
+		}
+		if c, err = c.Parent(0); err != nil {
+			return []byte(""), err
+		}
+	}
+	return []byte(out.String()), nil
+}
+
+// formatCommit expands the placeholders of the log format for the commit
+func formatCommit(format string, c *object.Commit) (string, error) {
+	var out strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i == len(format)-1 {
+			out.WriteByte(format[i])
+			continue
+		}
+		placeholder := format[i+1:]
+		switch {
+		case strings.HasPrefix(placeholder, "H"):
+			out.WriteString(c.Hash.String())
+		case strings.HasPrefix(placeholder, "P"):
+			parents := make([]string, 0, len(c.ParentHashes))
+			for _, parent := range c.ParentHashes {
+				parents = append(parents, parent.String())
+			}
+			out.WriteString(strings.Join(parents, " "))
+		case strings.HasPrefix(placeholder, "an"):
+			out.WriteString(c.Author.Name)
+			i++
+		case strings.HasPrefix(placeholder, "ae"):
+			out.WriteString(c.Author.Email)
+			i++
+		case strings.HasPrefix(placeholder, "aI"):
+			out.WriteString(c.Author.When.Format(time.RFC3339))
+			i++
+		case strings.HasPrefix(placeholder, "s"):
+			out.WriteString(strings.SplitN(c.Message, "\n", 2)[0])
+		case strings.HasPrefix(placeholder, "B"):
+			out.WriteString(c.Message)
+		case strings.HasPrefix(placeholder, "x") && len(placeholder) >= 3:
+			b, err := strconv.ParseUint(placeholder[1:3], 16, 8)
+			if err != nil {
+				return "", fmt.Errorf("invalid placeholder %%%s", placeholder[:3])
+			}
+			out.WriteByte(byte(b))
+			i += 2
+		default:
+			return "", fmt.Errorf("unsupported placeholder %%%c", placeholder[0])
+		}
+		i++
+	}
+	return out.String(), nil
+}
+
+// revert only supports "revert --no-commit <rev>", and stages the changes undoing the commit the revision resolves
+// to. Like rebase, the paths changed since the commit are reported as conflicts, in which case nothing is changed.
+func (e *GoGitExecutor) revert(repoPath string, args gitArgs) ([]byte, error) {
+	if !args.flags["--no-commit"] || len(args.positional) != 1 {
+		return []byte(""), errors.New("only revert --no-commit <rev> is supported")
+	}
+	r, w, err := e.open(repoPath)
+	if err != nil {
+		return []byte(""), err
+	}
+	hash, err := r.ResolveRevision(plumbing.Revision(args.positional[0]))
+	if err != nil {
+		return []byte(""), fmt.Errorf("bad revision '%s'", args.positional[0])
+	}
+	c, err := r.CommitObject(*hash)
+	if err != nil {
+		return []byte(""), err
+	}
+	if c.NumParents() != 1 {
+		return []byte(""), fmt.Errorf("cannot revert commit %s, which does not have a single parent", c.Hash)
+	}
+	parent, err := c.Parent(0)
+	if err != nil {
+		return []byte(""), err
+	}
+	head, err := r.Head()
+	if err != nil {
+		return []byte(""), err
+	}
+	tip, err := r.CommitObject(head.Hash())
+	if err != nil {
+		return []byte(""), err
+	}
+	commitTree, err := c.Tree()
+	if err != nil {
+		return []byte(""), err
+	}
+	parentTree, err := parent.Tree()
+	if err != nil {
+		return []byte(""), err
+	}
+	conflicts, err := e.applyChanges(repoPath, w, tip, commitTree, parentTree)
+	if err != nil {
+		return []byte(""), err
+	}
+	if len(conflicts) > 0 {
+		var out strings.Builder
+		for _, path := range conflicts {
+			out.WriteString(fmt.Sprintf("CONFLICT (content): Merge conflict in %s\n", path))
+		}
+		return []byte(out.String()), fmt.Errorf("could not revert %s... %s", c.Hash.String()[:7], strings.SplitN(c.Message, "\n", 2)[0])
+	}
+	return []byte(""), nil
+}
+
+// show only supports "show <rev>:<path>...", and outputs the contents of the files at the revisions one after the other
+func (e *GoGitExecutor) show(repoPath string, args gitArgs) ([]byte, error) {
+	if len(args.positional) == 0 {
+		return []byte(""), errors.New("only show <rev>:<path>... is supported")
+	}
+	var out strings.Builder
+	for _, arg := range args.positional {
+		if !strings.Contains(arg, ":") {
+			return []byte(""), errors.New("only show <rev>:<path>... is supported")
+		}
+		revPath := strings.SplitN(arg, ":", 2)
+		tree, err := e.revisionTree(repoPath, revPath[0])
+		if err != nil {
+			return []byte(""), err
+		}
+		f, err := tree.File(revPath[1])
+		if err != nil {
+			return []byte(""), fmt.Errorf("path '%s' does not exist in '%s'", revPath[1], revPath[0])
+		}
+		content, err := f.Contents()
+		if err != nil {
+			return []byte(""), err
+		}
+		out.WriteString(content)
+	}
+	return []byte(out.String()), nil
+}
+
+// revisionTree returns the tree of the commit the revision resolves to
+func (e *GoGitExecutor) revisionTree(repoPath string, rev string) (*object.Tree, error) {
+	r, _, err := e.open(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := r.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, err
+	}
+	c, err := r.CommitObject(*hash)
+	if err != nil {
+		return nil, err
+	}
+	return c.Tree()
+}
+
+// rm only supports removing paths recursively, relative paths are resolved against baseDir
+func (e *GoGitExecutor) rm(baseDir string, args []string) ([]byte, error) {
+	for _, path := range args {
+		if strings.HasPrefix(path, "-") {
+			continue
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		if err := e.fs.RemoveAll(path); err != nil {
+			return []byte(""), err
+		}
+	}
+	return []byte(""), nil
+}
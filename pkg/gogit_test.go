@@ -0,0 +1,266 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	"github.com/go-git/go-git/v5/plumbing/transport/file"
+	"github.com/go-git/go-git/v5/plumbing/transport/server"
+	"github.com/redhat-developer/gitops-generator/pkg/testutils"
+	"github.com/redhat-developer/gitops-generator/pkg/util/ioutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// useInProcessFileTransport serves file:// remotes in-process, so that no git binary is needed by the tests
+func useInProcessFileTransport(t *testing.T) {
+	client.InstallProtocol("file", &knownHavesTransport{Transport: server.NewClient(server.DefaultLoader)})
+	t.Cleanup(func() {
+		client.InstallProtocol("file", file.DefaultClient)
+	})
+}
+
+// knownHavesTransport drops the commits the remote does not have from the fetch requests. Unlike git, the go-git
+// server fails on such commits, which are sent when fetching into a repository with local commits.
+type knownHavesTransport struct {
+	transport.Transport
+}
+
+func (k *knownHavesTransport) NewUploadPackSession(ep *transport.Endpoint, auth transport.AuthMethod) (transport.UploadPackSession, error) {
+	session, err := k.Transport.NewUploadPackSession(ep, auth)
+	if err != nil {
+		return nil, err
+	}
+	storer, err := server.DefaultLoader.Load(ep)
+	if err != nil {
+		return nil, err
+	}
+	return &knownHavesSession{UploadPackSession: session, storer: storer}, nil
+}
+
+type knownHavesSession struct {
+	transport.UploadPackSession
+	storer storer.Storer
+}
+
+func (k *knownHavesSession) UploadPack(ctx context.Context, req *packp.UploadPackRequest) (*packp.UploadPackResponse, error) {
+	var haves []plumbing.Hash
+	for _, have := range req.Haves {
+		if k.storer.HasEncodedObject(have) == nil {
+			haves = append(haves, have)
+		}
+	}
+	req.Haves = haves
+	return k.UploadPackSession.UploadPack(ctx, req)
+}
+
+// newBareRemote creates an empty bare repository whose HEAD points to the given branch
+func newBareRemote(t *testing.T, branch string) string {
+	remoteDir := t.TempDir()
+	r, err := git.PlainInit(remoteDir, true)
+	testutils.AssertNoError(t, err)
+	testutils.AssertNoError(t, r.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.NewBranchReferenceName(branch))))
+	return remoteDir
+}
+
+func TestGoGitExecutor(t *testing.T) {
+	useInProcessFileTransport(t)
+	remote := newBareRemote(t, "main")
+	fs := ioutils.NewMemoryFilesystem()
+	e := NewGoGitExecutor(fs)
+	userConfig := []string{"-c", "user.name=Test User", "-c", "user.email=test@test.org"}
+
+	run := func(baseDir string, cmd CommandType, args ...string) string {
+		t.Helper()
+		out, err := e.Execute(context.Background(), baseDir, cmd, args...)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", cmd, strings.Join(args, " "), err)
+		}
+		return string(out)
+	}
+	write := func(path, content string) {
+		t.Helper()
+		testutils.AssertNoError(t, fs.MkdirAll(path[:strings.LastIndex(path, "/")], 0755))
+		testutils.AssertNoError(t, fs.WriteFile(path, []byte(content), 0644))
+	}
+
+	// Clone the empty remote and push a first commit to a new branch
+	out := run("/work", GitCommand, "clone", remote, "first")
+	assert.Contains(t, out, "empty repository")
+	_, err := e.Execute(context.Background(), "/work/first", GitCommand, "switch", "main")
+	testutils.AssertErrorMatch(t, "invalid reference: main", err)
+	run("/work/first", GitCommand, "checkout", "-b", "main")
+	write("/work/first/components/a/base/deployment.yaml", "a")
+	write("/work/first/components/b/base/deployment.yaml", "b")
+	run("/work/first", GitCommand, "add", ".")
+	assert.Equal(t, "components/a/base/deployment.yaml\ncomponents/b/base/deployment.yaml\n", run("/work/first", GitCommand, "--no-pager", "diff", "--cached", "--name-only"))
+	assert.Equal(t, "", run("/work/first", GitCommand, "ls-remote", "--heads", remote, "main"))
+	run("/work/first", GitCommand, append(userConfig, "commit", "-m", "first commit")...)
+	run("/work/first", GitCommand, "push", "-u", "origin", "main")
+	assert.Contains(t, run("/work/first", GitCommand, "ls-remote", "--heads", remote, "main"), "refs/heads/main")
+	_, err = e.Execute(context.Background(), "/work/first", GitCommand, "commit", "-m", "nothing changed")
+	testutils.AssertErrorMatch(t, "nothing to commit", err)
+
+	// A second clone updates one component and pushes it
+	run("/work", GitCommand, "clone", remote, "second")
+	assert.Contains(t, run("/work/second", GitCommand, "switch", "main"), "Already on")
+	write("/work/second/components/a/base/deployment.yaml", "a2")
+	run("/work/second", GitCommand, "add", ".")
+	run("/work/second", GitCommand, append(userConfig, "commit", "-m", "update a")...)
+	run("/work/second", GitCommand, "push", "origin", "main")
+
+	// Local changes to another component survive the pull and can be pushed on top of the remote changes
+	run("/work/first", RmCommand, "-rf", "components/b")
+	write("/work/first/components/c/base/deployment.yaml", "c")
+	run("/work/first", GitCommand, "add", ".")
+	assert.Equal(t, "components/b/base/deployment.yaml\ncomponents/c/base/deployment.yaml\n", run("/work/first", GitCommand, "--no-pager", "diff", "--cached", "--name-only"))
+	assert.Contains(t, run("/work/first", GitCommand, "pull"), "Fast-forward")
+	assert.Equal(t, "components/b/base/deployment.yaml\ncomponents/c/base/deployment.yaml\n", run("/work/first", GitCommand, "--no-pager", "diff", "--cached", "--name-only"))
+	content, err := fs.ReadFile("/work/first/components/a/base/deployment.yaml")
+	testutils.AssertNoError(t, err)
+	assert.Equal(t, "a2", string(content))
+	run("/work/first", GitCommand, append(userConfig, "commit", "-m", "remove b, add c")...)
+	run("/work/first", GitCommand, "push", "origin", "main")
+	assert.Equal(t, "Already up to date.", run("/work/first", GitCommand, "pull"))
+
+	// Local changes to files updated on the remote are not overwritten
+	write("/work/second/components/c/base/deployment.yaml", "conflict")
+	run("/work/second", GitCommand, "add", ".")
+	_, err = e.Execute(context.Background(), "/work/second", GitCommand, "pull")
+	testutils.AssertErrorMatch(t, "would be overwritten by merge: components/c/base/deployment.yaml", err)
+
+	// The commit ID is available through the Gen using the executor
+	generator := NewGitopsGen(WithExecutor(e))
+	commitID, err := generator.GetCommitIDFromRepo(fs, "/work/first")
+	testutils.AssertNoError(t, err)
+	remoteHeads := run("/work/first", GitCommand, "ls-remote", "--heads", remote, "main")
+	assert.Equal(t, strings.TrimSpace(commitID), strings.Fields(remoteHeads)[0])
+
+	// Bootstrap a new repository the way GenerateAndPush does
+	write("/work/new/components/d/base/deployment.yaml", "d")
+	run("/work/new", GitCommand, "init", ".")
+	run("/work/new", GitCommand, "add", ".")
+	run("/work/new", GitCommand, append(userConfig, "commit", "-m", "Generate GitOps resources")...)
+	run("/work/new", GitCommand, "branch", "-m", "bootstrap")
+	run("/work/new", GitCommand, "remote", "add", "origin", remote)
+	run("/work/new", GitCommand, "push", "-u", "origin", "bootstrap")
+	assert.Contains(t, run("/work/new", GitCommand, "ls-remote", "--heads", remote, "bootstrap"), "refs/heads/bootstrap")
+	assert.Contains(t, run("/work/new", GitCommand, "init", "."), "Reinitialized")
+
+	// Topic branches are force pushed from HEAD
+	run("/work/new", GitCommand, "push", "--force", "origin", "HEAD:refs/heads/topic")
+	assert.Contains(t, run("/work/new", GitCommand, "ls-remote", "--heads", remote, "topic"), "refs/heads/topic")
+
+	// Unsupported commands are rejected
+	_, err = e.Execute(context.Background(), "/work/new", GitCommand, "merge", "main")
+	testutils.AssertErrorMatch(t, "unsupported git command \"merge main\"", err)
+	_, err = e.Execute(context.Background(), "/work/new", "cd", "/")
+	testutils.AssertErrorMatch(t, "Unsupported command \"cd\"", err)
+}
+
+// racingExecutor runs the push of another writer right before the first push it executes
+type racingExecutor struct {
+	GitExecutor
+	race func()
+}
+
+func (e *racingExecutor) Execute(ctx context.Context, baseDir string, cmd CommandType, args ...string) ([]byte, error) {
+	if e.race != nil && len(args) > 0 && args[0] == "push" {
+		e.race()
+		e.race = nil
+	}
+	return e.GitExecutor.Execute(ctx, baseDir, cmd, args...)
+}
+
+func TestGoGitExecutorRebase(t *testing.T) {
+	useInProcessFileTransport(t)
+	remote := newBareRemote(t, "main")
+	fs := ioutils.NewMemoryFilesystem()
+	e := NewGoGitExecutor(fs)
+	userConfig := []string{"-c", "user.name=Test User", "-c", "user.email=test@test.org"}
+
+	run := func(baseDir string, args ...string) string {
+		t.Helper()
+		out, err := e.Execute(context.Background(), baseDir, GitCommand, args...)
+		if err != nil {
+			t.Fatalf("git %s failed: %v", strings.Join(args, " "), err)
+		}
+		return string(out)
+	}
+	write := func(path, content string) {
+		t.Helper()
+		testutils.AssertNoError(t, fs.MkdirAll(path[:strings.LastIndex(path, "/")], 0755))
+		testutils.AssertNoError(t, fs.WriteFile(path, []byte(content), 0644))
+	}
+	commitAndPush := func(repoPath, path, content string) {
+		t.Helper()
+		write(repoPath+"/"+path, content)
+		run(repoPath, "add", ".")
+		run(repoPath, append(userConfig, "commit", "-m", "update "+path)...)
+		run(repoPath, "push", "origin", "main")
+	}
+
+	run("/work", "clone", remote, "first")
+	run("/work/first", "checkout", "-b", "main")
+	commitAndPush("/work/first", "components/a/base/deployment.yaml", "a")
+	run("/work", "clone", remote, "second")
+	run("/work", "clone", remote, "third")
+
+	// Another writer pushes a change to another component right before the generator pushes its commit
+	race := &racingExecutor{GitExecutor: e, race: func() {
+		commitAndPush("/work/second", "components/b/base/deployment.yaml", "b")
+	}}
+	generator := NewGitopsGen(WithExecutor(race), WithRetryPolicy(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}))
+	write("/work/first/components/a/base/deployment.yaml", "a2")
+	run("/work/first", "add", ".")
+	run("/work/first", append(userConfig, "commit", "-m", "update a")...)
+	testutils.AssertNoError(t, generator.pushWithRetry(context.Background(), "/work/first", remote, "main"))
+
+	run("/work/third", "pull")
+	for path, want := range map[string]string{"components/a/base/deployment.yaml": "a2", "components/b/base/deployment.yaml": "b"} {
+		content, err := fs.ReadFile("/work/third/" + path)
+		testutils.AssertNoError(t, err)
+		assert.Equal(t, want, string(content))
+	}
+
+	// Conflicting changes leave the branch untouched
+	commitAndPush("/work/third", "components/a/base/deployment.yaml", "a3")
+	write("/work/second/components/a/base/deployment.yaml", "conflict")
+	run("/work/second", "add", ".")
+	run("/work/second", append(userConfig, "commit", "-m", "conflicting update")...)
+	before := run("/work/second", "rev-parse", "HEAD")
+	out, err := e.Execute(context.Background(), "/work/second", GitCommand, "push", "origin", "main")
+	assert.Contains(t, string(out), "[rejected]")
+	assert.Error(t, err)
+	run("/work/second", "fetch", "origin", "main")
+	out, err = e.Execute(context.Background(), "/work/second", GitCommand, "rebase", "origin/main")
+	testutils.AssertErrorMatch(t, "could not apply .* conflicting update", err)
+	assert.Equal(t, "CONFLICT (content): Merge conflict in components/a/base/deployment.yaml\n", string(out))
+	assert.Equal(t, before, run("/work/second", "rev-parse", "HEAD"))
+	run("/work/second", "rebase", "--abort")
+
+	// Already rebased branches are up to date
+	assert.Contains(t, run("/work/third", "rebase", "origin/main"), "is up to date")
+}
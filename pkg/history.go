@@ -0,0 +1,325 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// logFormat prints the ID, author, date and message of the commits, separating the fields with the unit separator
+// and the commits with the record separator
+const logFormat = "--format=%H%x1f%an%x1f%ae%x1f%aI%x1f%B%x1e"
+
+var (
+	generateBasePattern     = regexp.MustCompile(`^Generate GitOps base resources for component (\S+)$`)
+	generateOverlaysPattern = regexp.MustCompile(`^Generate (\S+) environment overlays for component (\S+)$`)
+	removeComponentPattern  = regexp.MustCompile(`^Removed component (\S+)$`)
+	batchPattern            = regexp.MustCompile(`^Apply \d+ changes to the GitOps resources$`)
+	revertPattern           = regexp.MustCompile(`^Revert "(.*)"$`)
+	revertedCommitPattern   = regexp.MustCompile(`This reverts commit ([0-9a-f]+)\.`)
+)
+
+// GeneratorCommit is a change made by the generator to a component, parsed from a commit of the GitOps repository.
+// A commit made by a Batch holds a change per operation, each returned as a GeneratorCommit.
+type GeneratorCommit struct {
+	CommitID string
+	// Component is the name of the changed component
+	Component string
+	// Environment is the name of the environment the overlays were generated for, empty for the base resources
+	Environment string
+	// Image is the container image of the component, in the overlays of the Environment or in the base resources, as
+	// of the commit. It is empty when the component was removed.
+	Image string
+	// Subject describes the change, e.g. "Removed component <name>"
+	Subject string
+	Author  Identity
+	Date    time.Time
+	// Reverts is the ID of the commit reverted by the commit, if any
+	Reverts string
+}
+
+// CommitHistoryOptions selects the changes returned by GetCommitHistory
+type CommitHistoryOptions struct {
+	// Component only returns the changes to the component when set
+	Component string
+	// Environment only returns the changes to the overlays of the environment when set
+	Environment string
+	// MaxCount limits the number of returned changes. No limit is applied when zero.
+	MaxCount int
+}
+
+// matches returns true if the change is selected by the options
+func (o CommitHistoryOptions) matches(c GeneratorCommit) bool {
+	return (o.Component == "" || o.Component == c.Component) && (o.Environment == "" || o.Environment == c.Environment)
+}
+
+// GetCommitHistory returns the changes made by the generator to the components, parsed from the commits of the
+// current branch of the repository, the most recent first. The commits not made by the generator are skipped.
+// 1. repoPath: The path of the cloned repository
+// 2. repoContext: The path within the repository the resources were generated in
+// 3. options: Selects the returned changes
+func (s Gen) GetCommitHistory(repoPath string, repoContext string, options CommitHistoryOptions) ([]GeneratorCommit, error) {
+	return s.GetCommitHistoryWithContext(context.Background(), repoPath, repoContext, options)
+}
+
+// GetCommitHistoryWithContext is the context aware variant of GetCommitHistory
+func (s Gen) GetCommitHistoryWithContext(ctx context.Context, repoPath string, repoContext string, options CommitHistoryOptions) (history []GeneratorCommit, err error) {
+	defer func() { err = checkCancelled(ctx, "GetCommitHistory", err) }()
+	if err := validateArgs(pathArg("context", repoContext)); err != nil {
+		return nil, err
+	}
+	commits, err := s.readCommits(ctx, repoPath, "HEAD", 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range commits {
+		for _, change := range c {
+			if !options.matches(change) {
+				continue
+			}
+			if change.Image, err = s.readImage(ctx, repoPath, repoContext, change); err != nil {
+				return nil, err
+			}
+			history = append(history, change)
+			if options.MaxCount > 0 && len(history) == options.MaxCount {
+				return history, nil
+			}
+		}
+	}
+	return history, nil
+}
+
+// RevertCommit reverts a commit made by the generator on top of the branch, and pushes the revert to the remote.
+// Pushes rejected because the remote branch has moved are retried according to the RetryPolicy of the Gen. For a Gen
+// returned by DryRun, the changes of the revert are recorded in its DryRunResult instead of being committed.
+// 1. repoPath: The path of the cloned repository, where the branch is checked out
+// 2. remote: A string of the form https://$token@<domain>/<org>/<repo>, where <domain> is either github.com or gitlab.com, or one of the Hosts of the Gen, and $token is optional and omitted when using Credentials, or an SSH remote such as git@<domain>:<org>/<repo>.git. Corresponds to the component's gitops repository
+// 3. The branch to push to
+// 4. commitID: The full or abbreviated hexadecimal ID of the commit to revert, e.g. the CommitID of a GeneratorCommit
+func (s Gen) RevertCommit(repoPath string, remote string, branch string, commitID string) error {
+	return s.RevertCommitWithContext(context.Background(), repoPath, remote, branch, commitID)
+}
+
+// RevertCommitWithContext is the context aware variant of RevertCommit
+func (s Gen) RevertCommitWithContext(ctx context.Context, repoPath string, remote string, branch string, commitID string) (err error) {
+	defer func() { err = checkCancelled(ctx, "RevertCommit", err) }()
+	if err := validateArgs(commitIDArg("commit ID", commitID)); err != nil {
+		return err
+	}
+	if invalidRemoteErr := s.validateRemote(remote); invalidRemoteErr != nil {
+		return invalidRemoteErr
+	}
+	ctx, unlock, err := repoLocks.lock(ctx, remote, branch, repoPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	out, err := s.execute(ctx, repoPath, GitCommand, "rev-parse", "--verify", "--end-of-options", commitID+"^{commit}")
+	if err != nil {
+		return &GitCmdError{path: repoPath, cmdResult: string(out), err: err, cmdType: listCommits}
+	}
+	commits, err := s.readCommits(ctx, repoPath, strings.TrimSpace(string(out)), 1)
+	if err != nil {
+		return err
+	}
+	if len(commits) == 0 || len(commits[0]) == 0 {
+		return &GitCmdError{path: repoPath, err: fmt.Errorf("commit %s was not made by the generator", commitID), cmdType: revertCommit}
+	}
+	reverted := commits[0]
+	message := revertMessage(reverted)
+
+	if s.dryRun == nil {
+		if err := s.pull(ctx, repoPath, remote, branch); err != nil {
+			return err
+		}
+	}
+	if out, err := s.execute(ctx, repoPath, GitCommand, "revert", "--no-commit", reverted[0].CommitID); err != nil {
+		// Leave the repository as it was before the revert, the reset is best effort
+		if resetOut, resetErr := s.execute(ctx, repoPath, GitCommand, "reset", "--hard", "HEAD"); resetErr != nil {
+			s.Log.Error(resetErr, "failed to reset the reverted changes", "output", string(resetOut))
+		}
+		return &GitCmdError{path: repoPath, cmdResult: string(out), err: err, cmdType: revertCommit}
+	}
+	if s.dryRun != nil {
+		defer func() {
+			if out, err := s.execute(ctx, repoPath, GitCommand, "reset", "--hard", "HEAD"); err != nil {
+				s.Log.Error(err, "failed to reset the reverted changes", "output", string(out))
+			}
+		}()
+		return s.recordDryRunCommit(ctx, s.filesystem(), repoPath)
+	}
+	trailers := make([]CommitTrailers, 0, len(reverted))
+	for _, change := range reverted {
+		trailers = append(trailers, CommitTrailers{Component: change.Component, Environment: change.Environment})
+	}
+	if err := s.commitChanges(ctx, repoPath, withTrailers(message, trailers, s.CommitOptions.createdBy())); err != nil {
+		return err
+	}
+	return s.pushWithRetry(ctx, repoPath, remote, branch)
+}
+
+// revertMessage returns the message of the commit reverting the commit holding the changes, without its trailers
+func revertMessage(reverted []GeneratorCommit) string {
+	message := fmt.Sprintf("Revert \"%s\"\n\nThis reverts commit %s.\n", revertedSubject(reverted), reverted[0].CommitID)
+	if len(reverted) > 1 {
+		// List the changes of a batch, so that the revert can be parsed as well
+		message += "\n"
+		for _, change := range reverted {
+			message += "- " + change.Subject + "\n"
+		}
+	}
+	return message
+}
+
+// revertedSubject returns the subject of the commit holding the changes
+func revertedSubject(changes []GeneratorCommit) string {
+	if len(changes) == 1 {
+		return changes[0].Subject
+	}
+	return fmt.Sprintf("Apply %d changes to the GitOps resources", len(changes))
+}
+
+// readCommits returns the changes made by the generator in each of the commits of the revision and its first
+// parents, at most maxCount commits being read when not zero
+func (s Gen) readCommits(ctx context.Context, repoPath string, rev string, maxCount int) ([][]GeneratorCommit, error) {
+	args := []string{"--no-pager", "log", logFormat}
+	if maxCount > 0 {
+		args = append(args, "--max-count="+strconv.Itoa(maxCount))
+	}
+	out, err := s.execute(ctx, repoPath, GitCommand, append(args, rev)...)
+	if err != nil {
+		return nil, &GitCmdError{path: repoPath, cmdResult: string(out), err: err, cmdType: listCommits}
+	}
+
+	var commits [][]GeneratorCommit
+	for _, record := range strings.Split(string(out), "\x1e") {
+		fields := strings.SplitN(strings.TrimLeft(record, "\n"), "\x1f", 5)
+		if len(fields) != 5 {
+			continue
+		}
+		date, err := time.Parse(time.RFC3339, fields[3])
+		if err != nil {
+			return nil, &GitCmdError{path: repoPath, err: err, cmdType: listCommits}
+		}
+		changes := parseGeneratorChanges(fields[4])
+		for i := range changes {
+			changes[i].CommitID = fields[0]
+			changes[i].Author = Identity{Name: fields[1], Email: fields[2]}
+			changes[i].Date = date
+		}
+		commits = append(commits, changes)
+	}
+	return commits, nil
+}
+
+// parseGeneratorChanges returns the changes described by the message of a commit made by the generator, none for
+// the other commits. The CommitID, Author and Date of the changes are not set.
+func parseGeneratorChanges(message string) []GeneratorCommit {
+	lines := strings.Split(strings.TrimSpace(message), "\n")
+	subject, reverts := lines[0], ""
+	if match := revertPattern.FindStringSubmatch(subject); match != nil {
+		if reverted := revertedCommitPattern.FindStringSubmatch(message); reverted != nil {
+			subject, reverts = match[1], reverted[1]
+		}
+	}
+
+	subjects := []string{subject}
+	if batchPattern.MatchString(subject) {
+		subjects = nil
+		for _, line := range lines[1:] {
+			if strings.HasPrefix(line, "- ") {
+				subjects = append(subjects, strings.TrimPrefix(line, "- "))
+			}
+		}
+	}
+
+	var changes []GeneratorCommit
+	if trailers := ParseCommitTrailers(message); len(trailers) > 0 && trailers[0].Component != "" {
+		// The trailers describe the changes even when the subjects were rendered from a CommitMessageTemplate
+		for i, t := range trailers {
+			change := GeneratorCommit{Subject: subject, Component: t.Component, Environment: t.Environment, Reverts: reverts}
+			if len(subjects) == len(trailers) {
+				change.Subject = subjects[i]
+			}
+			changes = append(changes, change)
+		}
+		return changes
+	}
+	for _, subject := range subjects {
+		change := GeneratorCommit{Subject: subject, Reverts: reverts}
+		if match := generateBasePattern.FindStringSubmatch(subject); match != nil {
+			change.Component = match[1]
+		} else if match := generateOverlaysPattern.FindStringSubmatch(subject); match != nil {
+			change.Environment, change.Component = match[1], match[2]
+		} else if match := removeComponentPattern.FindStringSubmatch(subject); match != nil {
+			change.Component = match[1]
+		} else {
+			continue
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// readImage returns the container image of the component as of the commit of the change, read from the deployment
+// patch of the overlays of the environment, or from the base deployment. An empty image is returned if the file does
+// not exist.
+func (s Gen) readImage(ctx context.Context, repoPath string, repoContext string, change GeneratorCommit) (string, error) {
+	file := imageFile(repoContext, change)
+	out, err := s.execute(ctx, repoPath, GitCommand, "--no-pager", "show", change.CommitID+":"+file)
+	if err != nil {
+		// The component was removed, or its resources were not generated in the commit
+		return "", ctx.Err()
+	}
+	image, err := deploymentImage(out)
+	if err != nil {
+		return "", &GitCmdError{path: repoPath, err: fmt.Errorf("failed to read %s at commit %s: %w", file, change.CommitID, err), cmdType: listCommits}
+	}
+	return image, nil
+}
+
+// imageFile returns the slash separated path, relative to the repository, of the file holding the container image of
+// the component of the change
+func imageFile(repoContext string, change GeneratorCommit) string {
+	file := path.Join("components", change.Component, "base", deploymentFileName)
+	if change.Environment != "" {
+		file = path.Join("components", change.Component, "overlays", change.Environment, deploymentPatchFileName)
+	}
+	return strings.TrimPrefix(path.Join(filepath.ToSlash(repoContext), file), "/")
+}
+
+// deploymentImage returns the image of the first container of the deployment, empty if it has none
+func deploymentImage(content []byte) (string, error) {
+	var deployment appsv1.Deployment
+	if err := yaml.Unmarshal(content, &deployment); err != nil {
+		return "", err
+	}
+	if containers := deployment.Spec.Template.Spec.Containers; len(containers) > 0 {
+		return containers[0].Image, nil
+	}
+	return "", nil
+}
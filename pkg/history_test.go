@@ -0,0 +1,148 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	gitopsv1alpha1 "github.com/redhat-developer/gitops-generator/api/v1alpha1"
+	"github.com/redhat-developer/gitops-generator/pkg/testutils"
+	"github.com/redhat-developer/gitops-generator/pkg/util"
+	"github.com/redhat-developer/gitops-generator/pkg/util/ioutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGeneratorChanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    []GeneratorCommit
+	}{
+		{
+			name:    "Base resources",
+			message: "Generate GitOps base resources for component frontend\n",
+			want:    []GeneratorCommit{{Subject: "Generate GitOps base resources for component frontend", Component: "frontend"}},
+		},
+		{
+			name:    "Overlays",
+			message: "Generate staging environment overlays for component frontend",
+			want:    []GeneratorCommit{{Subject: "Generate staging environment overlays for component frontend", Component: "frontend", Environment: "staging"}},
+		},
+		{
+			name:    "Batch",
+			message: "Apply 2 changes to the GitOps resources\n\n- Removed component backend\n- Generate prod environment overlays for component frontend\n",
+			want: []GeneratorCommit{
+				{Subject: "Removed component backend", Component: "backend"},
+				{Subject: "Generate prod environment overlays for component frontend", Component: "frontend", Environment: "prod"},
+			},
+		},
+		{
+			name:    "Revert",
+			message: "Revert \"Removed component backend\"\n\nThis reverts commit 0123abcd.\n",
+			want:    []GeneratorCommit{{Subject: "Removed component backend", Component: "backend", Reverts: "0123abcd"}},
+		},
+		{
+			name:    "Subject rendered from a template",
+			message: "chore(gitops): promote frontend to prod\n\nComponent: frontend\nEnvironment: prod\nCreated-By: application-service\n",
+			want:    []GeneratorCommit{{Subject: "chore(gitops): promote frontend to prod", Component: "frontend", Environment: "prod"}},
+		},
+		{
+			name:    "Commit not made by the generator",
+			message: "Update README.md",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseGeneratorChanges(tt.message))
+		})
+	}
+}
+
+func TestCommitHistoryAndRevert(t *testing.T) {
+	useInProcessFileTransport(t)
+	remote := "file://" + newBareRemote(t, "main")
+	fs := ioutils.NewMemoryFilesystem()
+	e := NewGoGitExecutor(fs)
+	run := func(baseDir string, args ...string) string {
+		t.Helper()
+		out, err := e.Execute(context.Background(), baseDir, GitCommand, args...)
+		testutils.AssertNoError(t, err)
+		return string(out)
+	}
+	run("/upstream", "clone", remote, "repo")
+	run("/upstream/repo", "checkout", "-b", "main")
+	testutils.AssertNoError(t, writeFile(fs, "/upstream/repo/README.md", []byte("GitOps\n"), 0644))
+	run("/upstream/repo", "add", ".")
+	run("/upstream/repo", "-c", "user.name=Test User", "-c", "user.email=test@test.org", "commit", "-m", "Add README.md")
+	run("/upstream/repo", "push", "origin", "main")
+
+	generator := NewGitopsGen(WithExecutor(e), WithFilesystem(fs), WithHostRegistry(util.NewHostRegistry(util.Host{Schemes: []string{"file"}})),
+		WithCommitOptions(CommitOptions{Author: &Identity{Name: "Generator", Email: "generator@test.org"}}))
+	component := gitopsv1alpha1.GeneratorOptions{Name: "frontend", ContainerImage: "quay.io/org/frontend:v1", Replicas: 1}
+	testutils.AssertNoError(t, generator.CloneGenerateAndPush("/output", remote, component, fs, "main", "gitops", true))
+	for _, image := range []string{"quay.io/org/frontend:v2", "quay.io/org/frontend:v3"} {
+		testutils.AssertNoError(t, generator.GenerateOverlaysAndPush("/output", false, remote, component, "frontend", "staging", image, "ns", fs, "main", "gitops", true, nil))
+	}
+
+	history, err := generator.GetCommitHistory("/output/frontend", "gitops", CommitHistoryOptions{})
+	testutils.AssertNoError(t, err)
+	assert.Len(t, history, 3, "the commits not made by the generator should be skipped")
+	assert.Equal(t, "quay.io/org/frontend:v3", history[0].Image)
+	assert.Equal(t, "staging", history[0].Environment)
+	assert.Equal(t, "quay.io/org/frontend:v2", history[1].Image)
+	assert.Equal(t, "quay.io/org/frontend:v1", history[2].Image)
+	assert.Equal(t, "", history[2].Environment)
+	assert.Equal(t, Identity{Name: "Generator", Email: "generator@test.org"}, history[0].Author)
+	assert.Equal(t, strings.TrimSpace(run("/output/frontend", "rev-parse", "HEAD")), history[0].CommitID)
+
+	history, err = generator.GetCommitHistory("/output/frontend", "gitops", CommitHistoryOptions{Environment: "staging", MaxCount: 1})
+	testutils.AssertNoError(t, err)
+	assert.Len(t, history, 1)
+	history, err = generator.GetCommitHistory("/output/frontend", "gitops", CommitHistoryOptions{Component: "backend"})
+	testutils.AssertNoError(t, err)
+	assert.Empty(t, history)
+
+	// Rolling back the last promotion restores the previous image
+	bad := strings.TrimSpace(run("/output/frontend", "rev-parse", "HEAD"))
+	testutils.AssertNoError(t, generator.RevertCommit("/output/frontend", remote, "main", bad))
+	run("/upstream/repo", "pull")
+	history, err = generator.GetCommitHistory("/upstream/repo", "gitops", CommitHistoryOptions{MaxCount: 1})
+	testutils.AssertNoError(t, err)
+	assert.Equal(t, bad, history[0].Reverts)
+	assert.Equal(t, "quay.io/org/frontend:v2", history[0].Image)
+	assert.Equal(t, "frontend", history[0].Component)
+
+	readme, err := generator.GetCommitHistory("/upstream/repo", "gitops", CommitHistoryOptions{})
+	testutils.AssertNoError(t, err)
+	first := readme[len(readme)-1].CommitID
+	initial := strings.TrimSpace(run("/output/frontend", "rev-parse", first+"~1"))
+	err = generator.RevertCommit("/output/frontend", remote, "main", initial)
+	testutils.AssertErrorMatch(t, "was not made by the generator", err)
+}
+
+func TestRevertCommitValidation(t *testing.T) {
+	executedCmds := []testutils.Execution{}
+	generator := NewGitopsGen(WithExecutor(newTestExecutor(testutils.NewOutputs(), testutils.NewErrors(), &executedCmds)), WithFilesystem(ioutils.NewMemoryFilesystem()))
+	for _, commitID := range []string{"--output=/tmp/pwned", "HEAD~1", "abc", "0123456789ABCDEF"} {
+		err := generator.RevertCommit("/output/frontend", "https://github.com/testing/testing.git", "main", commitID)
+		var validationErr *ValidationError
+		assert.True(t, errors.As(err, &validationErr), "a ValidationError should be returned for %q, got %v", commitID, err)
+	}
+	assert.Empty(t, executedCmds, "no command should be run")
+}
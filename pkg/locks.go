@@ -0,0 +1,112 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"context"
+	"net/url"
+	"path/filepath"
+	"sync"
+)
+
+// repoLocks serializes the Gen methods working on the same local repository of a remote branch, so that concurrent
+// calls, e.g. from reconcilers with MaxConcurrentReconciles > 1, do not change the same working tree at the same time.
+// It is shared by all the Gen of the process.
+var repoLocks = newRepoLockManager()
+
+// repoLockKey identifies the local repository of a remote branch
+type repoLockKey struct {
+	remote   string
+	branch   string
+	repoPath string
+}
+
+// repoLock is held by the call working on a repository. A channel is used, so that waiting for it can be cancelled.
+type repoLock struct {
+	ch chan struct{}
+	// refs counts the calls holding or waiting for the lock, which is dropped once it is 0
+	refs int
+}
+
+// repoLockManager holds the locks of the repositories in use
+type repoLockManager struct {
+	mu    sync.Mutex
+	locks map[repoLockKey]*repoLock
+}
+
+// heldRepoLock is the key of the context values marking the repository locks held by the call
+type heldRepoLock repoLockKey
+
+func newRepoLockManager() *repoLockManager {
+	return &repoLockManager{locks: map[repoLockKey]*repoLock{}}
+}
+
+// lock waits until no other call works on the repository of the remote branch at repoPath, or the context is done.
+// It returns the context marking the lock as held, to be passed to the nested calls so that they do not wait for it,
+// along with the function releasing the lock.
+func (m *repoLockManager) lock(ctx context.Context, remote string, branch string, repoPath string) (context.Context, func(), error) {
+	key := newRepoLockKey(remote, branch, repoPath)
+	if ctx.Value(heldRepoLock(key)) != nil {
+		return ctx, func() {}, nil
+	}
+
+	m.mu.Lock()
+	l, ok := m.locks[key]
+	if !ok {
+		l = &repoLock{ch: make(chan struct{}, 1)}
+		m.locks[key] = l
+	}
+	l.refs++
+	m.mu.Unlock()
+
+	// A free lock is taken even if the context is done, so that the error is reported by the operation itself
+	select {
+	case l.ch <- struct{}{}:
+	default:
+		select {
+		case l.ch <- struct{}{}:
+		case <-ctx.Done():
+			m.unref(key, l)
+			return ctx, nil, ctx.Err()
+		}
+	}
+	var once sync.Once
+	return context.WithValue(ctx, heldRepoLock(key), true), func() {
+		once.Do(func() {
+			<-l.ch
+			m.unref(key, l)
+		})
+	}, nil
+}
+
+// unref drops the lock once no call holds or waits for it
+func (m *repoLockManager) unref(key repoLockKey, l *repoLock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if l.refs--; l.refs == 0 {
+		delete(m.locks, key)
+	}
+}
+
+// newRepoLockKey returns the key of the repository, without the credentials of the remote URL so that the calls with
+// different tokens share the lock
+func newRepoLockKey(remote string, branch string, repoPath string) repoLockKey {
+	if u, err := url.Parse(remote); err == nil && u.User != nil {
+		u.User = nil
+		remote = u.String()
+	}
+	return repoLockKey{remote: remote, branch: branch, repoPath: filepath.Clean(repoPath)}
+}
@@ -0,0 +1,95 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redhat-developer/gitops-generator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepoLockManager(t *testing.T) {
+	m := newRepoLockManager()
+	remote := "https://github.com/org/repo.git"
+
+	ctx, unlock, err := m.lock(context.Background(), "https://token@github.com/org/repo.git", "main", "/output/app/")
+	testutils.AssertNoError(t, err)
+
+	// The nested calls do not wait for the lock they hold
+	_, unlockNested, err := m.lock(ctx, remote, "main", "/output/app")
+	testutils.AssertNoError(t, err)
+	unlockNested()
+
+	// Other repositories are not locked
+	_, unlockOther, err := m.lock(context.Background(), remote, "main", "/output/other")
+	testutils.AssertNoError(t, err)
+	unlockOther()
+	_, unlockOther, err = m.lock(context.Background(), remote, "staging", "/output/app")
+	testutils.AssertNoError(t, err)
+	unlockOther()
+
+	// The same repository is locked whatever the token of the remote
+	timeoutCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _, err = m.lock(timeoutCtx, remote, "main", "/output/app")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	locked := make(chan struct{})
+	go func() {
+		_, unlock, err := m.lock(context.Background(), remote, "main", "/output/app")
+		testutils.AssertNoError(t, err)
+		close(locked)
+		unlock()
+	}()
+	select {
+	case <-locked:
+		t.Fatal("the lock should be held")
+	case <-time.After(20 * time.Millisecond):
+	}
+	unlock()
+	unlock()
+	<-locked
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	assert.Empty(t, m.locks, "the unused locks should be dropped")
+}
+
+func TestRepoLockCancellation(t *testing.T) {
+	executedCmds := []testutils.Execution{}
+	generator := NewGitopsGen(WithExecutor(newTestExecutor(testutils.NewOutputs(), testutils.NewErrors(), &executedCmds)))
+	remote := "https://github.com/testing/testing.git"
+
+	_, unlock, err := repoLocks.lock(context.Background(), remote, "main", "/fake/path/test-component")
+	testutils.AssertNoError(t, err)
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = generator.CommitAndPushWithContext(ctx, "/fake/path", "", remote, "test-component", "main", "Update")
+	var cancelledErr *OperationCancelledError
+	assert.True(t, errors.As(err, &cancelledErr), "unexpected error %v", err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Empty(t, executedCmds, "no command should run while the repository is locked")
+
+	// Other branches of the same repository can be changed in the meantime
+	testutils.AssertNoError(t, generator.CommitAndPush("/fake/path", "", remote, "test-component", "staging", "Update"))
+	assert.NotEmpty(t, executedCmds)
+}
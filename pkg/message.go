@@ -0,0 +1,162 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/afero"
+)
+
+// CommitOperation is the operation of the generator a commit is made for
+type CommitOperation string
+
+const (
+	// GenerateBaseOperation is the generation of the base resources of a component by CloneGenerateAndPush
+	GenerateBaseOperation CommitOperation = "generate-base"
+	// GenerateOverlaysOperation is the generation of the overlays of a component for an environment by
+	// GenerateOverlaysAndPush and GenerateOverlaysAndOpenPullRequest
+	GenerateOverlaysOperation CommitOperation = "generate-overlays"
+	// RemoveComponentOperation is the removal of a component by GitRemoveComponent
+	RemoveComponentOperation CommitOperation = "remove-component"
+	// GenerateRepositoryOperation is the generation of a new GitOps repository by GenerateAndPush
+	GenerateRepositoryOperation CommitOperation = "generate-repository"
+)
+
+// DefaultCommitSubjectTemplate is the template of the commit subjects used when the CommitMessageTemplate has none
+const DefaultCommitSubjectTemplate = `{{if eq .Operation "generate-base"}}Generate GitOps base resources for component {{.Component}}` +
+	`{{else if eq .Operation "generate-overlays"}}Generate {{.Environment}} environment overlays for component {{.Component}}` +
+	`{{else if eq .Operation "remove-component"}}Removed component {{.Component}}` +
+	`{{else}}Generate GitOps resources{{end}}`
+
+// CommitMessageTemplate holds the text/template templates of the messages of the commits made by CloneGenerateAndPush,
+// GenerateOverlaysAndPush, GenerateOverlaysAndOpenPullRequest, GitRemoveComponent, GenerateAndPush and the operations
+// of a Batch. The templates are executed with a CommitMessageData, e.g. a Conventional Commits subject referencing a ticket can be set with:
+//
+//	Subject: "chore(gitops): {{.DefaultSubject}}",
+//	Body:    "Refs: PROJ-123\n\n{{range .Files}}- {{.}}\n{{end}}",
+//
+// The messages of the commits made by CommitAndPush and CommitAndOpenPullRequest are the ones passed to them.
+type CommitMessageTemplate struct {
+	// Subject is the template of the first line of the messages. Defaults to DefaultCommitSubjectTemplate.
+	Subject string
+	// Body is the template of the rest of the messages. The messages have no body when not set.
+	Body string
+}
+
+// CommitMessageData is passed to the CommitMessageTemplate to render the message of a commit
+type CommitMessageData struct {
+	Operation   CommitOperation
+	Component   string
+	Application string
+	// Environment is only set for the GenerateOverlaysOperation
+	Environment string
+	Image       string
+	// Files are the paths of the files changed by the commit, relative to the repository
+	Files []string
+	// DefaultSubject is the subject rendered from DefaultCommitSubjectTemplate
+	DefaultSubject string
+}
+
+// render returns the commit message rendered from the templates with the data
+func (t CommitMessageTemplate) render(data CommitMessageData) (string, error) {
+	var err error
+	if data.DefaultSubject, err = executeTemplate("subject", DefaultCommitSubjectTemplate, data); err != nil {
+		return "", err
+	}
+	subject := data.DefaultSubject
+	if t.Subject != "" {
+		if subject, err = executeTemplate("subject", t.Subject, data); err != nil {
+			return "", err
+		}
+	}
+	body := ""
+	if t.Body != "" {
+		if body, err = executeTemplate("body", t.Body, data); err != nil {
+			return "", err
+		}
+	}
+	// The subject is a single line, and a blank line separates it from the body
+	message := strings.Join(strings.Fields(subject), " ")
+	if body = strings.TrimSpace(body); body != "" {
+		message += "\n\n" + body
+	}
+	return message, nil
+}
+
+// executeTemplate parses and executes the template with the data
+func executeTemplate(name string, text string, data CommitMessageData) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", &CommitMessageTemplateError{template: name, operation: data.Operation, err: err}
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", &CommitMessageTemplateError{template: name, operation: data.Operation, err: err}
+	}
+	return out.String(), nil
+}
+
+// commitMessage returns the message of the commit of the staged changes, rendered from the CommitMessageTemplate of the
+// Gen with the files listed by the output of git diff --cached --name-only. The commitMessage is returned as is when data is nil.
+func (s Gen) commitMessage(commitMessage string, data *CommitMessageData, diff string) (string, error) {
+	if data == nil {
+		return commitMessage, nil
+	}
+	withFiles := *data
+	withFiles.Files = stagedFiles(diff)
+	return s.CommitOptions.MessageTemplate.render(withFiles)
+}
+
+// stagedFiles returns the paths of the files listed by git diff --cached --name-only
+func stagedFiles(diff string) []string {
+	var files []string
+	for _, line := range strings.Split(diff, "\n") {
+		if line != "" {
+			files = append(files, line)
+		}
+	}
+	return files
+}
+
+// repositoryFiles returns the paths of the files of the repository, relative to it, for the first commit of a new
+// repository
+func repositoryFiles(fs afero.Afero, repoPath string) ([]string, error) {
+	var files []string
+	err := fs.Walk(repoPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(repoPath, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
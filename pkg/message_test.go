@@ -0,0 +1,122 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"testing"
+
+	"github.com/redhat-developer/gitops-generator/pkg/testutils"
+	"github.com/redhat-developer/gitops-generator/pkg/util/ioutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommitMessageTemplate(t *testing.T) {
+	tests := []struct {
+		name          string
+		template      CommitMessageTemplate
+		data          CommitMessageData
+		want          string
+		wantErrString string
+	}{
+		{
+			name: "Default base resources message",
+			data: CommitMessageData{Operation: GenerateBaseOperation, Component: "frontend"},
+			want: "Generate GitOps base resources for component frontend",
+		},
+		{
+			name: "Default overlays message",
+			data: CommitMessageData{Operation: GenerateOverlaysOperation, Component: "frontend", Environment: "staging"},
+			want: "Generate staging environment overlays for component frontend",
+		},
+		{
+			name: "Default removal message",
+			data: CommitMessageData{Operation: RemoveComponentOperation, Component: "frontend"},
+			want: "Removed component frontend",
+		},
+		{
+			name: "Default repository message",
+			data: CommitMessageData{Operation: GenerateRepositoryOperation, Component: "frontend"},
+			want: "Generate GitOps resources",
+		},
+		{
+			name: "Custom subject and body",
+			template: CommitMessageTemplate{
+				Subject: "chore(gitops): {{.DefaultSubject}}",
+				Body:    "Refs: PROJ-123\nImage: {{.Image}} of {{.Application}}\n\n{{range .Files}}- {{.}}\n{{end}}",
+			},
+			data: CommitMessageData{Operation: GenerateOverlaysOperation, Component: "frontend", Application: "shop", Environment: "prod", Image: "quay.io/org/frontend:v2",
+				Files: []string{"components/frontend/overlays/prod/kustomization.yaml", "components/frontend/overlays/prod/deployment-patch.yaml"}},
+			want: "chore(gitops): Generate prod environment overlays for component frontend\n\n" +
+				"Refs: PROJ-123\nImage: quay.io/org/frontend:v2 of shop\n\n" +
+				"- components/frontend/overlays/prod/kustomization.yaml\n- components/frontend/overlays/prod/deployment-patch.yaml",
+		},
+		{
+			name:     "Multiline subject is joined",
+			template: CommitMessageTemplate{Subject: "feat: remove\n{{.Component}}\n"},
+			data:     CommitMessageData{Operation: RemoveComponentOperation, Component: "frontend"},
+			want:     "feat: remove frontend",
+		},
+		{
+			name:          "Invalid template",
+			template:      CommitMessageTemplate{Body: "{{.Component"},
+			data:          CommitMessageData{Operation: RemoveComponentOperation, Component: "frontend"},
+			wantErrString: "failed to render the commit message body template of operation \"remove-component\": template: body:1: unclosed action",
+		},
+		{
+			name:          "Unknown field",
+			template:      CommitMessageTemplate{Subject: "{{.Ticket}}"},
+			data:          CommitMessageData{Operation: RemoveComponentOperation, Component: "frontend"},
+			wantErrString: "failed to render the commit message subject template of operation \"remove-component\".*can't evaluate field Ticket",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, err := tt.template.render(tt.data)
+			if tt.wantErrString != "" {
+				testutils.AssertErrorMatch(t, tt.wantErrString, err)
+				return
+			}
+			testutils.AssertNoError(t, err)
+			assert.Equal(t, tt.want, message)
+		})
+	}
+}
+
+func TestStagedFiles(t *testing.T) {
+	assert.Equal(t, []string{"components/a/base/deployment.yaml", "components/a b/base/kustomization.yaml"}, stagedFiles("components/a/base/deployment.yaml\ncomponents/a b/base/kustomization.yaml\n"))
+	assert.Equal(t, []string{"components/a/base/x b/deployment.yaml"}, stagedFiles("components/a/base/x b/deployment.yaml"))
+	assert.Empty(t, stagedFiles(""))
+}
+
+func TestGitRemoveComponentMessageTemplate(t *testing.T) {
+	repo := "https://github.com/testing/testing.git"
+	executedCmds := []testutils.Execution{}
+	outputs := testutils.NewOutputs(nil, nil, nil, []byte("abc\trefs/heads/main"), []byte("components/test-component/base/deployment.yaml"), nil, nil, nil)
+	generator := NewGitopsGen(WithExecutor(newTestExecutor(outputs, testutils.NewErrors(), &executedCmds)), WithFilesystem(ioutils.NewMemoryFilesystem()),
+		WithCommitOptions(CommitOptions{MessageTemplate: CommitMessageTemplate{Subject: "chore: remove {{.Component}}", Body: "{{range .Files}}{{.}}{{end}}"}}))
+
+	testutils.AssertNoError(t, generator.GitRemoveComponent("/fake/path", repo, "test-component", "main", "/"))
+	want := withTrailers("chore: remove test-component\n\ncomponents/test-component/base/deployment.yaml", []CommitTrailers{{Component: "test-component"}}, defaultCreatedBy)
+	assert.Equal(t, []string{"commit", "-m", want}, executedCmds[len(executedCmds)-2].Args)
+
+	executedCmds = []testutils.Execution{}
+	generator.CommitOptions.MessageTemplate = CommitMessageTemplate{Subject: "{{"}
+	outputs = testutils.NewOutputs(nil, nil, nil, []byte("abc\trefs/heads/main"), []byte("components/test-component/base/deployment.yaml"), nil, nil, nil)
+	generator.Executor = newTestExecutor(outputs, testutils.NewErrors(), &executedCmds)
+	err := generator.GitRemoveComponent("/fake/path", repo, "test-component", "main", "/")
+	testutils.AssertErrorMatch(t, "failed to render the commit message subject template", err)
+	assert.Equal(t, []string{"--no-pager", "diff", "--cached", "--name-only"}, executedCmds[len(executedCmds)-1].Args, "nothing should be committed")
+}
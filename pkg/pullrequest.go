@@ -0,0 +1,233 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/jenkins-x/go-scm/scm"
+	gitopsv1alpha1 "github.com/redhat-developer/gitops-generator/api/v1alpha1"
+	"github.com/spf13/afero"
+)
+
+const pullRequestBranchPrefix = "gitops-generator"
+
+// PullRequestOptions configures the pull request (GitHub) or merge request (GitLab) opened in place of a direct push
+// to the target branch
+type PullRequestOptions struct {
+	// Title of the pull request. Defaults to the subject of the commit message.
+	Title string
+	// Body of the pull request
+	Body string
+	// Labels to add to the pull request
+	Labels []string
+	// Reviewers are the logins of the users to request a review from
+	Reviewers []string
+	// SourceBranch is the topic branch the changes are pushed to. Defaults to a branch derived from the component and
+	// environment names, so that the changes to the same component and environment update the same pull request.
+	SourceBranch string
+}
+
+// PullRequest describes the pull request opened or updated with the generated changes
+type PullRequest struct {
+	Number int
+	URL    string
+	// SourceBranch is the topic branch holding the changes
+	SourceBranch string
+	// TargetBranch is the branch the changes are proposed to
+	TargetBranch string
+	// Updated is true if an already open pull request was updated, instead of opening a new one
+	Updated bool
+}
+
+// pullRequestBranch returns the default topic branch for the changes to the component, and environment if any
+func pullRequestBranch(componentName string, environmentName string) string {
+	if environmentName == "" {
+		return fmt.Sprintf("%s/components/%s", pullRequestBranchPrefix, componentName)
+	}
+	return fmt.Sprintf("%s/environments/%s/%s", pullRequestBranchPrefix, environmentName, componentName)
+}
+
+// CommitAndOpenPullRequest commits the changes like CommitAndPush, but pushes them to a topic branch and opens a pull
+// request to the target branch instead of pushing to it. An open pull request from the same topic branch is updated
+// rather than opening a new one. nil is returned when there are no changes to propose, or for a dry run.
+// 1. outputPath: Where the gitops resources are
+// 2. repoPathOverride: The default path is the componentName. Use this to override the default folder.
+// 3. remote: A string of the form https://$token@github.com/<org>/<repo>, where $token is omitted when using Credentials, or an SSH remote such as git@github.com:<org>/<repo>.git. Corresponds to the component's gitops repository
+// 4. componentName: The component name corresponding to a single Component in an Application in AS. eg. component.Name
+// 5. The branch to open the pull request against
+// 6. The commit message, also used as the pull request title when none is set
+// 7. prOptions: Options of the pull request
+func (s Gen) CommitAndOpenPullRequest(outputPath string, repoPathOverride string, remote string, componentName string, branch string, commitMessage string, prOptions PullRequestOptions) (*PullRequest, error) {
+	return s.CommitAndOpenPullRequestWithContext(context.Background(), outputPath, repoPathOverride, remote, componentName, branch, commitMessage, prOptions)
+}
+
+// CommitAndOpenPullRequestWithContext is the context aware variant of CommitAndOpenPullRequest
+func (s Gen) CommitAndOpenPullRequestWithContext(ctx context.Context, outputPath string, repoPathOverride string, remote string, componentName string, branch string, commitMessage string, prOptions PullRequestOptions) (pr *PullRequest, err error) {
+	defer func() { err = checkCancelled(ctx, "CommitAndOpenPullRequest", err) }()
+	if err := validateArgs(nameArg("component name", componentName), pathArg("repository path override", repoPathOverride)); err != nil {
+		return nil, err
+	}
+	return s.commitAndOpenPullRequest(ctx, outputPath, repoPathOverride, remote, componentName, "", branch, commitMessage, nil, []CommitTrailers{{Component: componentName}}, prOptions)
+}
+
+// GenerateOverlaysAndOpenPullRequest generates the overlays like GenerateOverlaysAndPush, and proposes them through a
+// pull request to the target branch like CommitAndOpenPullRequest. The default topic branch is specific to the
+// component and environment. nil is returned when there are no changes to propose, or for a dry run.
+// The arguments are the ones of GenerateOverlaysAndPush, without doPush, followed by the options of the pull request.
+func (s Gen) GenerateOverlaysAndOpenPullRequest(outputPath string, clone bool, remote string, options gitopsv1alpha1.GeneratorOptions, applicationName, environmentName, imageName, namespace string, appFs afero.Afero, branch string, repoContext string, componentGeneratedResources map[string][]string, prOptions PullRequestOptions) (*PullRequest, error) {
+	return s.GenerateOverlaysAndOpenPullRequestWithContext(context.Background(), outputPath, clone, remote, options, applicationName, environmentName, imageName, namespace, appFs, branch, repoContext, componentGeneratedResources, prOptions)
+}
+
+// GenerateOverlaysAndOpenPullRequestWithContext is the context aware variant of GenerateOverlaysAndOpenPullRequest
+func (s Gen) GenerateOverlaysAndOpenPullRequestWithContext(ctx context.Context, outputPath string, clone bool, remote string, options gitopsv1alpha1.GeneratorOptions, applicationName, environmentName, imageName, namespace string, appFs afero.Afero, branch string, repoContext string, componentGeneratedResources map[string][]string, prOptions PullRequestOptions) (pr *PullRequest, err error) {
+	defer func() { err = checkCancelled(ctx, "GenerateOverlaysAndOpenPullRequest", err) }()
+	if err := validateArgs(nameArg("component name", options.Name), optionalNameArg("application name", applicationName), optionalNameArg("environment name", environmentName), pathArg("context", repoContext)); err != nil {
+		return nil, err
+	}
+	ctx, unlock, err := repoLocks.lock(ctx, remote, branch, filepath.Join(outputPath, applicationName))
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if err := s.GenerateOverlaysAndPushWithContext(ctx, outputPath, clone, remote, options, applicationName, environmentName, imageName, namespace, appFs, branch, repoContext, false, componentGeneratedResources); err != nil || s.dryRun != nil {
+		return nil, err
+	}
+	data := &CommitMessageData{Operation: GenerateOverlaysOperation, Component: options.Name, Application: applicationName, Environment: environmentName, Image: imageName}
+	trailers := []CommitTrailers{{Component: options.Name, Application: applicationName, Environment: environmentName, Image: imageName}}
+	return s.commitAndOpenPullRequest(ctx, outputPath, applicationName, remote, options.Name, environmentName, branch, "", data, trailers, prOptions)
+}
+
+func (s Gen) commitAndOpenPullRequest(ctx context.Context, outputPath string, repoPathOverride string, remote string, componentName string, environmentName string, branch string, commitMessage string, data *CommitMessageData, trailers []CommitTrailers, prOptions PullRequestOptions) (*PullRequest, error) {
+	invalidRemoteErr := s.validateRemote(remote)
+	if invalidRemoteErr != nil {
+		return nil, invalidRemoteErr
+	}
+
+	repoPath := filepath.Join(outputPath, componentName)
+	if repoPathOverride != "" {
+		repoPath = filepath.Join(outputPath, repoPathOverride)
+	}
+	sourceBranch := prOptions.SourceBranch
+	if sourceBranch == "" {
+		sourceBranch = pullRequestBranch(componentName, environmentName)
+	}
+
+	ctx, unlock, err := repoLocks.lock(ctx, remote, branch, repoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if s.dryRun != nil {
+		return nil, s.recordDryRunCommit(ctx, s.filesystem(), repoPath)
+	}
+	commitMessage, committed, err := s.commit(ctx, repoPath, remote, componentName, branch, commitMessage, data, trailers)
+	if err != nil || !committed {
+		return nil, err
+	}
+	// The topic branch is owned by the generator, and always holds a single commit on top of the target branch
+	if out, err := s.executeRemote(ctx, repoPath, remote, "push", "--force", "origin", "HEAD:refs/heads/"+sourceBranch); err != nil {
+		return nil, &GitCmdError{path: remote, cmdResult: string(out), err: err, cmdType: pushRemote}
+	}
+
+	title := prOptions.Title
+	if title == "" {
+		title = strings.SplitN(commitMessage, "\n", 2)[0]
+	}
+	pr, err := s.openPullRequest(ctx, remote, sourceBranch, branch, title, prOptions)
+	if err != nil {
+		return nil, &PullRequestError{remote: remote, sourceBranch: sourceBranch, targetBranch: branch, err: err}
+	}
+	return pr, nil
+}
+
+// openPullRequest opens a pull request from the source branch to the target branch, or updates the one already open
+func (s Gen) openPullRequest(ctx context.Context, remote string, sourceBranch string, targetBranch string, title string, prOptions PullRequestOptions) (*PullRequest, error) {
+	client, err := s.scmClient(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	repo, err := repoFullName(remote)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := findOpenPullRequest(ctx, client, repo, sourceBranch, targetBranch)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &scm.PullRequestInput{Title: title, Body: prOptions.Body, Head: sourceBranch, Base: targetBranch}
+	var scmPR *scm.PullRequest
+	if existing != nil {
+		if scmPR, _, err = client.PullRequests.Update(ctx, repo, existing.Number, input); err != nil {
+			return nil, err
+		}
+		// Not all the drivers return the labels of the updated pull request
+		scmPR.Labels = existing.Labels
+	} else if scmPR, _, err = client.PullRequests.Create(ctx, repo, input); err != nil {
+		return nil, err
+	}
+
+	existingLabels := map[string]bool{}
+	for _, label := range scmPR.Labels {
+		existingLabels[label.Name] = true
+	}
+	for _, label := range prOptions.Labels {
+		if existingLabels[label] {
+			continue
+		}
+		if _, err := client.PullRequests.AddLabel(ctx, repo, scmPR.Number, label); err != nil {
+			return nil, err
+		}
+	}
+	if len(prOptions.Reviewers) > 0 {
+		if _, err := client.PullRequests.RequestReview(ctx, repo, scmPR.Number, prOptions.Reviewers); err != nil {
+			return nil, err
+		}
+	}
+
+	return &PullRequest{
+		Number:       scmPR.Number,
+		URL:          scmPR.Link,
+		SourceBranch: sourceBranch,
+		TargetBranch: targetBranch,
+		Updated:      existing != nil,
+	}, nil
+}
+
+// findOpenPullRequest returns the open pull request from the source branch to the target branch, nil if there is none
+func findOpenPullRequest(ctx context.Context, client *scm.Client, repo string, sourceBranch string, targetBranch string) (*scm.PullRequest, error) {
+	opts := scm.PullRequestListOptions{Open: true, Page: 1, Size: 100}
+	for {
+		prs, resp, err := client.PullRequests.List(ctx, repo, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, pr := range prs {
+			if pr.Source == sourceBranch && pr.Target == targetBranch && !pr.Closed && !pr.Merged {
+				return pr, nil
+			}
+		}
+		if resp == nil || resp.Page.Next <= opts.Page {
+			return nil, nil
+		}
+		opts.Page = resp.Page.Next
+	}
+}
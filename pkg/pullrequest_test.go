@@ -0,0 +1,250 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/jenkins-x/go-scm/scm/driver/github"
+	gitopsv1alpha1 "github.com/redhat-developer/gitops-generator/api/v1alpha1"
+	"github.com/redhat-developer/gitops-generator/pkg/testutils"
+	"github.com/redhat-developer/gitops-generator/pkg/util/ioutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// githubPR is the subset of the GitHub pull request payload used by go-scm
+type githubPR struct {
+	Number    int                 `json:"number"`
+	State     string              `json:"state"`
+	Title     string              `json:"title"`
+	Body      string              `json:"body"`
+	HTMLURL   string              `json:"html_url"`
+	Head      map[string]string   `json:"head"`
+	Base      map[string]string   `json:"base"`
+	Labels    []map[string]string `json:"labels"`
+	Reviewers []string            `json:"-"`
+}
+
+// fakeGitHub serves the GitHub pull request API of the testing/testing repository
+type fakeGitHub struct {
+	sync.Mutex
+	prs      []*githubPR
+	requests []string
+	fail     bool
+}
+
+func (f *fakeGitHub) find(number int) *githubPR {
+	for _, pr := range f.prs {
+		if pr.Number == number {
+			return pr
+		}
+	}
+	return nil
+}
+
+func (f *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	if f.fail {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"message": "server error"}`))
+		return
+	}
+
+	var number int
+	var input map[string]interface{}
+	_ = json.NewDecoder(r.Body).Decode(&input)
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/repos/testing/testing/pulls":
+		open := []*githubPR{}
+		for _, pr := range f.prs {
+			if pr.State == "open" {
+				open = append(open, pr)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(open)
+	case r.Method == http.MethodPost && r.URL.Path == "/repos/testing/testing/pulls":
+		pr := &githubPR{
+			Number:  len(f.prs) + 1,
+			State:   "open",
+			Title:   fmt.Sprint(input["title"]),
+			Body:    fmt.Sprint(input["body"]),
+			HTMLURL: fmt.Sprintf("https://github.com/testing/testing/pull/%d", len(f.prs)+1),
+			Head:    map[string]string{"ref": fmt.Sprint(input["head"])},
+			Base:    map[string]string{"ref": fmt.Sprint(input["base"])},
+		}
+		f.prs = append(f.prs, pr)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(pr)
+	case r.Method == http.MethodPatch:
+		_, _ = fmt.Sscanf(r.URL.Path, "/repos/testing/testing/pulls/%d", &number)
+		pr := f.find(number)
+		pr.Title, pr.Body = fmt.Sprint(input["title"]), fmt.Sprint(input["body"])
+		_ = json.NewEncoder(w).Encode(githubPR{Number: pr.Number, State: pr.State, Title: pr.Title, Body: pr.Body, HTMLURL: pr.HTMLURL, Head: pr.Head, Base: pr.Base})
+	default:
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{}`))
+	}
+}
+
+func TestCommitAndOpenPullRequest(t *testing.T) {
+	repo := "https://token@github.com/testing/testing.git"
+	outputPath := "/fake/path"
+	repoPath := "/fake/path/test-component"
+	branch := "main"
+	commitMessage := "Update component"
+	prOptions := PullRequestOptions{Body: "Generated changes", Labels: []string{"gitops"}, Reviewers: []string{"reviewer"}}
+	defaultBranch := "gitops-generator/components/test-component"
+
+	commitCmds := func(sourceBranch string) []testutils.Execution {
+		return []testutils.Execution{
+			{BaseDir: repoPath, Command: "git", Args: []string{"add", "."}},
+			{BaseDir: repoPath, Command: "git", Args: []string{"--no-pager", "diff", "--cached", "--name-only"}},
+			{BaseDir: repoPath, Command: "git", Args: []string{"ls-remote", "--heads", repo, branch}},
+			{BaseDir: repoPath, Command: "git", Args: []string{"pull"}},
+			{BaseDir: repoPath, Command: "git", Args: []string{"commit", "-m", withTrailers(commitMessage, []CommitTrailers{{Component: "test-component"}}, defaultCreatedBy)}},
+			{BaseDir: repoPath, Command: "git", Args: []string{"push", "--force", "origin", "HEAD:refs/heads/" + sourceBranch}},
+		}
+	}
+	changedOutputs := func() *testutils.OutputStack {
+		return testutils.NewOutputs(nil, nil, nil, []byte("abc\trefs/heads/main"), []byte("components/test-component/base/deployment.yaml"), nil)
+	}
+
+	tests := []struct {
+		name          string
+		existing      []*githubPR
+		fail          bool
+		outputs       *testutils.OutputStack
+		prOptions     PullRequestOptions
+		want          *PullRequest
+		wantCmds      []testutils.Execution
+		wantRequests  []string
+		wantErrString string
+	}{
+		{
+			name:      "New pull request",
+			outputs:   changedOutputs(),
+			prOptions: prOptions,
+			want:      &PullRequest{Number: 1, URL: "https://github.com/testing/testing/pull/1", SourceBranch: defaultBranch, TargetBranch: branch},
+			wantCmds:  commitCmds(defaultBranch),
+			wantRequests: []string{
+				"GET /repos/testing/testing/pulls",
+				"POST /repos/testing/testing/pulls",
+				"POST /repos/testing/testing/issues/1/labels",
+				"POST /repos/testing/testing/pulls/1/requested_reviewers",
+			},
+		},
+		{
+			name: "Open pull request for the same component is updated",
+			existing: []*githubPR{
+				{Number: 1, State: "open", HTMLURL: "https://github.com/testing/testing/pull/1", Head: map[string]string{"ref": "other"}, Base: map[string]string{"ref": branch}},
+				{Number: 2, State: "closed", HTMLURL: "https://github.com/testing/testing/pull/2", Head: map[string]string{"ref": defaultBranch}, Base: map[string]string{"ref": branch}},
+				{Number: 3, State: "open", HTMLURL: "https://github.com/testing/testing/pull/3", Head: map[string]string{"ref": defaultBranch}, Base: map[string]string{"ref": branch}, Labels: []map[string]string{{"name": "gitops"}}},
+			},
+			outputs:   changedOutputs(),
+			prOptions: PullRequestOptions{Title: "Custom title", Labels: []string{"gitops"}},
+			want:      &PullRequest{Number: 3, URL: "https://github.com/testing/testing/pull/3", SourceBranch: defaultBranch, TargetBranch: branch, Updated: true},
+			wantCmds:  commitCmds(defaultBranch),
+			wantRequests: []string{
+				"GET /repos/testing/testing/pulls",
+				"PATCH /repos/testing/testing/pulls/3",
+			},
+		},
+		{
+			name:      "Custom source branch",
+			outputs:   changedOutputs(),
+			prOptions: PullRequestOptions{SourceBranch: "topic"},
+			want:      &PullRequest{Number: 1, URL: "https://github.com/testing/testing/pull/1", SourceBranch: "topic", TargetBranch: branch},
+			wantCmds:  commitCmds("topic"),
+			wantRequests: []string{
+				"GET /repos/testing/testing/pulls",
+				"POST /repos/testing/testing/pulls",
+			},
+		},
+		{
+			name:      "No changes to propose",
+			outputs:   testutils.NewOutputs(),
+			prOptions: prOptions,
+			wantCmds:  commitCmds(defaultBranch)[:2],
+		},
+		{
+			name:          "Git host API failure",
+			fail:          true,
+			outputs:       changedOutputs(),
+			prOptions:     prOptions,
+			wantCmds:      commitCmds(defaultBranch),
+			wantRequests:  []string{"GET /repos/testing/testing/pulls"},
+			wantErrString: "failed to open a pull request from branch \"gitops-generator/components/test-component\" to branch \"main\" of remote \"https://<TOKEN>@github.com/testing/testing.git\"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &fakeGitHub{prs: tt.existing, fail: tt.fail}
+			server := httptest.NewServer(api)
+			defer server.Close()
+			var clientRemote string
+			scmClientFactory := func(remote string) (*scm.Client, error) {
+				clientRemote = remote
+				return github.New(server.URL)
+			}
+			executedCmds := []testutils.Execution{}
+			generator := NewGitopsGen(WithExecutor(newTestExecutor(tt.outputs, testutils.NewErrors(), &executedCmds)), WithScmClientFactory(scmClientFactory))
+
+			pr, err := generator.CommitAndOpenPullRequest(outputPath, "", repo, "test-component", branch, commitMessage, tt.prOptions)
+			if tt.wantErrString != "" {
+				testutils.AssertErrorMatch(t, tt.wantErrString, err)
+				assert.IsType(t, &PullRequestError{}, err)
+			} else {
+				testutils.AssertNoError(t, err)
+			}
+			assert.Equal(t, tt.want, pr)
+			assert.Equal(t, tt.wantCmds, executedCmds, "command executed should be equal")
+			if tt.wantRequests != nil {
+				assert.Equal(t, repo, clientRemote)
+			}
+			assert.Equal(t, tt.wantRequests, api.requests, "API requests should be equal")
+		})
+	}
+}
+
+func TestGenerateOverlaysAndOpenPullRequest(t *testing.T) {
+	repo := "https://github.com/testing/testing.git"
+	api := &fakeGitHub{}
+	server := httptest.NewServer(api)
+	defer server.Close()
+	executedCmds := []testutils.Execution{}
+	outputs := testutils.NewOutputs(nil, nil, nil, []byte("abc\trefs/heads/main"), []byte("components/test-component/overlays/staging/kustomization.yaml"), nil, nil, nil)
+	generator := NewGitopsGen(WithExecutor(newTestExecutor(outputs, testutils.NewErrors(), &executedCmds)), WithScmClientFactory(func(remote string) (*scm.Client, error) {
+		return github.New(server.URL)
+	}))
+	component := gitopsv1alpha1.GeneratorOptions{Name: "test-component", Replicas: 2}
+
+	pr, err := generator.GenerateOverlaysAndOpenPullRequest("/fake/path", true, repo, component, "test-application", "staging", "image", "namespace", ioutils.NewMemoryFilesystem(), "main", "/", nil, PullRequestOptions{})
+	testutils.AssertNoError(t, err)
+	assert.Equal(t, &PullRequest{Number: 1, URL: "https://github.com/testing/testing/pull/1", SourceBranch: "gitops-generator/environments/staging/test-component", TargetBranch: "main"}, pr)
+	assert.Equal(t, []string{"clone", repo, "test-application"}, executedCmds[0].Args)
+	assert.Equal(t, []string{"commit", "-m", withTrailers("Generate staging environment overlays for component test-component", []CommitTrailers{{Component: "test-component", Application: "test-application", Environment: "staging", Image: "image"}}, defaultCreatedBy)}, executedCmds[len(executedCmds)-2].Args)
+	assert.Equal(t, []string{"push", "--force", "origin", "HEAD:refs/heads/gitops-generator/environments/staging/test-component"}, executedCmds[len(executedCmds)-1].Args)
+	assert.Equal(t, "Generate staging environment overlays for component test-component", api.prs[0].Title)
+}
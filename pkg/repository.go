@@ -0,0 +1,352 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/jenkins-x/go-scm/scm"
+	gitopsv1alpha1 "github.com/redhat-developer/gitops-generator/api/v1alpha1"
+	"github.com/spf13/afero"
+)
+
+// legacyRepositorySubject is the subject of the first commit of the repositories created by GenerateAndPush before
+// the generator commits had trailers
+const legacyRepositorySubject = "Generate GitOps resources"
+
+// RepositoryVisibility is the visibility of the repositories created by GenerateAndPush
+type RepositoryVisibility string
+
+const (
+	// PrivateVisibility restricts the access to the repository to its members
+	PrivateVisibility RepositoryVisibility = "private"
+	// InternalVisibility gives access to the repository to the members of the enterprise or instance. It is only
+	// supported by the github and gitlab drivers.
+	InternalVisibility RepositoryVisibility = "internal"
+	// PublicVisibility gives access to the repository to everyone
+	PublicVisibility RepositoryVisibility = "public"
+)
+
+// RepositoryOwner is the kind of account the repositories created by GenerateAndPush belong to
+type RepositoryOwner string
+
+const (
+	// UserOwner creates the repositories in the personal account of the user of the token
+	UserOwner RepositoryOwner = "user"
+	// OrganizationOwner creates the repositories in an organization, or a group for GitLab
+	OrganizationOwner RepositoryOwner = "organization"
+)
+
+// RepositoryOptions configures the GitOps repositories created by GenerateAndPush. The settings that go-scm cannot set
+// when creating a repository, such as the topics, are set through the API of the github and gitlab drivers, and a
+// GitCreateRepoError is returned for the other drivers.
+type RepositoryOptions struct {
+	// Owner is the kind of account the repository is created in. When not set, the repository is created in the
+	// personal account of the user of the token if the namespace is their login, and in the namespace otherwise.
+	Owner RepositoryOwner
+	// Namespace is the organization or group the repository is created in. Defaults to the organization of the URL
+	// of the GitSource of the GeneratorOptions, which must point to the created repository. Ignored for UserOwner.
+	Namespace string
+	// Visibility of the repository. Defaults to PrivateVisibility.
+	Visibility RepositoryVisibility
+	// Description of the repository. Defaults to "Bootstrapped GitOps Repository based on Components".
+	Description string
+	// Topics are added to the repository
+	Topics []string
+	// DefaultBranch is set as the default branch of the repository after the resources are pushed. It must be the
+	// branch pushed to, or one of the branches of the Template. The host decides of the default branch when not set.
+	DefaultBranch string
+	// Template is the <owner>/<repo> full name of the repository the repository is created from. The resources are
+	// committed on top of the branch of the template, if it has one. It is only supported by the github driver.
+	Template string
+	// Scaffold adds scaffolding files, such as a README.md, to the generated resources. The scaffolding files missing
+	// from an adopted repository are added to it. Only the resources of the component are generated when not set.
+	Scaffold *ScaffoldOptions
+	// Webhook is registered on the repository after the resources are pushed, including when it is adopted. No webhook
+	// is registered when not set.
+	Webhook *WebhookOptions
+	// AdoptExisting makes GenerateAndPush push to the repository when it already exists, instead of failing, so that
+	// it can be retried after a partial failure. An empty repository is pushed to like a new one. The component is
+	// regenerated on top of the branch of a repository only holding commits made by the generator, and a
+	// ForeignRepositoryError is returned for any other repository, which is left untouched. The settings of an
+	// existing repository are not changed.
+	AdoptExisting bool
+}
+
+// WithRepositoryOptions sets how the GitOps repositories are created by GenerateAndPush
+func WithRepositoryOptions(repositoryOptions RepositoryOptions) GenOption {
+	return func(g *Gen) {
+		g.RepositoryOptions = repositoryOptions
+	}
+}
+
+// validate returns an error if the options are invalid, or not supported by the driver
+func (o RepositoryOptions) validate(driver scm.Driver) error {
+	switch o.Owner {
+	case "", UserOwner, OrganizationOwner:
+	default:
+		return fmt.Errorf("unknown repository owner %q", o.Owner)
+	}
+	switch o.Visibility {
+	case "", PrivateVisibility, PublicVisibility:
+	case InternalVisibility:
+		if driver != scm.DriverGithub && driver != scm.DriverGitlab {
+			return fmt.Errorf("the internal visibility is not supported by the %s driver", driver)
+		}
+	default:
+		return fmt.Errorf("unknown repository visibility %q", o.Visibility)
+	}
+	if (len(o.Topics) > 0 || o.DefaultBranch != "") && driver != scm.DriverGithub && driver != scm.DriverGitlab {
+		return fmt.Errorf("setting the topics and default branch of a repository is not supported by the %s driver", driver)
+	}
+	if o.Template != "" && driver != scm.DriverGithub {
+		return fmt.Errorf("creating a repository from a template is not supported by the %s driver", driver)
+	}
+	return nil
+}
+
+// namespace returns the namespace the repository is created in, which is the login of the user for a personal
+// repository. org is the organization of the URL of the repository.
+func (o RepositoryOptions) namespace(org string, login string) (string, bool) {
+	namespace := org
+	if o.Namespace != "" {
+		namespace = o.Namespace
+	}
+	switch o.Owner {
+	case UserOwner:
+		return login, true
+	case OrganizationOwner:
+		return namespace, false
+	}
+	if namespace == "" || namespace == login {
+		return login, true
+	}
+	return namespace, false
+}
+
+// create creates the repository in the namespace, or in the personal account of the user
+func (o RepositoryOptions) create(ctx context.Context, client *scm.Client, namespace string, personal bool, name string) error {
+	description := o.Description
+	if description == "" {
+		description = defaultRepoDescription
+	}
+	private := o.Visibility != PublicVisibility
+	if o.Template != "" {
+		in := map[string]interface{}{"owner": namespace, "name": name, "description": description, "private": private}
+		return doRequest(ctx, client, http.MethodPost, "repos/"+o.Template+"/generate", in)
+	}
+	// Unlike for the namespaces of GitLab, clearing the namespace makes go-scm use the endpoint creating a personal
+	// repository of GitHub
+	if personal && client.Driver != scm.DriverGitlab {
+		namespace = ""
+	}
+	_, _, err := client.Repositories.Create(ctx, &scm.RepositoryInput{Private: private, Description: description, Namespace: namespace, Name: name})
+	return err
+}
+
+// configure sets the internal visibility and the topics of the created repository, which go-scm cannot set
+func (o RepositoryOptions) configure(ctx context.Context, client *scm.Client, fullName string) error {
+	settings := map[string]interface{}{}
+	if o.Visibility == InternalVisibility {
+		settings["visibility"] = string(InternalVisibility)
+	}
+	if len(o.Topics) > 0 {
+		if client.Driver == scm.DriverGithub {
+			if err := doRequest(ctx, client, http.MethodPut, "repos/"+fullName+"/topics", map[string]interface{}{"names": o.Topics}); err != nil {
+				return err
+			}
+		} else {
+			settings["topics"] = o.Topics
+		}
+	}
+	if len(settings) == 0 {
+		return nil
+	}
+	return updateRepository(ctx, client, fullName, settings)
+}
+
+// updateRepository updates the settings of the repository through the API of the github and gitlab drivers. The path
+// of the request is relative to the API URL of the client, which may have a path prefix for a self-hosted Git host.
+func updateRepository(ctx context.Context, client *scm.Client, fullName string, settings map[string]interface{}) error {
+	switch client.Driver {
+	case scm.DriverGithub:
+		return doRequest(ctx, client, http.MethodPatch, "repos/"+fullName, settings)
+	case scm.DriverGitlab:
+		return doRequest(ctx, client, http.MethodPut, "api/v4/projects/"+url.PathEscape(fullName), settings)
+	default:
+		return fmt.Errorf("updating the settings of a repository is not supported by the %s driver", client.Driver)
+	}
+}
+
+// doRequest sends the JSON request to the API of the Git host with the go-scm client, which authenticates it
+func doRequest(ctx context.Context, client *scm.Client, method string, path string, in interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(ctx, &scm.Request{Method: method, Path: path, Header: http.Header{"Content-Type": []string{"application/json"}}, Body: bytes.NewReader(body)})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.Status >= http.StatusMultipleChoices {
+		return fmt.Errorf("%s %s: %s", method, path, http.StatusText(res.Status))
+	}
+	return nil
+}
+
+// adoptRepository pushes the generated resources to the existing repository of the remote. It returns false if the
+// repository is empty, for it to be pushed to like a new repository. Otherwise, the component is regenerated on top of
+// the branch, as long as all its commits were made by the generator.
+func (s Gen) adoptRepository(ctx context.Context, repoPath string, remote string, branch string, appFs afero.Afero, options gitopsv1alpha1.GeneratorOptions) (bool, error) {
+	out, err := s.executeRemote(ctx, repoPath, remote, "ls-remote", "--heads", remote)
+	if err != nil {
+		return false, &GitLsRemoteError{err: err, cmdResult: string(out), remote: remote}
+	}
+	if strings.TrimSpace(string(out)) == "" {
+		return false, nil
+	}
+	head := branchHead(string(out), branch)
+	if head == "" {
+		return false, &ForeignRepositoryError{remote: remote, reason: fmt.Sprintf("it has branches but not branch %q", branch)}
+	}
+	return true, s.regenerateOnBranch(ctx, repoPath, remote, branch, head, appFs, options, true)
+}
+
+// pushOnTemplate pushes the generated resources on top of the branch of a repository created from a template. It
+// returns false if the template does not have the branch, for it to be pushed like the branch of a new repository.
+func (s Gen) pushOnTemplate(ctx context.Context, repoPath string, remote string, branch string, appFs afero.Afero, options gitopsv1alpha1.GeneratorOptions) (bool, error) {
+	out, err := s.executeRemote(ctx, repoPath, remote, "ls-remote", "--heads", remote, branch)
+	if err != nil {
+		return false, &GitLsRemoteError{err: err, cmdResult: string(out), remote: remote}
+	}
+	head := branchHead(string(out), branch)
+	if head == "" {
+		return false, nil
+	}
+	return true, s.regenerateOnBranch(ctx, repoPath, remote, branch, head, appFs, options, false)
+}
+
+// regenerateOnBranch checks out the head commit of the branch of the remote in repoPath, where the resources were
+// generated, and regenerates the component on top of it before pushing. When checkCommits is set, a
+// ForeignRepositoryError is returned if any of the commits of the branch was not made by the generator.
+func (s Gen) regenerateOnBranch(ctx context.Context, repoPath string, remote string, branch string, head string, appFs afero.Afero, options gitopsv1alpha1.GeneratorOptions, checkCommits bool) error {
+	if out, err := s.execute(ctx, repoPath, GitCommand, "init", "."); err != nil {
+		return &GitCmdError{path: repoPath, cmdResult: string(out), err: err, cmdType: initializeGit}
+	}
+	if out, err := s.execute(ctx, repoPath, GitCommand, "remote", "add", "origin", remote); err != nil {
+		return &GitAddFilesToRemoteError{componentName: options.Name, remoteURL: remote, repoPath: repoPath, cmdResult: string(out), err: err}
+	}
+	if out, err := s.executeRemote(ctx, repoPath, remote, "fetch", "origin", branch); err != nil {
+		return &GitFetchError{remote: remote, cmdResult: string(out), err: err}
+	}
+	if checkCommits {
+		commitID, err := s.foreignCommit(ctx, repoPath, head)
+		if err != nil {
+			return err
+		}
+		if commitID != "" {
+			return &ForeignRepositoryError{remote: remote, reason: fmt.Sprintf("commit %s of branch %q was not made by the generator", commitID, branch)}
+		}
+	}
+
+	// The generated files are replaced by the ones of the branch, and the component is generated again on top of them
+	if out, err := s.execute(ctx, repoPath, GitCommand, "branch", "-m", branch); err != nil {
+		return &GitBranchError{branch: branch, repoPath: repoPath, cmdResult: string(out), err: err, cmdType: switchBranch}
+	}
+	if out, err := s.execute(ctx, repoPath, GitCommand, "update-ref", "HEAD", head); err != nil {
+		return &GitCmdError{path: repoPath, cmdResult: string(out), err: err, cmdType: resetWorkspace}
+	}
+	if out, err := s.execute(ctx, repoPath, GitCommand, "reset", "--hard", head); err != nil {
+		return &GitCmdError{path: repoPath, cmdResult: string(out), err: err, cmdType: resetWorkspace}
+	}
+	componentPath := filepath.Join(repoPath, "components", options.Name, "base")
+	if err := removeAll(appFs, repoPath, componentPath); err != nil {
+		return &GitGenResourcesAndOverlaysError{path: componentPath, componentName: options.Name, err: err}
+	}
+	if err := s.generateComponent(appFs, repoPath, componentPath, options); err != nil {
+		return &GitGenResourcesAndOverlaysError{path: componentPath, componentName: options.Name, err: err}
+	}
+
+	if out, err := s.execute(ctx, repoPath, GitCommand, "add", "."); err != nil {
+		return &GitAddFilesError{componentName: options.Name, repoPath: repoPath, cmdResult: string(out), err: err}
+	}
+	out, err := s.execute(ctx, repoPath, GitCommand, "--no-pager", "diff", "--cached", "--name-only")
+	if err != nil {
+		return &GitCmdError{path: repoPath, cmdResult: string(out), err: err, cmdType: checkGitDiff}
+	} else if string(out) == "" {
+		// The branch is already up to date, e.g. when the push of a previous call succeeded
+		return nil
+	}
+	data := CommitMessageData{Operation: GenerateBaseOperation, Component: options.Name, Application: options.Application, Image: options.ContainerImage}
+	commitMessage, err := s.commitMessage("", &data, string(out))
+	if err != nil {
+		return err
+	}
+	trailers := []CommitTrailers{{Component: options.Name, Application: options.Application, Image: options.ContainerImage}}
+	if err := s.commitChanges(ctx, repoPath, withTrailers(commitMessage, trailers, s.CommitOptions.createdBy())); err != nil {
+		return err
+	}
+	return s.pushWithRetry(ctx, repoPath, remote, branch)
+}
+
+// branchHead returns the commit of the branch listed by the output of git ls-remote --heads, or an empty string if
+// the branch is not listed
+func branchHead(lsRemote string, branch string) string {
+	for _, line := range strings.Split(lsRemote, "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[1] == "refs/heads/"+branch {
+			return fields[0]
+		}
+	}
+	return ""
+}
+
+// foreignCommit returns the ID of the most recent commit of the revision that was not made by the generator, or an
+// empty string if all of them were. Merge commits are skipped, the commits they merge being checked instead.
+func (s Gen) foreignCommit(ctx context.Context, repoPath string, rev string) (string, error) {
+	out, err := s.execute(ctx, repoPath, GitCommand, "--no-pager", "log", "--format=%H%x1f%P%x1f%B%x1e", rev)
+	if err != nil {
+		return "", &GitCmdError{path: repoPath, cmdResult: string(out), err: err, cmdType: listCommits}
+	}
+	for _, record := range strings.Split(string(out), "\x1e") {
+		fields := strings.SplitN(strings.TrimLeft(record, "\n"), "\x1f", 3)
+		if len(fields) != 3 || len(strings.Fields(fields[1])) > 1 {
+			continue
+		}
+		if !isGeneratorCommit(fields[2]) {
+			return fields[0], nil
+		}
+	}
+	return "", nil
+}
+
+// isGeneratorCommit returns true if the message is the one of a commit made by the generator, identified by its
+// trailers, or by its subject for the commits made before the trailers were added
+func isGeneratorCommit(message string) bool {
+	for _, trailers := range ParseCommitTrailers(message) {
+		if trailers.GeneratorVersion != "" || trailers.CreatedBy != "" {
+			return true
+		}
+	}
+	return len(parseGeneratorChanges(message)) > 0 || strings.TrimSpace(message) == legacyRepositorySubject
+}
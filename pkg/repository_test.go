@@ -0,0 +1,339 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/jenkins-x/go-scm/scm/driver/bitbucket"
+	"github.com/jenkins-x/go-scm/scm/driver/github"
+	"github.com/jenkins-x/go-scm/scm/driver/gitlab"
+	gitopsv1alpha1 "github.com/redhat-developer/gitops-generator/api/v1alpha1"
+	"github.com/redhat-developer/gitops-generator/pkg/testutils"
+	"github.com/redhat-developer/gitops-generator/pkg/util"
+	"github.com/redhat-developer/gitops-generator/pkg/util/ioutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeGitHubRepos serves the GitHub API creating the testing/testing repository, which fails once it exists. The
+// requests are recorded along with their body.
+type fakeGitHubRepos struct {
+	sync.Mutex
+	exists   bool
+	requests []string
+}
+
+func (f *fakeGitHubRepos) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	f.requests = append(f.requests, strings.TrimSpace(r.Method+" "+r.URL.Path+" "+strings.TrimSpace(string(body))))
+	switch {
+	case r.Method == http.MethodGet && (r.URL.Path == "/user" || r.URL.Path == "/api/v4/user"):
+		_, _ = w.Write([]byte(`{"login": "test-user"}`))
+	case r.Method == http.MethodPost && (strings.HasSuffix(r.URL.Path, "/repos") || strings.HasSuffix(r.URL.Path, "/generate")):
+		if f.exists {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_, _ = w.Write([]byte(`{"message": "Repository creation failed."}`))
+			return
+		}
+		f.exists = true
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"name": "testing", "full_name": "testing/testing"}`))
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/repos/") && f.exists:
+		_, _ = w.Write([]byte(`{"name": "testing", "full_name": "testing/testing"}`))
+	case r.Method == http.MethodPatch || r.Method == http.MethodPut:
+		_, _ = w.Write([]byte(`{}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"message": "Not Found"}`))
+	}
+}
+
+func TestGenerateAndPushAdoptExisting(t *testing.T) {
+	useInProcessFileTransport(t)
+	remote := "file://" + newBareRemote(t, "main")
+	fs := ioutils.NewMemoryFilesystem()
+	e := NewGoGitExecutor(fs)
+	run := func(baseDir string, args ...string) string {
+		t.Helper()
+		out, err := e.Execute(context.Background(), baseDir, GitCommand, args...)
+		testutils.AssertNoError(t, err)
+		return string(out)
+	}
+	api := &fakeGitHubRepos{exists: true}
+	server := httptest.NewServer(api)
+	defer server.Close()
+	newGenerator := func(adopt bool) Gen {
+		return NewGitopsGen(WithExecutor(e), WithFilesystem(fs), WithHostRegistry(util.NewHostRegistry(util.Host{Schemes: []string{"file"}})),
+			WithCommitOptions(CommitOptions{Author: &Identity{Name: "Generator", Email: "generator@test.org"}}),
+			WithScmClientFactory(func(remote string) (*scm.Client, error) {
+				return github.New(server.URL)
+			}),
+			WithRepositoryOptions(RepositoryOptions{AdoptExisting: adopt}))
+	}
+	component := func(name string, image string) gitopsv1alpha1.GeneratorOptions {
+		options := gitopsv1alpha1.GeneratorOptions{ContainerImage: image, GitSource: &gitopsv1alpha1.GitSource{URL: "https://github.com/testing/testing.git"}, TargetPort: 5000}
+		options.Name, options.Application = name, "shop"
+		return options
+	}
+
+	err := newGenerator(false).GenerateAndPush("/refused", remote, component("frontend", "quay.io/org/frontend:v1"), fs, "main", true, "KAM CLI")
+	testutils.AssertErrorMatch(t, "failed to create repository, repo already exists", err)
+
+	// The repository was created, but is empty
+	testutils.AssertNoError(t, newGenerator(true).GenerateAndPush("/first", remote, component("frontend", "quay.io/org/frontend:v1"), fs, "main", true, "KAM CLI"))
+	// The repository holds the resources pushed by the previous call
+	testutils.AssertNoError(t, newGenerator(true).GenerateAndPush("/second", remote, component("backend", "quay.io/org/backend:v1"), fs, "main", true, "KAM CLI"))
+	// Nothing is pushed when the component is already up to date
+	testutils.AssertNoError(t, newGenerator(true).GenerateAndPush("/third", remote, component("backend", "quay.io/org/backend:v1"), fs, "main", true, "KAM CLI"))
+
+	run("/check", "clone", remote, "repo")
+	log := run("/check/repo", "--no-pager", "log", "--format=%s")
+	assert.Equal(t, "Generate GitOps base resources for component backend\nGenerate GitOps resources\n", log)
+	for _, name := range []string{"frontend", "backend"} {
+		exists, err := fs.Exists("/check/repo/components/" + name + "/base/deployment.yaml")
+		testutils.AssertNoError(t, err)
+		assert.True(t, exists, "the adopted repository should hold the resources of %s", name)
+	}
+
+	// A commit that was not made by the generator is pushed to the repository
+	testutils.AssertNoError(t, writeFile(fs, "/check/repo/README.md", []byte("GitOps\n"), 0644))
+	run("/check/repo", "add", ".")
+	run("/check/repo", "-c", "user.name=Test User", "-c", "user.email=test@test.org", "commit", "-m", "Add README.md")
+	run("/check/repo", "push", "origin", "main")
+	head := strings.TrimSpace(run("/check/repo", "rev-parse", "HEAD"))
+
+	err = newGenerator(true).GenerateAndPush("/foreign", remote, component("backend", "quay.io/org/backend:v2"), fs, "main", true, "KAM CLI")
+	testutils.AssertErrorMatch(t, "refusing to adopt the existing repository of remote \".*\", commit "+head+" of branch \"main\" was not made by the generator", err)
+	assert.IsType(t, &ForeignRepositoryError{}, err)
+	assert.Contains(t, run("/", "ls-remote", "--heads", remote), head, "the foreign repository should be left untouched")
+
+	err = newGenerator(true).GenerateAndPush("/other-branch", remote, component("backend", "quay.io/org/backend:v2"), fs, "release", true, "KAM CLI")
+	testutils.AssertErrorMatch(t, "it has branches but not branch \"release\"", err)
+}
+
+func TestGenerateAndPushRetryAfterRejectedPush(t *testing.T) {
+	api := testutils.NewScmServer(t, "test-user")
+	api.Git.Token = "secret-token"
+	remote := api.Git.Remote("shop/gitops")
+	options := gitopsv1alpha1.GeneratorOptions{ContainerImage: "quay.io/shop/frontend:v1", TargetPort: 5000,
+		GitSource: &gitopsv1alpha1.GitSource{URL: api.Git.URL + "/shop/gitops.git"}, Secret: api.Git.Token}
+	options.Name, options.Application = "frontend", "shop"
+	fs := ioutils.NewMemoryFilesystem()
+	gen := newServedGen(api, fs, WithRepositoryOptions(RepositoryOptions{AdoptExisting: true}))
+
+	// The repository is created, but the pushes are rejected
+	api.Git.RejectPushes("shop/gitops", "pre-receive hook declined", 1)
+	err := gen.GenerateAndPush("/output", remote, options, fs, "main", true, "KAM CLI")
+	testutils.AssertErrorMatch(t, "pre-receive hook declined", err)
+	api.Git.RejectPushes("shop/gitops", "pre-receive hook declined", 1)
+	options.ContainerImage = "quay.io/shop/frontend:v2"
+	err = gen.GenerateAndPush("/output", remote, options, fs, "main", true, "KAM CLI")
+	testutils.AssertErrorMatch(t, "pre-receive hook declined", err)
+	assert.Equal(t, 0, api.Git.Pushes("shop/gitops"))
+
+	// Calling again with the same output path pushes the commits of the previous calls
+	testutils.AssertNoError(t, gen.GenerateAndPush("/output", remote, options, fs, "main", true, "KAM CLI"))
+	assert.Equal(t, 1, api.Git.Pushes("shop/gitops"))
+	assert.Contains(t, pushedFiles(t, api.Git, "shop/gitops", "main"), "components/frontend/base/deployment.yaml")
+	r, err := api.Git.Repository("shop/gitops")
+	testutils.AssertNoError(t, err)
+	commits, err := r.Log(&git.LogOptions{})
+	testutils.AssertNoError(t, err)
+	var subjects []string
+	testutils.AssertNoError(t, commits.ForEach(func(c *object.Commit) error {
+		subjects = append(subjects, strings.SplitN(c.Message, "\n", 2)[0])
+		return nil
+	}))
+	assert.Equal(t, []string{"Generate GitOps base resources for component frontend", "Generate GitOps resources"}, subjects,
+		"the image changed by the second call should be committed on top of the first commit, and nothing by the last call")
+}
+
+func TestIsGeneratorCommit(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    bool
+	}{
+		{
+			name:    "Trailers",
+			message: "chore: update the GitOps resources\n\nComponent: frontend\nGenerator-Version: v0.1.0\nCreated-By: application-service\n",
+			want:    true,
+		},
+		{
+			name:    "Default subject without trailers",
+			message: "Generate staging environment overlays for component frontend\n",
+			want:    true,
+		},
+		{
+			name:    "First commit without trailers",
+			message: "Generate GitOps resources",
+			want:    true,
+		},
+		{
+			name:    "Foreign commit",
+			message: "Add README.md\n\nSigned-off-by: Test User <test@test.org>\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isGeneratorCommit(tt.message))
+		})
+	}
+}
+
+func TestGenerateAndPushRepositoryOptions(t *testing.T) {
+	repo := "https://github.com/testing/testing.git"
+	description := `"description":"Bootstrapped GitOps Repository based on Components","homepage":""`
+	tests := []struct {
+		name          string
+		options       RepositoryOptions
+		url           string
+		driver        scm.Driver
+		outputs       [][]byte
+		wantRequests  []string
+		wantCmds      int
+		wantErrString string
+	}{
+		{
+			name:         "Default options",
+			wantRequests: []string{"POST /orgs/testing/repos {\"name\":\"testing\"," + description + ",\"private\":true}"},
+			wantCmds:     6,
+		},
+		{
+			name:         "Personal repository of the user of the token",
+			url:          "https://github.com/test-user/testing.git",
+			wantRequests: []string{"POST /user/repos {\"name\":\"testing\"," + description + ",\"private\":true}"},
+			wantCmds:     6,
+		},
+		{
+			name:         "Explicit personal repository",
+			options:      RepositoryOptions{Owner: UserOwner},
+			wantRequests: []string{"POST /user/repos {\"name\":\"testing\"," + description + ",\"private\":true}"},
+			wantCmds:     6,
+		},
+		{
+			name:         "Explicit organization",
+			options:      RepositoryOptions{Owner: OrganizationOwner, Namespace: "test-user"},
+			wantRequests: []string{"POST /orgs/test-user/repos {\"name\":\"testing\"," + description + ",\"private\":true}"},
+			wantCmds:     6,
+		},
+		{
+			name:    "Settings",
+			options: RepositoryOptions{Visibility: InternalVisibility, Description: "Shop", Topics: []string{"gitops", "shop"}, DefaultBranch: "main"},
+			wantRequests: []string{
+				"POST /orgs/testing/repos {\"name\":\"testing\",\"description\":\"Shop\",\"homepage\":\"\",\"private\":true}",
+				"PUT /repos/testing/testing/topics {\"names\":[\"gitops\",\"shop\"]}",
+				"PATCH /repos/testing/testing {\"visibility\":\"internal\"}",
+				"PATCH /repos/testing/testing {\"default_branch\":\"main\"}",
+			},
+			wantCmds: 6,
+		},
+		{
+			name:         "Public repository",
+			options:      RepositoryOptions{Visibility: PublicVisibility},
+			wantRequests: []string{"POST /orgs/testing/repos {\"name\":\"testing\"," + description + ",\"private\":false}"},
+			wantCmds:     6,
+		},
+		{
+			name:    "Template without the branch",
+			options: RepositoryOptions{Template: "templates/gitops"},
+			wantRequests: []string{
+				"POST /repos/templates/gitops/generate {\"description\":\"Bootstrapped GitOps Repository based on Components\",\"name\":\"testing\",\"owner\":\"testing\",\"private\":true}",
+			},
+			wantCmds: 7,
+		},
+		{
+			name:          "Unknown visibility",
+			options:       RepositoryOptions{Visibility: "secret"},
+			wantErrString: "failed to create repository \"testing\" in namespace \"testing\": unknown repository visibility \"secret\"",
+		},
+		{
+			name:          "Template not supported by the driver",
+			options:       RepositoryOptions{Template: "templates/gitops"},
+			driver:        scm.DriverGitlab,
+			wantErrString: "creating a repository from a template is not supported by the gitlab driver",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &fakeGitHubRepos{}
+			server := httptest.NewServer(api)
+			defer server.Close()
+			executedCmds := []testutils.Execution{}
+			generator := NewGitopsGen(WithExecutor(newTestExecutor(testutils.NewOutputs(tt.outputs...), testutils.NewErrors(), &executedCmds)),
+				WithScmClientFactory(func(remote string) (*scm.Client, error) {
+					if tt.driver == scm.DriverGitlab {
+						return gitlab.New(server.URL)
+					}
+					return github.New(server.URL)
+				}),
+				WithRepositoryOptions(tt.options))
+			url := tt.url
+			if url == "" {
+				url = repo
+			}
+			options := gitopsv1alpha1.GeneratorOptions{ContainerImage: "testimage:latest", GitSource: &gitopsv1alpha1.GitSource{URL: url}, TargetPort: 5000}
+			options.Name = "test-component"
+
+			err := generator.GenerateAndPush("/fake/path", repo, options, ioutils.NewMemoryFilesystem(), "main", true, "KAM CLI")
+			if tt.wantErrString != "" {
+				testutils.AssertErrorMatch(t, tt.wantErrString, err)
+				assert.Empty(t, executedCmds, "nothing should be pushed")
+				return
+			}
+			testutils.AssertNoError(t, err)
+			assert.Equal(t, append([]string{"GET /user"}, tt.wantRequests...), api.requests)
+			assert.Len(t, executedCmds, tt.wantCmds)
+			assert.Equal(t, []string{"push", "-u", "origin", "main"}, executedCmds[len(executedCmds)-1].Args)
+		})
+	}
+}
+
+func TestUpdateRepository(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.EscapedPath())
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	settings := map[string]interface{}{"default_branch": "main"}
+
+	// The path prefix of a self-hosted GitLab is kept
+	client, err := gitlab.New(server.URL + "/gitlab")
+	testutils.AssertNoError(t, err)
+	testutils.AssertNoError(t, updateRepository(context.Background(), client, "shop/gitops", settings))
+	client, err = github.New(server.URL + "/api/v3")
+	testutils.AssertNoError(t, err)
+	testutils.AssertNoError(t, updateRepository(context.Background(), client, "shop/gitops", settings))
+	assert.Equal(t, []string{"PUT /gitlab/api/v4/projects/shop%2Fgitops", "PATCH /api/v3/repos/shop/gitops"}, requests)
+
+	client, err = bitbucket.New(server.URL)
+	testutils.AssertNoError(t, err)
+	err = updateRepository(context.Background(), client, "shop/gitops", settings)
+	testutils.AssertErrorMatch(t, "updating the settings of a repository is not supported by the bitbucket driver", err)
+	assert.Len(t, requests, 2, "no request should be sent to the other drivers")
+}
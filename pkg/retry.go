@@ -0,0 +1,118 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// RetryPolicy configures how a push rejected because the remote branch has moved is retried. On each rejection, the
+// remote branch is fetched, the local commits are rebased onto it and the push is attempted again after a backoff.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of push attempts, including the first one. Values lower than 2 disable retries.
+	MaxAttempts int
+	// InitialBackoff is the time to wait before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the time to wait between two attempts. No cap is applied when zero.
+	MaxBackoff time.Duration
+	// Multiplier is applied to the backoff after every retry. Values lower than 1 keep the backoff constant.
+	Multiplier float64
+}
+
+// DefaultRetryPolicy returns the RetryPolicy used by NewGitopsGen and NewGitopsGenWithLogger
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Second,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+	}
+}
+
+// WithRetryPolicy sets the policy used to retry the pushes rejected because the remote branch has moved
+func WithRetryPolicy(policy RetryPolicy) GenOption {
+	return func(g *Gen) {
+		g.RetryPolicy = policy
+	}
+}
+
+// backoff returns the time to wait before the given retry, starting at 1
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < retry && p.Multiplier > 1; i++ {
+		backoff = time.Duration(float64(backoff) * p.Multiplier)
+		if p.MaxBackoff > 0 && backoff >= p.MaxBackoff {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return backoff
+}
+
+// isPushRejected returns true if the push failed because the remote branch contains commits that are not available
+// locally, as opposed to e.g. authentication or network failures
+func isPushRejected(cmdResult string, err error) bool {
+	for _, msg := range []string{cmdResult, err.Error()} {
+		if strings.Contains(msg, "[rejected]") || strings.Contains(msg, "non-fast-forward") || strings.Contains(msg, "fetch first") {
+			return true
+		}
+	}
+	return false
+}
+
+// pushWithRetry pushes the branch to origin. Following the RetryPolicy of the Gen, a rejected push is retried after
+// rebasing the local commits onto the remote branch. A GitRebaseConflictError is returned if the rebase fails.
+func (s Gen) pushWithRetry(ctx context.Context, repoPath string, remote string, branch string) error {
+	for attempt := 1; ; attempt++ {
+		out, err := s.executeRemote(ctx, repoPath, remote, "push", "origin", branch)
+		if err == nil {
+			return nil
+		}
+		if attempt >= s.RetryPolicy.MaxAttempts || !isPushRejected(string(out), err) {
+			return &GitCmdError{path: remote, cmdResult: string(out), err: err, cmdType: pushRemote}
+		}
+
+		backoff := s.RetryPolicy.backoff(attempt)
+		s.Log.Info("push was rejected, rebasing onto the remote branch before retrying", "branch", branch, "attempt", attempt, "backoff", backoff.String())
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		if out, err := s.executeRemote(ctx, repoPath, remote, "fetch", "origin", branch); err != nil {
+			return &GitFetchError{remote: remote, cmdResult: string(out), err: err}
+		}
+		// The rebased commits are committed again, by the configured committer
+		if out, err := s.execute(ctx, repoPath, GitCommand, append(s.CommitOptions.identityArgs(), "rebase", "origin/"+branch)...); err != nil {
+			// Leave the repository as it was before the rebase, the abort is best effort
+			if abortOut, abortErr := s.execute(ctx, repoPath, GitCommand, "rebase", "--abort"); abortErr != nil {
+				s.Log.Error(abortErr, "failed to abort the rebase", "output", string(abortOut))
+			}
+			return &GitRebaseConflictError{remote: remote, branch: branch, cmdResult: string(out), err: err}
+		}
+		// Rebasing drops the signature of the rebased commit
+		if err := s.signHead(ctx, repoPath); err != nil {
+			return err
+		}
+	}
+}
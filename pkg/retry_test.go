@@ -0,0 +1,176 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redhat-developer/gitops-generator/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommitAndPushRetry(t *testing.T) {
+	repo := "https://github.com/testing/testing.git"
+	outputPath := "/fake/path"
+	repoPath := "/fake/path/test-component"
+	rejectedOutput := []byte(" ! [rejected]        main -> main (fetch first)")
+	pushErr := errors.New("exit status 1")
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+
+	commitCmds := []testutils.Execution{
+		{BaseDir: repoPath, Command: "git", Args: []string{"add", "."}},
+		{BaseDir: repoPath, Command: "git", Args: []string{"--no-pager", "diff", "--cached", "--name-only"}},
+		{BaseDir: repoPath, Command: "git", Args: []string{"ls-remote", "--heads", repo, "main"}},
+		{BaseDir: repoPath, Command: "git", Args: []string{"pull"}},
+		{BaseDir: repoPath, Command: "git", Args: []string{"commit", "-m", withTrailers("Update component", []CommitTrailers{{Component: "test-component"}}, defaultCreatedBy)}},
+	}
+	push := testutils.Execution{BaseDir: repoPath, Command: "git", Args: []string{"push", "origin", "main"}}
+	fetch := testutils.Execution{BaseDir: repoPath, Command: "git", Args: []string{"fetch", "origin", "main"}}
+	rebase := testutils.Execution{BaseDir: repoPath, Command: "git", Args: []string{"rebase", "origin/main"}}
+	abort := testutils.Execution{BaseDir: repoPath, Command: "git", Args: []string{"rebase", "--abort"}}
+	commitOutputs := [][]byte{nil, []byte("components/test-component/base/deployment.yaml"), []byte("abc\trefs/heads/main"), nil, nil}
+	commitErrors := []error{nil, nil, nil, nil, nil}
+
+	tests := []struct {
+		name          string
+		policy        RetryPolicy
+		outputs       [][]byte
+		errors        []error
+		want          []testutils.Execution
+		wantErrString string
+		wantErr       interface{}
+	}{
+		{
+			name:    "Rejected push is pushed again after a rebase",
+			policy:  policy,
+			outputs: append(append([][]byte{}, commitOutputs...), rejectedOutput, nil, nil, nil),
+			errors:  append(append([]error{}, commitErrors...), pushErr, nil, nil, nil),
+			want:    append(append([]testutils.Execution{}, commitCmds...), push, fetch, rebase, push),
+		},
+		{
+			name:          "Rejected push is not retried without a retry policy",
+			outputs:       append(append([][]byte{}, commitOutputs...), rejectedOutput),
+			errors:        append(append([]error{}, commitErrors...), pushErr),
+			want:          append(append([]testutils.Execution{}, commitCmds...), push),
+			wantErrString: "failed to push remote to repository",
+		},
+		{
+			name:          "Push failures other than rejections are not retried",
+			policy:        policy,
+			outputs:       append(append([][]byte{}, commitOutputs...), []byte("fatal: Authentication failed")),
+			errors:        append(append([]error{}, commitErrors...), pushErr),
+			want:          append(append([]testutils.Execution{}, commitCmds...), push),
+			wantErrString: "Authentication failed",
+		},
+		{
+			name:          "Pushes are attempted up to MaxAttempts times",
+			policy:        policy,
+			outputs:       append(append([][]byte{}, commitOutputs...), rejectedOutput, nil, nil, rejectedOutput, nil, nil, rejectedOutput),
+			errors:        append(append([]error{}, commitErrors...), pushErr, nil, nil, pushErr, nil, nil, pushErr),
+			want:          append(append([]testutils.Execution{}, commitCmds...), push, fetch, rebase, push, fetch, rebase, push),
+			wantErrString: "fetch first",
+		},
+		{
+			name:          "Fetch failure",
+			policy:        policy,
+			outputs:       append(append([][]byte{}, commitOutputs...), rejectedOutput, nil),
+			errors:        append(append([]error{}, commitErrors...), pushErr, errors.New("fetch error")),
+			want:          append(append([]testutils.Execution{}, commitCmds...), push, fetch),
+			wantErrString: "failed to fetch from remote",
+			wantErr:       &GitFetchError{},
+		},
+		{
+			name:          "Rebase conflict is aborted and returned as a GitRebaseConflictError",
+			policy:        policy,
+			outputs:       append(append([][]byte{}, commitOutputs...), rejectedOutput, nil, []byte("CONFLICT (content): Merge conflict in components/test-component/base/deployment.yaml"), nil),
+			errors:        append(append([]error{}, commitErrors...), pushErr, nil, errors.New("could not apply"), nil),
+			want:          append(append([]testutils.Execution{}, commitCmds...), push, fetch, rebase, abort),
+			wantErrString: "failed to rebase onto branch \"main\" of remote .* Merge conflict in components/test-component/base/deployment.yaml",
+			wantErr:       &GitRebaseConflictError{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executedCmds := []testutils.Execution{}
+			outputs := testutils.NewOutputs()
+			errorStack := testutils.NewErrors()
+			// The stacks are popped from the end, push them in the reverse order of execution
+			for i := len(tt.outputs) - 1; i >= 0; i-- {
+				outputs.Outputs = append(outputs.Outputs, tt.outputs[i])
+				errorStack.Push(tt.errors[i])
+			}
+			generator := NewGitopsGen(WithExecutor(newTestExecutor(outputs, errorStack, &executedCmds)), WithRetryPolicy(tt.policy))
+
+			err := generator.CommitAndPush(outputPath, "", repo, "test-component", "main", "Update component")
+			if tt.wantErrString != "" {
+				testutils.AssertErrorMatch(t, tt.wantErrString, err)
+			} else {
+				testutils.AssertNoError(t, err)
+			}
+			if tt.wantErr != nil {
+				assert.IsType(t, tt.wantErr, err)
+			}
+			assert.Equal(t, tt.want, executedCmds, "command executed should be equal")
+		})
+	}
+
+	// Waiting for the backoff is aborted when the context is cancelled
+	executedCmds := []testutils.Execution{}
+	errorStack := testutils.NewErrors()
+	errorStack.Push(pushErr)
+	generator := NewGitopsGen(WithExecutor(newTestExecutor(testutils.NewOutputs(rejectedOutput), errorStack, &executedCmds)), WithRetryPolicy(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Hour}))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := generator.pushWithRetry(ctx, repoPath, repo, "main")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "error should match context.DeadlineExceeded")
+	assert.Equal(t, []testutils.Execution{push}, executedCmds, "command executed should be equal")
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		want   []time.Duration
+	}{
+		{
+			name:   "Default policy",
+			policy: DefaultRetryPolicy(),
+			want:   []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second},
+		},
+		{
+			name:   "Constant backoff",
+			policy: RetryPolicy{InitialBackoff: time.Second},
+			want:   []time.Duration{time.Second, time.Second, time.Second},
+		},
+		{
+			name:   "Uncapped backoff",
+			policy: RetryPolicy{InitialBackoff: time.Second, Multiplier: 3},
+			want:   []time.Duration{time.Second, 3 * time.Second, 9 * time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, want := range tt.want {
+				assert.Equal(t, want, tt.policy.backoff(i+1), "backoff of retry %d should be equal", i+1)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"embed"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	gitopsv1alpha1 "github.com/redhat-developer/gitops-generator/api/v1alpha1"
+	"github.com/spf13/afero"
+)
+
+//go:embed all:scaffold
+var embeddedScaffold embed.FS
+
+const (
+	// scaffoldTemplateSuffix is the suffix of the scaffolding files rendered as templates, which is removed from the
+	// path of the rendered files. The other files are copied as is.
+	scaffoldTemplateSuffix = ".tmpl"
+	// EnvironmentPlaceholder is the folder of the scaffolding templates rendered once for each environment, in a
+	// folder named after the environment
+	EnvironmentPlaceholder = "__environment__"
+)
+
+// DefaultScaffoldTemplates returns the scaffolding templates embedded in the generator: a README.md describing the
+// layout of the repository, a .gitignore, a CODEOWNERS, the kustomization.yaml of the application and the
+// environments/__environment__/kustomization.yaml of each environment
+func DefaultScaffoldTemplates() fs.FS {
+	templates, err := fs.Sub(embeddedScaffold, "scaffold")
+	if err != nil {
+		panic(err)
+	}
+	return templates
+}
+
+// ScaffoldOptions configures the scaffolding files added by GenerateAndPush to the repositories it bootstraps, next
+// to the resources of the component. The files are rendered with text/template from the DefaultScaffoldTemplates and
+// the Templates, and are executed with a ScaffoldData.
+type ScaffoldOptions struct {
+	// Templates override the default templates with the same path, and add the others. A template rendering an empty
+	// file is skipped, so that a default template is left out by overriding it with an empty file.
+	Templates fs.FS
+	// Environments are the names of the environments, which must be DNS-1123 labels. No environment folder is added
+	// when not set.
+	Environments []string
+	// Owners are the users or teams set as the owners of the files in CODEOWNERS, e.g. @org/team
+	Owners []string
+}
+
+// ScaffoldData is passed to the scaffolding templates
+type ScaffoldData struct {
+	// Application is empty when the GeneratorOptions have no application
+	Application string
+	Component   string
+	// Environment is only set for the templates of the EnvironmentPlaceholder folder
+	Environment  string
+	Environments []string
+	Owners       []string
+}
+
+// templates returns the content of the default templates, overridden by the Templates, by path
+func (o ScaffoldOptions) templates() (map[string][]byte, error) {
+	templates := map[string][]byte{}
+	for _, templateFs := range []fs.FS{DefaultScaffoldTemplates(), o.Templates} {
+		if templateFs == nil {
+			continue
+		}
+		err := fs.WalkDir(templateFs, ".", func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			content, err := fs.ReadFile(templateFs, path)
+			templates[path] = content
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return templates, nil
+}
+
+// write renders the templates in repoPath. The files that already exist, such as the generated resources, are not
+// overwritten.
+func (o ScaffoldOptions) write(appFs afero.Afero, repoPath string, data ScaffoldData) error {
+	templates, err := o.templates()
+	if err != nil {
+		return &ScaffoldError{err: err}
+	}
+	paths := make([]string, 0, len(templates))
+	for path := range templates {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	data.Environments, data.Owners = o.Environments, o.Owners
+	for _, templatePath := range paths {
+		if !hasPathElement(templatePath, EnvironmentPlaceholder) {
+			if err := renderScaffoldFile(appFs, repoPath, templatePath, templatePath, templates[templatePath], data); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, environment := range o.Environments {
+			environmentData := data
+			environmentData.Environment = environment
+			filePath := strings.ReplaceAll(templatePath, EnvironmentPlaceholder, environment)
+			if err := renderScaffoldFile(appFs, repoPath, templatePath, filePath, templates[templatePath], environmentData); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// renderScaffoldFile renders the template to the file of the repository, unless it exists or would be empty
+func renderScaffoldFile(appFs afero.Afero, repoPath string, templatePath string, filePath string, content []byte, data ScaffoldData) error {
+	if strings.HasSuffix(filePath, scaffoldTemplateSuffix) {
+		tmpl, err := template.New(templatePath).Option("missingkey=error").Parse(string(content))
+		if err != nil {
+			return &ScaffoldError{template: templatePath, err: err}
+		}
+		var out strings.Builder
+		if err := tmpl.Execute(&out, data); err != nil {
+			return &ScaffoldError{template: templatePath, err: err}
+		}
+		filePath, content = strings.TrimSuffix(filePath, scaffoldTemplateSuffix), []byte(out.String())
+	}
+	if strings.TrimSpace(string(content)) == "" {
+		return nil
+	}
+	target := filepath.Join(repoPath, filepath.FromSlash(filePath))
+	if exists, err := appFs.Exists(target); err != nil || exists {
+		return err
+	}
+	if err := writeFile(appFs, target, content, 0644); err != nil {
+		return &ScaffoldError{template: templatePath, err: err}
+	}
+	return nil
+}
+
+// hasPathElement returns true if one of the elements of the slash separated path is the element
+func hasPathElement(slashPath string, element string) bool {
+	for _, e := range strings.Split(path.Clean(slashPath), "/") {
+		if e == element {
+			return true
+		}
+	}
+	return false
+}
+
+// scaffold adds the scaffolding files of the ScaffoldOptions of the Gen to the repository, if any
+func (s Gen) scaffold(appFs afero.Afero, repoPath string, options gitopsv1alpha1.GeneratorOptions) error {
+	if s.RepositoryOptions.Scaffold == nil {
+		return nil
+	}
+	return s.RepositoryOptions.Scaffold.write(appFs, repoPath, ScaffoldData{Application: options.Application, Component: options.Name})
+}
@@ -0,0 +1,143 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"testing"
+	"testing/fstest"
+
+	gitopsv1alpha1 "github.com/redhat-developer/gitops-generator/api/v1alpha1"
+	"github.com/redhat-developer/gitops-generator/pkg/testutils"
+	"github.com/redhat-developer/gitops-generator/pkg/util/ioutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateAndPushScaffold(t *testing.T) {
+	fs := ioutils.NewMemoryFilesystem()
+	generator := NewGitopsGen(WithRepositoryOptions(RepositoryOptions{Scaffold: &ScaffoldOptions{Environments: []string{"staging", "prod"}, Owners: []string{"@shop/gitops", "@admin"}}}))
+	options := gitopsv1alpha1.GeneratorOptions{ContainerImage: "testimage:latest", TargetPort: 5000}
+	options.Name, options.Application = "frontend", "shop"
+
+	testutils.AssertNoError(t, generator.GenerateAndPush("/output", "https://github.com/testing/testing.git", options, fs, "main", false, "KAM CLI"))
+	files, err := repositoryFiles(fs, "/output/shop")
+	testutils.AssertNoError(t, err)
+	assert.Equal(t, []string{
+		".gitignore",
+		"CODEOWNERS",
+		"README.md",
+		"components/frontend/base/deployment.yaml",
+		"components/frontend/base/kustomization.yaml",
+		"components/frontend/base/route.yaml",
+		"components/frontend/base/service.yaml",
+		"environments/prod/kustomization.yaml",
+		"environments/staging/kustomization.yaml",
+		"kustomization.yaml",
+	}, files)
+
+	readFile := func(path string) string {
+		t.Helper()
+		content, err := fs.ReadFile("/output/shop/" + path)
+		testutils.AssertNoError(t, err)
+		return string(content)
+	}
+	assert.Equal(t, "# Owners of the GitOps resources of shop\n* @shop/gitops @admin\n", readFile("CODEOWNERS"))
+	assert.Contains(t, readFile("README.md"), "# shop\n")
+	assert.Contains(t, readFile("README.md"), "- `environments/<environment>`: the kustomization of each environment: staging prod\n")
+	assert.Equal(t, "apiVersion: kustomize.config.k8s.io/v1beta1\nkind: Kustomization\nresources:\n- components/frontend/base\n", readFile("kustomization.yaml"))
+	assert.Contains(t, readFile("environments/prod/kustomization.yaml"), "# Reference components/frontend/overlays/prod instead of the base")
+	assert.Contains(t, readFile("environments/prod/kustomization.yaml"), "- ../../components/frontend/base\n")
+}
+
+func TestScaffoldTemplates(t *testing.T) {
+	tests := []struct {
+		name          string
+		options       ScaffoldOptions
+		existing      map[string]string
+		want          map[string]string
+		wantMissing   []string
+		wantErrString string
+	}{
+		{
+			name:    "Default templates without environments",
+			options: ScaffoldOptions{},
+			want: map[string]string{
+				"CODEOWNERS": "# Owners of the GitOps resources of frontend\n",
+			},
+			wantMissing: []string{"environments"},
+		},
+		{
+			name: "Overridden templates",
+			options: ScaffoldOptions{
+				Environments: []string{"dev"},
+				Templates: fstest.MapFS{
+					"README.md.tmpl":  {Data: []byte("# {{.Component}} of {{.Application}}\n")},
+					"CODEOWNERS.tmpl": {Data: []byte("{{/* No CODEOWNERS */}}\n")},
+					"environments/__environment__/namespace.yaml.tmpl": {Data: []byte("apiVersion: v1\nkind: Namespace\nmetadata:\n  name: {{.Application}}-{{.Environment}}\n")},
+					"docs/CONTRIBUTING.md":                             {Data: []byte("Do not edit {{.Component}}\n")},
+				},
+			},
+			want: map[string]string{
+				"README.md":                           "# frontend of \n",
+				"environments/dev/namespace.yaml":     "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: -dev\n",
+				"environments/dev/kustomization.yaml": "# Reference components/frontend/overlays/dev instead of the base once the overlays of the\n# dev environment are generated\napiVersion: kustomize.config.k8s.io/v1beta1\nkind: Kustomization\nresources:\n- ../../components/frontend/base\n",
+				"docs/CONTRIBUTING.md":                "Do not edit {{.Component}}\n",
+			},
+			wantMissing: []string{"CODEOWNERS"},
+		},
+		{
+			name:     "Existing files are not overwritten",
+			existing: map[string]string{"README.md": "# Frontend\n"},
+			want:     map[string]string{"README.md": "# Frontend\n"},
+		},
+		{
+			name:          "Invalid template",
+			options:       ScaffoldOptions{Templates: fstest.MapFS{"README.md.tmpl": {Data: []byte("{{.Team}}")}}},
+			wantErrString: "failed to render the scaffolding template \"README.md.tmpl\".*can't evaluate field Team",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := ioutils.NewMemoryFilesystem()
+			for path, content := range tt.existing {
+				testutils.AssertNoError(t, writeFile(fs, "/repo/"+path, []byte(content), 0644))
+			}
+			err := tt.options.write(fs, "/repo", ScaffoldData{Component: "frontend"})
+			if tt.wantErrString != "" {
+				testutils.AssertErrorMatch(t, tt.wantErrString, err)
+				return
+			}
+			testutils.AssertNoError(t, err)
+			for path, want := range tt.want {
+				content, err := fs.ReadFile("/repo/" + path)
+				testutils.AssertNoError(t, err)
+				assert.Equal(t, want, string(content), path)
+			}
+			for _, path := range tt.wantMissing {
+				exists, err := fs.Exists("/repo/" + path)
+				testutils.AssertNoError(t, err)
+				assert.False(t, exists, "%s should not be written", path)
+			}
+		})
+	}
+}
+
+func TestGenerateAndPushScaffoldValidation(t *testing.T) {
+	generator := NewGitopsGen(WithRepositoryOptions(RepositoryOptions{Scaffold: &ScaffoldOptions{Environments: []string{"../prod"}}}))
+	options := gitopsv1alpha1.GeneratorOptions{}
+	options.Name = "frontend"
+	err := generator.GenerateAndPush("/output", "https://github.com/testing/testing.git", options, ioutils.NewMemoryFilesystem(), "main", false, "KAM CLI")
+	testutils.AssertErrorMatch(t, "invalid environment name \"../prod\"", err)
+}
@@ -0,0 +1,129 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/jenkins-x/go-scm/scm/factory"
+	"github.com/redhat-developer/gitops-generator/pkg/util"
+)
+
+// ScmClientFactory returns the go-scm client used to call the API of the Git host serving the remote.
+// The remote is of the form https://$token@<domain>/<org>/<repo>, where $token is optional.
+type ScmClientFactory func(remote string) (*scm.Client, error)
+
+// WithScmClientFactory sets the factory of the go-scm clients used to call the Git host APIs
+func WithScmClientFactory(scmClientFactory ScmClientFactory) GenOption {
+	return func(g *Gen) {
+		g.ScmClientFactory = scmClientFactory
+	}
+}
+
+// WithHostRegistry sets the Git hosts the remotes are allowed to point to
+func WithHostRegistry(hosts *util.HostRegistry) GenOption {
+	return func(g *Gen) {
+		g.Hosts = hosts
+	}
+}
+
+// hostRegistry returns the Hosts of the Gen, falling back to the default registry for a zero value Gen
+func (s Gen) hostRegistry() *util.HostRegistry {
+	if s.Hosts == nil {
+		return util.DefaultHostRegistry()
+	}
+	return s.Hosts
+}
+
+// validateRemote validates the remote points to one of the Hosts of the Gen
+func (s Gen) validateRemote(remote string) error {
+	if s.Hosts == nil {
+		return util.ValidateRemote(remote)
+	}
+	return s.Hosts.ValidateRemote(remote)
+}
+
+// scmClient returns a go-scm client for the remote with the configured ScmClientFactory, falling back to a client
+// for the Hosts of the Gen. The latter authenticates with the password of the Credentials, if any.
+func (s Gen) scmClient(ctx context.Context, remote string) (*scm.Client, error) {
+	if s.ScmClientFactory != nil {
+		return s.ScmClientFactory(remote)
+	}
+	if s.Credentials != nil {
+		u, err := util.ParseRemote(remote)
+		if err != nil {
+			return nil, err
+		}
+		_, password, err := s.credentials(ctx, remote)
+		if err != nil {
+			return nil, &CredentialsError{remote: remote, err: err}
+		}
+		u.User = url.UserPassword("", password)
+		remote = u.String()
+	}
+	return newScmClient(s.hostRegistry(), remote)
+}
+
+// NewScmClient is the default ScmClientFactory. The driver is identified from the host of the remote, and the
+// token of the remote, if any, is used to authenticate. The user of an SSH remote is not a token, and is ignored.
+func NewScmClient(remote string) (*scm.Client, error) {
+	return newScmClient(util.DefaultHostRegistry(), remote)
+}
+
+// newScmClient returns a go-scm client for the remote. The driver and API URL of the host of the remote are taken from
+// the registry, and identified by go-scm from the hostname for the hosts that are not registered.
+func newScmClient(hosts *util.HostRegistry, remote string) (*scm.Client, error) {
+	u, err := util.ParseRemote(remote)
+	if err != nil {
+		return nil, err
+	}
+	token := ""
+	if u.Scheme != "ssh" {
+		token = u.User.Username()
+		if password, ok := u.User.Password(); ok {
+			token = password
+		}
+	}
+	if host, err := hosts.HostOf(remote); err == nil {
+		return factory.NewClient(host.Driver, host.API(), token)
+	}
+	host := u.Host
+	if u.Scheme == "ssh" {
+		host = u.Hostname()
+	}
+	u = &url.URL{Scheme: "https", Host: host, Path: u.Path}
+	if token != "" {
+		u.User = url.UserPassword("", token)
+	}
+	return factory.FromRepoURL(u.String())
+}
+
+// repoFullName returns the <org>/<repo> full name of the repository of the remote, as expected by go-scm
+func repoFullName(remote string) (string, error) {
+	u, err := util.ParseRemote(remote)
+	if err != nil {
+		return "", err
+	}
+	fullName := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	if !strings.Contains(fullName, "/") {
+		return "", fmt.Errorf("the repository path %q is not of the form <org>/<repo>", u.Path)
+	}
+	return fullName, nil
+}
@@ -0,0 +1,109 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/redhat-developer/gitops-generator/pkg/testutils"
+	"github.com/redhat-developer/gitops-generator/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewScmClient(t *testing.T) {
+	tests := []struct {
+		name          string
+		remote        string
+		wantDriver    scm.Driver
+		wantFullName  string
+		wantErrString string
+	}{
+		{
+			name:         "GitHub remote with a token",
+			remote:       "https://token@github.com/org/repo.git",
+			wantDriver:   scm.DriverGithub,
+			wantFullName: "org/repo",
+		},
+		{
+			name:         "GitLab remote in a subgroup",
+			remote:       "https://gitlab.com/org/group/repo",
+			wantDriver:   scm.DriverGitlab,
+			wantFullName: "org/group/repo",
+		},
+		{
+			name:         "SSH remote",
+			remote:       "git@github.com:org/repo.git",
+			wantDriver:   scm.DriverGithub,
+			wantFullName: "org/repo",
+		},
+		{
+			name:         "SSH remote with ssh scheme",
+			remote:       "ssh://git@gitlab.com/org/repo.git",
+			wantDriver:   scm.DriverGitlab,
+			wantFullName: "org/repo",
+		},
+		{
+			name:          "Remote without a repository",
+			remote:        "https://github.com/repo",
+			wantDriver:    scm.DriverGithub,
+			wantErrString: "the repository path \"/repo\" is not of the form <org>/<repo>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := (Gen{}).scmClient(context.Background(), tt.remote)
+			testutils.AssertNoError(t, err)
+			assert.Equal(t, tt.wantDriver, client.Driver)
+
+			fullName, err := repoFullName(tt.remote)
+			if tt.wantErrString != "" {
+				testutils.AssertErrorMatch(t, tt.wantErrString, err)
+			} else {
+				testutils.AssertNoError(t, err)
+			}
+			assert.Equal(t, tt.wantFullName, fullName)
+		})
+	}
+}
+
+func TestHostRegistryScmClient(t *testing.T) {
+	hosts := util.NewHostRegistry(
+		util.Host{Hostname: "github.example.com", Driver: "github"},
+		util.Host{Hostname: "git.example.com", Driver: "gitlab", APIURL: "https://gitlab-api.example.com"},
+	)
+	generator := NewGitopsGen(WithHostRegistry(hosts))
+
+	client, err := generator.scmClient(context.Background(), "https://token@github.example.com/org/repo.git")
+	testutils.AssertNoError(t, err)
+	assert.Equal(t, scm.DriverGithub, client.Driver)
+	assert.Equal(t, "https://github.example.com/api/v3/", client.BaseURL.String())
+
+	client, err = generator.scmClient(context.Background(), "git@git.example.com:org/repo.git")
+	testutils.AssertNoError(t, err)
+	assert.Equal(t, scm.DriverGitlab, client.Driver)
+	assert.Equal(t, "https://gitlab-api.example.com/", client.BaseURL.String())
+
+	testutils.AssertNoError(t, generator.validateRemote("https://github.example.com/org/repo.git"))
+	err = generator.validateRemote("https://github.com/org/repo.git")
+	testutils.AssertErrorMatch(t, "supported git.example.com or github.example.com hosts", err)
+
+	err = generator.CommitAndPush("/fake/path", "", "https://github.com/org/repo.git", "test-component", "main", "Update")
+	testutils.AssertErrorMatch(t, "remote URL is invalid", err)
+	testutils.AssertNoError(t, (Gen{}).validateRemote("https://github.com/org/repo.git"))
+}
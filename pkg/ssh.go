@@ -0,0 +1,157 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/spf13/afero"
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHAuth holds the credentials used to access the SSH remotes, e.g. a deploy key of the GitOps repository.
+// The credentials are written to a temporary folder for the duration of each git command, and are only readable by the
+// current user. They are passed to git through its core.sshCommand option, and directly to a GoGitExecutor.
+type SSHAuth struct {
+	// PrivateKey is the PEM encoded private key, e.g. the content of the id_ed25519 file generated by ssh-keygen
+	PrivateKey []byte
+	// Passphrase decrypts the private key, if it is encrypted
+	Passphrase []byte
+	// KnownHosts holds the known_hosts entries the host keys of the remotes are checked against. The known_hosts files
+	// of the environment are used when not set.
+	KnownHosts []byte
+}
+
+// WithSSHAuth sets the credentials used to access the SSH remotes
+func WithSSHAuth(sshAuth SSHAuth) GenOption {
+	return func(g *Gen) {
+		g.SSHAuth = &sshAuth
+	}
+}
+
+// writeSSHCommand writes the credentials to the folder, and returns the ssh command using them
+func (a SSHAuth) writeSSHCommand(fs afero.Afero, dir string) (string, error) {
+	privateKey, err := a.decryptedPrivateKey()
+	if err != nil {
+		return "", err
+	}
+	keyPath := filepath.Join(dir, "id")
+	if err := fs.WriteFile(keyPath, privateKey, 0600); err != nil {
+		return "", fmt.Errorf("failed to write the SSH private key: %w", err)
+	}
+	// BatchMode makes ssh fail rather than prompt for anything
+	sshCommand := []string{"ssh", "-i", keyPath, "-o", "IdentitiesOnly=yes", "-o", "BatchMode=yes"}
+	if len(a.KnownHosts) > 0 {
+		knownHostsPath := filepath.Join(dir, "known_hosts")
+		if err := fs.WriteFile(knownHostsPath, a.KnownHosts, 0600); err != nil {
+			return "", fmt.Errorf("failed to write the SSH known hosts: %w", err)
+		}
+		sshCommand = append(sshCommand, "-o", "UserKnownHostsFile="+knownHostsPath, "-o", "StrictHostKeyChecking=yes")
+	}
+	return strings.Join(sshCommand, " "), nil
+}
+
+// publicKeys returns the go-git authentication to the SSH remote, checking the host keys against the KnownHosts if set
+func (a SSHAuth) publicKeys(remote string) (*gitssh.PublicKeys, error) {
+	privateKey, err := a.decryptedPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	user := "git"
+	if endpoint, err := transport.NewEndpoint(remote); err == nil && endpoint.User != "" {
+		user = endpoint.User
+	}
+	auth, err := gitssh.NewPublicKeys(user, privateKey, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the SSH private key: %w", err)
+	}
+	if len(a.KnownHosts) > 0 {
+		if auth.HostKeyCallback, err = knownHostsCallback(a.KnownHosts); err != nil {
+			return nil, fmt.Errorf("failed to read the SSH known hosts: %w", err)
+		}
+	}
+	return auth, nil
+}
+
+// decryptedPrivateKey returns the private key, decrypted with the passphrase if any, as ssh cannot prompt for it
+func (a SSHAuth) decryptedPrivateKey() ([]byte, error) {
+	if len(a.Passphrase) == 0 {
+		if _, err := ssh.ParseRawPrivateKey(a.PrivateKey); err != nil {
+			return nil, fmt.Errorf("failed to read the SSH private key: %w", err)
+		}
+		return a.PrivateKey, nil
+	}
+	key, err := ssh.ParseRawPrivateKeyWithPassphrase(a.PrivateKey, a.Passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt the SSH private key: %w", err)
+	}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}), nil
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+	case *ed25519.PrivateKey:
+		return marshalOpenSSHEd25519(*k), nil
+	case ed25519.PrivateKey:
+		return marshalOpenSSHEd25519(k), nil
+	}
+	return nil, errors.New("unsupported SSH private key type")
+}
+
+// marshalOpenSSHEd25519 encodes the ed25519 key in the unencrypted OpenSSH format, the only one ssh supports for
+// ed25519 keys
+func marshalOpenSSHEd25519(key ed25519.PrivateKey) []byte {
+	publicKey := key.Public().(ed25519.PublicKey)
+	publicKeyBlob := ssh.Marshal(struct {
+		KeyType   string
+		PublicKey []byte
+	}{ssh.KeyAlgoED25519, publicKey})
+	privateBlock := ssh.Marshal(struct {
+		Check1     uint32
+		Check2     uint32
+		KeyType    string
+		PublicKey  []byte
+		PrivateKey []byte
+		Comment    string
+	}{0, 0, ssh.KeyAlgoED25519, publicKey, key, ""})
+	// The private block is padded to the cipher block size, 8 when unencrypted
+	for i := byte(1); len(privateBlock)%8 != 0; i++ {
+		privateBlock = append(privateBlock, i)
+	}
+	data := append([]byte("openssh-key-v1\x00"), ssh.Marshal(struct {
+		CipherName   string
+		KdfName      string
+		KdfOptions   string
+		NumKeys      uint32
+		PublicKey    []byte
+		PrivateBlock []byte
+	}{"none", "none", "", 1, publicKeyBlob, privateBlock})...)
+	return pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: data})
+}
@@ -0,0 +1,362 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutils
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/server"
+)
+
+// GitServer is an in-process Git smart HTTP server, serving the bare repositories of a temporary folder. The clones,
+// pulls and pushes of the tests go through HTTP without any Git host, and can be checked against the repositories.
+// The server speaks the version 0 of the protocol, which the git and go-git clients fall back to.
+type GitServer struct {
+	*httptest.Server
+	// Token is required from the clients as the username or the password of the basic authentication, when set
+	Token string
+
+	root   string
+	loader server.Loader
+	// mu serializes the pushes, and guards the rejections
+	mu         sync.Mutex
+	rejections map[string]*pushRejection
+	pushes     map[string]int
+}
+
+// pushRejection rejects the next pushes to a repository
+type pushRejection struct {
+	reason string
+	// remaining is the number of pushes left to reject, all the pushes being rejected when negative
+	remaining int
+}
+
+// NewGitServer starts a GitServer without any repository, which is closed at the end of the test
+func NewGitServer(t *testing.T) *GitServer {
+	root := t.TempDir()
+	s := &GitServer{
+		root:       root,
+		loader:     server.NewFilesystemLoader(osfs.New(root)),
+		rejections: map[string]*pushRejection{},
+		pushes:     map[string]int{},
+	}
+	s.Server = httptest.NewServer(s)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Host returns the host and port of the server, as expected by the host registries
+func (s *GitServer) Host() string {
+	u, _ := url.Parse(s.URL)
+	return u.Host
+}
+
+// Remote returns the remote of the repository with the given <org>/<repo> full name, of the form
+// http://$token@<host>/<org>/<repo>.git, where $token is omitted when the server has no Token
+func (s *GitServer) Remote(fullName string) string {
+	u, _ := url.Parse(s.URL)
+	if s.Token != "" {
+		u.User = url.User(s.Token)
+	}
+	u.Path = "/" + fullName + ".git"
+	return u.String()
+}
+
+// CreateRepository creates an empty bare repository with the given <org>/<repo> full name, whose HEAD points to the
+// default branch
+func (s *GitServer) CreateRepository(fullName string, defaultBranch string) error {
+	if s.HasRepository(fullName) {
+		return fmt.Errorf("the repository %s already exists", fullName)
+	}
+	r, err := git.PlainInit(s.path(fullName), true)
+	if err != nil {
+		return err
+	}
+	return r.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.NewBranchReferenceName(defaultBranch)))
+}
+
+// CopyRepository creates the repository with the given full name, holding the branches and commits of the source
+// repository
+func (s *GitServer) CopyRepository(source string, fullName string) error {
+	if !s.HasRepository(source) {
+		return fmt.Errorf("the repository %s does not exist", source)
+	}
+	if s.HasRepository(fullName) {
+		return fmt.Errorf("the repository %s already exists", fullName)
+	}
+	sourcePath, targetPath := s.path(source), s.path(fullName)
+	return filepath.Walk(sourcePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(targetPath, strings.TrimPrefix(path, sourcePath))
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, content, info.Mode())
+	})
+}
+
+// HasRepository returns true if the repository with the given full name exists
+func (s *GitServer) HasRepository(fullName string) bool {
+	_, err := os.Stat(filepath.Join(s.path(fullName), "config"))
+	return err == nil
+}
+
+// Repository opens the bare repository with the given full name, e.g. to check the commits pushed to it
+func (s *GitServer) Repository(fullName string) (*git.Repository, error) {
+	return git.PlainOpen(s.path(fullName))
+}
+
+// SetDefaultBranch points the HEAD of the repository with the given full name to the branch
+func (s *GitServer) SetDefaultBranch(fullName string, branch string) error {
+	r, err := s.Repository(fullName)
+	if err != nil {
+		return err
+	}
+	return r.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.NewBranchReferenceName(branch)))
+}
+
+// RejectPushes rejects the next count pushes to the repository with the given full name, every push being rejected
+// when count is negative. The reason is reported for each of the pushed references, e.g. "fetch first" to simulate
+// a concurrent push, or "protected branch hook declined". A count of 0 accepts the pushes again.
+func (s *GitServer) RejectPushes(fullName string, reason string, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if count == 0 {
+		delete(s.rejections, fullName)
+		return
+	}
+	s.rejections[fullName] = &pushRejection{reason: reason, remaining: count}
+}
+
+// Pushes returns the number of pushes accepted by the repository with the given full name
+func (s *GitServer) Pushes(fullName string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pushes[fullName]
+}
+
+// path returns the folder of the bare repository with the given full name
+func (s *GitServer) path(fullName string) string {
+	return filepath.Join(s.root, filepath.FromSlash(fullName)+".git")
+}
+
+// authorized returns true if the request authenticates with the Token of the server, if any
+func (s *GitServer) authorized(r *http.Request) bool {
+	if s.Token == "" {
+		return true
+	}
+	username, password, ok := r.BasicAuth()
+	return ok && (username == s.Token || password == s.Token)
+}
+
+func (s *GitServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+		http.Error(w, "Authentication failed", http.StatusUnauthorized)
+		return
+	}
+	var repoPath, service string
+	switch {
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/info/refs"):
+		repoPath, service = strings.TrimSuffix(r.URL.Path, "/info/refs"), r.URL.Query().Get("service")
+	case r.Method == http.MethodPost:
+		repoPath, service = path.Dir(r.URL.Path), path.Base(r.URL.Path)
+	}
+	if service != transport.UploadPackServiceName && service != transport.ReceivePackServiceName {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	if !strings.HasSuffix(repoPath, ".git") {
+		repoPath += ".git"
+	}
+	fullName := strings.TrimSuffix(strings.TrimPrefix(repoPath, "/"), ".git")
+	ep := &transport.Endpoint{Protocol: "http", Path: repoPath}
+
+	body := r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gzipBody, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = gzipBody
+	}
+
+	var err error
+	switch {
+	case r.Method == http.MethodGet:
+		err = s.advertise(w, ep, service)
+	case service == transport.UploadPackServiceName:
+		err = s.uploadPack(w, r, ep, body)
+	default:
+		err = s.receivePack(w, r, ep, fullName, body)
+	}
+	if errors.Is(err, transport.ErrRepositoryNotFound) {
+		http.Error(w, "Repository not found", http.StatusNotFound)
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// advertise writes the references of the repository, for the service
+func (s *GitServer) advertise(w http.ResponseWriter, ep *transport.Endpoint, service string) error {
+	var ar *packp.AdvRefs
+	var err error
+	if service == transport.UploadPackServiceName {
+		var session transport.UploadPackSession
+		if session, err = server.NewServer(s.loader).NewUploadPackSession(ep, nil); err != nil {
+			return err
+		}
+		ar, err = session.AdvertisedReferences()
+	} else {
+		var session transport.ReceivePackSession
+		if session, err = server.NewServer(s.loader).NewReceivePackSession(ep, nil); err != nil {
+			return err
+		}
+		ar, err = session.AdvertisedReferences()
+	}
+	if err != nil {
+		return err
+	}
+	ar.Prefix = [][]byte{[]byte("# service=" + service), pktline.Flush}
+	w.Header().Set("Content-Type", "application/x-"+service+"-advertisement")
+	w.Header().Set("Cache-Control", "no-cache")
+	return ar.Encode(w)
+}
+
+// uploadPack sends the objects requested by a clone or a fetch
+func (s *GitServer) uploadPack(w http.ResponseWriter, r *http.Request, ep *transport.Endpoint, body io.Reader) error {
+	storer, err := s.loader.Load(ep)
+	if err != nil {
+		return err
+	}
+	session, err := server.NewServer(s.loader).NewUploadPackSession(ep, nil)
+	if err != nil {
+		return err
+	}
+	req := packp.NewUploadPackRequest()
+	if err := req.Decode(body); err != nil {
+		return err
+	}
+	// Unlike git, the go-git server fails on the commits the client has that the repository does not, which are sent
+	// when fetching into a repository with local commits
+	var haves []plumbing.Hash
+	for _, have := range req.Haves {
+		if storer.HasEncodedObject(have) == nil {
+			haves = append(haves, have)
+		}
+	}
+	req.Haves = haves
+
+	resp, err := session.UploadPack(r.Context(), req)
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+	w.Header().Set("Content-Type", "application/x-git-upload-pack-result")
+	return resp.Encode(w)
+}
+
+// receivePack updates the references of the repository with the pushed objects. Like git, the pushes made from stale
+// references are rejected.
+func (s *GitServer) receivePack(w http.ResponseWriter, r *http.Request, ep *transport.Endpoint, fullName string, body io.Reader) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	storer, err := s.loader.Load(ep)
+	if err != nil {
+		return err
+	}
+	session, err := server.NewServer(s.loader).NewReceivePackSession(ep, nil)
+	if err != nil {
+		return err
+	}
+	req := packp.NewReferenceUpdateRequest()
+	if err := req.Decode(body); err != nil {
+		return err
+	}
+
+	reason := ""
+	if rejection := s.rejections[fullName]; rejection != nil {
+		reason = rejection.reason
+		if rejection.remaining--; rejection.remaining == 0 {
+			delete(s.rejections, fullName)
+		}
+	}
+	for _, cmd := range req.Commands {
+		if reason != "" {
+			break
+		}
+		current := plumbing.ZeroHash
+		if ref, err := storer.Reference(cmd.Name); err == nil {
+			current = ref.Hash()
+		} else if !errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return err
+		}
+		if current != cmd.Old {
+			reason = fmt.Sprintf("cannot lock ref '%s': is at %s but expected %s", cmd.Name, current, cmd.Old)
+		}
+	}
+
+	var status *packp.ReportStatus
+	if reason != "" {
+		if req.Packfile != nil {
+			_, _ = io.Copy(io.Discard, req.Packfile)
+		}
+		status = packp.NewReportStatus()
+		status.UnpackStatus = "ok"
+		for _, cmd := range req.Commands {
+			status.CommandStatuses = append(status.CommandStatuses, &packp.CommandStatus{ReferenceName: cmd.Name, Status: reason})
+		}
+	} else {
+		status, err = session.ReceivePack(r.Context(), req)
+		if status == nil && err != nil {
+			return err
+		} else if err == nil {
+			s.pushes[fullName]++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/x-git-receive-pack-result")
+	if !req.Capabilities.Supports(capability.ReportStatus) {
+		return nil
+	}
+	return status.Encode(w)
+}
@@ -0,0 +1,437 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// ScmServer is a fake of the GitHub API, for the go-scm clients of the tests. The repositories it creates are served
+// by its GitServer, so that GenerateAndPush can create a repository and push to it. The users, repositories, topics,
+// webhooks and pull requests endpoints are supported, with or without the /api/v3 prefix of GitHub Enterprise.
+type ScmServer struct {
+	*httptest.Server
+	// Git serves the repositories. Its Token is required by the API, when set.
+	Git *GitServer
+	// Login is the authenticated user, who owns the repositories created outside an organization
+	Login string
+
+	mu       sync.Mutex
+	repos    map[string]*ScmRepository
+	requests []string
+	nextID   int
+}
+
+// ScmRepository holds the settings of a repository of the ScmServer
+type ScmRepository struct {
+	FullName      string
+	Description   string
+	Private       bool
+	Visibility    string
+	DefaultBranch string
+	Topics        []string
+	Hooks         []ScmHook
+	PullRequests  []ScmPullRequest
+}
+
+// ScmHook is a webhook of a repository of the ScmServer
+type ScmHook struct {
+	ID          int
+	URL         string
+	Secret      string
+	InsecureSSL bool
+	Events      []string
+}
+
+// ScmPullRequest is a pull request of a repository of the ScmServer
+type ScmPullRequest struct {
+	Number    int
+	Title     string
+	Body      string
+	Head      string
+	Base      string
+	Labels    []string
+	Reviewers []string
+	Closed    bool
+}
+
+// NewScmServer starts an ScmServer authenticating the login, whose repositories are served by a new GitServer. Both
+// are closed at the end of the test.
+func NewScmServer(t *testing.T, login string) *ScmServer {
+	s := &ScmServer{Git: NewGitServer(t), Login: login, repos: map[string]*ScmRepository{}}
+	s.Server = httptest.NewServer(s)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// CreateRepository creates the repository with the given <org>/<repo> full name, e.g. to test the adoption of an
+// existing repository
+func (s *ScmServer) CreateRepository(fullName string, defaultBranch string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.createRepository(fullName, "", defaultBranch)
+	return err
+}
+
+// Repository returns a copy of the settings of the repository with the given full name, false if it does not exist
+func (s *ScmServer) Repository(fullName string) (ScmRepository, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	repo, ok := s.repos[fullName]
+	if !ok {
+		return ScmRepository{}, false
+	}
+	copied := *repo
+	copied.Topics = append([]string(nil), repo.Topics...)
+	copied.Hooks = append([]ScmHook(nil), repo.Hooks...)
+	copied.PullRequests = append([]ScmPullRequest(nil), repo.PullRequests...)
+	return copied, true
+}
+
+// Requests returns the "<method> <path>" of the requests served so far, without the /api/v3 prefix
+func (s *ScmServer) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// createRepository creates the repository and its bare repository, copying the template repository when set
+func (s *ScmServer) createRepository(fullName string, template string, defaultBranch string) (*ScmRepository, error) {
+	if _, ok := s.repos[fullName]; ok {
+		return nil, fmt.Errorf("the repository %s already exists", fullName)
+	}
+	var err error
+	if template != "" {
+		err = s.Git.CopyRepository(template, fullName)
+	} else {
+		err = s.Git.CreateRepository(fullName, defaultBranch)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.nextID++
+	repo := &ScmRepository{FullName: fullName, DefaultBranch: defaultBranch, Visibility: "public"}
+	if template != "" {
+		repo.DefaultBranch = s.repos[template].DefaultBranch
+	}
+	s.repos[fullName] = repo
+	return repo, nil
+}
+
+// authorized returns true if the request authenticates with the Token of the GitServer, if any
+func (s *ScmServer) authorized(r *http.Request) bool {
+	if s.Git.Token == "" {
+		return true
+	}
+	fields := strings.Fields(r.Header.Get("Authorization"))
+	return len(fields) > 0 && fields[len(fields)-1] == s.Git.Token
+}
+
+var (
+	scmRepoPath        = regexp.MustCompile(`^/repos/([^/]+/[^/]+)(/.*)?$`)
+	scmOrgReposPath    = regexp.MustCompile(`^/orgs/([^/]+)/repos$`)
+	scmHookPath        = regexp.MustCompile(`^/hooks/(\d+)$`)
+	scmPullRequestPath = regexp.MustCompile(`^/(?:pulls|issues)/(\d+)(/.*)?$`)
+)
+
+func (s *ScmServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := strings.TrimPrefix(r.URL.Path, "/api/v3")
+	s.requests = append(s.requests, r.Method+" "+path)
+	if !s.authorized(r) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"message": "Bad credentials"})
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+
+	if r.Method == http.MethodGet && path == "/user" {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"id": 1, "login": s.Login})
+		return
+	}
+	if r.Method == http.MethodPost && path == "/user/repos" {
+		s.serveCreate(w, s.Login, "", body)
+		return
+	}
+	if match := scmOrgReposPath.FindStringSubmatch(path); match != nil && r.Method == http.MethodPost {
+		s.serveCreate(w, match[1], "", body)
+		return
+	}
+	match := scmRepoPath.FindStringSubmatch(path)
+	if match == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		return
+	}
+	repo, ok := s.repos[match[1]]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		return
+	}
+	s.serveRepository(w, r.Method, repo, match[2], body)
+}
+
+// serveCreate creates a repository in the namespace, from the template when set
+func (s *ScmServer) serveCreate(w http.ResponseWriter, namespace string, template string, body []byte) {
+	var input struct {
+		Owner       string `json:"owner"`
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Private     bool   `json:"private"`
+		Visibility  string `json:"visibility"`
+	}
+	if err := json.Unmarshal(body, &input); err != nil || input.Name == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": "Problems parsing JSON"})
+		return
+	}
+	if input.Owner != "" {
+		namespace = input.Owner
+	}
+	repo, err := s.createRepository(namespace+"/"+input.Name, template, "main")
+	if err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"message": "Repository creation failed.",
+			"errors":  []map[string]string{{"message": "name already exists on this account"}},
+		})
+		return
+	}
+	repo.Description, repo.Private = input.Description, input.Private
+	if input.Private {
+		repo.Visibility = "private"
+	}
+	if input.Visibility != "" {
+		repo.Visibility = input.Visibility
+	}
+	writeJSON(w, http.StatusCreated, s.repositoryJSON(repo))
+}
+
+// serveRepository serves the path of the repository, relative to /repos/<org>/<repo>
+func (s *ScmServer) serveRepository(w http.ResponseWriter, method string, repo *ScmRepository, path string, body []byte) {
+	switch {
+	case path == "" && method == http.MethodGet:
+		writeJSON(w, http.StatusOK, s.repositoryJSON(repo))
+	case path == "" && method == http.MethodPatch:
+		var input map[string]interface{}
+		_ = json.Unmarshal(body, &input)
+		if description, ok := input["description"].(string); ok {
+			repo.Description = description
+		}
+		if private, ok := input["private"].(bool); ok {
+			repo.Private = private
+		}
+		if visibility, ok := input["visibility"].(string); ok {
+			repo.Visibility = visibility
+		}
+		if branch, ok := input["default_branch"].(string); ok {
+			if err := s.Git.SetDefaultBranch(repo.FullName, branch); err != nil {
+				writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": err.Error()})
+				return
+			}
+			repo.DefaultBranch = branch
+		}
+		writeJSON(w, http.StatusOK, s.repositoryJSON(repo))
+	case path == "/generate" && method == http.MethodPost:
+		s.serveCreate(w, s.Login, repo.FullName, body)
+	case path == "/topics" && method == http.MethodPut:
+		var input struct {
+			Names []string `json:"names"`
+		}
+		_ = json.Unmarshal(body, &input)
+		repo.Topics = input.Names
+		writeJSON(w, http.StatusOK, map[string][]string{"names": repo.Topics})
+	case path == "/hooks" || scmHookPath.MatchString(path):
+		s.serveHooks(w, method, repo, path, body)
+	case path == "/pulls" || scmPullRequestPath.MatchString(path):
+		s.servePullRequests(w, method, repo, path, body)
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+	}
+}
+
+// serveHooks lists, creates and deletes the webhooks of the repository
+func (s *ScmServer) serveHooks(w http.ResponseWriter, method string, repo *ScmRepository, path string, body []byte) {
+	switch method {
+	case http.MethodGet:
+		hooks := []interface{}{}
+		for _, hook := range repo.Hooks {
+			hooks = append(hooks, hookJSON(hook))
+		}
+		writeJSON(w, http.StatusOK, hooks)
+	case http.MethodPost:
+		var input struct {
+			Events []string `json:"events"`
+			Config struct {
+				URL         string `json:"url"`
+				Secret      string `json:"secret"`
+				InsecureSSL string `json:"insecure_ssl"`
+			} `json:"config"`
+		}
+		_ = json.Unmarshal(body, &input)
+		s.nextID++
+		hook := ScmHook{ID: s.nextID, URL: input.Config.URL, Secret: input.Config.Secret, InsecureSSL: input.Config.InsecureSSL == "1", Events: input.Events}
+		repo.Hooks = append(repo.Hooks, hook)
+		writeJSON(w, http.StatusCreated, hookJSON(hook))
+	case http.MethodDelete:
+		id, _ := strconv.Atoi(scmHookPath.FindStringSubmatch(path)[1])
+		for i, hook := range repo.Hooks {
+			if hook.ID == id {
+				repo.Hooks = append(repo.Hooks[:i], repo.Hooks[i+1:]...)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+	}
+}
+
+// servePullRequests lists, creates and updates the pull requests of the repository, along with their labels and
+// reviewers
+func (s *ScmServer) servePullRequests(w http.ResponseWriter, method string, repo *ScmRepository, path string, body []byte) {
+	if path == "/pulls" {
+		switch method {
+		case http.MethodGet:
+			prs := []interface{}{}
+			for _, pr := range repo.PullRequests {
+				if !pr.Closed {
+					prs = append(prs, s.pullRequestJSON(repo, pr))
+				}
+			}
+			writeJSON(w, http.StatusOK, prs)
+		case http.MethodPost:
+			var pr ScmPullRequest
+			_ = json.Unmarshal(body, &pr)
+			for _, existing := range repo.PullRequests {
+				if existing.Head == pr.Head && existing.Base == pr.Base && !existing.Closed {
+					writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "A pull request already exists for " + pr.Head + "."})
+					return
+				}
+			}
+			pr.Number = len(repo.PullRequests) + 1
+			repo.PullRequests = append(repo.PullRequests, pr)
+			writeJSON(w, http.StatusCreated, s.pullRequestJSON(repo, pr))
+		}
+		return
+	}
+
+	match := scmPullRequestPath.FindStringSubmatch(path)
+	number, _ := strconv.Atoi(match[1])
+	if number < 1 || number > len(repo.PullRequests) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		return
+	}
+	pr := &repo.PullRequests[number-1]
+	switch {
+	case match[2] == "" && method == http.MethodPatch:
+		var input ScmPullRequest
+		_ = json.Unmarshal(body, &input)
+		if input.Title != "" {
+			pr.Title = input.Title
+		}
+		if input.Body != "" {
+			pr.Body = input.Body
+		}
+	case match[2] == "/labels" && method == http.MethodPost:
+		var labels []string
+		_ = json.Unmarshal(body, &labels)
+		pr.Labels = append(pr.Labels, labels...)
+	case match[2] == "/requested_reviewers" && method == http.MethodPost:
+		var input struct {
+			Reviewers []string `json:"reviewers"`
+		}
+		_ = json.Unmarshal(body, &input)
+		pr.Reviewers = append(pr.Reviewers, input.Reviewers...)
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.pullRequestJSON(repo, *pr))
+}
+
+// repositoryJSON returns the repository as returned by the GitHub API
+func (s *ScmServer) repositoryJSON(repo *ScmRepository) map[string]interface{} {
+	owner, name, _ := strings.Cut(repo.FullName, "/")
+	return map[string]interface{}{
+		"id":             1,
+		"owner":          map[string]string{"login": owner},
+		"name":           name,
+		"full_name":      repo.FullName,
+		"description":    repo.Description,
+		"private":        repo.Private,
+		"visibility":     repo.Visibility,
+		"default_branch": repo.DefaultBranch,
+		"clone_url":      s.Git.Remote(repo.FullName),
+		"html_url":       s.URL + "/" + repo.FullName,
+		"topics":         repo.Topics,
+		"permissions":    map[string]bool{"admin": true, "push": true, "pull": true},
+	}
+}
+
+// hookJSON returns the webhook as returned by the GitHub API
+func hookJSON(hook ScmHook) map[string]interface{} {
+	insecureSSL := "0"
+	if hook.InsecureSSL {
+		insecureSSL = "1"
+	}
+	return map[string]interface{}{
+		"id":     hook.ID,
+		"name":   "web",
+		"active": true,
+		"events": hook.Events,
+		"config": map[string]string{"url": hook.URL, "secret": hook.Secret, "content_type": "json", "insecure_ssl": insecureSSL},
+	}
+}
+
+// pullRequestJSON returns the pull request as returned by the GitHub API
+func (s *ScmServer) pullRequestJSON(repo *ScmRepository, pr ScmPullRequest) map[string]interface{} {
+	state := "open"
+	if pr.Closed {
+		state = "closed"
+	}
+	labels := []map[string]string{}
+	for _, label := range pr.Labels {
+		labels = append(labels, map[string]string{"name": label})
+	}
+	reviewers := []map[string]string{}
+	for _, reviewer := range pr.Reviewers {
+		reviewers = append(reviewers, map[string]string{"login": reviewer})
+	}
+	return map[string]interface{}{
+		"number":              pr.Number,
+		"state":               state,
+		"title":               pr.Title,
+		"body":                pr.Body,
+		"labels":              labels,
+		"requested_reviewers": reviewers,
+		"html_url":            fmt.Sprintf("%s/%s/pull/%d", s.URL, repo.FullName, pr.Number),
+		"head":                map[string]string{"ref": pr.Head},
+		"base":                map[string]string{"ref": pr.Base},
+	}
+}
+
+// writeJSON writes the value as the JSON body of the response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
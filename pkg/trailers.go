@@ -0,0 +1,152 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"regexp"
+	"runtime/debug"
+	"strings"
+)
+
+// The keys of the trailers appended to the commits made by the generator
+const (
+	ComponentTrailer        = "Component"
+	ApplicationTrailer      = "Application"
+	EnvironmentTrailer      = "Environment"
+	ImageTrailer            = "Image"
+	GeneratorVersionTrailer = "Generator-Version"
+	CreatedByTrailer        = "Created-By"
+)
+
+const generatorModule = "github.com/redhat-developer/gitops-generator"
+
+// defaultCreatedBy is the Created-By trailer of the commits when none is configured
+const defaultCreatedBy = "application-service"
+
+// GeneratorVersion is the version of the generator set in the Generator-Version trailer. It defaults to the version of
+// the gitops-generator module the binary was built with, and to "(devel)" when unknown.
+var GeneratorVersion = moduleVersion()
+
+// trailerPattern matches a "Key: value" git trailer
+var trailerPattern = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9-]*): ?(.*)$`)
+
+// CommitTrailers describes a change made by the generator in a commit, as git trailers appended to the commit
+// message. A commit changing several components, e.g. made by a Batch, holds the trailers of each change, each
+// starting with its Component trailer and followed by the Generator-Version and Created-By trailers of the commit:
+//
+//	Component: frontend
+//	Application: shop
+//	Environment: staging
+//	Image: quay.io/org/frontend:v2
+//	Generator-Version: v0.1.0
+//	Created-By: application-service
+type CommitTrailers struct {
+	Component        string
+	Application      string
+	Environment      string
+	Image            string
+	GeneratorVersion string
+	CreatedBy        string
+}
+
+// ParseCommitTrailers returns the changes described by the trailers of the commit message, which are read from its
+// last paragraph like git interpret-trailers does. nil is returned when the message has no trailers.
+func ParseCommitTrailers(message string) []CommitTrailers {
+	paragraphs := strings.Split(strings.TrimSpace(strings.ReplaceAll(message, "\r\n", "\n")), "\n\n")
+	if len(paragraphs) < 2 {
+		// The subject is not a trailer
+		return nil
+	}
+	var changes []CommitTrailers
+	var generatorVersion, createdBy string
+	current := func() *CommitTrailers {
+		if len(changes) == 0 {
+			changes = append(changes, CommitTrailers{})
+		}
+		return &changes[len(changes)-1]
+	}
+	for _, line := range strings.Split(strings.TrimSpace(paragraphs[len(paragraphs)-1]), "\n") {
+		match := trailerPattern.FindStringSubmatch(line)
+		if match == nil {
+			// Like git, the last paragraph only holds trailers if all its lines are trailers
+			return nil
+		}
+		value := strings.TrimSpace(match[2])
+		switch match[1] {
+		case ComponentTrailer:
+			changes = append(changes, CommitTrailers{Component: value})
+		case ApplicationTrailer:
+			current().Application = value
+		case EnvironmentTrailer:
+			current().Environment = value
+		case ImageTrailer:
+			current().Image = value
+		case GeneratorVersionTrailer:
+			generatorVersion = value
+		case CreatedByTrailer:
+			createdBy = value
+		}
+	}
+	if len(changes) == 0 {
+		if generatorVersion == "" && createdBy == "" {
+			return nil
+		}
+		changes = append(changes, CommitTrailers{})
+	}
+	for i := range changes {
+		changes[i].GeneratorVersion = generatorVersion
+		changes[i].CreatedBy = createdBy
+	}
+	return changes
+}
+
+// withTrailers appends the trailers of the changes to the commit message, along with the Generator-Version and
+// Created-By trailers. The empty trailers are omitted.
+func withTrailers(commitMessage string, changes []CommitTrailers, createdBy string) string {
+	var trailers strings.Builder
+	add := func(key string, value string) {
+		if value != "" {
+			// A trailer is a single line
+			trailers.WriteString(key + ": " + strings.Join(strings.Fields(value), " ") + "\n")
+		}
+	}
+	for _, change := range changes {
+		add(ComponentTrailer, change.Component)
+		add(ApplicationTrailer, change.Application)
+		add(EnvironmentTrailer, change.Environment)
+		add(ImageTrailer, change.Image)
+	}
+	add(GeneratorVersionTrailer, GeneratorVersion)
+	add(CreatedByTrailer, createdBy)
+	return strings.TrimRight(commitMessage, "\n") + "\n\n" + trailers.String()
+}
+
+// moduleVersion returns the version of the gitops-generator module in the build information of the binary
+func moduleVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(devel)"
+	}
+	if info.Main.Path == generatorModule && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == generatorModule && dep.Version != "" {
+			return dep.Version
+		}
+	}
+	return "(devel)"
+}
@@ -0,0 +1,136 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"sync"
+	"testing"
+
+	gitopsv1alpha1 "github.com/redhat-developer/gitops-generator/api/v1alpha1"
+	"github.com/redhat-developer/gitops-generator/pkg/testutils"
+	"github.com/redhat-developer/gitops-generator/pkg/util/ioutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithTrailers(t *testing.T) {
+	generatorVersion := GeneratorVersion
+	GeneratorVersion = "v0.1.0"
+	defer func() { GeneratorVersion = generatorVersion }()
+
+	message := withTrailers("Generate staging environment overlays for component frontend\n", []CommitTrailers{
+		{Component: "frontend", Application: "shop", Environment: "staging", Image: "quay.io/org/frontend:v2"},
+		{Component: "backend"},
+	}, "KAM CLI")
+	assert.Equal(t, "Generate staging environment overlays for component frontend\n\n"+
+		"Component: frontend\n"+
+		"Application: shop\n"+
+		"Environment: staging\n"+
+		"Image: quay.io/org/frontend:v2\n"+
+		"Component: backend\n"+
+		"Generator-Version: v0.1.0\n"+
+		"Created-By: KAM CLI\n", message)
+	assert.Equal(t, []CommitTrailers{
+		{Component: "frontend", Application: "shop", Environment: "staging", Image: "quay.io/org/frontend:v2", GeneratorVersion: "v0.1.0", CreatedBy: "KAM CLI"},
+		{Component: "backend", GeneratorVersion: "v0.1.0", CreatedBy: "KAM CLI"},
+	}, ParseCommitTrailers(message))
+}
+
+func TestParseCommitTrailers(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    []CommitTrailers
+	}{
+		{
+			name:    "Single change",
+			message: "Removed component backend\n\nComponent: backend\nGenerator-Version: v0.1.0\nCreated-By: application-service\n",
+			want:    []CommitTrailers{{Component: "backend", GeneratorVersion: "v0.1.0", CreatedBy: "application-service"}},
+		},
+		{
+			name:    "Trailers after the body",
+			message: "Apply 2 changes to the GitOps resources\n\n- Removed component a\n- Removed component b\n\nComponent: a\nComponent: b\nCreated-By: application-service",
+			want:    []CommitTrailers{{Component: "a", CreatedBy: "application-service"}, {Component: "b", CreatedBy: "application-service"}},
+		},
+		{
+			name:    "Unknown trailers are ignored",
+			message: "Update\n\nComponent: a\nSigned-off-by: Test User <test@test.org>\n",
+			want:    []CommitTrailers{{Component: "a"}},
+		},
+		{
+			name:    "Last paragraph not made of trailers",
+			message: "Update\n\nComponent: a\nThis is not a trailer\n",
+		},
+		{
+			name:    "Subject only",
+			message: "Component: a",
+		},
+		{
+			name:    "No trailers",
+			message: "Update README.md\n\nThe documentation of the generator.\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ParseCommitTrailers(tt.message))
+		})
+	}
+}
+
+func TestCreatedByTrailer(t *testing.T) {
+	executedCmds := []testutils.Execution{}
+	outputs := testutils.NewOutputs(nil, nil, nil, []byte("components/test-component/base/deployment.yaml"), nil)
+	generator := NewGitopsGen(WithExecutor(newTestExecutor(outputs, testutils.NewErrors(), &executedCmds)), WithFilesystem(ioutils.NewMemoryFilesystem()))
+	options := gitopsv1alpha1.GeneratorOptions{Name: "test-component", ContainerImage: "image"}
+
+	// The createdBy argument of GenerateAndPush does not leak into the commits of the other calls
+	testutils.AssertNoError(t, generator.GenerateAndPush("/fake/path", "https://github.com/testing/testing.git", options, generator.Fs, "main", false, "KAM CLI"))
+	testutils.AssertNoError(t, generator.CommitAndPush("/fake/path", "", "https://github.com/testing/testing.git", "test-component", "main", "Update"))
+	commit := executedCmds[len(executedCmds)-2].Args
+	assert.Equal(t, "commit", commit[0])
+	assert.Contains(t, commit[2], "\nCreated-By: application-service\n")
+}
+
+func TestCreatedByLabel(t *testing.T) {
+	fs := ioutils.NewMemoryFilesystem()
+	generator := NewGitopsGen(WithExecutor(newTestExecutor(testutils.NewOutputs(), testutils.NewErrors(), &[]testutils.Execution{})), WithFilesystem(fs))
+	options := gitopsv1alpha1.GeneratorOptions{Name: "test-component", ContainerImage: "image"}
+
+	// The concurrent calls label the resources with their own createdBy argument, without changing CreatedBy
+	tests := []struct {
+		repo      string
+		createdBy string
+		want      string
+	}{
+		{repo: "kam", createdBy: "KAM CLI", want: "KAM CLI"},
+		{repo: "default", createdBy: "", want: "application-service"},
+		{repo: "console", createdBy: "application-console", want: "application-console"},
+	}
+	var wg sync.WaitGroup
+	for _, tt := range tests {
+		wg.Add(1)
+		go func(repo string, createdBy string) {
+			defer wg.Done()
+			assert.NoError(t, generator.GenerateAndPush("/"+repo, "https://github.com/testing/"+repo+".git", options, fs, "main", false, createdBy))
+		}(tt.repo, tt.createdBy)
+	}
+	wg.Wait()
+	for _, tt := range tests {
+		deployment, err := fs.ReadFile("/" + tt.repo + "/components/test-component/base/deployment.yaml")
+		testutils.AssertNoError(t, err)
+		assert.Contains(t, string(deployment), "app.kubernetes.io/created-by: "+tt.want+"\n", tt.repo)
+	}
+	assert.Equal(t, "application-service", CreatedBy)
+}
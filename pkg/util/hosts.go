@@ -0,0 +1,147 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Host is a Git host the remotes are allowed to point to, e.g. a GitHub Enterprise or self-managed GitLab instance
+type Host struct {
+	// Hostname of the remotes, e.g. github.example.com. HTTP(S) remotes on a non default port need it to include the
+	// port, e.g. gitea.example.com:3000, while the port of SSH remotes is ignored.
+	Hostname string
+	// Driver is the go-scm driver of the API of the host, e.g. github, gitlab, gitea or bitbucketcloud
+	Driver string
+	// APIURL is the base URL of the API of the host. Defaults to https://<Hostname>, go-scm appending the API path of
+	// the driver, e.g. /api/v3 for GitHub Enterprise.
+	APIURL string
+	// Schemes the remotes are allowed to use, e.g. https and ssh. Defaults to https and ssh.
+	Schemes []string
+}
+
+// defaultSchemes are the schemes allowed for the hosts that do not set any
+var defaultSchemes = []string{"https", "ssh"}
+
+// allowsScheme returns true if the remotes of the host are allowed to use the scheme
+func (h Host) allowsScheme(scheme string) bool {
+	schemes := h.Schemes
+	if len(schemes) == 0 {
+		schemes = defaultSchemes
+	}
+	for _, s := range schemes {
+		if s == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+// API returns the base URL of the API of the host
+func (h Host) API() string {
+	if h.APIURL != "" {
+		return h.APIURL
+	}
+	return "https://" + h.Hostname
+}
+
+// HostRegistry holds the Git hosts the remotes are allowed to point to. It is safe for concurrent use.
+type HostRegistry struct {
+	mu    sync.RWMutex
+	hosts map[string]Host
+}
+
+// NewHostRegistry returns a registry of the hosts
+func NewHostRegistry(hosts ...Host) *HostRegistry {
+	r := &HostRegistry{hosts: map[string]Host{}}
+	for _, host := range hosts {
+		r.Register(host)
+	}
+	return r
+}
+
+// DefaultHostRegistry returns a registry of the github.com and gitlab.com hosts, accessed over HTTPS or SSH
+func DefaultHostRegistry() *HostRegistry {
+	return NewHostRegistry(Host{Hostname: "github.com", Driver: "github"}, Host{Hostname: "gitlab.com", Driver: "gitlab"})
+}
+
+// Register adds the host to the registry, replacing the host with the same Hostname if any
+func (r *HostRegistry) Register(host Host) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hosts[host.Hostname] = host
+}
+
+// HostOf returns the host the remote points to. An error is returned if the remote is invalid, or points to a host
+// that is not registered or does not allow its scheme. SSH remotes can use the scp-like syntax, e.g.
+// git@github.example.com:org/repo.git
+func (r *HostRegistry) HostOf(remote string) (Host, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	remoteURL, err := ParseRemote(remote)
+	if err != nil {
+		return Host{}, r.invalidRemoteErr()
+	}
+	for _, host := range r.hosts {
+		hostname, remoteHostname := host.Hostname, remoteURL.Host
+		if remoteURL.Scheme == "ssh" {
+			// The SSH port of the remote is unrelated to the port of the HTTP(S) remotes, if any
+			remoteHostname = remoteURL.Hostname()
+			if h, _, err := net.SplitHostPort(hostname); err == nil {
+				hostname = h
+			}
+		}
+		if remoteHostname == hostname && host.allowsScheme(remoteURL.Scheme) {
+			return host, nil
+		}
+	}
+	return Host{}, r.invalidRemoteErr()
+}
+
+// ValidateRemote validates the remote points to a registered host with one of its allowed schemes
+func (r *HostRegistry) ValidateRemote(remote string) error {
+	_, err := r.HostOf(remote)
+	return err
+}
+
+// invalidRemoteErr returns the error listing the schemes and hosts of the registry. The read lock of the registry must
+// be held, as a recursive read lock deadlocks when Register is waiting for the write lock.
+func (r *HostRegistry) invalidRemoteErr() error {
+	var hostnames []string
+	schemes := map[string]bool{}
+	for hostname, host := range r.hosts {
+		hostnames = append(hostnames, hostname)
+		for _, scheme := range defaultSchemes {
+			schemes[scheme] = schemes[scheme] || host.allowsScheme(scheme)
+		}
+		for _, scheme := range host.Schemes {
+			schemes[scheme] = true
+		}
+	}
+	var allowedSchemes []string
+	for scheme, allowed := range schemes {
+		if allowed {
+			allowedSchemes = append(allowedSchemes, scheme)
+		}
+	}
+	sort.Strings(hostnames)
+	sort.Strings(allowedSchemes)
+	return fmt.Errorf("remote URL is invalid or missing the %s scheme and/or supported %s hosts", strings.Join(allowedSchemes, " or "), strings.Join(hostnames, " or "))
+}
@@ -0,0 +1,118 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostRegistry(t *testing.T) {
+	ghe := Host{Hostname: "github.example.com", Driver: "github"}
+	gitea := Host{Hostname: "gitea.example.com:3000", Driver: "gitea", Schemes: []string{"http"}}
+	gitlab := Host{Hostname: "gitlab.example.com", Driver: "gitlab", APIURL: "https://api.gitlab.example.com"}
+	registry := NewHostRegistry(ghe, gitea, gitlab)
+	invalidRemoteErr := "remote URL is invalid or missing the http or https or ssh scheme and/or supported gitea.example.com:3000 or github.example.com or gitlab.example.com hosts"
+
+	tests := []struct {
+		name     string
+		remote   string
+		wantHost Host
+	}{
+		{
+			name:     "GitHub Enterprise remote",
+			remote:   "https://token@github.example.com/org/repo.git",
+			wantHost: ghe,
+		},
+		{
+			name:     "GitHub Enterprise SSH remote",
+			remote:   "git@github.example.com:org/repo.git",
+			wantHost: ghe,
+		},
+		{
+			name:     "Remote with a port",
+			remote:   "http://gitea.example.com:3000/org/repo.git",
+			wantHost: gitea,
+		},
+		{
+			name:   "Remote without the port of the host",
+			remote: "http://gitea.example.com/org/repo.git",
+		},
+		{
+			name:   "Remote with a scheme the host does not allow",
+			remote: "https://gitea.example.com:3000/org/repo.git",
+		},
+		{
+			name:   "Remote of an unregistered host",
+			remote: "https://github.com/org/repo.git",
+		},
+		{
+			name:     "Remote with the API URL of the host",
+			remote:   "ssh://git@gitlab.example.com:2222/org/repo.git",
+			wantHost: gitlab,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, err := registry.HostOf(tt.remote)
+			if tt.wantHost.Hostname == "" {
+				assert.EqualError(t, err, invalidRemoteErr)
+				assert.EqualError(t, registry.ValidateRemote(tt.remote), invalidRemoteErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, registry.ValidateRemote(tt.remote))
+			assert.Equal(t, tt.wantHost, host)
+		})
+	}
+
+	assert.Equal(t, "https://github.example.com", ghe.API())
+	assert.Equal(t, "https://api.gitlab.example.com", gitlab.API())
+
+	registry.Register(Host{Hostname: "github.com", Driver: "github"})
+	assert.NoError(t, registry.ValidateRemote("https://github.com/org/repo.git"))
+}
+
+func TestDefaultHostRegistry(t *testing.T) {
+	registry := DefaultHostRegistry()
+	assert.NoError(t, registry.ValidateRemote("https://github.com/org/repo.git"))
+	assert.NoError(t, registry.ValidateRemote("git@gitlab.com:org/repo.git"))
+	assert.EqualError(t, registry.ValidateRemote("https://github.example.com/org/repo.git"), invalidRemoteMsg.Error())
+}
+
+func TestHostRegistryConcurrentRegister(t *testing.T) {
+	registry := NewHostRegistry(Host{Hostname: "github.com", Driver: "github"})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			registry.Register(Host{Hostname: fmt.Sprintf("git%d.example.com", i), Driver: "gitlab"})
+		}
+	}()
+	// The invalid remotes are validated while Register waits for the write lock
+	for i := 0; i < 1000; i++ {
+		assert.Error(t, registry.ValidateRemote("https://unknown.example.com/org/repo.git"))
+	}
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Register is blocked")
+	}
+}
@@ -0,0 +1,230 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ioutils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/spf13/afero"
+)
+
+// NewBillyFilesystem returns a go-billy filesystem rooted at the given folder of the afero filesystem.
+// It lets go-git read and write repositories on the same filesystem that is used to generate the resources.
+func NewBillyFilesystem(fs afero.Afero, root string) billy.Filesystem {
+	return &billyFs{fs: fs, root: filepath.Clean(root)}
+}
+
+type billyFs struct {
+	fs   afero.Afero
+	root string
+}
+
+// abs returns the path of name on the underlying afero filesystem, ensuring it does not escape the root
+func (b *billyFs) abs(name string) (string, error) {
+	fullPath := filepath.Join(b.root, name)
+	if fullPath != b.root && !strings.HasPrefix(fullPath, b.root+string(filepath.Separator)) && b.root != string(filepath.Separator) {
+		return "", billy.ErrCrossedBoundary
+	}
+	return fullPath, nil
+}
+
+func (b *billyFs) Create(filename string) (billy.File, error) {
+	return b.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (b *billyFs) Open(filename string) (billy.File, error) {
+	return b.OpenFile(filename, os.O_RDONLY, 0)
+}
+
+func (b *billyFs) OpenFile(filename string, flag int, perm os.FileMode) (billy.File, error) {
+	fullPath, err := b.abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	if flag&os.O_CREATE != 0 {
+		if err := b.fs.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			return nil, err
+		}
+	}
+	f, err := b.fs.OpenFile(fullPath, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &billyFile{File: f, name: filename}, nil
+}
+
+func (b *billyFs) Stat(filename string) (os.FileInfo, error) {
+	fullPath, err := b.abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := b.fs.Stat(fullPath)
+	return regularFileInfo(fi), err
+}
+
+func (b *billyFs) Rename(oldpath, newpath string) error {
+	from, err := b.abs(oldpath)
+	if err != nil {
+		return err
+	}
+	to, err := b.abs(newpath)
+	if err != nil {
+		return err
+	}
+	if err := b.fs.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	return b.fs.Rename(from, to)
+}
+
+func (b *billyFs) Remove(filename string) error {
+	fullPath, err := b.abs(filename)
+	if err != nil {
+		return err
+	}
+	return b.fs.Remove(fullPath)
+}
+
+func (b *billyFs) Join(elem ...string) string {
+	return filepath.Join(elem...)
+}
+
+func (b *billyFs) TempFile(dir, prefix string) (billy.File, error) {
+	fullDir, err := b.abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.fs.MkdirAll(fullDir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := b.fs.TempFile(fullDir, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return &billyFile{File: f, name: filepath.Join(dir, filepath.Base(f.Name()))}, nil
+}
+
+func (b *billyFs) ReadDir(path string) ([]os.FileInfo, error) {
+	fullPath, err := b.abs(path)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := b.fs.ReadDir(fullPath)
+	for i, fi := range infos {
+		infos[i] = regularFileInfo(fi)
+	}
+	return infos, err
+}
+
+func (b *billyFs) MkdirAll(filename string, perm os.FileMode) error {
+	fullPath, err := b.abs(filename)
+	if err != nil {
+		return err
+	}
+	return b.fs.MkdirAll(fullPath, perm)
+}
+
+func (b *billyFs) Lstat(filename string) (os.FileInfo, error) {
+	fullPath, err := b.abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	if lstater, ok := b.fs.Fs.(afero.Lstater); ok {
+		fi, _, err := lstater.LstatIfPossible(fullPath)
+		return regularFileInfo(fi), err
+	}
+	fi, err := b.fs.Stat(fullPath)
+	return regularFileInfo(fi), err
+}
+
+// regularFileInfo reports the files created by afero's MemMapFs Create, which have the os.ModeTemporary mode that git
+// has no equivalent for, as regular files
+func regularFileInfo(fi os.FileInfo) os.FileInfo {
+	if fi == nil || fi.Mode()&os.ModeTemporary == 0 {
+		return fi
+	}
+	return temporaryFileInfo{FileInfo: fi}
+}
+
+type temporaryFileInfo struct {
+	os.FileInfo
+}
+
+func (fi temporaryFileInfo) Mode() os.FileMode {
+	return fi.FileInfo.Mode() &^ os.ModeTemporary
+}
+
+func (b *billyFs) Symlink(target, link string) error {
+	linker, ok := b.fs.Fs.(afero.Linker)
+	if !ok {
+		return billy.ErrNotSupported
+	}
+	fullPath, err := b.abs(link)
+	if err != nil {
+		return err
+	}
+	if err := b.fs.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return err
+	}
+	return linker.SymlinkIfPossible(target, fullPath)
+}
+
+func (b *billyFs) Readlink(link string) (string, error) {
+	reader, ok := b.fs.Fs.(afero.LinkReader)
+	if !ok {
+		return "", billy.ErrNotSupported
+	}
+	fullPath, err := b.abs(link)
+	if err != nil {
+		return "", err
+	}
+	return reader.ReadlinkIfPossible(fullPath)
+}
+
+func (b *billyFs) Chroot(path string) (billy.Filesystem, error) {
+	fullPath, err := b.abs(path)
+	if err != nil {
+		return nil, err
+	}
+	return &billyFs{fs: b.fs, root: fullPath}, nil
+}
+
+func (b *billyFs) Root() string {
+	return b.root
+}
+
+// billyFile wraps an afero file so that its name is relative to the billy filesystem root
+type billyFile struct {
+	afero.File
+	name string
+}
+
+func (f *billyFile) Name() string {
+	return f.name
+}
+
+// Lock is a no-op, afero files do not support locking
+func (f *billyFile) Lock() error {
+	return nil
+}
+
+// Unlock is a no-op, afero files do not support locking
+func (f *billyFile) Unlock() error {
+	return nil
+}
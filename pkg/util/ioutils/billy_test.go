@@ -0,0 +1,99 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ioutils
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBillyFilesystem(t *testing.T) {
+	fs := NewMemoryFilesystem()
+	billyFs := NewBillyFilesystem(fs, "/repo")
+
+	// Files are created under the root, along with their parent folders
+	f, err := billyFs.Create("dir/file.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "dir/file.txt", f.Name())
+	_, err = f.Write([]byte("content"))
+	assert.NoError(t, err)
+	assert.NoError(t, f.Lock())
+	assert.NoError(t, f.Unlock())
+	assert.NoError(t, f.Close())
+
+	content, err := fs.ReadFile("/repo/dir/file.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "content", string(content))
+
+	f, err = billyFs.Open("dir/file.txt")
+	assert.NoError(t, err)
+	content, err = io.ReadAll(f)
+	assert.NoError(t, err)
+	assert.Equal(t, "content", string(content))
+	assert.NoError(t, f.Close())
+
+	// Temp files are named relative to the root, so that they can be renamed
+	tmp, err := billyFs.TempFile("tmp", "pack")
+	assert.NoError(t, err)
+	assert.Equal(t, "tmp", filepath.Dir(tmp.Name()))
+	assert.NoError(t, tmp.Close())
+	assert.NoError(t, billyFs.Rename(tmp.Name(), "objects/pack/file.pack"))
+	exists, err := fs.Exists("/repo/objects/pack/file.pack")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	infos, err := billyFs.ReadDir("dir")
+	assert.NoError(t, err)
+	assert.Len(t, infos, 1)
+
+	fi, err := billyFs.Lstat("dir/file.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "file.txt", fi.Name())
+
+	// Files created by afero, which the in-memory filesystem marks as temporary, are regular files
+	created, err := fs.Create("/repo/dir/created.txt")
+	assert.NoError(t, err)
+	assert.NoError(t, created.Close())
+	fi, err = billyFs.Stat("dir/created.txt")
+	assert.NoError(t, err)
+	assert.True(t, fi.Mode().IsRegular())
+	assert.NoError(t, fs.Remove("/repo/dir/created.txt"))
+
+	// Chroot nests the root
+	chroot, err := billyFs.Chroot("dir")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join("/repo", "dir"), chroot.Root())
+	_, err = chroot.Stat("file.txt")
+	assert.NoError(t, err)
+
+	assert.NoError(t, billyFs.Remove("dir/file.txt"))
+	_, err = billyFs.Stat("dir/file.txt")
+	assert.True(t, os.IsNotExist(err))
+
+	// Paths cannot escape the root
+	_, err = billyFs.Create("../outside.txt")
+	assert.Equal(t, billy.ErrCrossedBoundary, err)
+	_, err = chroot.Stat("../../etc")
+	assert.Equal(t, billy.ErrCrossedBoundary, err)
+
+	// Symlinks are not supported by the in-memory filesystem
+	assert.Equal(t, billy.ErrNotSupported, billyFs.Symlink("target", "link"))
+}
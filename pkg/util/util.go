@@ -23,41 +23,68 @@ import (
 	"strings"
 )
 
-var invalidRemoteMsg = errors.New("remote URL is invalid or missing the https scheme and/or supported github.com or gitlab.com hosts")
+var invalidRemoteMsg = errors.New("remote URL is invalid or missing the https or ssh scheme and/or supported github.com or gitlab.com hosts")
 
-// ValidateRemote minimally validates the remote gitops URL to ensure it contains the "https" scheme and supported "github.com" and "gitlab.com" hosts
-func ValidateRemote(remote string) error {
-	remoteURL, parseErr := url.Parse(remote)
-	if parseErr != nil {
-		return invalidRemoteMsg
-	}
+// scpLikeRemoteRegex matches the scp-like syntax of SSH remotes, e.g. git@github.com:org/repo.git
+var scpLikeRemoteRegex = regexp.MustCompile(`^(?:([\w.-]+)@)?([\w.-]+):([^/].*)$`)
 
-	if remoteURL.Scheme == "https" && (remoteURL.Host == "github.com" || remoteURL.Host == "gitlab.com") {
-		return nil
+// ParseRemote parses the remote URL. Remotes using the scp-like syntax of SSH, e.g. git@github.com:org/repo.git, are
+// returned as the equivalent ssh:// URL.
+func ParseRemote(remote string) (*url.URL, error) {
+	if match := scpLikeRemoteRegex.FindStringSubmatch(remote); match != nil {
+		u := &url.URL{Scheme: "ssh", Host: match[2], Path: "/" + match[3]}
+		if match[1] != "" {
+			u.User = url.User(match[1])
+		}
+		return u, nil
 	}
+	return url.Parse(remote)
+}
+
+// IsSSHRemote returns true if the remote is accessed over SSH, either through an ssh:// URL or the scp-like syntax
+func IsSSHRemote(remote string) bool {
+	remoteURL, err := ParseRemote(remote)
+	return err == nil && remoteURL.Scheme == "ssh"
+}
+
+// defaultHosts is the registry ValidateRemote validates the remotes against
+var defaultHosts = DefaultHostRegistry()
 
-	return invalidRemoteMsg
+// ValidateRemote minimally validates the remote gitops URL to ensure it contains the "https" or "ssh" scheme and supported "github.com" and "gitlab.com" hosts.
+// SSH remotes can use the scp-like syntax, e.g. git@github.com:org/repo.git. Use a HostRegistry to allow other hosts.
+func ValidateRemote(remote string) error {
+	if err := defaultHosts.ValidateRemote(remote); err != nil {
+		return invalidRemoteMsg
+	}
+	return nil
 }
 
+// CredentialsDirPrefix prefixes the name of the temporary folders the credentials, such as SSH keys, are written to.
+// Paths containing it are redacted by SanitizeErrorMessage.
+const CredentialsDirPrefix = "gitops-generator-credentials-"
+
 /* #nosec G101 -- regex for remote url segment that can contain a token.  This is not a hardcoded token*/
 const (
-	tokenRegex  = `(https:\/\/)(\w+)@`
+	// tokenRegex matches the user info of the URLs of any scheme, e.g. http or https, which may hold a token or a
+	// user and password, whatever characters they contain
+	tokenRegex  = `([a-zA-Z][a-zA-Z0-9+.-]*:\/\/)([^\s/@"'<>]+)@`
 	schemaBytes = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
 )
 
-// SanitizeErrorMessage takes in a given error message and returns a new, sanitized error with things like tokens removed
+var (
+	// privateKeyRegex matches PEM encoded private keys, including truncated ones
+	privateKeyRegex = regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----(?s:.*?)(-----END [A-Z ]*PRIVATE KEY-----|$)`)
+	// credentialsPathRegex matches the paths of the files holding the credentials
+	credentialsPathRegex = regexp.MustCompile(`[^\s"'=]*` + CredentialsDirPrefix + `[^\s"']*`)
+)
+
+// SanitizeErrorMessage takes in a given error message and returns a new, sanitized error with things like tokens, private keys and
+// the paths of the credentials files removed
 func SanitizeErrorMessage(err error) error {
 	reg := regexp.MustCompile(tokenRegex)
-	matches := reg.FindAllStringSubmatch(err.Error(), -1)
-	newErrMsg := err.Error()
-
-	for _, v := range matches {
-		// check for length of 3 because this includes the string match for the entire regex and sub-matches to the two capturing groups
-		if len(v) == 3 {
-			// use newErrMsg in subsequent iterations to ensure multiple tokens in a message get redacted
-			newErrMsg = strings.Replace(newErrMsg, v[2], "<TOKEN>", 1)
-		}
-	}
+	newErrMsg := reg.ReplaceAllString(err.Error(), "${1}<TOKEN>@")
+	newErrMsg = privateKeyRegex.ReplaceAllString(newErrMsg, "<PRIVATE KEY>")
+	newErrMsg = credentialsPathRegex.ReplaceAllString(newErrMsg, "<CREDENTIALS>")
 
 	return errors.New(newErrMsg)
 }
@@ -0,0 +1,101 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// commitIDPattern matches a full or abbreviated commit ID, which git cannot mistake for an option or a revision
+// expression
+var commitIDPattern = regexp.MustCompile(`^[0-9a-f]{4,40}$`)
+
+// argument is an argument of a Gen method that is joined into the paths of the repository
+type argument struct {
+	name  string
+	value string
+	// path is set for the arguments holding a path within the repository, such as the context, and unset for names
+	path bool
+	// optional arguments are not validated when empty
+	optional bool
+	// commitID is set for the arguments holding the ID of a commit, passed to git
+	commitID bool
+}
+
+// nameArg is a component, application or environment name, which must be a DNS-1123 label
+func nameArg(name string, value string) argument {
+	return argument{name: name, value: value}
+}
+
+// optionalNameArg is a name that is only validated when set
+func optionalNameArg(name string, value string) argument {
+	return argument{name: name, value: value, optional: true}
+}
+
+// pathArg is a path that must stay within the folder it is joined to, such as the context within the repository
+func pathArg(name string, value string) argument {
+	return argument{name: name, value: value, path: true}
+}
+
+// commitIDArg is the ID of a commit, possibly abbreviated
+func commitIDArg(name string, value string) argument {
+	return argument{name: name, value: value, commitID: true}
+}
+
+// validateArgs returns a ValidationError for the first invalid argument, so that the names and paths are checked
+// before any git or filesystem operation is run
+func validateArgs(args ...argument) error {
+	for _, arg := range args {
+		if arg.optional && arg.value == "" {
+			continue
+		}
+		var reasons []string
+		if arg.path {
+			reasons = validatePath(arg.value)
+		} else if arg.commitID {
+			if !commitIDPattern.MatchString(arg.value) {
+				reasons = []string{"must be a hexadecimal commit ID of 4 to 40 characters"}
+			}
+		} else {
+			reasons = validation.IsDNS1123Label(arg.value)
+		}
+		if len(reasons) > 0 {
+			return &ValidationError{argument: arg.name, value: arg.value, reasons: reasons}
+		}
+	}
+	return nil
+}
+
+// validatePath returns why the path escapes the folder it is joined to, or points to the .git folder of the
+// repository. Like with filepath.Join, a leading separator does not make the path absolute.
+func validatePath(path string) []string {
+	rel, err := filepath.Rel("root", filepath.Join("root", path))
+	if err != nil {
+		return []string{err.Error()}
+	}
+	first := strings.Split(rel, string(filepath.Separator))[0]
+	if first == ".." {
+		return []string{"must not point outside of the repository"}
+	}
+	if first == ".git" {
+		return []string{"must not point to the .git folder"}
+	}
+	return nil
+}
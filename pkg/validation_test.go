@@ -0,0 +1,111 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"errors"
+	"testing"
+
+	gitopsv1alpha1 "github.com/redhat-developer/gitops-generator/api/v1alpha1"
+	"github.com/redhat-developer/gitops-generator/pkg/testutils"
+	"github.com/redhat-developer/gitops-generator/pkg/util/ioutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateArgs(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          []argument
+		wantErrString string
+	}{
+		{
+			name: "Valid arguments",
+			args: []argument{nameArg("component name", "frontend"), optionalNameArg("application name", ""), pathArg("context", "/gitops/dev"), pathArg("context", "")},
+		},
+		{
+			name:          "Path traversal in a name",
+			args:          []argument{nameArg("component name", "../../etc")},
+			wantErrString: "invalid component name \"../../etc\": a lowercase RFC 1123 label must consist of",
+		},
+		{
+			name:          "Missing name",
+			args:          []argument{nameArg("component name", "frontend"), nameArg("environment name", "")},
+			wantErrString: "invalid environment name \"\"",
+		},
+		{
+			name:          "Uppercase name",
+			args:          []argument{optionalNameArg("application name", "Shop")},
+			wantErrString: "invalid application name \"Shop\"",
+		},
+		{
+			name:          "Name too long",
+			args:          []argument{nameArg("component name", "a123456789012345678901234567890123456789012345678901234567890123")},
+			wantErrString: "must be no more than 63 characters",
+		},
+		{
+			name:          "Context outside of the repository",
+			args:          []argument{pathArg("context", "gitops/../../..")},
+			wantErrString: "invalid context \"gitops/../../..\": must not point outside of the repository",
+		},
+		{
+			name:          "Absolute context outside of the repository",
+			args:          []argument{pathArg("context", "/../etc")},
+			wantErrString: "must not point outside of the repository",
+		},
+		{
+			name:          "Context in the git folder",
+			args:          []argument{pathArg("context", "./.git/hooks")},
+			wantErrString: "invalid context \"./.git/hooks\": must not point to the .git folder",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateArgs(tt.args...)
+			if tt.wantErrString != "" {
+				testutils.AssertErrorMatch(t, tt.wantErrString, err)
+				var validationErr *ValidationError
+				assert.True(t, errors.As(err, &validationErr), "a ValidationError should be returned")
+			} else {
+				testutils.AssertNoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidationBeforeOperations(t *testing.T) {
+	repo := "https://github.com/testing/testing.git"
+	executedCmds := []testutils.Execution{}
+	fs := ioutils.NewMemoryFilesystem()
+	generator := NewGitopsGen(WithExecutor(newTestExecutor(testutils.NewOutputs(), testutils.NewErrors(), &executedCmds)), WithFilesystem(fs))
+	component := gitopsv1alpha1.GeneratorOptions{Name: "frontend", ContainerImage: "image"}
+
+	var validationErr *ValidationError
+	err := generator.GitRemoveComponent("/fake/path", repo, "../../etc", "main", "/")
+	assert.True(t, errors.As(err, &validationErr), "a ValidationError should be returned, got %v", err)
+	err = generator.CloneGenerateAndPush("/fake/path", repo, component, fs, "main", "../..", true)
+	assert.True(t, errors.As(err, &validationErr), "a ValidationError should be returned, got %v", err)
+	err = generator.GenerateOverlaysAndPush("/fake/path", true, repo, component, "shop", "Staging", "image", "ns", fs, "main", "/", true, nil)
+	assert.True(t, errors.As(err, &validationErr), "a ValidationError should be returned, got %v", err)
+	err = generator.CommitAndPush("/fake/path", "../outside", repo, "frontend", "main", "Update")
+	assert.True(t, errors.As(err, &validationErr), "a ValidationError should be returned, got %v", err)
+	_, err = generator.OpenBatch("/fake/path/app", repo, "main", "../..")
+	assert.True(t, errors.As(err, &validationErr), "a ValidationError should be returned, got %v", err)
+
+	assert.Empty(t, executedCmds, "no command should be run")
+	files, err := fs.ReadDir("/")
+	testutils.AssertNoError(t, err)
+	assert.Empty(t, files, "no file should be written")
+}
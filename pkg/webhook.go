@@ -0,0 +1,188 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"context"
+	"errors"
+	"net/url"
+
+	"github.com/jenkins-x/go-scm/scm"
+)
+
+// webhookMarker is the query parameter added to the target URL of the webhooks registered by the generator, so that
+// they can be told apart from the other webhooks of the repository
+const webhookMarker = "managed-by"
+
+// webhookMarkerValue is the value of the webhookMarker query parameter
+const webhookMarkerValue = "gitops-generator"
+
+// WebhookOptions configures the webhook registered by GenerateAndPush on the repositories it creates or adopts, e.g.
+// to notify Argo CD of the pushes instead of having it poll the repositories
+type WebhookOptions struct {
+	// URL the events are sent to. The managed-by=gitops-generator query parameter is added to it, to identify the
+	// webhooks managed by the generator.
+	URL string
+	// Secret signs the payloads of the events, or authenticates them for GitLab. The payloads are not signed when not set.
+	Secret string
+	// Events are the events sent to the URL. Defaults to the push events.
+	Events scm.HookEvents
+	// SkipTLSVerify disables the verification of the TLS certificate of the URL by the Git host
+	SkipTLSVerify bool
+}
+
+// target returns the URL of the webhook, marked as managed by the generator
+func (o WebhookOptions) target() (string, error) {
+	u, err := url.Parse(o.URL)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set(webhookMarker, webhookMarkerValue)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// isManagedWebhook returns true if the webhook was registered by the generator
+func isManagedWebhook(hook *scm.Hook) bool {
+	u, err := url.Parse(hook.Target)
+	return err == nil && u.Query().Get(webhookMarker) == webhookMarkerValue
+}
+
+// registerWebhook registers the webhook on the repository. A webhook managed by the generator already sending the
+// events to the same URL is updated instead, so that GenerateAndPush can be run again without duplicating the webhook,
+// while still applying the changes of its secret, events and TLS verification.
+func registerWebhook(ctx context.Context, client *scm.Client, repo string, options WebhookOptions) error {
+	target, err := options.target()
+	if err != nil {
+		return &WebhookError{repo: repo, action: "register", err: err}
+	}
+	hooks, err := listManagedWebhooks(ctx, client, repo)
+	if err != nil {
+		return &WebhookError{repo: repo, action: "register", err: err}
+	}
+	events := options.Events
+	if events == (scm.HookEvents{}) {
+		events.Push = true
+	}
+	input := &scm.HookInput{Target: target, Secret: options.Secret, Events: events, SkipVerify: options.SkipTLSVerify}
+	for _, hook := range hooks {
+		if hook.Target != target {
+			continue
+		}
+		// go-scm reads the ID of the webhook to update from the name of the input
+		update := *input
+		update.Name = hook.ID
+		_, _, err := client.Repositories.UpdateHook(ctx, repo, &update)
+		if err == nil {
+			return nil
+		} else if !errors.Is(err, scm.ErrNotSupported) {
+			return &WebhookError{repo: repo, action: "update", err: err}
+		}
+		// The drivers not supporting the update, e.g. GitHub, replace the webhook
+		if _, err := client.Repositories.DeleteHook(ctx, repo, hook.ID); err != nil {
+			return &WebhookError{repo: repo, action: "update", err: err}
+		}
+		break
+	}
+	if _, _, err := client.Repositories.CreateHook(ctx, repo, input); err != nil {
+		return &WebhookError{repo: repo, action: "register", err: err}
+	}
+	return nil
+}
+
+// listManagedWebhooks returns the webhooks of the repository registered by the generator
+func listManagedWebhooks(ctx context.Context, client *scm.Client, repo string) ([]*scm.Hook, error) {
+	var managed []*scm.Hook
+	opts := scm.ListOptions{Page: 1, Size: 100}
+	for {
+		hooks, resp, err := client.Repositories.ListHooks(ctx, repo, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, hook := range hooks {
+			if isManagedWebhook(hook) {
+				managed = append(managed, hook)
+			}
+		}
+		if resp == nil || resp.Page.Next <= opts.Page {
+			return managed, nil
+		}
+		opts.Page = resp.Page.Next
+	}
+}
+
+// ListWebhooks returns the webhooks registered by the generator on the repository of the remote. The other webhooks
+// of the repository are not returned.
+// 1. remote: A string of the form https://$token@github.com/<org>/<repo>, where $token is omitted when using Credentials, or an SSH remote such as git@github.com:<org>/<repo>.git
+func (s Gen) ListWebhooks(remote string) ([]*scm.Hook, error) {
+	return s.ListWebhooksWithContext(context.Background(), remote)
+}
+
+// ListWebhooksWithContext is the context aware variant of ListWebhooks
+func (s Gen) ListWebhooksWithContext(ctx context.Context, remote string) (hooks []*scm.Hook, err error) {
+	defer func() { err = checkCancelled(ctx, "ListWebhooks", err) }()
+	client, repo, err := s.webhookClient(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	if hooks, err = listManagedWebhooks(ctx, client, repo); err != nil {
+		return nil, &WebhookError{repo: repo, action: "list", err: err}
+	}
+	return hooks, nil
+}
+
+// RemoveWebhooks removes the webhooks registered by the generator from the repository of the remote, leaving the
+// other webhooks of the repository untouched.
+// 1. remote: A string of the form https://$token@github.com/<org>/<repo>, where $token is omitted when using Credentials, or an SSH remote such as git@github.com:<org>/<repo>.git
+func (s Gen) RemoveWebhooks(remote string) error {
+	return s.RemoveWebhooksWithContext(context.Background(), remote)
+}
+
+// RemoveWebhooksWithContext is the context aware variant of RemoveWebhooks
+func (s Gen) RemoveWebhooksWithContext(ctx context.Context, remote string) (err error) {
+	defer func() { err = checkCancelled(ctx, "RemoveWebhooks", err) }()
+	client, repo, err := s.webhookClient(ctx, remote)
+	if err != nil {
+		return err
+	}
+	hooks, err := listManagedWebhooks(ctx, client, repo)
+	if err != nil {
+		return &WebhookError{repo: repo, action: "remove", err: err}
+	}
+	for _, hook := range hooks {
+		if _, err := client.Repositories.DeleteHook(ctx, repo, hook.ID); err != nil {
+			return &WebhookError{repo: repo, action: "remove", err: err}
+		}
+	}
+	return nil
+}
+
+// webhookClient returns the go-scm client and the full name of the repository of the remote
+func (s Gen) webhookClient(ctx context.Context, remote string) (*scm.Client, string, error) {
+	if err := s.validateRemote(remote); err != nil {
+		return nil, "", err
+	}
+	repo, err := repoFullName(remote)
+	if err != nil {
+		return nil, "", err
+	}
+	client, err := s.scmClient(ctx, remote)
+	if err != nil {
+		return nil, "", err
+	}
+	return client, repo, nil
+}
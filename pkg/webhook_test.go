@@ -0,0 +1,182 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/jenkins-x/go-scm/scm/driver/github"
+	"github.com/jenkins-x/go-scm/scm/driver/gitlab"
+	gitopsv1alpha1 "github.com/redhat-developer/gitops-generator/api/v1alpha1"
+	"github.com/redhat-developer/gitops-generator/pkg/testutils"
+	"github.com/redhat-developer/gitops-generator/pkg/util/ioutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// githubHook is the webhook of the GitHub API
+type githubHook struct {
+	ID     int               `json:"id"`
+	Name   string            `json:"name"`
+	Active bool              `json:"active"`
+	Events []string          `json:"events"`
+	Config map[string]string `json:"config"`
+}
+
+// fakeGitHubHooks serves the GitHub webhook API of the testing/testing repository, the other requests being served
+// by the embedded fakeGitHubRepos
+type fakeGitHubHooks struct {
+	fakeGitHubRepos
+	mu     sync.Mutex
+	hooks  []githubHook
+	nextID int
+}
+
+func (f *fakeGitHubHooks) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, "/repos/testing/testing/hooks") {
+		f.fakeGitHubRepos.ServeHTTP(w, r)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodGet:
+		_ = json.NewEncoder(w).Encode(f.hooks)
+	case http.MethodPost:
+		var hook githubHook
+		_ = json.NewDecoder(r.Body).Decode(&hook)
+		f.nextID++
+		hook.ID = f.nextID
+		f.hooks = append(f.hooks, hook)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(hook)
+	case http.MethodDelete:
+		for i, hook := range f.hooks {
+			if r.URL.Path == fmt.Sprintf("/repos/testing/testing/hooks/%d", hook.ID) {
+				f.hooks = append(f.hooks[:i], f.hooks[i+1:]...)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newFakeGitHubHooks(t *testing.T, targets ...string) (*fakeGitHubHooks, func(remote string) (*scm.Client, error)) {
+	api := &fakeGitHubHooks{}
+	for _, target := range targets {
+		api.nextID++
+		api.hooks = append(api.hooks, githubHook{ID: api.nextID, Name: "web", Active: true, Events: []string{"push"}, Config: map[string]string{"url": target}})
+	}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+	return api, func(remote string) (*scm.Client, error) {
+		return github.New(server.URL)
+	}
+}
+
+func TestGenerateAndPushWebhook(t *testing.T) {
+	api, scmClientFactory := newFakeGitHubHooks(t, "https://ci.example.com/hooks")
+	webhook := &WebhookOptions{URL: "https://argocd.example.com/api/webhook", Secret: "secret", SkipTLSVerify: true}
+	options := gitopsv1alpha1.GeneratorOptions{ContainerImage: "testimage:latest", GitSource: &gitopsv1alpha1.GitSource{URL: "https://github.com/testing/testing.git"}, TargetPort: 5000}
+	options.Name = "test-component"
+
+	for _, outputPath := range []string{"/first", "/second"} {
+		if outputPath == "/second" {
+			// GitHub does not support updating the webhook through go-scm, so it is replaced
+			webhook.Secret = "rotated"
+		}
+		executedCmds := []testutils.Execution{}
+		// The first command of the second run lists the branch of the repository, which is then adopted
+		outputs := testutils.NewOutputs([]byte("abc\trefs/heads/main"))
+		generator := NewGitopsGen(WithExecutor(newTestExecutor(outputs, testutils.NewErrors(), &executedCmds)),
+			WithScmClientFactory(scmClientFactory), WithRepositoryOptions(RepositoryOptions{Webhook: webhook, AdoptExisting: true}))
+		testutils.AssertNoError(t, generator.GenerateAndPush(outputPath, "https://github.com/testing/testing.git", options, ioutils.NewMemoryFilesystem(), "main", true, "KAM CLI"))
+	}
+
+	assert.Len(t, api.hooks, 2, "the webhook should not be registered twice")
+	assert.Equal(t, githubHook{ID: 3, Name: "web", Active: true, Events: []string{"push"}, Config: map[string]string{
+		"url":          "https://argocd.example.com/api/webhook?managed-by=gitops-generator",
+		"secret":       "rotated",
+		"content_type": "json",
+		"insecure_ssl": "1",
+	}}, api.hooks[1])
+}
+
+func TestRegisterWebhookUpdate(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.EscapedPath())
+		switch r.Method {
+		case http.MethodGet:
+			_ = json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"id": 1, "url": "https://ci.example.com/hooks", "push_events": true},
+				{"id": 2, "url": "https://argocd.example.com/api/webhook?managed-by=gitops-generator", "push_events": true},
+			})
+		case http.MethodPut:
+			assert.Equal(t, "rotated", r.URL.Query().Get("token"))
+			assert.Equal(t, "true", r.URL.Query().Get("tag_push_events"))
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": 2, "url": r.URL.Query().Get("url"), "push_events": true, "tag_push_events": true})
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer server.Close()
+	client, err := gitlab.New(server.URL)
+	testutils.AssertNoError(t, err)
+
+	// The managed webhook sending the events to the same URL is updated, rather than registered again
+	options := WebhookOptions{URL: "https://argocd.example.com/api/webhook", Secret: "rotated", Events: scm.HookEvents{Push: true, Tag: true}}
+	testutils.AssertNoError(t, registerWebhook(context.Background(), client, "testing/testing", options))
+	assert.Equal(t, []string{
+		"GET /api/v4/projects/testing%2Ftesting/hooks",
+		"PUT /api/v4/projects/testing%2Ftesting/hooks/2",
+	}, requests)
+}
+
+func TestListAndRemoveWebhooks(t *testing.T) {
+	remote := "https://github.com/testing/testing.git"
+	api, scmClientFactory := newFakeGitHubHooks(t,
+		"https://ci.example.com/hooks",
+		"https://argocd.example.com/api/webhook?managed-by=gitops-generator",
+		"https://tekton.example.com/?managed-by=gitops-generator&token=abc",
+	)
+	generator := NewGitopsGen(WithScmClientFactory(scmClientFactory))
+
+	hooks, err := generator.ListWebhooks(remote)
+	testutils.AssertNoError(t, err)
+	assert.Equal(t, []*scm.Hook{
+		{ID: "2", Target: "https://argocd.example.com/api/webhook?managed-by=gitops-generator", Active: true, Events: []string{"push"}},
+		{ID: "3", Target: "https://tekton.example.com/?managed-by=gitops-generator&token=abc", Active: true, Events: []string{"push"}},
+	}, hooks)
+
+	testutils.AssertNoError(t, generator.RemoveWebhooks(remote))
+	assert.Len(t, api.hooks, 1, "only the webhooks managed by the generator should be removed")
+	assert.Equal(t, "https://ci.example.com/hooks", api.hooks[0].Config["url"])
+	hooks, err = generator.ListWebhooks(remote)
+	testutils.AssertNoError(t, err)
+	assert.Empty(t, hooks)
+
+	_, err = generator.ListWebhooks("https://github.com/testing")
+	testutils.AssertErrorMatch(t, "is not of the form <org>/<repo>", err)
+}
@@ -0,0 +1,224 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/redhat-developer/gitops-generator/pkg/util"
+	"github.com/spf13/afero"
+)
+
+// WorkspaceCache keeps a local clone of the GitOps repositories per remote and branch, so that the Gen methods that
+// clone the repository reuse it instead of cloning it on every call. Before each use, the workspace is fetched and
+// hard reset to the tip of the remote branch. A workspace is used by a single call at a time, and the least recently
+// used workspaces are removed once the cache exceeds its limits. It is safe for concurrent use, and can be shared by
+// several Gen using the same filesystem.
+type WorkspaceCache struct {
+	dir           string
+	maxWorkspaces int
+	maxBytes      int64
+
+	mu         sync.Mutex
+	workspaces map[string]*list.Element
+	// lru holds the *workspace, the most recently used first
+	lru *list.List
+	// next numbers the folders of the workspaces, so that a new workspace never reuses the folder of an evicted one
+	next int
+}
+
+// workspace is the clone of a remote branch in the WorkspaceCache
+type workspace struct {
+	key  string
+	path string
+	// lock is held by the call using the workspace. A channel is used, so that waiting for it can be cancelled.
+	lock chan struct{}
+	// refs counts the calls using or waiting for the workspace, which cannot be evicted until it is 0
+	refs int
+	// size is the size of the folder of the workspace, in bytes, when it was last released
+	size int64
+}
+
+// NewWorkspaceCache returns a cache keeping its workspaces in dir. maxWorkspaces limits the number of workspaces and
+// maxBytes their total size, no limit being applied when zero.
+func NewWorkspaceCache(dir string, maxWorkspaces int, maxBytes int64) *WorkspaceCache {
+	return &WorkspaceCache{
+		dir:           dir,
+		maxWorkspaces: maxWorkspaces,
+		maxBytes:      maxBytes,
+		workspaces:    map[string]*list.Element{},
+		lru:           list.New(),
+	}
+}
+
+// WithWorkspaceCache sets the cache of the clones reused by CloneGenerateAndPush, GenerateOverlaysAndPush and
+// GitRemoveComponent
+func WithWorkspaceCache(cache *WorkspaceCache) GenOption {
+	return func(g *Gen) {
+		g.Workspaces = cache
+	}
+}
+
+// acquire returns the path of the workspace of the remote branch, fetched and reset to the tip of the remote branch,
+// along with the function releasing it. It waits for the workspace to be released if it is in use. The sparsePaths
+// folders are added to the sparse checkout of the workspace if not empty.
+func (c *WorkspaceCache) acquire(ctx context.Context, s Gen, remote string, branch string, sparsePaths []string) (string, func(), error) {
+	w := c.reference(remote, branch)
+	select {
+	case w.lock <- struct{}{}:
+	case <-ctx.Done():
+		c.release(s, w, false)
+		return "", nil, ctx.Err()
+	}
+
+	fs := s.filesystem()
+	if exists, _ := fs.DirExists(w.path); exists {
+		if err := c.refresh(ctx, s, w.path, remote, branch, sparsePaths); err == nil {
+			return w.path, func() { c.release(s, w, true) }, nil
+		}
+		// Start over from a fresh clone, e.g. when the branch does not exist on the remote yet
+		if err := fs.RemoveAll(w.path); err != nil {
+			c.release(s, w, true)
+			return "", nil, err
+		}
+	}
+	if err := fs.MkdirAll(c.dir, 0755); err != nil {
+		c.release(s, w, true)
+		return "", nil, err
+	}
+	if err := s.cloneRepo(ctx, c.dir, remote, filepath.Base(w.path), branch, sparsePaths); err != nil {
+		c.release(s, w, true)
+		return "", nil, err
+	}
+	return w.path, func() { c.release(s, w, true) }, nil
+}
+
+// reference returns the workspace of the remote branch, creating it if needed, and marks it as used. The workspaces
+// are keyed on the remote without its token, so that a workspace is reused once the token changes.
+func (c *WorkspaceCache) reference(remote string, branch string) *workspace {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := withoutToken(remote) + "\x00" + branch
+	if e, ok := c.workspaces[key]; ok {
+		c.lru.MoveToFront(e)
+		w := e.Value.(*workspace)
+		w.refs++
+		return w
+	}
+	hash := sha256.Sum256([]byte(key))
+	c.next++
+	w := &workspace{
+		key:  key,
+		path: filepath.Join(c.dir, fmt.Sprintf("%s-%d", hex.EncodeToString(hash[:8]), c.next)),
+		lock: make(chan struct{}, 1),
+		refs: 1,
+	}
+	c.workspaces[key] = c.lru.PushFront(w)
+	return w
+}
+
+// refresh fetches the remote branch, and hard resets the workspace to it. The workspace may have been cloned with
+// another token, so the remote of the call is set as its origin first.
+func (c *WorkspaceCache) refresh(ctx context.Context, s Gen, repoPath string, remote string, branch string, sparsePaths []string) error {
+	if out, err := s.execute(ctx, repoPath, GitCommand, "remote", "set-url", "origin", remote); err != nil {
+		return &GitCmdError{path: repoPath, cmdResult: string(out), err: err, cmdType: resetWorkspace}
+	}
+	if out, err := s.executeRemote(ctx, repoPath, remote, "fetch", "origin", branch); err != nil {
+		return &GitCmdError{path: repoPath, cmdResult: string(out), err: err, cmdType: resetWorkspace}
+	}
+	if out, err := s.execute(ctx, repoPath, GitCommand, "reset", "--hard", "origin/"+branch); err != nil {
+		return &GitCmdError{path: repoPath, cmdResult: string(out), err: err, cmdType: resetWorkspace}
+	}
+	if out, err := s.execute(ctx, repoPath, GitCommand, "clean", "-fd"); err != nil {
+		return &GitCmdError{path: repoPath, cmdResult: string(out), err: err, cmdType: resetWorkspace}
+	}
+	if len(sparsePaths) > 0 {
+		return s.sparseCheckout(ctx, repoPath, sparsePaths, false)
+	}
+	return nil
+}
+
+// withoutToken returns the remote without the token of its user info. SSH remotes are returned as is.
+func withoutToken(remote string) string {
+	remoteURL, err := util.ParseRemote(remote)
+	if err != nil || util.IsSSHRemote(remote) || remoteURL.User == nil {
+		return remote
+	}
+	remoteURL.User = nil
+	return remoteURL.String()
+}
+
+// release marks the workspace as unused, unlocking it if locked, and evicts the least recently used workspaces
+// exceeding the limits of the cache
+func (c *WorkspaceCache) release(s Gen, w *workspace, locked bool) {
+	fs := s.filesystem()
+	size := w.size
+	if locked {
+		if c.maxBytes > 0 {
+			size = dirSize(fs, w.path)
+		}
+		<-w.lock
+	}
+
+	c.mu.Lock()
+	w.size = size
+	w.refs--
+	var evicted []*workspace
+	total := int64(0)
+	for e := c.lru.Front(); e != nil; e = e.Next() {
+		total += e.Value.(*workspace).size
+	}
+	for e := c.lru.Back(); e != nil && c.exceedsLimits(total); {
+		prev := e.Prev()
+		if candidate := e.Value.(*workspace); candidate.refs == 0 {
+			c.lru.Remove(e)
+			delete(c.workspaces, candidate.key)
+			total -= candidate.size
+			evicted = append(evicted, candidate)
+		}
+		e = prev
+	}
+	c.mu.Unlock()
+
+	// The folders of the evicted workspaces are not reused, so they can be removed once unlocked
+	for _, candidate := range evicted {
+		_ = fs.RemoveAll(candidate.path)
+	}
+}
+
+// exceedsLimits returns true if the cache holds too many workspaces, or too large ones
+func (c *WorkspaceCache) exceedsLimits(total int64) bool {
+	return (c.maxWorkspaces > 0 && c.lru.Len() > c.maxWorkspaces) || (c.maxBytes > 0 && total > c.maxBytes)
+}
+
+// dirSize returns the total size of the files of the folder
+func dirSize(fs afero.Afero, dir string) int64 {
+	var size int64
+	_ = fs.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,181 @@
+//
+// Copyright 2023 Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitops
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/redhat-developer/gitops-generator/api/v1alpha1"
+	"github.com/redhat-developer/gitops-generator/pkg/testutils"
+	"github.com/redhat-developer/gitops-generator/pkg/util"
+	"github.com/redhat-developer/gitops-generator/pkg/util/ioutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkspaceCache(t *testing.T) {
+	useInProcessFileTransport(t)
+	remote := "file://" + newBareRemote(t, "main")
+	fs := ioutils.NewMemoryFilesystem()
+	e := NewGoGitExecutor(fs)
+	run := func(baseDir string, args ...string) {
+		t.Helper()
+		_, err := e.Execute(context.Background(), baseDir, GitCommand, args...)
+		testutils.AssertNoError(t, err)
+	}
+	read := func(path string) string {
+		t.Helper()
+		content, err := fs.ReadFile(path)
+		testutils.AssertNoError(t, err)
+		return string(content)
+	}
+	userConfig := []string{"-c", "user.name=Test User", "-c", "user.email=test@test.org"}
+	pushUpstream := func(content string) {
+		t.Helper()
+		testutils.AssertNoError(t, writeFile(fs, "/upstream/repo/components/a/base/deployment.yaml", []byte(content), 0644))
+		run("/upstream/repo", "add", ".")
+		run("/upstream/repo", append(userConfig, "commit", "-m", "update")...)
+		run("/upstream/repo", "push", "origin", "main")
+	}
+	run("/upstream", "clone", remote, "repo")
+	run("/upstream/repo", "checkout", "-b", "main")
+	pushUpstream("a\n")
+
+	cache := NewWorkspaceCache("/cache", 1, 0)
+	hosts := util.NewHostRegistry(util.Host{Schemes: []string{"file"}})
+	generator := NewGitopsGen(WithExecutor(e), WithFilesystem(fs), WithHostRegistry(hosts), WithWorkspaceCache(cache),
+		WithCommitOptions(CommitOptions{Author: &Identity{Name: "Test User", Email: "test@test.org"}}))
+
+	// The first use clones the remote branch
+	repoPath, release, err := cache.acquire(context.Background(), generator, remote, "main", nil)
+	testutils.AssertNoError(t, err)
+	assert.Equal(t, "a\n", read(repoPath+"/components/a/base/deployment.yaml"))
+	testutils.AssertNoError(t, fs.WriteFile(repoPath+"/components/a/base/deployment.yaml", []byte("local\n"), 0644))
+	testutils.AssertNoError(t, fs.WriteFile(repoPath+"/untracked.yaml", []byte("untracked\n"), 0644))
+
+	// The workspace is used by one call at a time
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _, err = cache.acquire(ctx, generator, remote, "main", nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	release()
+
+	// The next uses reset the workspace to the tip of the remote branch
+	pushUpstream("b\n")
+	reusedPath, release, err := cache.acquire(context.Background(), generator, remote, "main", nil)
+	testutils.AssertNoError(t, err)
+	assert.Equal(t, repoPath, reusedPath)
+	assert.Equal(t, "b\n", read(repoPath+"/components/a/base/deployment.yaml"))
+	exists, err := fs.Exists(repoPath + "/untracked.yaml")
+	testutils.AssertNoError(t, err)
+	assert.False(t, exists, "the untracked files should be removed")
+	release()
+
+	// The Gen methods push from the workspace, without cloning to the outputPath
+	component := gitopsv1alpha1.GeneratorOptions{Name: "b", ContainerImage: "testimage:latest", Replicas: 1}
+	testutils.AssertNoError(t, generator.CloneGenerateAndPush("/output", remote, component, fs, "main", "/", true))
+	exists, err = fs.Exists("/output")
+	testutils.AssertNoError(t, err)
+	assert.False(t, exists, "the remote should not be cloned to the outputPath")
+	run("/upstream/repo", "pull")
+	exists, err = fs.Exists("/upstream/repo/components/b/base/deployment.yaml")
+	testutils.AssertNoError(t, err)
+	assert.True(t, exists, "the generated resources should be pushed")
+
+	testutils.AssertNoError(t, generator.GitRemoveComponent("/output", remote, "a", "main", "/"))
+	run("/upstream/repo", "pull")
+	_, err = e.Execute(context.Background(), "/upstream/repo", GitCommand, "--no-pager", "show", "HEAD:components/a/base/deployment.yaml")
+	assert.Error(t, err, "the removal of the component should be pushed")
+
+	// The least recently used workspace is evicted once the cache is full
+	otherPath, release, err := cache.acquire(context.Background(), generator, remote, "other", nil)
+	testutils.AssertNoError(t, err)
+	assert.NotEqual(t, repoPath, otherPath)
+	release()
+	exists, err = fs.Exists(repoPath)
+	testutils.AssertNoError(t, err)
+	assert.False(t, exists, "the evicted workspace should be removed")
+	exists, err = fs.Exists(otherPath)
+	testutils.AssertNoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestWorkspaceCacheSizeLimit(t *testing.T) {
+	fs := ioutils.NewMemoryFilesystem()
+	generator := NewGitopsGen(WithFilesystem(fs))
+	cache := NewWorkspaceCache("/cache", 0, 10)
+
+	first := cache.reference("https://github.com/org/first.git", "main")
+	first.lock <- struct{}{}
+	testutils.AssertNoError(t, writeFile(fs, first.path+"/file", []byte("0123456789"), 0644))
+	cache.release(generator, first, true)
+	exists, err := fs.Exists(first.path)
+	testutils.AssertNoError(t, err)
+	assert.True(t, exists, "the workspace fits in the cache")
+
+	second := cache.reference("https://github.com/org/second.git", "main")
+	second.lock <- struct{}{}
+	testutils.AssertNoError(t, writeFile(fs, second.path+"/file", []byte("0"), 0644))
+	cache.release(generator, second, true)
+	exists, err = fs.Exists(first.path)
+	testutils.AssertNoError(t, err)
+	assert.False(t, exists, "the least recently used workspace should be evicted")
+	assert.Equal(t, 1, cache.lru.Len())
+}
+
+func TestWorkspaceCacheToken(t *testing.T) {
+	executedCmds := []testutils.Execution{}
+	fs := ioutils.NewMemoryFilesystem()
+	generator := NewGitopsGen(WithExecutor(newTestExecutor(testutils.NewOutputs(), testutils.NewErrors(), &executedCmds)), WithFilesystem(fs))
+	cache := NewWorkspaceCache("/cache", 0, 0)
+
+	w := cache.reference("https://old-token@github.com/org/repo.git", "main")
+	assert.NotContains(t, w.key, "old-token")
+	testutils.AssertNoError(t, fs.MkdirAll(w.path, 0755))
+	cache.release(generator, w, false)
+
+	// The workspace cloned with the previous token is fetched with the new one
+	remote := "https://new-token@github.com/org/repo.git"
+	repoPath, release, err := cache.acquire(context.Background(), generator, remote, "main", nil)
+	testutils.AssertNoError(t, err)
+	defer release()
+	assert.Equal(t, w.path, repoPath)
+	assert.Equal(t, []testutils.Execution{
+		{BaseDir: repoPath, Command: "git", Args: []string{"remote", "set-url", "origin", remote}},
+		{BaseDir: repoPath, Command: "git", Args: []string{"fetch", "origin", "main"}},
+		{BaseDir: repoPath, Command: "git", Args: []string{"reset", "--hard", "origin/main"}},
+		{BaseDir: repoPath, Command: "git", Args: []string{"clean", "-fd"}},
+	}, executedCmds)
+}
+
+func TestWorkspaceCachePullRequest(t *testing.T) {
+	api := testutils.NewScmServer(t, "test-user")
+	api.Git.Token = "secret-token"
+	remote := api.Git.Remote("shop/gitops")
+	fs := ioutils.NewMemoryFilesystem()
+	component := gitopsv1alpha1.GeneratorOptions{Name: "frontend", ContainerImage: "quay.io/shop/frontend:v1", TargetPort: 5000,
+		GitSource: &gitopsv1alpha1.GitSource{URL: api.Git.URL + "/shop/gitops.git"}, Secret: api.Git.Token}
+	testutils.AssertNoError(t, newServedGen(api, fs).GenerateAndPush("/generated", remote, component, fs, "main", true, "KAM CLI"))
+
+	// The overlays are committed to the source branch of the pull request rather than left in a cached workspace
+	cache := NewWorkspaceCache("/cache", 1, 0)
+	generator := newServedGen(api, fs, WithWorkspaceCache(cache))
+	pr, err := generator.GenerateOverlaysAndOpenPullRequest("/overlays", true, remote, component, "shop", "staging", "quay.io/shop/frontend:v2", "shop-staging", fs, "main", "/", nil, PullRequestOptions{})
+	testutils.AssertNoError(t, err)
+	assert.Contains(t, pushedFiles(t, api.Git, "shop/gitops", pr.SourceBranch), "components/frontend/overlays/staging/kustomization.yaml")
+	assert.Equal(t, 0, cache.lru.Len())
+}